@@ -141,6 +141,7 @@ func main() {
 		log.Printf("加载数据库连接失败: %v", err)
 	}
 
+	services.StartTaskLeaseKeeper()
 	if err := scheduler.GetScheduler().Start(); err != nil {
 		log.Fatalf("启动定时任务失败: %v", err)
 	}
@@ -201,8 +202,12 @@ func main() {
 	syncGroup.GET("/tasks/:id/logs", syncHandler.GetTaskLogs)
 	syncGroup.GET("/tasks/:id/metrics", syncHandler.GetTaskMetrics)
 	syncGroup.GET("/tasks/:id/repair/jobs", syncHandler.ListRepairJobs)
+	syncGroup.GET("/tasks/:id/dead-letters", syncHandler.ListDeadLetters)
+	syncGroup.GET("/tasks/:id/runs", syncHandler.ListTaskRuns)
+	syncGroup.GET("/tasks/:id/runs/:run_id", syncHandler.GetTaskRun)
 	syncGroup.GET("/repair/jobs/:job_id/diffs", syncHandler.ListRepairDiffs)
 	syncGroup.GET("/logs", syncHandler.ListLogs)
+	syncGroup.GET("/plugins", syncHandler.ListPlugins)
 	syncAdmin := syncGroup.Group("", middleware.AdminMiddleware())
 	syncAdmin.POST("/tasks", syncHandler.CreateTask)
 	syncAdmin.PUT("/tasks/:id", syncHandler.UpdateTask)
@@ -214,8 +219,12 @@ func main() {
 	syncAdmin.PUT("/tasks/:id/checkpoint", syncHandler.UpdateCheckpoint)
 	syncAdmin.POST("/tasks/:id/repair/compare", syncHandler.StartRepairCompare)
 	syncAdmin.POST("/tasks/:id/repair/jobs/:job_id/apply", syncHandler.StartRepairApply)
+	syncAdmin.POST("/tasks/:id/dead-letters/replay", syncHandler.ReplayDeadLetters)
+	syncAdmin.POST("/tasks/:id/dead-letters/discard", syncHandler.DiscardDeadLetters)
 	syncAdmin.POST("/repair/jobs/:job_id/cancel", syncHandler.CancelRepairJob)
 	syncAdmin.POST("/cron/next-run", syncHandler.CronNextRun)
+	syncAdmin.POST("/plugins", syncHandler.UploadPlugin)
+	syncAdmin.DELETE("/plugins/:id", syncHandler.DeletePlugin)
 
 	alertGroup := api.Group("/alerts", middleware.AuthMiddleware())
 	alertGroup.GET("/channels", alertHandler.List)
@@ -274,6 +283,7 @@ func main() {
 
 	scheduler.GetScheduler().Stop()
 	services.GetCDCManager().Close()
+	services.ReleaseTaskLeases()
 	manager.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -31,6 +31,12 @@ type CreateConnectionRequest struct {
 	Charset  string `json:"charset"`
 	MaxIdle  int    `json:"max_idle"`
 	MaxOpen  int    `json:"max_open"`
+
+	ReadRowsPerSecond         int                    `json:"read_rows_per_second"`
+	ReadBytesPerSecond        int64                  `json:"read_bytes_per_second"`
+	ThrottleThreadsRunning    int                    `json:"throttle_threads_running"`
+	ThrottleReplicaLagSeconds int                    `json:"throttle_replica_lag_seconds"`
+	ThrottleWindows           models.ThrottleWindows `json:"throttle_windows"`
 }
 
 func (h *ConnectionHandler) CreateConnection(c *gin.Context) {
@@ -54,6 +60,12 @@ func (h *ConnectionHandler) CreateConnection(c *gin.Context) {
 		MaxIdle:  req.MaxIdle,
 		MaxOpen:  req.MaxOpen,
 		UserID:   userID.(uint),
+
+		ReadRowsPerSecond:         req.ReadRowsPerSecond,
+		ReadBytesPerSecond:        req.ReadBytesPerSecond,
+		ThrottleThreadsRunning:    req.ThrottleThreadsRunning,
+		ThrottleReplicaLagSeconds: req.ThrottleReplicaLagSeconds,
+		ThrottleWindows:           req.ThrottleWindows,
 	}
 
 	if connection.Charset == "" {
@@ -65,6 +77,10 @@ func (h *ConnectionHandler) CreateConnection(c *gin.Context) {
 	if connection.MaxOpen == 0 {
 		connection.MaxOpen = 100
 	}
+	if err := h.connectionService.ValidateThrottle(connection); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
 
 	if err := h.connectionService.TestConnection(connection); err != nil {
 		utils.BadRequest(c, "连接测试失败: "+err.Error())
@@ -121,6 +137,12 @@ type UpdateConnectionRequest struct {
 	Charset  string `json:"charset"`
 	MaxIdle  *int   `json:"max_idle"`
 	MaxOpen  *int   `json:"max_open"`
+
+	ReadRowsPerSecond         *int                    `json:"read_rows_per_second"`
+	ReadBytesPerSecond        *int64                  `json:"read_bytes_per_second"`
+	ThrottleThreadsRunning    *int                    `json:"throttle_threads_running"`
+	ThrottleReplicaLagSeconds *int                    `json:"throttle_replica_lag_seconds"`
+	ThrottleWindows           *models.ThrottleWindows `json:"throttle_windows"`
 }
 
 func (h *ConnectionHandler) UpdateConnection(c *gin.Context) {
@@ -182,6 +204,25 @@ func (h *ConnectionHandler) UpdateConnection(c *gin.Context) {
 	if updated.MaxOpen == 0 {
 		updated.MaxOpen = 100
 	}
+	if req.ReadRowsPerSecond != nil {
+		updated.ReadRowsPerSecond = *req.ReadRowsPerSecond
+	}
+	if req.ReadBytesPerSecond != nil {
+		updated.ReadBytesPerSecond = *req.ReadBytesPerSecond
+	}
+	if req.ThrottleThreadsRunning != nil {
+		updated.ThrottleThreadsRunning = *req.ThrottleThreadsRunning
+	}
+	if req.ThrottleReplicaLagSeconds != nil {
+		updated.ThrottleReplicaLagSeconds = *req.ThrottleReplicaLagSeconds
+	}
+	if req.ThrottleWindows != nil {
+		updated.ThrottleWindows = *req.ThrottleWindows
+	}
+	if err := h.connectionService.ValidateThrottle(&updated); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
 
 	if err := h.connectionService.TestConnection(&updated); err != nil {
 		utils.BadRequest(c, "连接测试失败: "+err.Error())
@@ -222,6 +263,12 @@ func (h *ConnectionHandler) UpdateConnection(c *gin.Context) {
 	if req.MaxOpen != nil {
 		updates["max_open"] = updated.MaxOpen
 	}
+	// 限流配置不影响连接本身，随其他字段一并保存
+	updates["read_rows_per_second"] = updated.ReadRowsPerSecond
+	updates["read_bytes_per_second"] = updated.ReadBytesPerSecond
+	updates["throttle_threads_running"] = updated.ThrottleThreadsRunning
+	updates["throttle_replica_lag_seconds"] = updated.ThrottleReplicaLagSeconds
+	updates["throttle_windows"] = updated.ThrottleWindows
 
 	if err := h.connectionService.UpdateConnection(uint(id), updates); err != nil {
 		utils.InternalServerError(c, "更新连接失败: "+err.Error())
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"fmt"
+	"io"
 	"strconv"
 	"strings"
 	"time"
@@ -27,26 +29,39 @@ func NewSyncHandler() *SyncHandler {
 
 // CreateTaskRequest 创建任务请求
 type CreateTaskRequest struct {
-	Name                 string             `json:"name" binding:"required"`
-	SourceDB             string             `json:"source_db" binding:"required"`
-	SourceTable          string             `json:"source_table"`
-	TargetDB             string             `json:"target_db" binding:"required"`
-	TargetTable          string             `json:"target_table"`
-	Tables               []TaskTableRequest `json:"tables"`
-	FieldMapping         map[string]string  `json:"field_mapping"`
-	SyncType             string             `json:"sync_type" binding:"required,oneof=full cdc full_cdc"`
-	CronExpression       string             `json:"cron_expression"`
-	ScheduleType         string             `json:"schedule_type" binding:"required,oneof=manual interval cron"`
-	IntervalMinutes      int                `json:"interval_minutes"`
-	AlertChannelID       *uint              `json:"alert_channel_id"`
-	AlertDelaySeconds    int                `json:"alert_delay_seconds"`
-	AlertDelayMS         int                `json:"alert_delay_ms"`
-	AlertStoppedMinutes  int                `json:"alert_stopped_minutes"`
-	AlertOnError         bool               `json:"alert_on_error"`
-	AlertCooldownMinutes int                `json:"alert_cooldown_minutes"`
-	SyncBatchSize        int                `json:"sync_batch_size"`
-	SnapshotTableWorkers int                `json:"snapshot_table_workers"`
-	SnapshotShardWorkers int                `json:"snapshot_shard_workers"`
+	Name                 string               `json:"name" binding:"required"`
+	SourceDB             string               `json:"source_db" binding:"required"`
+	SourceTable          string               `json:"source_table"`
+	TargetDB             string               `json:"target_db" binding:"required"`
+	TargetTable          string               `json:"target_table"`
+	Tables               []TaskTableRequest   `json:"tables"`
+	TablePatterns        []TaskPatternRequest `json:"table_patterns"`
+	FieldMapping         map[string]string    `json:"field_mapping"`
+	SyncType             string               `json:"sync_type" binding:"required,oneof=full cdc full_cdc incremental"`
+	CronExpression       string               `json:"cron_expression"`
+	ScheduleType         string               `json:"schedule_type" binding:"required,oneof=manual interval cron"`
+	IntervalMinutes      int                  `json:"interval_minutes"`
+	AlertChannelID       *uint                `json:"alert_channel_id"`
+	AlertDelaySeconds    int                  `json:"alert_delay_seconds"`
+	AlertDelayMS         int                  `json:"alert_delay_ms"`
+	AlertStoppedMinutes  int                  `json:"alert_stopped_minutes"`
+	AlertOnError         bool                 `json:"alert_on_error"`
+	AlertCooldownMinutes int                  `json:"alert_cooldown_minutes"`
+	SyncBatchSize        int                  `json:"sync_batch_size"`
+	SnapshotTableWorkers int                  `json:"snapshot_table_workers"`
+	SnapshotShardWorkers int                  `json:"snapshot_shard_workers"`
+	CDCApplyWorkers      int                  `json:"cdc_apply_workers"`
+	ReadRowsPerSecond    int                  `json:"read_rows_per_second"`
+	ReadBytesPerSecond   int64                `json:"read_bytes_per_second"`
+	DDLPolicy            string               `json:"ddl_policy"`
+	SnapshotMode         string               `json:"snapshot_mode"`
+	ApplyErrorPolicy     string               `json:"apply_error_policy"`
+	ApplyRetryTimes      int                  `json:"apply_retry_times"`
+	BinlogPurgePolicy    string               `json:"binlog_purge_policy"`
+	BinlogPurgeColumn    string               `json:"binlog_purge_column"`
+	BinlogPurgeAutoApply bool                 `json:"binlog_purge_auto_apply"`
+	TransientRetries     int                  `json:"transient_retries"`
+	TransientBackoff     int                  `json:"transient_backoff"`
 }
 
 type TaskTableRequest struct {
@@ -56,6 +71,47 @@ type TaskTableRequest struct {
 	IgnoredFields       []string          `json:"ignored_fields"`
 	TypeMismatchIgnores []string          `json:"type_mismatch_ignores"`
 	CustomWhere         string            `json:"custom_where,omitempty"`
+	RowIdentity         string            `json:"row_identity"`
+	IdentityIndex       string            `json:"identity_index"`
+	IncrementalKey      string            `json:"incremental_key"`
+	SoftDeleteColumn    string            `json:"soft_delete_column"`
+	WriteMode           string            `json:"write_mode"`
+	VersionColumn       string            `json:"version_column"`
+	DeleteMode          string            `json:"delete_mode"`
+	DeleteColumn        string            `json:"delete_column"`
+	RowFilter           models.RowFilter  `json:"row_filter"`
+	Transforms          map[string]string `json:"transforms"`
+	PluginID            *uint             `json:"plugin_id"`
+}
+
+// TaskPatternRequest 分表合并规则，按正则匹配多张源表写入同一目标表
+type TaskPatternRequest struct {
+	SourceSchemas       []string          `json:"source_schemas"`
+	SourcePattern       string            `json:"source_pattern" binding:"required"`
+	TargetTable         string            `json:"target_table" binding:"required"`
+	DiscriminatorColumn string            `json:"discriminator_column"`
+	FieldMapping        map[string]string `json:"field_mapping"`
+	IgnoredFields       []string          `json:"ignored_fields"`
+	TypeMismatchIgnores []string          `json:"type_mismatch_ignores"`
+	CustomWhere         string            `json:"custom_where,omitempty"`
+	RowIdentity         string            `json:"row_identity"`
+	IdentityIndex       string            `json:"identity_index"`
+	WriteMode           string            `json:"write_mode"`
+	VersionColumn       string            `json:"version_column"`
+	DeleteMode          string            `json:"delete_mode"`
+	DeleteColumn        string            `json:"delete_column"`
+	RowFilter           models.RowFilter  `json:"row_filter"`
+	Transforms          map[string]string `json:"transforms"`
+	PluginID            *uint             `json:"plugin_id"`
+}
+
+func tablePatternModels(requests []TaskPatternRequest) []models.SyncTablePattern {
+	patterns := make([]models.SyncTablePattern, 0, len(requests))
+	for _, pattern := range requests {
+		patterns = append(patterns, models.SyncTablePattern{SourceSchemas: pattern.SourceSchemas, SourcePattern: pattern.SourcePattern, TargetTable: pattern.TargetTable, DiscriminatorColumn: pattern.DiscriminatorColumn, FieldMapping: pattern.FieldMapping, IgnoredFields: pattern.IgnoredFields, TypeMismatchIgnores: pattern.TypeMismatchIgnores, CustomWhere: pattern.CustomWhere, RowIdentity: pattern.RowIdentity, IdentityIndex: pattern.IdentityIndex,
+			WriteMode: pattern.WriteMode, VersionColumn: pattern.VersionColumn, DeleteMode: pattern.DeleteMode, DeleteColumn: pattern.DeleteColumn, RowFilter: pattern.RowFilter, Transforms: pattern.Transforms, PluginID: pattern.PluginID})
+	}
+	return patterns
 }
 
 // CreateTask 创建同步任务
@@ -91,6 +147,18 @@ func (h *SyncHandler) CreateTask(c *gin.Context) {
 		SyncBatchSize:        req.SyncBatchSize,
 		SnapshotTableWorkers: req.SnapshotTableWorkers,
 		SnapshotShardWorkers: req.SnapshotShardWorkers,
+		CDCApplyWorkers:      req.CDCApplyWorkers,
+		ReadRowsPerSecond:    req.ReadRowsPerSecond,
+		ReadBytesPerSecond:   req.ReadBytesPerSecond,
+		DDLPolicy:            req.DDLPolicy,
+		SnapshotMode:         req.SnapshotMode,
+		ApplyErrorPolicy:     req.ApplyErrorPolicy,
+		ApplyRetryTimes:      req.ApplyRetryTimes,
+		BinlogPurgePolicy:    req.BinlogPurgePolicy,
+		BinlogPurgeColumn:    req.BinlogPurgeColumn,
+		BinlogPurgeAutoApply: req.BinlogPurgeAutoApply,
+		TransientRetries:     req.TransientRetries,
+		TransientBackoff:     req.TransientBackoff,
 		Status:               1,
 		UserID:               userID.(uint),
 	}
@@ -101,9 +169,9 @@ func (h *SyncHandler) CreateTask(c *gin.Context) {
 	}
 	tables := make([]models.SyncTaskTable, 0, len(tableRequests))
 	for _, table := range tableRequests {
-		tables = append(tables, models.SyncTaskTable{SourceTable: table.SourceTable, TargetTable: table.TargetTable, FieldMapping: table.FieldMapping, IgnoredFields: table.IgnoredFields, TypeMismatchIgnores: table.TypeMismatchIgnores, CustomWhere: table.CustomWhere})
+		tables = append(tables, models.SyncTaskTable{SourceTable: table.SourceTable, TargetTable: table.TargetTable, FieldMapping: table.FieldMapping, IgnoredFields: table.IgnoredFields, TypeMismatchIgnores: table.TypeMismatchIgnores, CustomWhere: table.CustomWhere, RowIdentity: table.RowIdentity, IdentityIndex: table.IdentityIndex, IncrementalKey: table.IncrementalKey, SoftDeleteColumn: table.SoftDeleteColumn, WriteMode: table.WriteMode, VersionColumn: table.VersionColumn, DeleteMode: table.DeleteMode, DeleteColumn: table.DeleteColumn, RowFilter: table.RowFilter, Transforms: table.Transforms, PluginID: table.PluginID})
 	}
-	if err := h.syncService.CreateTaskWithTables(task, tables); err != nil {
+	if err := h.syncService.CreateTaskWithTables(task, tables, tablePatternModels(req.TablePatterns)); err != nil {
 		utils.InternalServerError(c, "创建任务失败: "+err.Error())
 		return
 	}
@@ -151,19 +219,32 @@ func (h *SyncHandler) GetTask(c *gin.Context) {
 
 // UpdateTaskRequest 更新任务请求
 type UpdateTaskRequest struct {
-	AlertChannelID       *uint              `json:"alert_channel_id"`
-	AlertDelaySeconds    int                `json:"alert_delay_seconds"`
-	AlertDelayMS         int                `json:"alert_delay_ms"`
-	AlertStoppedMinutes  *int               `json:"alert_stopped_minutes"`
-	AlertOnError         *bool              `json:"alert_on_error"`
-	AlertCooldownMinutes *int               `json:"alert_cooldown_minutes"`
-	SyncBatchSize        int                `json:"sync_batch_size"`
-	SnapshotTableWorkers int                `json:"snapshot_table_workers"`
-	SnapshotShardWorkers int                `json:"snapshot_shard_workers"`
-	ScheduleType         string             `json:"schedule_type"`
-	CronExpression       string             `json:"cron_expression"`
-	IntervalMinutes      int                `json:"interval_minutes"`
-	Tables               []TaskTableRequest `json:"tables"`
+	AlertChannelID       *uint                `json:"alert_channel_id"`
+	AlertDelaySeconds    int                  `json:"alert_delay_seconds"`
+	AlertDelayMS         int                  `json:"alert_delay_ms"`
+	AlertStoppedMinutes  *int                 `json:"alert_stopped_minutes"`
+	AlertOnError         *bool                `json:"alert_on_error"`
+	AlertCooldownMinutes *int                 `json:"alert_cooldown_minutes"`
+	SyncBatchSize        int                  `json:"sync_batch_size"`
+	SnapshotTableWorkers int                  `json:"snapshot_table_workers"`
+	SnapshotShardWorkers int                  `json:"snapshot_shard_workers"`
+	CDCApplyWorkers      int                  `json:"cdc_apply_workers"`
+	ReadRowsPerSecond    int                  `json:"read_rows_per_second"`
+	ReadBytesPerSecond   int64                `json:"read_bytes_per_second"`
+	DDLPolicy            string               `json:"ddl_policy"`
+	SnapshotMode         string               `json:"snapshot_mode"`
+	ApplyErrorPolicy     string               `json:"apply_error_policy"`
+	ApplyRetryTimes      int                  `json:"apply_retry_times"`
+	BinlogPurgePolicy    string               `json:"binlog_purge_policy"`
+	BinlogPurgeColumn    string               `json:"binlog_purge_column"`
+	BinlogPurgeAutoApply bool                 `json:"binlog_purge_auto_apply"`
+	TransientRetries     int                  `json:"transient_retries"`
+	TransientBackoff     int                  `json:"transient_backoff"`
+	ScheduleType         string               `json:"schedule_type"`
+	CronExpression       string               `json:"cron_expression"`
+	IntervalMinutes      int                  `json:"interval_minutes"`
+	Tables               []TaskTableRequest   `json:"tables"`
+	TablePatterns        []TaskPatternRequest `json:"table_patterns"`
 }
 
 // UpdateTask 更新任务（仅允许修改同步对象和预警策略）
@@ -174,7 +255,7 @@ func (h *SyncHandler) UpdateTask(c *gin.Context) {
 		utils.Error(c, 404, "任务不存在")
 		return
 	}
-	running := currentTask.RuntimeStatus == "initializing" || currentTask.RuntimeStatus == "catching_up" || currentTask.RuntimeStatus == "cdc_running"
+	running := isTaskRunning(currentTask.RuntimeStatus)
 
 	var req UpdateTaskRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -207,6 +288,9 @@ func (h *SyncHandler) UpdateTask(c *gin.Context) {
 		"sync_batch_size":        req.SyncBatchSize,
 		"snapshot_table_workers": req.SnapshotTableWorkers,
 		"snapshot_shard_workers": req.SnapshotShardWorkers,
+		"cdc_apply_workers":      req.CDCApplyWorkers,
+		"read_rows_per_second":   req.ReadRowsPerSecond,
+		"read_bytes_per_second":  req.ReadBytesPerSecond,
 		"schedule_type":          req.ScheduleType,
 		"cron_expression":        strings.TrimSpace(req.CronExpression),
 		"interval_minutes":       req.IntervalMinutes,
@@ -216,10 +300,63 @@ func (h *SyncHandler) UpdateTask(c *gin.Context) {
 	} else {
 		updates["alert_channel_id"] = *alertChannelID
 	}
-	if err := h.syncService.ValidateTaskExecutionConfig(req.SyncBatchSize, req.SnapshotTableWorkers, req.SnapshotShardWorkers); err != nil {
+	if err := h.syncService.ValidateTaskExecutionConfig(models.SyncTask{SyncBatchSize: req.SyncBatchSize, SnapshotTableWorkers: req.SnapshotTableWorkers, SnapshotShardWorkers: req.SnapshotShardWorkers, CDCApplyWorkers: req.CDCApplyWorkers, ReadRowsPerSecond: req.ReadRowsPerSecond, ReadBytesPerSecond: req.ReadBytesPerSecond}); err != nil {
 		utils.BadRequest(c, err.Error())
 		return
 	}
+	if req.DDLPolicy != "" {
+		policy, err := h.syncService.NormalizeDDLPolicy(req.DDLPolicy)
+		if err != nil {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+		updates["ddl_policy"] = policy
+	}
+	if req.SnapshotMode != "" {
+		mode, err := h.syncService.NormalizeSnapshotMode(req.SnapshotMode)
+		if err != nil {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+		if mode == "consistent" && currentTask.SyncType != "full_cdc" {
+			utils.BadRequest(c, "一致性快照仅用于全量初始化 + Binlog CDC 任务")
+			return
+		}
+		updates["snapshot_mode"] = mode
+	}
+	if req.ApplyErrorPolicy != "" {
+		policy, err := h.syncService.NormalizeApplyErrorPolicy(req.ApplyErrorPolicy, req.ApplyRetryTimes)
+		if err != nil {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+		updates["apply_error_policy"] = policy
+		if policy == "retry" {
+			updates["apply_retry_times"] = req.ApplyRetryTimes
+		}
+	}
+	if req.BinlogPurgePolicy != "" {
+		policy, column, err := h.syncService.NormalizeBinlogPurgeSettings(req.BinlogPurgePolicy, req.BinlogPurgeColumn)
+		if err == nil {
+			err = h.syncService.ValidateBinlogPurgeEndpoints(currentTask.SourceDB, currentTask.TargetDB, policy)
+		}
+		if err != nil {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+		updates["binlog_purge_policy"] = policy
+		updates["binlog_purge_column"] = column
+		updates["binlog_purge_auto_apply"] = policy == "repair" && req.BinlogPurgeAutoApply
+	}
+	if req.TransientRetries != 0 || req.TransientBackoff != 0 {
+		retries, backoff, err := h.syncService.NormalizeTransientRetrySettings(req.TransientRetries, req.TransientBackoff)
+		if err != nil {
+			utils.BadRequest(c, err.Error())
+			return
+		}
+		updates["transient_retries"] = retries
+		updates["transient_backoff"] = backoff
+	}
 	if req.ScheduleType != "manual" && req.ScheduleType != "interval" && req.ScheduleType != "cron" {
 		utils.BadRequest(c, "不支持的调度方式")
 		return
@@ -237,17 +374,17 @@ func (h *SyncHandler) UpdateTask(c *gin.Context) {
 		utils.InternalServerError(c, "更新任务失败: "+err.Error())
 		return
 	}
-	if len(req.Tables) > 0 {
+	if len(req.Tables) > 0 || len(req.TablePatterns) > 0 {
 		tables := make([]models.SyncTaskTable, 0, len(req.Tables))
 		for _, table := range req.Tables {
-			tables = append(tables, models.SyncTaskTable{SourceTable: table.SourceTable, TargetTable: table.TargetTable, FieldMapping: table.FieldMapping, IgnoredFields: table.IgnoredFields, TypeMismatchIgnores: table.TypeMismatchIgnores, CustomWhere: table.CustomWhere})
+			tables = append(tables, models.SyncTaskTable{SourceTable: table.SourceTable, TargetTable: table.TargetTable, FieldMapping: table.FieldMapping, IgnoredFields: table.IgnoredFields, TypeMismatchIgnores: table.TypeMismatchIgnores, CustomWhere: table.CustomWhere, RowIdentity: table.RowIdentity, IdentityIndex: table.IdentityIndex, IncrementalKey: table.IncrementalKey, SoftDeleteColumn: table.SoftDeleteColumn, WriteMode: table.WriteMode, VersionColumn: table.VersionColumn, DeleteMode: table.DeleteMode, DeleteColumn: table.DeleteColumn, RowFilter: table.RowFilter, Transforms: table.Transforms, PluginID: table.PluginID})
 		}
 		var tableErr error
 		if running {
-			_, tableErr = h.syncService.AddTaskTablesOnline(uint(id), tables)
+			_, tableErr = h.syncService.AddTaskTablesOnline(uint(id), tables, tablePatternModels(req.TablePatterns))
 		} else {
 			services.GetCDCManager().StopTask(uint(id))
-			tableErr = h.syncService.ReplaceTaskTables(uint(id), tables)
+			tableErr = h.syncService.ReplaceTaskTables(uint(id), tables, tablePatternModels(req.TablePatterns))
 		}
 		if tableErr != nil {
 			utils.InternalServerError(c, "更新同步对象失败: "+tableErr.Error())
@@ -296,7 +433,7 @@ func (h *SyncHandler) DeleteTask(c *gin.Context) {
 }
 
 func isTaskRunning(status string) bool {
-	return status == "initializing" || status == "catching_up" || status == "cdc_running"
+	return status == "initializing" || status == "catching_up" || status == "cdc_running" || status == "retrying"
 }
 
 func (h *SyncHandler) PauseTask(c *gin.Context) {
@@ -310,7 +447,7 @@ func (h *SyncHandler) PauseTask(c *gin.Context) {
 
 func (h *SyncHandler) ResumeTask(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
-	if err := h.syncService.ResumeTask(uint(id)); err != nil {
+	if err := h.syncService.ResumeTask(uint(id), services.RunTriggerManual); err != nil {
 		utils.BadRequest(c, err.Error())
 		return
 	}
@@ -320,14 +457,15 @@ func (h *SyncHandler) ResumeTask(c *gin.Context) {
 func (h *SyncHandler) UpdateCheckpoint(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
 	var req struct {
-		File     string `json:"file" binding:"required"`
-		Position uint32 `json:"position" binding:"required"`
+		File     string `json:"file"`
+		Position uint32 `json:"position"`
+		GTIDSet  string `json:"gtid_set"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequest(c, "请填写 file 和 position")
+	if err := c.ShouldBindJSON(&req); err != nil || (req.File == "" && strings.TrimSpace(req.GTIDSet) == "") {
+		utils.BadRequest(c, "请填写 file 和 position 或 gtid_set")
 		return
 	}
-	if err := h.syncService.UpdateBinlogPosition(uint(id), strings.TrimSpace(req.File), req.Position); err != nil {
+	if err := h.syncService.UpdateBinlogPosition(uint(id), strings.TrimSpace(req.File), req.Position, req.GTIDSet); err != nil {
 		utils.BadRequest(c, err.Error())
 		return
 	}
@@ -339,7 +477,7 @@ func (h *SyncHandler) ExecuteTask(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
 
 	// 异步执行
-	go h.syncService.ExecuteTask(uint(id))
+	go h.syncService.ExecuteTask(uint(id), services.RunTriggerManual)
 
 	utils.SuccessWithMessage(c, "任务已开始执行", nil)
 }
@@ -361,7 +499,7 @@ func (h *SyncHandler) PrecheckTask(c *gin.Context) {
 			if task.RuntimeStatus == "pending" {
 				if !isTaskRunning(task.RuntimeStatus) {
 					go func(taskID uint) {
-						_ = h.syncService.ExecuteTask(taskID)
+						_ = h.syncService.ExecuteTask(taskID, services.RunTriggerManual)
 					}(task.ID)
 					autoStarted = true
 				}
@@ -531,6 +669,128 @@ func (h *SyncHandler) ListRepairDiffs(c *gin.Context) {
 	utils.Success(c, gin.H{"data": diffs, "total": total, "page": page, "page_size": pageSize})
 }
 
+func (h *SyncHandler) ListDeadLetters(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	letters, total, err := h.syncService.ListDeadLetters(uint(id), c.Query("status"), page, pageSize)
+	if err != nil {
+		utils.InternalServerError(c, "获取死信记录失败: "+err.Error())
+		return
+	}
+	utils.Success(c, gin.H{"data": letters, "total": total, "page": page, "page_size": pageSize})
+}
+
+// ListTaskRuns 分页查询任务的执行记录
+func (h *SyncHandler) ListTaskRuns(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	runs, total, err := h.syncService.ListTaskRuns(uint(id), page, pageSize)
+	if err != nil {
+		utils.InternalServerError(c, "获取执行记录失败: "+err.Error())
+		return
+	}
+	utils.Success(c, gin.H{"data": runs, "total": total, "page": page, "page_size": pageSize})
+}
+
+// GetTaskRun 获取一次执行的详情
+func (h *SyncHandler) GetTaskRun(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	runID, _ := strconv.ParseUint(c.Param("run_id"), 10, 32)
+	run, err := h.syncService.GetTaskRun(uint(id), uint(runID))
+	if err != nil {
+		utils.Error(c, 404, "执行记录不存在")
+		return
+	}
+	utils.Success(c, run)
+}
+
+type DeadLetterRequest struct {
+	IDs []uint `json:"ids"`
+}
+
+func (h *SyncHandler) ReplayDeadLetters(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var req DeadLetterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数错误: "+err.Error())
+		return
+	}
+	replayed, failed, err := h.syncService.ReplayDeadLetters(uint(id), req.IDs)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, fmt.Sprintf("重放成功 %d 行，失败 %d 行", replayed, failed), gin.H{"replayed": replayed, "failed": failed})
+}
+
+func (h *SyncHandler) DiscardDeadLetters(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var req DeadLetterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数错误: "+err.Error())
+		return
+	}
+	discarded, err := h.syncService.DiscardDeadLetters(uint(id), req.IDs)
+	if err != nil {
+		utils.InternalServerError(c, "忽略死信记录失败: "+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, fmt.Sprintf("已忽略 %d 行", discarded), nil)
+}
+
+func (h *SyncHandler) ListPlugins(c *gin.Context) {
+	plugins, err := h.syncService.ListPlugins()
+	if err != nil {
+		utils.InternalServerError(c, "获取插件列表失败: "+err.Error())
+		return
+	}
+	utils.Success(c, plugins)
+}
+
+// UploadPlugin 以 multipart 表单上传 WASM 模块：name、description、timeout_ms 和文件字段 file
+func (h *SyncHandler) UploadPlugin(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		utils.BadRequest(c, "请选择插件文件: "+err.Error())
+		return
+	}
+	timeoutMs := 0
+	if value := strings.TrimSpace(c.PostForm("timeout_ms")); value != "" {
+		if timeoutMs, err = strconv.Atoi(value); err != nil {
+			utils.BadRequest(c, "单次调用超时必须是整数")
+			return
+		}
+	}
+	reader, err := file.Open()
+	if err != nil {
+		utils.BadRequest(c, "读取插件文件失败: "+err.Error())
+		return
+	}
+	defer reader.Close()
+	module, err := io.ReadAll(reader)
+	if err != nil {
+		utils.BadRequest(c, "读取插件文件失败: "+err.Error())
+		return
+	}
+	plugin, err := h.syncService.UploadPlugin(c.PostForm("name"), c.PostForm("description"), timeoutMs, module)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, fmt.Sprintf("插件 %s 已发布为 v%d", plugin.Name, plugin.Version), plugin)
+}
+
+func (h *SyncHandler) DeletePlugin(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err := h.syncService.DeletePlugin(uint(id)); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "插件已删除", nil)
+}
+
 func parseRepairTime(value string) (time.Time, error) {
 	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
 		return parsed, nil
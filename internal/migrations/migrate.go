@@ -38,19 +38,6 @@ func (m *Migrator) Run(db *gorm.DB) error {
 			return err
 		}
 	}
-	if err := db.Model(&models.SyncTask{}).Where("sync_type = ?", "incremental").Updates(map[string]interface{}{
-		"sync_type": "full_cdc", "schedule_type": "manual", "status": 0, "validation_status": "pending",
-	}).Error; err != nil {
-		return fmt.Errorf("旧增量任务迁移失败: %w", err)
-	}
-	if db.Dialector.Name() == "postgres" {
-		if err := db.Exec("ALTER TABLE sync_tasks DROP CONSTRAINT IF EXISTS ck_sync_tasks_sync_type").Error; err != nil {
-			return err
-		}
-		if err := db.Exec("ALTER TABLE sync_tasks ADD CONSTRAINT ck_sync_tasks_sync_type CHECK (sync_type IN ('full', 'cdc', 'full_cdc'))").Error; err != nil {
-			return err
-		}
-	}
 
 	// 3. 初始化基础数据
 	if err := m.initializeData(db); err != nil {
@@ -114,10 +101,16 @@ func (m *Migrator) migrateSchema(db *gorm.DB) error {
 		&models.AlertChannel{},
 		&models.SyncTask{},
 		&models.SyncTaskTable{},
+		&models.SyncTablePattern{},
+		&models.SyncSchemaState{},
 		&models.SyncCheckpoint{},
 		&models.SyncSnapshotShardCheckpoint{},
 		&models.SyncCDCCheckpoint{},
 		&models.SyncXAPreparedTransaction{},
+		&models.SyncDeadLetter{},
+		&models.SyncTaskRun{},
+		&models.SyncTaskLease{},
+		&models.SyncPlugin{},
 		&models.SyncLog{},
 		&models.TaskAlertState{},
 		&models.ServerMonitorSetting{},
@@ -145,6 +138,15 @@ func (m *Migrator) migrateSchema(db *gorm.DB) error {
 		}
 	}
 
+	// 源表唯一约束已扩展为 (task_id, source_schema, source_table)，删除旧约束以允许不同库的同名分表
+	taskTable := &models.SyncTaskTable{}
+	if db.Migrator().HasIndex(taskTable, "uk_task_source_table") {
+		if err := db.Migrator().DropIndex(taskTable, "uk_task_source_table"); err != nil {
+			return fmt.Errorf("删除旧索引 uk_task_source_table 失败: %w", err)
+		}
+		log.Println("  - 已删除 sync_task_tables.uk_task_source_table 旧索引")
+	}
+
 	log.Println("  ✓ 所有表结构迁移完成")
 	return nil
 }
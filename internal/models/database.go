@@ -1,6 +1,8 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -23,10 +25,39 @@ type DatabaseConnection struct {
 	Charset   string         `gorm:"size:20;default:'utf8mb4'" json:"charset"`
 	MaxIdle   int            `gorm:"default:10" json:"max_idle"`
 	MaxOpen   int            `gorm:"default:100" json:"max_open"`
-	UserID    uint           `gorm:"not null" json:"user_id"` // 创建者
+	// 作为源端时全部任务的全量读取和数据比对共享的限流，0 表示不限
+	ReadRowsPerSecond         int             `gorm:"not null;default:0" json:"read_rows_per_second"`
+	ReadBytesPerSecond        int64           `gorm:"not null;default:0" json:"read_bytes_per_second"`
+	ThrottleThreadsRunning    int             `gorm:"not null;default:0" json:"throttle_threads_running"`     // 活跃线程超过该值时暂停读取
+	ThrottleReplicaLagSeconds int             `gorm:"not null;default:0" json:"throttle_replica_lag_seconds"` // 复制延迟超过该值时暂停读取
+	ThrottleWindows           ThrottleWindows `gorm:"type:json" json:"throttle_windows"`                      // 降速时段
+	UserID                    uint            `gorm:"not null" json:"user_id"`                                // 创建者
 }
 
 // TableName 指定表名
 func (DatabaseConnection) TableName() string {
 	return "database_connections"
 }
+
+// ThrottleWindow 是每天重复的降速时段，Start、End 为 HH:MM，End 早于 Start 时跨越午夜
+type ThrottleWindow struct {
+	Start          string `json:"start"`
+	End            string `json:"end"`
+	RowsPerSecond  int    `json:"rows_per_second"`
+	BytesPerSecond int64  `json:"bytes_per_second"`
+}
+
+// ThrottleWindows 是连接的降速时段列表
+type ThrottleWindows []ThrottleWindow
+
+func (tw *ThrottleWindows) Scan(value interface{}) error {
+	bytes, ok := jsonBytes(value)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(bytes, tw)
+}
+
+func (tw ThrottleWindows) Value() (driver.Value, error) {
+	return json.Marshal(tw)
+}
@@ -40,6 +40,32 @@ func (sl StringList) Value() (driver.Value, error) {
 	return json.Marshal(sl)
 }
 
+// RowFilterCondition 是一条行过滤条件，Op 为 eq、ne、gt、ge、lt、le、in、not_in、is_null、not_null
+type RowFilterCondition struct {
+	Column string   `json:"column"`
+	Op     string   `json:"op"`
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"`
+	// 以下由 CDC 按源表结构填充，不持久化：字段类别（number、time、string）和是否按大小写不敏感排序规则比较
+	ColumnKind string `json:"-"`
+	FoldCase   bool   `json:"-"`
+}
+
+// RowFilter 是表映射的行过滤条件，多条之间为 AND
+type RowFilter []RowFilterCondition
+
+func (rf *RowFilter) Scan(value interface{}) error {
+	bytes, ok := jsonBytes(value)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(bytes, rf)
+}
+
+func (rf RowFilter) Value() (driver.Value, error) {
+	return json.Marshal(rf)
+}
+
 func jsonBytes(value interface{}) ([]byte, bool) {
 	switch typed := value.(type) {
 	case []byte:
@@ -100,13 +126,28 @@ type SyncTask struct {
 	SyncBatchSize        int                `gorm:"not null;default:0" json:"sync_batch_size"`
 	SnapshotTableWorkers int                `gorm:"not null;default:0" json:"snapshot_table_workers"`
 	SnapshotShardWorkers int                `gorm:"not null;default:0" json:"snapshot_shard_workers"`
+	ReadRowsPerSecond    int                `gorm:"not null;default:0" json:"read_rows_per_second"`                       // 全量读取和数据比对的行数限流，0 表示不限
+	ReadBytesPerSecond   int64              `gorm:"not null;default:0" json:"read_bytes_per_second"`                      // 全量读取和数据比对的字节限流，0 表示不限
+	CDCApplyWorkers      int                `gorm:"column:cdc_apply_workers;not null;default:0" json:"cdc_apply_workers"` // CDC 并行写入分区数，0 或 1 为串行
+	DDLPolicy            string             `gorm:"column:ddl_policy;size:20;not null;default:ignore" json:"ddl_policy"`  // apply, ignore, pause
+	SnapshotMode         string             `gorm:"size:20;not null;default:replay" json:"snapshot_mode"`                 // replay, consistent
+	ApplyErrorPolicy     string             `gorm:"size:20;not null;default:stop" json:"apply_error_policy"`              // stop, skip, retry
+	ApplyRetryTimes      int                `gorm:"not null;default:3" json:"apply_retry_times"`                          // retry 策略的重试次数
+	BinlogPurgePolicy    string             `gorm:"size:20;not null;default:fail" json:"binlog_purge_policy"`             // fail, resnapshot, repair
+	BinlogPurgeColumn    string             `gorm:"size:100" json:"binlog_purge_column"`                                  // repair 策略按此时间字段限定比对范围，空则整表比对
+	BinlogPurgeAutoApply bool               `gorm:"not null;default:false" json:"binlog_purge_auto_apply"`                // repair 策略比对后自动补数
+	TransientRetries     int                `gorm:"not null;default:3" json:"transient_retries"`                          // 网络中断、锁等待超时等临时故障的自动重试次数
+	TransientBackoff     int                `gorm:"not null;default:10" json:"transient_backoff"`                         // 首次重试前等待秒数，之后逐次翻倍
+	PossiblyInconsistent bool               `gorm:"not null;default:false" json:"possibly_inconsistent"`                  // Binlog 被清理后跳过的区间尚未补齐
 	RowsProcessed        int64              `gorm:"not null;default:0" json:"rows_processed"`
 	RowsPerSecond        float64            `gorm:"not null;default:0" json:"rows_per_second"`
 	DelaySeconds         int64              `gorm:"not null;default:0" json:"delay_seconds"`
 	PhaseStartedAt       *time.Time         `json:"phase_started_at"`
 	RepairStatus         string             `gorm:"size:30;not null;default:idle;index" json:"repair_status"`
 	TaskTables           []SyncTaskTable    `gorm:"foreignKey:TaskID" json:"task_tables,omitempty"`
+	TablePatterns        []SyncTablePattern `gorm:"foreignKey:TaskID" json:"table_patterns,omitempty"`
 	CDCCheckpoint        *SyncCDCCheckpoint `gorm:"foreignKey:TaskID;references:ID" json:"cdc_checkpoint,omitempty"`
+	Leases               []SyncTaskLease    `gorm:"foreignKey:TaskID;references:ID" json:"leases,omitempty"`
 }
 
 // TableName 指定表名
@@ -116,31 +157,96 @@ func (SyncTask) TableName() string {
 
 // SyncTaskTable stores one source-to-target table mapping in a task.
 type SyncTaskTable struct {
+	ID                  uint             `gorm:"primarykey" json:"id"`
+	CreatedAt           time.Time        `json:"created_at"`
+	UpdatedAt           time.Time        `json:"updated_at"`
+	TaskID              uint             `gorm:"not null;index;uniqueIndex:uk_task_source_schema_table" json:"task_id"`
+	SourceSchema        string           `gorm:"size:64;not null;default:'';uniqueIndex:uk_task_source_schema_table" json:"source_schema"` // 为空表示源连接的默认库
+	SourceTable         string           `gorm:"size:100;not null;uniqueIndex:uk_task_source_schema_table" json:"source_table"`
+	TargetTable         string           `gorm:"size:100;not null" json:"target_table"`
+	PatternID           *uint            `gorm:"index" json:"pattern_id,omitempty"` // 由分表合并规则展开的分片表
+	DiscriminatorColumn string           `gorm:"size:100" json:"discriminator_column"`
+	IncrementalKey      string           `gorm:"size:100" json:"incremental_key"`
+	SoftDeleteColumn    string           `gorm:"size:100" json:"soft_delete_column"` // 轮询增量同步时值为真表示源行已删除
+	FieldMapping        FieldMapping     `gorm:"type:json" json:"field_mapping"`
+	Transforms          FieldMapping     `gorm:"type:json" json:"transforms"` // 目标字段 → 转换表达式
+	IgnoredFields       StringList       `gorm:"type:json" json:"ignored_fields"`
+	TypeMismatchIgnores StringList       `gorm:"type:json" json:"type_mismatch_ignores"`
+	CustomWhere         string           `gorm:"type:text" json:"custom_where,omitempty"`
+	PluginID            *uint            `gorm:"index" json:"plugin_id,omitempty"` // 写入前调用的 WASM 行处理插件版本
+	RowFilter           RowFilter        `gorm:"type:json" json:"row_filter"`      // 全量、CDC、轮询增量和数据比对共用的结构化过滤
+	Position            int              `gorm:"not null;default:0" json:"position"`
+	RowIdentity         string           `gorm:"size:20;not null;default:primary_key" json:"row_identity"` // primary_key, unique_index, append_only, full_row
+	IdentityIndex       string           `gorm:"size:100" json:"identity_index"`
+	WriteMode           string           `gorm:"size:20;not null;default:upsert" json:"write_mode"`  // upsert, insert_ignore, newer_only, history
+	VersionColumn       string           `gorm:"size:100" json:"version_column"`                     // newer_only 比较的源字段
+	DeleteMode          string           `gorm:"size:20;not null;default:delete" json:"delete_mode"` // delete, ignore, soft_flag, soft_time
+	DeleteColumn        string           `gorm:"size:100" json:"delete_column"`                      // 软删除时标记的目标字段
+	SourcePrimaryKey    string           `gorm:"size:255" json:"source_primary_key"`                 // 复合主键按索引顺序逗号分隔；无键模式为空
+	TargetPrimaryKey    string           `gorm:"size:255" json:"target_primary_key"`
+	SyncState           string           `gorm:"size:30;not null;default:pending;index" json:"sync_state"`
+	SnapshotTotal       int64            `gorm:"not null;default:0" json:"snapshot_total"`
+	SnapshotProcessed   int64            `gorm:"not null;default:0" json:"snapshot_processed"`
+	ProgressPercent     float64          `gorm:"not null;default:0" json:"progress_percent"`
+	OnboardingFile      string           `gorm:"size:255" json:"onboarding_file"`
+	OnboardingPosition  uint32           `gorm:"not null;default:0" json:"onboarding_position"`
+	ProgressMessage     string           `gorm:"type:text" json:"progress_message"`
+	ActivatedAt         *time.Time       `json:"activated_at"`
+	SchemaState         *SyncSchemaState `gorm:"foreignKey:TaskTableID" json:"schema_state,omitempty"`
+}
+
+func (SyncTaskTable) TableName() string { return "sync_task_tables" }
+
+// SyncTablePattern maps every source table whose name matches SourcePattern,
+// in the connection database or in SourceSchemas, into one target table.
+// Precheck expands it into one SyncTaskTable per matching shard; when
+// DiscriminatorColumn is set the target records each row's source shard there.
+// Row filter, transforms, plugin, write and delete modes apply to every shard.
+type SyncTablePattern struct {
 	ID                  uint         `gorm:"primarykey" json:"id"`
 	CreatedAt           time.Time    `json:"created_at"`
 	UpdatedAt           time.Time    `json:"updated_at"`
-	TaskID              uint         `gorm:"not null;index;uniqueIndex:uk_task_source_table" json:"task_id"`
-	SourceTable         string       `gorm:"size:100;not null;uniqueIndex:uk_task_source_table" json:"source_table"`
+	TaskID              uint         `gorm:"not null;index" json:"task_id"`
+	SourceSchemas       StringList   `gorm:"type:json" json:"source_schemas"`
+	SourcePattern       string       `gorm:"size:100;not null" json:"source_pattern"`
 	TargetTable         string       `gorm:"size:100;not null" json:"target_table"`
-	IncrementalKey      string       `gorm:"size:100" json:"incremental_key"`
+	DiscriminatorColumn string       `gorm:"size:100" json:"discriminator_column"`
 	FieldMapping        FieldMapping `gorm:"type:json" json:"field_mapping"`
 	IgnoredFields       StringList   `gorm:"type:json" json:"ignored_fields"`
 	TypeMismatchIgnores StringList   `gorm:"type:json" json:"type_mismatch_ignores"`
 	CustomWhere         string       `gorm:"type:text" json:"custom_where,omitempty"`
+	RowIdentity         string       `gorm:"size:20;not null;default:primary_key" json:"row_identity"`
+	IdentityIndex       string       `gorm:"size:100" json:"identity_index"`
+	Transforms          FieldMapping `gorm:"type:json" json:"transforms"`
+	PluginID            *uint        `gorm:"index" json:"plugin_id,omitempty"`
+	RowFilter           RowFilter    `gorm:"type:json" json:"row_filter"`
+	WriteMode           string       `gorm:"size:20;not null;default:upsert" json:"write_mode"`
+	VersionColumn       string       `gorm:"size:100" json:"version_column"`
+	DeleteMode          string       `gorm:"size:20;not null;default:delete" json:"delete_mode"`
+	DeleteColumn        string       `gorm:"size:100" json:"delete_column"`
 	Position            int          `gorm:"not null;default:0" json:"position"`
-	SourcePrimaryKey    string       `gorm:"size:100" json:"source_primary_key"`
-	TargetPrimaryKey    string       `gorm:"size:100" json:"target_primary_key"`
-	SyncState           string       `gorm:"size:30;not null;default:pending;index" json:"sync_state"`
-	SnapshotTotal       int64        `gorm:"not null;default:0" json:"snapshot_total"`
-	SnapshotProcessed   int64        `gorm:"not null;default:0" json:"snapshot_processed"`
-	ProgressPercent     float64      `gorm:"not null;default:0" json:"progress_percent"`
-	OnboardingFile      string       `gorm:"size:255" json:"onboarding_file"`
-	OnboardingPosition  uint32       `gorm:"not null;default:0" json:"onboarding_position"`
-	ProgressMessage     string       `gorm:"type:text" json:"progress_message"`
-	ActivatedAt         *time.Time   `json:"activated_at"`
 }
 
-func (SyncTaskTable) TableName() string { return "sync_task_tables" }
+func (SyncTablePattern) TableName() string { return "sync_table_patterns" }
+
+// SyncSchemaState stores the accepted schema fingerprint of one table mapping and
+// the drift found by the periodic schema check. A passed precheck resets it.
+type SyncSchemaState struct {
+	ID                uint       `gorm:"primarykey" json:"id"`
+	TaskID            uint       `gorm:"not null;index" json:"task_id"`
+	TaskTableID       uint       `gorm:"not null;uniqueIndex" json:"task_table_id"`
+	SourceFingerprint string     `gorm:"size:64;not null" json:"source_fingerprint"`
+	TargetFingerprint string     `gorm:"size:64;not null" json:"target_fingerprint"`
+	SourceSchema      string     `gorm:"type:text" json:"-"`
+	TargetSchema      string     `gorm:"type:text" json:"-"`
+	DriftDetected     bool       `gorm:"not null;default:false;index" json:"drift_detected"`
+	DriftDetail       StringList `gorm:"type:json" json:"drift_detail"`
+	DetectedAt        *time.Time `json:"detected_at"`
+	CheckedAt         *time.Time `json:"checked_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+func (SyncSchemaState) TableName() string { return "sync_schema_states" }
 
 type SyncCheckpoint struct {
 	ID               uint      `gorm:"primarykey" json:"id"`
@@ -169,11 +275,19 @@ func (SyncSnapshotShardCheckpoint) TableName() string { return "sync_snapshot_sh
 
 // SyncCDCCheckpoint is the durable resume point for a task's MySQL binlog stream.
 // The position is advanced only after the corresponding target transaction commits.
+// GTIDSet holds the executed GTID set at the same point; when present on a
+// GTID-enabled source it takes precedence over file/position so the stream can
+// resume on a promoted replica after failover.
 type SyncCDCCheckpoint struct {
-	ID                uint       `gorm:"primarykey" json:"id"`
-	TaskID            uint       `gorm:"not null;uniqueIndex" json:"task_id"`
-	BinlogFile        string     `gorm:"size:255;not null" json:"binlog_file"`
-	BinlogPosition    uint32     `gorm:"not null" json:"binlog_position"`
+	ID             uint   `gorm:"primarykey" json:"id"`
+	TaskID         uint   `gorm:"not null;uniqueIndex" json:"task_id"`
+	BinlogFile     string `gorm:"size:255;not null" json:"binlog_file"`
+	BinlogPosition uint32 `gorm:"not null" json:"binlog_position"`
+	GTIDSet        string `gorm:"column:gtid_set;type:text" json:"gtid_set"`
+	// ServerUUID 是 BinlogFile/BinlogPosition 所属源库的 server_uuid，为空表示未确认；主从切换后同名文件的位点不可用
+	ServerUUID string `gorm:"column:server_uuid;size:64;not null;default:''" json:"server_uuid"`
+	// LSN 是 PostgreSQL 逻辑复制源已确认写入目标的位置，MySQL 源为空
+	LSN               string     `gorm:"column:lsn;size:32" json:"lsn"`
 	SnapshotCompleted bool       `gorm:"not null;default:false" json:"snapshot_completed"`
 	LastEventAt       *time.Time `json:"last_event_at"`
 	UpdatedAt         time.Time  `json:"updated_at"`
@@ -190,10 +304,50 @@ type SyncXAPreparedTransaction struct {
 	BinlogFile     string    `gorm:"size:255;not null" json:"binlog_file"`
 	BinlogPosition uint32    `gorm:"not null" json:"binlog_position"`
 	OperationsJSON string    `gorm:"type:text;not null" json:"operations_json"`
+	// ResolvedFile/ResolvedPosition 记录 XA COMMIT 已写入目标的位点，检查点越过该位点后才删除缓存
+	ResolvedFile     string `gorm:"size:255;not null;default:''" json:"resolved_file"`
+	ResolvedPosition uint32 `gorm:"not null;default:0" json:"resolved_position"`
 }
 
 func (SyncXAPreparedTransaction) TableName() string { return "sync_xa_prepared_transactions" }
 
+// SyncDeadLetter 记录 CDC 因数据错误无法写入目标库而被跳过的行操作，修复原因后可重放
+type SyncDeadLetter struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	TaskID        uint       `gorm:"not null;index" json:"task_id"`
+	TaskTableID   uint       `gorm:"not null;index" json:"task_table_id"`
+	SourceTable   string     `gorm:"size:200;not null" json:"source_table"`
+	TargetTable   string     `gorm:"size:100;not null" json:"target_table"`
+	Operation     string     `gorm:"size:20;not null" json:"operation"` // upsert, delete
+	PrimaryKey    string     `gorm:"size:512" json:"primary_key"`       // 复合主键为 JSON 数组；无键模式为空
+	OperationJSON string     `gorm:"type:text;not null" json:"operation_json"`
+	Position      string     `gorm:"size:300" json:"position"` // Binlog 文件:位点或 LSN
+	Error         string     `gorm:"type:text" json:"error"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	Status        string     `gorm:"size:20;not null;default:pending;index" json:"status"` // pending, replayed, discarded
+	ReplayedAt    *time.Time `json:"replayed_at"`
+}
+
+func (SyncDeadLetter) TableName() string { return "sync_dead_letters" }
+
+// SyncPlugin 是上传的 WASM 行处理插件，同名插件每次上传生成新版本，表映射引用具体版本
+type SyncPlugin struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Name        string    `gorm:"size:100;not null;uniqueIndex:uk_plugin_name_version" json:"name"`
+	Version     int       `gorm:"not null;uniqueIndex:uk_plugin_name_version" json:"version"`
+	Description string    `gorm:"size:500" json:"description"`
+	TimeoutMs   int       `gorm:"not null;default:200" json:"timeout_ms"` // 单行调用的执行时限
+	Checksum    string    `gorm:"size:64;not null" json:"checksum"`       // 模块 SHA-256
+	Size        int64     `gorm:"not null" json:"size"`
+	Module      []byte    `gorm:"not null" json:"-"`
+}
+
+func (SyncPlugin) TableName() string { return "sync_plugins" }
+
 // SyncLog 同步日志
 type SyncLog struct {
 	ID           uint      `gorm:"primarykey" json:"id"`
@@ -215,6 +369,46 @@ func (SyncLog) TableName() string {
 	return "sync_logs"
 }
 
+// RunTableRows 记录一次执行中每张源表写入的行数，键为带库名的源表（分表合并时各分片分开计数）
+type RunTableRows map[string]int64
+
+func (m *RunTableRows) Scan(value interface{}) error {
+	bytes, ok := jsonBytes(value)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(bytes, m)
+}
+
+func (m RunTableRows) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+// SyncTaskRun 记录任务的一次执行或一次 CDC 会话，SyncTask 上只保留最近一次的汇总状态
+type SyncTaskRun struct {
+	ID              uint         `gorm:"primarykey" json:"id"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	TaskID          uint         `gorm:"not null;index:idx_task_run_started" json:"task_id"`
+	RunType         string       `gorm:"size:20;not null" json:"run_type"`     // 执行时的同步类型
+	Trigger         string       `gorm:"size:20;not null" json:"trigger"`      // manual, cron, recovery, system
+	Status          string       `gorm:"size:20;not null;index" json:"status"` // running, success, failed, paused, stopped, interrupted
+	Instance        string       `gorm:"size:255;index" json:"instance"`       // 执行所在的实例 ID
+	StartedAt       time.Time    `gorm:"not null;index:idx_task_run_started" json:"started_at"`
+	FinishedAt      *time.Time   `json:"finished_at"`
+	DurationMs      int64        `gorm:"not null;default:0" json:"duration_ms"`
+	RowsTotal       int64        `gorm:"not null;default:0" json:"rows_total"`
+	Bytes           int64        `gorm:"not null;default:0" json:"bytes"`
+	ErrorCount      int64        `gorm:"not null;default:0" json:"error_count"` // 记入死信的行数
+	TableRows       RunTableRows `gorm:"type:json" json:"table_rows"`
+	Message         string       `gorm:"type:text" json:"message"`
+	ErrorDetail     string       `gorm:"type:text" json:"error_detail,omitempty"`
+	StartCheckpoint string       `gorm:"type:text" json:"start_checkpoint"`
+	EndCheckpoint   string       `gorm:"type:text" json:"end_checkpoint"`
+}
+
+func (SyncTaskRun) TableName() string { return "sync_task_runs" }
+
 // TaskAlertState records alert transitions and throttles repeated notifications.
 type TaskAlertState struct {
 	ID         uint       `gorm:"primarykey" json:"id"`
@@ -265,6 +459,8 @@ type SyncRepairJob struct {
 	Message         string        `gorm:"type:text" json:"message"`
 	ErrorDetail     string        `gorm:"type:text" json:"error_detail,omitempty"`
 	PreviousStatus  string        `gorm:"size:30" json:"previous_status"`
+	Trigger         string        `gorm:"size:20" json:"trigger"` // 空为手动发起，binlog_purge 为 Binlog 缺口自动发起
+	AutoApply       bool          `gorm:"not null;default:false" json:"auto_apply"`
 	StartedAt       *time.Time    `json:"started_at"`
 	FinishedAt      *time.Time    `json:"finished_at"`
 }
@@ -280,8 +476,8 @@ type SyncRepairDiff struct {
 	TaskTableID uint      `gorm:"not null;index;uniqueIndex:uk_repair_diff" json:"task_table_id"`
 	SourceTable string    `gorm:"size:100;not null" json:"source_table"`
 	TargetTable string    `gorm:"size:100;not null" json:"target_table"`
-	SourcePK    string    `gorm:"size:255;not null;uniqueIndex:uk_repair_diff" json:"source_pk"`
-	TargetPK    string    `gorm:"size:255" json:"target_pk"`
+	SourcePK    string    `gorm:"size:512;not null;uniqueIndex:uk_repair_diff" json:"source_pk"` // 复合主键为 JSON 数组
+	TargetPK    string    `gorm:"size:512" json:"target_pk"`
 	DiffType    string    `gorm:"size:30;not null;index" json:"diff_type"` // missing_target, missing_source, mismatch
 	SourceHash  string    `gorm:"size:64" json:"source_hash"`
 	TargetHash  string    `gorm:"size:64" json:"target_hash"`
@@ -290,3 +486,18 @@ type SyncRepairDiff struct {
 }
 
 func (SyncRepairDiff) TableName() string { return "sync_repair_diffs" }
+
+// SyncTaskLease 是多实例部署时任务的租约，同一任务同一类型只有一个实例持有。
+// run 租约在 CDC 会话或单次执行期间持有；schedule 租约由负责定时触发的实例持有，
+// 持有者按心跳续期，过期后其他实例可以接管。
+type SyncTaskLease struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	TaskID     uint      `gorm:"not null;uniqueIndex:uk_task_lease" json:"task_id"`
+	Kind       string    `gorm:"size:20;not null;uniqueIndex:uk_task_lease" json:"kind"` // run, schedule
+	Holder     string    `gorm:"size:255;not null;index" json:"holder"`                  // 持有租约的实例 ID
+	AcquiredAt time.Time `gorm:"not null" json:"acquired_at"`
+	RenewedAt  time.Time `gorm:"not null" json:"renewed_at"`
+	ExpiresAt  time.Time `gorm:"not null" json:"expires_at"`
+}
+
+func (SyncTaskLease) TableName() string { return "sync_task_leases" }
@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -60,6 +61,15 @@ func (s *Scheduler) Start() error {
 	}); err != nil {
 		return err
 	}
+	if _, err := s.cron.AddFunc("@every 10m", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 9*time.Minute)
+		defer cancel()
+		if err := services.NewSchemaDriftService().CheckSchemaDrift(ctx); err != nil {
+			log.Printf("表结构漂移巡检失败: %v", err)
+		}
+	}); err != nil {
+		return err
+	}
 	s.cron.Start()
 	log.Println("定时任务调度器已启动")
 	return nil
@@ -116,8 +126,15 @@ func (s *Scheduler) AddTask(task *models.SyncTask) error {
 		return err
 	}
 	entryID, err := s.cron.AddFunc(spec, func() {
+		// 多实例部署时只由持有定时租约的实例触发
+		if err := services.AcquireScheduleLease(taskID); err != nil {
+			if !errors.Is(err, services.ErrTaskLeaseHeld) {
+				log.Printf("获取定时任务租约失败 [ID: %d]: %v", taskID, err)
+			}
+			return
+		}
 		log.Printf("执行定时同步任务 [ID: %d]", taskID)
-		if err := s.syncService.ExecuteTask(taskID); err != nil {
+		if err := s.syncService.ExecuteTask(taskID, services.RunTriggerCron); err != nil {
 			log.Printf("定时同步任务执行失败 [ID: %d]: %v", taskID, err)
 		} else {
 			log.Printf("定时同步任务执行成功 [ID: %d]", taskID)
@@ -141,6 +158,7 @@ func (s *Scheduler) RemoveTask(taskID uint) {
 	if entryID, exists := s.tasks[taskID]; exists {
 		s.cron.Remove(entryID)
 		delete(s.tasks, taskID)
+		services.ReleaseScheduleLease(taskID)
 		log.Printf("移除定时任务 [ID: %d]", taskID)
 	}
 }
@@ -125,14 +125,18 @@ func (s *AlertService) CheckTaskAlerts(ctx context.Context) error {
 			_ = s.ResolveTaskAlertSilent(task.ID, "error")
 			continue
 		}
-		// 全量任务只检测执行失败
-		if task.SyncType == "full" {
+		// 全量和轮询增量任务按次执行，只检测执行失败
+		if task.SyncType == "full" || task.SyncType == "incremental" {
 			if task.RuntimeStatus == "failed" && task.LastRunStatus == "failed" {
-				content := fmt.Sprintf("全量同步任务执行失败\n任务：%s\n错误信息：%s", task.Name, task.LastRunMessage)
+				kind := "全量"
+				if task.SyncType == "incremental" {
+					kind = "轮询增量"
+				}
+				content := fmt.Sprintf("%s同步任务执行失败\n任务：%s\n错误信息：%s", kind, task.Name, task.LastRunMessage)
 				_ = s.SendTaskAlert(ctx, task, "error", content)
 				_ = s.ResolveTaskAlertSilent(task.ID, "delay")
 			} else {
-				// 全量任务非失败状态不触发任何预警
+				// 非失败状态不触发任何预警
 				_ = s.ResolveTaskAlertSilent(task.ID, "error")
 			}
 			continue
@@ -168,7 +172,7 @@ func (s *AlertService) CheckTaskAlerts(ctx context.Context) error {
 }
 
 func taskAlertEligible(task *models.SyncTask) bool {
-	if task.SyncType == "full" {
+	if task.SyncType == "full" || task.SyncType == "incremental" {
 		return false
 	}
 	return task.RuntimeStatus == "catching_up" || task.RuntimeStatus == "cdc_running"
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+// 检查点之后的 Binlog 被源库清理时的恢复策略。fail 停止任务并预警，由人工处理；
+// resnapshot 从当前位点继续，并重新全量初始化全部同步表；repair 从当前位点继续，并自动发起按缺口时间窗口限定的数据比对，
+// 可选比对后自动补数。后两种策略在初始化或比对补数完成前任务标记为"可能不一致"。
+// 全量初始化和补数只写入源端存在的行，缺口期间源端删除的行不会从目标删除，比对结果中会列为目标多余数据。
+const (
+	binlogPurgePolicyFail       = "fail"
+	binlogPurgePolicyResnapshot = "resnapshot"
+	binlogPurgePolicyRepair     = "repair"
+
+	repairTriggerBinlogPurge = "binlog_purge"
+	// binlogGapMargin 向前多比对的时长，覆盖检查点落盘间隔和源库时钟偏差
+	binlogGapMargin = 5 * time.Minute
+)
+
+func normalizeBinlogPurgePolicy(policy string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "", binlogPurgePolicyFail:
+		return binlogPurgePolicyFail, nil
+	case binlogPurgePolicyResnapshot:
+		return binlogPurgePolicyResnapshot, nil
+	case binlogPurgePolicyRepair:
+		return binlogPurgePolicyRepair, nil
+	default:
+		return "", fmt.Errorf("不支持的 Binlog 清理恢复策略: %s", policy)
+	}
+}
+
+func normalizeBinlogPurgeSettings(policy, column string) (string, string, error) {
+	policy, err := normalizeBinlogPurgePolicy(policy)
+	if err != nil {
+		return "", "", err
+	}
+	column = strings.TrimSpace(column)
+	if policy != binlogPurgePolicyRepair {
+		return policy, "", nil
+	}
+	if column != "" && !taskIdentifierPattern.MatchString(column) {
+		return "", "", fmt.Errorf("缺口比对时间字段名不合法")
+	}
+	return policy, column, nil
+}
+
+// validateBinlogPurgeEndpoints 检查恢复策略与源、目标连接类型匹配：缺口比对仅支持 MySQL 到 MySQL
+func validateBinlogPurgeEndpoints(policy, sourceType, targetType string) error {
+	if policy == binlogPurgePolicyRepair && (sourceType != "mysql" || targetType != "mysql") {
+		return fmt.Errorf("缺口比对补数仅支持 MySQL 源库和目标库，请改用 fail 或 resnapshot 策略")
+	}
+	return nil
+}
+
+// ValidateBinlogPurgeEndpoints 按源、目标连接类型校验 Binlog 清理恢复策略
+func (s *SyncService) ValidateBinlogPurgeEndpoints(sourceName, targetName, policy string) error {
+	if policy != binlogPurgePolicyRepair {
+		return nil
+	}
+	var source, target models.DatabaseConnection
+	if err := s.systemDB.Where("name = ?", sourceName).First(&source).Error; err != nil {
+		return fmt.Errorf("数据库连接 %s 不存在", sourceName)
+	}
+	if err := s.systemDB.Where("name = ?", targetName).First(&target).Error; err != nil {
+		return fmt.Errorf("数据库连接 %s 不存在", targetName)
+	}
+	return validateBinlogPurgeEndpoints(policy, source.Type, target.Type)
+}
+
+// NormalizeBinlogPurgeSettings 校验 Binlog 清理恢复策略和缺口比对时间字段，空策略按 fail 处理
+func (s *SyncService) NormalizeBinlogPurgeSettings(policy, column string) (string, string, error) {
+	return normalizeBinlogPurgeSettings(policy, column)
+}
+
+// binlogGapWindow 估算被跳过的变更发生的时间范围。检查点只记录落盘时刻，当时已落后 delay 秒，
+// 起点再向前留出余量；检查点没有时间时返回 nil，表示整表比对
+func binlogGapWindow(lastEventAt *time.Time, delaySeconds int64, now time.Time) (*time.Time, *time.Time) {
+	if lastEventAt == nil || lastEventAt.IsZero() {
+		return nil, &now
+	}
+	from := lastEventAt.Add(-time.Duration(delaySeconds)*time.Second - binlogGapMargin)
+	return &from, &now
+}
+
+// recoverBinlogPurge 按任务策略处理检查点 Binlog 已被清理的情况，返回错误时任务不应启动
+func (m *CDCManager) recoverBinlogPurge(task *models.SyncTask, checkpoint *models.SyncCDCCheckpoint, cause error) error {
+	policy, _ := normalizeBinlogPurgePolicy(task.BinlogPurgePolicy)
+	old := cdcCheckpointLabel(checkpoint)
+	if policy == binlogPurgePolicyFail {
+		m.service.RecordTaskEvent(task, "binlog_purged", "cdc", "failed", "检查点之后的 Binlog 已被清理，任务已停止", fmt.Sprintf("位点 %s；%v", old, cause), 0, 0)
+		return fmt.Errorf("检查点 %s 之后的 Binlog 已被清理，按恢复策略停止同步，请人工确认后修改位点或重新初始化: %w", old, cause)
+	}
+	status, err := currentMySQLMasterStatus(task.SourceDB)
+	if err != nil {
+		return fmt.Errorf("检查点 %s 之后的 Binlog 已被清理，读取当前位点失败: %w", old, err)
+	}
+	gapFrom, gapTo := binlogGapWindow(checkpoint.LastEventAt, task.DelaySeconds, time.Now())
+	resnapshot := policy == binlogPurgePolicyResnapshot
+	if resnapshot {
+		tableIDs := m.service.systemDB.Model(&models.SyncTaskTable{}).Select("id").Where("task_id = ?", task.ID)
+		if err := m.service.systemDB.Where("task_table_id IN (?)", tableIDs).Delete(&models.SyncCheckpoint{}).Error; err != nil {
+			return err
+		}
+		if err := m.service.systemDB.Where("task_table_id IN (?)", tableIDs).Delete(&models.SyncSnapshotShardCheckpoint{}).Error; err != nil {
+			return err
+		}
+	}
+	checkpoint.BinlogFile, checkpoint.BinlogPosition, checkpoint.GTIDSet, checkpoint.ServerUUID = status.File, status.Position, status.ExecutedGTIDSet, status.ServerUUID
+	checkpoint.SnapshotCompleted = !resnapshot
+	if err := m.service.systemDB.Model(checkpoint).Updates(map[string]interface{}{"binlog_file": status.File, "binlog_position": status.Position, "gtid_set": status.ExecutedGTIDSet, "server_uuid": status.ServerUUID, "last_event_at": nil, "snapshot_completed": !resnapshot}).Error; err != nil {
+		return err
+	}
+	_ = m.service.UpdateTask(task.ID, map[string]interface{}{"possibly_inconsistent": true})
+	task.PossiblyInconsistent = true
+	detail := fmt.Sprintf("原 %s → 新 %s", old, cdcCheckpointLabel(checkpoint))
+	if resnapshot {
+		m.service.RecordTaskEvent(task, "checkpoint_reset", "cdc", "running", "Binlog 位点被清理，从当前位点恢复并重新全量初始化", detail, 0, 0)
+		return nil
+	}
+	m.service.RecordTaskEvent(task, "checkpoint_reset", "cdc", "running", "Binlog 位点被清理，从当前位点恢复并比对缺口数据", detail, 0, 0)
+	req := RepairCompareRequest{CutoffFrom: gapFrom, CutoffTime: gapTo, CutoffColumn: task.BinlogPurgeColumn}
+	job, err := NewRepairService().startCompare(task.ID, req, repairTriggerBinlogPurge, task.BinlogPurgeAutoApply)
+	if err != nil {
+		log.Printf("CDC 任务 %d 缺口比对启动失败: %v", task.ID, err)
+		m.service.RecordTaskEvent(task, "gap_compare_failed", "repair", "failed", "Binlog 缺口比对启动失败，任务数据可能不一致", err.Error(), 0, 0)
+		content := fmt.Sprintf("Binlog 缺口比对启动失败，任务已从当前位点继续，数据可能不一致，请人工比对补数\n任务：%s\n%s\n错误：%s", task.Name, detail, err.Error())
+		_ = NewAlertService().SendTaskAlert(context.Background(), task, "error", content)
+		return nil
+	}
+	m.service.RecordTaskEvent(task, "gap_compare_started", "repair", "running", "已发起 Binlog 缺口数据比对", gapWindowLabel(job), 0, 0)
+	return nil
+}
+
+func gapWindowLabel(job *models.SyncRepairJob) string {
+	from := "任务开始"
+	if job.CutoffFrom != nil {
+		from = job.CutoffFrom.Format("2006-01-02 15:04:05")
+	}
+	label := fmt.Sprintf("比对任务 %d，时间范围 %s ~ %s", job.ID, from, job.CutoffTime.Format("2006-01-02 15:04:05"))
+	if job.CutoffColumn == "" {
+		label += "，未配置时间字段，整表比对"
+	}
+	return label
+}
+
+// finishGapJob 在缺口比对或补数结束后推进后续步骤，全部完成且没有遗留差异时清除不一致标记。
+// 补数不删除目标端多余的行（源端在缺口期间删除的行），仍有这类差异时保留标记并报告行数
+func (s *RepairService) finishGapJob(job *models.SyncRepairJob, err error) {
+	syncSvc := NewSyncService()
+	task, taskErr := syncSvc.GetTask(job.TaskID)
+	if taskErr != nil {
+		return
+	}
+	if err != nil {
+		syncSvc.RecordTaskEvent(task, "gap_"+job.JobType+"_failed", "repair", "failed", "Binlog 缺口数据处理未完成，任务数据可能不一致", err.Error(), 0, 0)
+		return
+	}
+	var current models.SyncRepairJob
+	if err := s.systemDB.First(&current, job.ID).Error; err != nil || current.Status != "success" {
+		return
+	}
+	if current.JobType == "compare" && current.DiffRows > 0 {
+		if !current.AutoApply {
+			syncSvc.RecordTaskEvent(task, "gap_compare_completed", "repair", "success", "Binlog 缺口比对发现差异，请确认后补数", fmt.Sprintf("比对任务 %d，差异 %d 行", current.ID, current.DiffRows), current.DiffRows, 0)
+			return
+		}
+		if _, err := s.StartRepair(task.ID, current.ID); err != nil {
+			syncSvc.RecordTaskEvent(task, "gap_repair_failed", "repair", "failed", "Binlog 缺口自动补数启动失败", err.Error(), 0, 0)
+		}
+		return
+	}
+	detail := fmt.Sprintf("比对任务 %d 未发现差异", current.ID)
+	if current.JobType == "repair" {
+		detail = fmt.Sprintf("补数任务 %d 已补齐 %d 行", current.ID, current.RepairedRows)
+		if extra := s.gapExtraRows(current.SourceJobID); extra > 0 {
+			detail += fmt.Sprintf("，目标端仍有 %d 行源端已删除的数据未删除", extra)
+			syncSvc.RecordTaskEvent(task, "gap_repair_completed", "repair", "failed", "Binlog 缺口补数完成，源端在缺口期间删除的行仍留在目标端，任务数据仍可能不一致", detail, current.RepairedRows, 0)
+			content := fmt.Sprintf("Binlog 缺口补数完成，但源端在缺口期间删除的 %d 行仍留在目标端，请在比对结果中确认后人工删除\n任务：%s\n比对任务：%d", extra, task.Name, current.SourceJobID)
+			_ = NewAlertService().SendTaskAlert(context.Background(), task, "error", content)
+			return
+		}
+	}
+	_ = syncSvc.UpdateTask(task.ID, map[string]interface{}{"possibly_inconsistent": false})
+	syncSvc.RecordTaskEvent(task, "consistency_restored", "repair", "success", "Binlog 缺口数据已补齐", detail, current.RepairedRows, 0)
+}
+
+// gapExtraRows 统计比对结果中补数后仍留在目标端的多余行
+func (s *RepairService) gapExtraRows(compareJobID uint) int64 {
+	var count int64
+	_ = s.systemDB.Model(&models.SyncRepairDiff{}).Where("job_id = ? AND diff_type = ? AND status IN ?", compareJobID, "missing_source", []string{"pending", "skipped"}).Count(&count).Error
+	return count
+}
+
+// checkSnapshotInconsistency 在重新全量初始化完成后发起整表比对。全量只写入源端现存的行，
+// 源端在缺口期间删除的行仍留在目标端，由比对结果决定能否清除不一致标记
+func (s *SyncService) checkSnapshotInconsistency(task *models.SyncTask) {
+	if !task.PossiblyInconsistent {
+		return
+	}
+	now := time.Now()
+	job, err := NewRepairService().startCompare(task.ID, RepairCompareRequest{CutoffTime: &now}, repairTriggerBinlogPurge, false)
+	if err != nil {
+		s.RecordTaskEvent(task, "gap_compare_failed", "repair", "failed", "重新全量初始化完成，但无法比对源端在缺口期间删除的行，任务数据仍可能不一致", err.Error(), 0, 0)
+		content := fmt.Sprintf("重新全量初始化完成，但源端在 Binlog 缺口期间删除的行可能仍留在目标端，且无法发起比对，请人工核对\n任务：%s\n错误：%s", task.Name, err.Error())
+		_ = NewAlertService().SendTaskAlert(context.Background(), task, "error", content)
+		return
+	}
+	s.RecordTaskEvent(task, "gap_compare_started", "repair", "running", "重新全量初始化完成，已发起整表比对确认源端删除的行", gapWindowLabel(job), 0, 0)
+}
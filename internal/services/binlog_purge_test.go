@@ -0,0 +1,56 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeBinlogPurgeSettings(t *testing.T) {
+	tests := []struct {
+		policy, column string
+		want, column2  string
+		ok             bool
+	}{
+		{policy: "", want: "fail", ok: true},
+		{policy: "resnapshot", column: "updated_at", want: "resnapshot", ok: true},
+		{policy: "REPAIR", column: " updated_at ", want: "repair", column2: "updated_at", ok: true},
+		{policy: "repair", column: "updated at", ok: false},
+		{policy: "skip", ok: false},
+	}
+	for _, tt := range tests {
+		policy, column, err := normalizeBinlogPurgeSettings(tt.policy, tt.column)
+		if (err == nil) != tt.ok || policy != tt.want || column != tt.column2 {
+			t.Fatalf("%q/%q: got %q %q %v", tt.policy, tt.column, policy, column, err)
+		}
+	}
+}
+
+func TestValidateBinlogPurgeEndpoints(t *testing.T) {
+	tests := []struct {
+		policy, source, target string
+		ok                     bool
+	}{
+		{policy: "repair", source: "mysql", target: "mysql", ok: true},
+		{policy: "repair", source: "postgres", target: "mysql"},
+		{policy: "repair", source: "mysql", target: "sqlserver"},
+		{policy: "resnapshot", source: "postgres", target: "mysql", ok: true},
+		{policy: "fail", source: "mysql", target: "postgres", ok: true},
+	}
+	for _, tt := range tests {
+		if err := validateBinlogPurgeEndpoints(tt.policy, tt.source, tt.target); (err == nil) != tt.ok {
+			t.Fatalf("%s %s→%s: err = %v", tt.policy, tt.source, tt.target, err)
+		}
+	}
+}
+
+func TestBinlogGapWindow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	last := now.Add(-time.Hour)
+	from, to := binlogGapWindow(&last, 60, now)
+	if from == nil || !from.Equal(last.Add(-time.Minute-binlogGapMargin)) || !to.Equal(now) {
+		t.Fatalf("window = %v ~ %v", from, to)
+	}
+	if from, _ := binlogGapWindow(nil, 0, now); from != nil {
+		t.Fatalf("missing checkpoint time should compare whole table, got %v", from)
+	}
+}
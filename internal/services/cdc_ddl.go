@@ -0,0 +1,423 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// DDL 处理策略：apply 改写后在目标库执行，ignore 只记录事件，pause 暂停任务并预警
+const (
+	ddlPolicyApply  = "apply"
+	ddlPolicyIgnore = "ignore"
+	ddlPolicyPause  = "pause"
+)
+
+// errCDCPausedByDDL 表示流因 DDL 策略主动暂停，不按失败处理
+var errCDCPausedByDDL = errors.New("源表 DDL 待处理，任务已暂停")
+
+func normalizeDDLPolicy(policy string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "", ddlPolicyIgnore:
+		return ddlPolicyIgnore, nil
+	case ddlPolicyApply:
+		return ddlPolicyApply, nil
+	case ddlPolicyPause:
+		return ddlPolicyPause, nil
+	default:
+		return "", fmt.Errorf("不支持的 DDL 处理策略: %s", policy)
+	}
+}
+
+// cdcDDL 是从 QueryEvent 中识别出的表级 DDL
+type cdcDDL struct {
+	kind   string // alter, rename, truncate
+	tables []cdcDDLTable
+	body   string // ALTER TABLE 表名之后的子句
+}
+
+type cdcDDLTable struct {
+	schema   string
+	name     string
+	renameTo string
+}
+
+var (
+	cdcDDLCommentPattern  = regexp.MustCompile(`(?s)^\s*/\*.*?\*/`)
+	cdcDDLAlterPattern    = regexp.MustCompile(`(?is)^ALTER\s+(?:ONLINE\s+|IGNORE\s+)*TABLE\s+`)
+	cdcDDLRenamePattern   = regexp.MustCompile(`(?is)^RENAME\s+TABLES?\s+`)
+	cdcDDLTruncatePattern = regexp.MustCompile(`(?is)^TRUNCATE\s+(?:TABLE\s+)?`)
+	cdcDDLAlterRename     = regexp.MustCompile(`(?is)^RENAME\s+(?:TO\s+|AS\s+)?`)
+	cdcDDLRenameOther     = regexp.MustCompile(`(?is)^RENAME\s+(?:COLUMN|INDEX|KEY)\s`)
+	cdcDDLRenameTo        = regexp.MustCompile(`(?is)^TO\s+`)
+)
+
+// parseCDCDDL 识别 ALTER TABLE / RENAME TABLE / TRUNCATE，其它语句返回 false
+func parseCDCDDL(query, defaultSchema string) (*cdcDDL, bool) {
+	query = strings.TrimSpace(query)
+	for {
+		stripped := cdcDDLCommentPattern.ReplaceAllString(query, "")
+		if stripped == query {
+			break
+		}
+		query = strings.TrimSpace(stripped)
+	}
+	query = strings.TrimRight(query, "; \t\r\n")
+	switch {
+	case cdcDDLAlterPattern.MatchString(query):
+		rest := query[len(cdcDDLAlterPattern.FindString(query)):]
+		schema, name, rest, ok := parseQualifiedIdentifier(rest, defaultSchema)
+		if !ok {
+			return nil, false
+		}
+		body := strings.TrimSpace(rest)
+		// ALTER TABLE a RENAME TO b 按改名处理
+		if prefix := cdcDDLAlterRename.FindString(body); prefix != "" && !cdcDDLRenameOther.MatchString(body) {
+			_, newName, tail, ok := parseQualifiedIdentifier(body[len(prefix):], defaultSchema)
+			if ok && strings.TrimSpace(tail) == "" {
+				return &cdcDDL{kind: "rename", tables: []cdcDDLTable{{schema: schema, name: name, renameTo: newName}}}, true
+			}
+		}
+		return &cdcDDL{kind: "alter", tables: []cdcDDLTable{{schema: schema, name: name}}, body: body}, true
+	case cdcDDLRenamePattern.MatchString(query):
+		rest := query[len(cdcDDLRenamePattern.FindString(query)):]
+		ddl := &cdcDDL{kind: "rename"}
+		for {
+			schema, name, tail, ok := parseQualifiedIdentifier(rest, defaultSchema)
+			if !ok {
+				return nil, false
+			}
+			tail = strings.TrimSpace(tail)
+			prefix := cdcDDLRenameTo.FindString(tail)
+			if prefix == "" {
+				return nil, false
+			}
+			_, newName, tail, ok := parseQualifiedIdentifier(tail[len(prefix):], defaultSchema)
+			if !ok {
+				return nil, false
+			}
+			ddl.tables = append(ddl.tables, cdcDDLTable{schema: schema, name: name, renameTo: newName})
+			tail = strings.TrimSpace(tail)
+			if !strings.HasPrefix(tail, ",") {
+				break
+			}
+			rest = tail[1:]
+		}
+		return ddl, true
+	case cdcDDLTruncatePattern.MatchString(query):
+		rest := query[len(cdcDDLTruncatePattern.FindString(query)):]
+		schema, name, _, ok := parseQualifiedIdentifier(rest, defaultSchema)
+		if !ok {
+			return nil, false
+		}
+		return &cdcDDL{kind: "truncate", tables: []cdcDDLTable{{schema: schema, name: name}}}, true
+	}
+	return nil, false
+}
+
+// parseQualifiedIdentifier 读取 `db`.`table` 或 table，返回剩余文本
+func parseQualifiedIdentifier(text, defaultSchema string) (string, string, string, bool) {
+	first, rest, ok := parseIdentifier(strings.TrimSpace(text))
+	if !ok {
+		return "", "", text, false
+	}
+	trimmed := strings.TrimLeft(rest, " \t\r\n")
+	if strings.HasPrefix(trimmed, ".") {
+		second, tail, ok := parseIdentifier(strings.TrimLeft(trimmed[1:], " \t\r\n"))
+		if !ok {
+			return "", "", text, false
+		}
+		return first, second, tail, true
+	}
+	return defaultSchema, first, rest, true
+}
+
+func parseIdentifier(text string) (string, string, bool) {
+	if text == "" {
+		return "", text, false
+	}
+	if text[0] == '`' {
+		var name strings.Builder
+		for i := 1; i < len(text); i++ {
+			if text[i] != '`' {
+				name.WriteByte(text[i])
+				continue
+			}
+			if i+1 < len(text) && text[i+1] == '`' {
+				name.WriteByte('`')
+				i++
+				continue
+			}
+			return name.String(), text[i+1:], true
+		}
+		return "", text, false
+	}
+	end := 0
+	for end < len(text) && isDDLIdentifierByte(text[end]) {
+		end++
+	}
+	if end == 0 {
+		return "", text, false
+	}
+	return text[:end], text[end:], true
+}
+
+func isDDLIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// ddlColumnKeywords 之后紧跟的标识符视为列名，按字段映射改写；索引、约束名不在其列
+var ddlColumnKeywords = map[string]bool{"COLUMN": true, "ADD": true, "DROP": true, "MODIFY": true, "ALTER": true, "AFTER": true, "(": true, ",": true}
+
+// rewriteDDLColumns 把 ALTER 语句按顶层子句改写为目标字段名，涉及忽略字段的子句跳过并返回，
+// 字符串字面量保持不变
+func rewriteDDLColumns(body string, mapping *models.SyncTaskTable) (string, []string) {
+	if len(mapping.FieldMapping) == 0 && len(mapping.IgnoredFields) == 0 {
+		return body, nil
+	}
+	var kept, skipped []string
+	for _, clause := range splitDDLClauses(body) {
+		rewritten, ok := rewriteDDLClause(clause, mapping)
+		if !ok {
+			skipped = append(skipped, clause)
+			continue
+		}
+		kept = append(kept, rewritten)
+	}
+	return strings.Join(kept, ", "), skipped
+}
+
+// splitDDLClauses 按括号、引号之外的逗号拆分 ALTER 子句
+func splitDDLClauses(body string) []string {
+	var clauses []string
+	depth, start := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; c {
+		case '\'', '"', '`':
+			for i++; i < len(body) && body[i] != c; i++ {
+				if body[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				clauses = append(clauses, strings.TrimSpace(body[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if clause := strings.TrimSpace(body[start:]); clause != "" {
+		clauses = append(clauses, clause)
+	}
+	return clauses
+}
+
+// rewriteDDLClause 改写单个子句中列位置上的标识符；子句涉及忽略字段时返回 false，
+// 仅 AFTER 指向忽略字段时去掉位置说明
+func rewriteDDLClause(clause string, mapping *models.SyncTaskTable) (string, bool) {
+	var out bytes.Buffer
+	previous := ""
+	afterAt := -1       // AFTER 关键字在输出中的位置
+	changeNames := 0    // CHANGE [COLUMN] old new 中尚未处理的列名个数
+	references := false // REFERENCES 之后的列属于被引用表，不改写
+	column := func(name string, quoted bool) (string, bool) {
+		if ignoredField(mapping, name) {
+			return "", false
+		}
+		target := mappedDDLColumn(mapping.FieldMapping, name)
+		if !quoted && target == name {
+			return name, true
+		}
+		return quoteMySQL(target), true
+	}
+	for i := 0; i < len(clause); {
+		c := clause[i]
+		word, quoted, j := "", false, i
+		switch {
+		case c == '\'' || c == '"':
+			j = i + 1
+			for ; j < len(clause); j++ {
+				if clause[j] == '\\' {
+					j++
+				} else if clause[j] == c {
+					break
+				}
+			}
+			j = min(j+1, len(clause))
+			out.WriteString(clause[i:j])
+			i, previous = j, "'"
+			continue
+		case c == '`':
+			name, rest, ok := parseIdentifier(clause[i:])
+			if !ok {
+				out.WriteString(clause[i:])
+				i = len(clause)
+				continue
+			}
+			word, quoted, j = name, true, len(clause)-len(rest)
+		case isDDLIdentifierByte(c):
+			for j < len(clause) && isDDLIdentifierByte(clause[j]) {
+				j++
+			}
+			word = clause[i:j]
+		default:
+			if c == ')' {
+				references = false
+			}
+			if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+				previous = string(c)
+			}
+			out.WriteByte(c)
+			i++
+			continue
+		}
+		upper := strings.ToUpper(word)
+		if quoted {
+			upper = "`"
+		}
+		switch {
+		case !quoted && upper == "CHANGE":
+			changeNames = 2
+			out.WriteString(word)
+		case !quoted && upper == "REFERENCES":
+			references = true
+			out.WriteString(word)
+		case !quoted && upper == "AFTER":
+			afterAt = out.Len()
+			out.WriteString(word)
+		case changeNames > 0 && upper != "COLUMN", ddlColumnKeywords[previous] && !references:
+			if changeNames > 0 {
+				changeNames--
+			}
+			rewritten, ok := column(word, quoted)
+			if !ok && previous == "AFTER" && afterAt >= 0 {
+				out.Truncate(afterAt)
+				rewritten, ok = "", true
+			}
+			if !ok {
+				return "", false
+			}
+			out.WriteString(rewritten)
+		case quoted:
+			out.WriteString(quoteMySQL(word))
+		default:
+			out.WriteString(word)
+		}
+		i, previous = j, upper
+	}
+	return strings.TrimSpace(out.String()), true
+}
+
+func mappedDDLColumn(mapping models.FieldMapping, column string) string {
+	if target, ok := mapping[column]; ok && target != "" {
+		return target
+	}
+	for source, target := range mapping {
+		if strings.EqualFold(source, column) && target != "" {
+			return target
+		}
+	}
+	return column
+}
+
+// handleCDCDDL 按任务的 DDL 策略处理映射表上的 DDL，并刷新字段缓存
+func (m *CDCManager) handleCDCDDL(task *models.SyncTask, targetDB *gorm.DB, ddl *cdcDDL, statement string, mappings map[string]*models.SyncTaskTable, columnCache map[string][]string) error {
+	policy, err := normalizeDDLPolicy(task.DDLPolicy)
+	if err != nil {
+		return err
+	}
+	for _, table := range ddl.tables {
+		mapping := mappings[cdcTableKey(table.schema, table.name)]
+		if mapping == nil {
+			continue
+		}
+		delete(columnCache, sourceTableName(mapping))
+		invalidateMySQLColumnCache(sourceTableName(mapping))
+		invalidateMySQLColumnCache(mapping.TargetTable)
+		object := fmt.Sprintf("%s → %s", sourceTableName(mapping), mapping.TargetTable)
+		tablePolicy := policy
+		if tablePolicy == ddlPolicyApply && mapping.PatternID != nil {
+			// 分表共享同一张目标表，单个分片的 DDL 不能直接改目标表
+			tablePolicy = ddlPolicyPause
+		}
+		if tablePolicy == ddlPolicyApply && dialectOf(targetDB).name() != "mysql" {
+			// MySQL DDL 不能直接在其他目标库执行，交由人工处理
+			tablePolicy = ddlPolicyPause
+		}
+		switch tablePolicy {
+		case ddlPolicyIgnore:
+			m.service.RecordTaskEvent(task, "ddl_ignored", "cdc", "success", "源表 DDL 已忽略", object+"\n"+statement, 0, 0)
+		case ddlPolicyPause:
+			m.service.RecordTaskEvent(task, "ddl_paused", "cdc", "failed", "源表 DDL 待人工处理，任务已暂停", object+"\n"+statement, 0, 0)
+			_ = m.service.UpdateTask(task.ID, map[string]interface{}{"runtime_status": "paused", "last_run_status": "paused", "last_run_message": "源表 " + sourceTableName(mapping) + " 发生 DDL，任务已暂停"})
+			content := fmt.Sprintf("CDC 任务因源表 DDL 暂停\n任务：%s\n表：%s\n语句：%s", task.Name, object, statement)
+			_ = NewAlertService().SendTaskAlert(context.Background(), task, "error", content)
+			return errCDCPausedByDDL
+		case ddlPolicyApply:
+			started := time.Now()
+			applied, skipped, err := m.applyCDCDDL(targetDB, ddl.kind, ddl.body, table, mapping, mappings)
+			if err != nil {
+				m.service.RecordTaskEvent(task, "ddl_failed", "cdc", "failed", "源表 DDL 同步到目标库失败", object+"\n"+applied+"\n"+err.Error(), 0, 0)
+				return fmt.Errorf("表 %s DDL 同步失败: %w", sourceTableName(mapping), err)
+			}
+			// 两端结构按同一 DDL 变化，清除结构基线由下次巡检重新建立
+			_ = m.service.systemDB.Where("task_table_id = ?", mapping.ID).Delete(&models.SyncSchemaState{}).Error
+			if len(skipped) > 0 {
+				m.service.RecordTaskEvent(task, "ddl_ignored", "cdc", "success", "源表 DDL 中涉及忽略字段的子句已跳过", object+"\n"+strings.Join(skipped, "\n"), 0, 0)
+			}
+			if applied == "" && len(skipped) > 0 {
+				continue
+			}
+			m.service.RecordTaskEvent(task, "ddl_applied", "cdc", "success", "源表 DDL 已同步到目标库", object+"\n"+applied, 0, time.Since(started).Milliseconds())
+		}
+	}
+	return nil
+}
+
+// applyCDCDDL 把 DDL 改写到目标表后执行，返回实际执行的语句和因忽略字段跳过的子句
+func (m *CDCManager) applyCDCDDL(targetDB *gorm.DB, kind, body string, table cdcDDLTable, mapping *models.SyncTaskTable, mappings map[string]*models.SyncTaskTable) (string, []string, error) {
+	switch kind {
+	case "truncate":
+		statement := "TRUNCATE TABLE " + quoteMySQL(mapping.TargetTable)
+		return statement, nil, targetDB.Exec(statement).Error
+	case "rename":
+		// 目标表与源表同名时一起改名，否则只更新映射的源表名
+		updates := map[string]interface{}{"source_table": table.renameTo}
+		statement := ""
+		if mapping.TargetTable == mapping.SourceTable {
+			statement = "RENAME TABLE " + quoteMySQL(mapping.TargetTable) + " TO " + quoteMySQL(table.renameTo)
+			if err := targetDB.Exec(statement).Error; err != nil {
+				return statement, nil, err
+			}
+			updates["target_table"] = table.renameTo
+		}
+		if err := m.service.systemDB.Model(&models.SyncTaskTable{}).Where("id = ?", mapping.ID).Updates(updates).Error; err != nil {
+			return statement, nil, err
+		}
+		delete(mappings, cdcTableKey(table.schema, table.name))
+		if mapping.TargetTable == mapping.SourceTable {
+			mapping.TargetTable = table.renameTo
+		}
+		mapping.SourceTable = table.renameTo
+		mappings[cdcTableKey(table.schema, table.renameTo)] = mapping
+		return statement, nil, nil
+	default:
+		clauses, skipped := rewriteDDLColumns(body, mapping)
+		if clauses == "" {
+			return "", skipped, nil
+		}
+		statement := "ALTER TABLE " + quoteMySQL(mapping.TargetTable) + " " + clauses
+		return statement, skipped, targetDB.Exec(statement).Error
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestParseCDCDDL(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		kind     string
+		table    string
+		renameTo string
+		body     string
+		ok       bool
+	}{
+		{name: "alter add column", query: "ALTER TABLE `orders` ADD COLUMN `memo` varchar(50)", kind: "alter", table: "orders", body: "ADD COLUMN `memo` varchar(50)", ok: true},
+		{name: "qualified alter", query: "/* tool */ alter table shop.orders drop column memo;", kind: "alter", table: "orders", body: "drop column memo", ok: true},
+		{name: "alter rename", query: "ALTER TABLE orders RENAME TO orders_v2", kind: "rename", table: "orders", renameTo: "orders_v2", ok: true},
+		{name: "alter rename column", query: "ALTER TABLE orders RENAME COLUMN a TO b", kind: "alter", table: "orders", body: "RENAME COLUMN a TO b", ok: true},
+		{name: "rename table", query: "RENAME TABLE `orders` TO `orders_old`, items TO items_old", kind: "rename", table: "orders", renameTo: "orders_old", ok: true},
+		{name: "truncate", query: "TRUNCATE TABLE orders", kind: "truncate", table: "orders", ok: true},
+		{name: "truncate without table keyword", query: "truncate `orders`", kind: "truncate", table: "orders", ok: true},
+		{name: "not ddl", query: "BEGIN", ok: false},
+		{name: "create table ignored", query: "CREATE TABLE t (id int)", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ddl, ok := parseCDCDDL(tt.query, "shop")
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			first := ddl.tables[0]
+			if ddl.kind != tt.kind || first.schema != "shop" || first.name != tt.table || first.renameTo != tt.renameTo || ddl.body != tt.body {
+				t.Fatalf("got %+v %+v", ddl, first)
+			}
+		})
+	}
+}
+
+func TestRewriteDDLColumns(t *testing.T) {
+	mapping := &models.SyncTaskTable{
+		FieldMapping:  models.FieldMapping{"memo": "remark", "date": "biz_date"},
+		IgnoredFields: models.StringList{"secret"},
+	}
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		skipped int
+	}{
+		{name: "add after", body: "ADD COLUMN note varchar(20) AFTER memo", want: "ADD COLUMN note varchar(20) AFTER `remark`"},
+		{name: "modify quoted", body: "MODIFY `memo` varchar(100) COMMENT 'memo'", want: "MODIFY `remark` varchar(100) COMMENT 'memo'"},
+		{name: "type name kept", body: "ADD COLUMN created date", want: "ADD COLUMN created date"},
+		{name: "change column", body: "CHANGE COLUMN date memo datetime", want: "CHANGE COLUMN `biz_date` `remark` datetime"},
+		{name: "index columns", body: "ADD INDEX idx_memo (memo, id)", want: "ADD INDEX idx_memo (`remark`, id)"},
+		{name: "quoted index name kept", body: "ADD INDEX `memo` (`memo`), DROP INDEX `date`", want: "ADD INDEX `memo` (`remark`), DROP INDEX `date`"},
+		{name: "constraint and referenced columns kept", body: "ADD CONSTRAINT `memo` FOREIGN KEY (`memo`) REFERENCES other (`memo`)", want: "ADD CONSTRAINT `memo` FOREIGN KEY (`remark`) REFERENCES other (`memo`)"},
+		{name: "ignored column skipped", body: "ADD COLUMN secret int, ADD COLUMN note int", want: "ADD COLUMN note int", skipped: 1},
+		{name: "only ignored column", body: "DROP COLUMN `secret`", want: "", skipped: 1},
+		{name: "index on ignored column skipped", body: "ADD INDEX idx_secret (secret, id)", want: "", skipped: 1},
+		{name: "after ignored column dropped", body: "ADD COLUMN note int AFTER secret", want: "ADD COLUMN note int"},
+		{name: "comma inside type kept", body: "ADD COLUMN price decimal(10, 2), MODIFY memo enum('a,b', 'c')", want: "ADD COLUMN price decimal(10, 2), MODIFY `remark` enum('a,b', 'c')"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, skipped := rewriteDDLColumns(tt.body, mapping)
+			if got != tt.want || len(skipped) != tt.skipped {
+				t.Fatalf("got %q skipped %v, want %q skipped %d", got, skipped, tt.want, tt.skipped)
+			}
+		})
+	}
+}
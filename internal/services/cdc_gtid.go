@@ -0,0 +1,172 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/redgreat/mergewong/internal/database"
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// mysqlMasterStatus 是 SHOW MASTER STATUS 的一次快照，File/Position 与 GTID 集合属于同一时刻
+type mysqlMasterStatus struct {
+	File            string `gorm:"column:File"`
+	Position        uint32 `gorm:"column:Position"`
+	ExecutedGTIDSet string `gorm:"column:Executed_Gtid_Set"`
+	ServerUUID      string `gorm:"-"`
+}
+
+func currentMySQLMasterStatus(connectionName string) (*mysqlMasterStatus, error) {
+	db, err := database.GetManager().GetConnection(connectionName)
+	if err != nil {
+		return nil, err
+	}
+	return mysqlMasterStatusOf(db)
+}
+
+func mysqlMasterStatusOf(db *gorm.DB) (*mysqlMasterStatus, error) {
+	var status mysqlMasterStatus
+	if err := db.Raw("SHOW MASTER STATUS").Scan(&status).Error; err != nil {
+		return nil, fmt.Errorf("读取 Binlog 位点失败: %w", err)
+	}
+	if status.File == "" {
+		return nil, fmt.Errorf("读取 Binlog 位点失败：源库未返回 Master Status")
+	}
+	status.ExecutedGTIDSet = normalizeGTIDSet(status.ExecutedGTIDSet)
+	status.ServerUUID = mysqlServerUUID(db)
+	if !mysqlGTIDEnabled(db) {
+		status.ExecutedGTIDSet = ""
+	}
+	return &status, nil
+}
+
+func mysqlGTIDEnabled(db *gorm.DB) bool {
+	var variable struct {
+		VariableName string `gorm:"column:Variable_name"`
+		Value        string `gorm:"column:Value"`
+	}
+	if err := db.Raw("SHOW VARIABLES LIKE 'gtid_mode'").Scan(&variable).Error; err != nil {
+		return false
+	}
+	return strings.EqualFold(variable.Value, "ON")
+}
+
+// mysqlServerUUID 读取源库的 server_uuid，读取失败时返回空串
+func mysqlServerUUID(db *gorm.DB) string {
+	var uuid string
+	if err := db.Raw("SELECT @@server_uuid").Row().Scan(&uuid); err != nil {
+		return ""
+	}
+	return uuid
+}
+
+func mysqlGTIDEnabledByName(connectionName string) bool {
+	db, err := database.GetManager().GetConnection(connectionName)
+	if err != nil {
+		return false
+	}
+	return mysqlGTIDEnabled(db)
+}
+
+// normalizeGTIDSet 去掉 SHOW MASTER STATUS 多 UUID 输出中的换行和空白
+func normalizeGTIDSet(value string) string {
+	value = strings.ReplaceAll(value, "\n", "")
+	value = strings.ReplaceAll(value, "\r", "")
+	return strings.ReplaceAll(value, " ", "")
+}
+
+func parseGTIDSet(value string) (*gomysql.MysqlGTIDSet, error) {
+	parsed, err := gomysql.ParseMysqlGTIDSet(normalizeGTIDSet(value))
+	if err != nil {
+		return nil, fmt.Errorf("GTID 集合格式不正确: %w", err)
+	}
+	return parsed.(*gomysql.MysqlGTIDSet), nil
+}
+
+// useGTIDResume 判断检查点是否应按 GTID 恢复：检查点有 GTID 集合且源库开启了 gtid_mode
+func useGTIDResume(task *models.SyncTask, checkpoint *models.SyncCDCCheckpoint) bool {
+	return checkpoint != nil && checkpoint.GTIDSet != "" && mysqlGTIDEnabledByName(task.SourceDB)
+}
+
+// ensureGTIDSetValid 确认源库尚未清理检查点之后需要的事务：gtid_purged 必须是检查点集合的子集
+func (m *CDCManager) ensureGTIDSetValid(task *models.SyncTask, checkpoint *models.SyncCDCCheckpoint) error {
+	sourceDB, err := database.GetManager().GetConnection(task.SourceDB)
+	if err != nil {
+		return err
+	}
+	if _, err := parseGTIDSet(checkpoint.GTIDSet); err != nil {
+		return err
+	}
+	var covered int
+	if err := sourceDB.Raw("SELECT GTID_SUBSET(@@GLOBAL.gtid_purged, ?)", checkpoint.GTIDSet).Row().Scan(&covered); err != nil {
+		return err
+	}
+	if covered != 1 {
+		return fmt.Errorf("源库已清理检查点 GTID 集合之后仍需要的 Binlog")
+	}
+	return nil
+}
+
+// cdcGTIDTracker 在 Binlog 流中累积已执行 GTID 集合，供检查点与文件位点一起持久化。
+// 位点模式启动时没有基线集合，遇到下一个 binlog 文件开头的 PreviousGTIDsEvent 后开始跟踪。
+type cdcGTIDTracker struct {
+	set     *gomysql.MysqlGTIDSet
+	pending string
+}
+
+func newCDCGTIDTracker(initial string) *cdcGTIDTracker {
+	tracker := &cdcGTIDTracker{}
+	if initial != "" {
+		if set, err := parseGTIDSet(initial); err == nil {
+			tracker.set = set
+		}
+	}
+	return tracker
+}
+
+// observePrevious 用 binlog 文件头的 PreviousGTIDsEvent 建立基线
+func (t *cdcGTIDTracker) observePrevious(e *replication.PreviousGTIDsEvent) {
+	if t.set != nil {
+		return
+	}
+	if set, err := parseGTIDSet(e.GTIDSets); err == nil {
+		t.set = set
+		t.pending = ""
+	}
+}
+
+// observe 记录下一个事务的 GTID；上一个事务（包括被忽略的 DDL）此时已经结束，先并入集合
+func (t *cdcGTIDTracker) observe(e *replication.GTIDEvent) {
+	t.flushPending()
+	next, err := e.GTIDNext()
+	if err != nil {
+		return
+	}
+	t.pending = next.String()
+}
+
+// commit 在事务提交点把当前事务并入集合，返回提交后的集合快照
+func (t *cdcGTIDTracker) commit() string {
+	t.flushPending()
+	return t.snapshot()
+}
+
+func (t *cdcGTIDTracker) snapshot() string {
+	if t.set == nil {
+		return ""
+	}
+	return t.set.String()
+}
+
+func (t *cdcGTIDTracker) flushPending() {
+	if t.pending == "" {
+		return
+	}
+	if t.set != nil {
+		_ = t.set.Update(t.pending)
+	}
+	t.pending = ""
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+const (
+	testGTIDSourceA = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	testGTIDSourceB = "9b1c2b6e-2f0a-11ee-8c7a-0242ac120002"
+)
+
+// testGTIDSID 是 testGTIDSourceA 的 16 字节形式
+var testGTIDSID = []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+
+func TestNormalizeGTIDSet(t *testing.T) {
+	tests := []struct{ input, want string }{
+		{input: "", want: ""},
+		{input: testGTIDSourceA + ":1-5", want: testGTIDSourceA + ":1-5"},
+		{input: testGTIDSourceA + ":1-5,\n" + testGTIDSourceB + ":1-3", want: testGTIDSourceA + ":1-5," + testGTIDSourceB + ":1-3"},
+		{input: " " + testGTIDSourceA + ":1-5,\r\n " + testGTIDSourceB + ":7", want: testGTIDSourceA + ":1-5," + testGTIDSourceB + ":7"},
+	}
+	for _, tt := range tests {
+		if got := normalizeGTIDSet(tt.input); got != tt.want {
+			t.Fatalf("%q: got %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseGTIDSet(t *testing.T) {
+	set, err := parseGTIDSet(testGTIDSourceA + ":1-5,\n" + testGTIDSourceB + ":1-3")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(set.Sets) != 2 {
+		t.Fatalf("got %d sources", len(set.Sets))
+	}
+	if _, err := parseGTIDSet("not-a-gtid:1-5"); err == nil {
+		t.Fatalf("invalid uuid should fail")
+	}
+	if _, err := parseGTIDSet(testGTIDSourceA + ":x"); err == nil {
+		t.Fatalf("invalid interval should fail")
+	}
+}
+
+func TestCDCGTIDTracker(t *testing.T) {
+	tracker := newCDCGTIDTracker(testGTIDSourceA + ":1-5")
+	tracker.observe(&replication.GTIDEvent{SID: testGTIDSID, GNO: 6})
+	if got := tracker.snapshot(); got != testGTIDSourceA+":1-5" {
+		t.Fatalf("pending transaction merged before commit: %s", got)
+	}
+	if got := tracker.commit(); got != testGTIDSourceA+":1-6" {
+		t.Fatalf("commit: got %s", got)
+	}
+	if got := tracker.commit(); got != testGTIDSourceA+":1-6" {
+		t.Fatalf("repeated commit: got %s", got)
+	}
+
+	// 被忽略的事务（如 DDL）没有提交点，下一个 GTID 到来时并入
+	tracker.observe(&replication.GTIDEvent{SID: testGTIDSID, GNO: 7})
+	tracker.observe(&replication.GTIDEvent{SID: testGTIDSID, GNO: 8})
+	if got := tracker.snapshot(); got != testGTIDSourceA+":1-7" {
+		t.Fatalf("previous transaction not flushed: %s", got)
+	}
+	tracker.flushPending()
+	if got := tracker.snapshot(); got != testGTIDSourceA+":1-8" {
+		t.Fatalf("flushPending: got %s", got)
+	}
+	if tracker.pending != "" {
+		t.Fatalf("pending not cleared: %s", tracker.pending)
+	}
+}
+
+func TestCDCGTIDTrackerWithoutBaseline(t *testing.T) {
+	tracker := newCDCGTIDTracker("")
+	tracker.observe(&replication.GTIDEvent{SID: testGTIDSID, GNO: 3})
+	if got := tracker.commit(); got != "" {
+		t.Fatalf("tracker without baseline should stay empty: %s", got)
+	}
+
+	// 下一个 binlog 文件头的 PreviousGTIDsEvent 建立基线，之后开始累积
+	tracker.observePrevious(&replication.PreviousGTIDsEvent{GTIDSets: testGTIDSourceA + ":1-10"})
+	tracker.observePrevious(&replication.PreviousGTIDsEvent{GTIDSets: testGTIDSourceA + ":1-20"})
+	if got := tracker.snapshot(); got != testGTIDSourceA+":1-10" {
+		t.Fatalf("baseline: got %s", got)
+	}
+	tracker.observe(&replication.GTIDEvent{SID: testGTIDSID, GNO: 11})
+	if got := tracker.commit(); got != testGTIDSourceA+":1-11" {
+		t.Fatalf("commit after baseline: got %s", got)
+	}
+
+	if invalid := newCDCGTIDTracker("garbage"); invalid.snapshot() != "" {
+		t.Fatalf("invalid initial set should be ignored")
+	}
+}
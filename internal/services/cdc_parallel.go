@@ -0,0 +1,94 @@
+package services
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// CDC 并行写入：任务开启后，每次写入的一批操作按（目标表，行标识哈希）分到多个分区并发写入，
+// 同一行的变更始终落在同一分区并保持原顺序。并行只发生在一批之内，读取不与写入流水：所有分区提交后才返回、
+// 继续读取下一批，检查点只推进到整批都已提交的位点，吞吐受最慢分区限制，批次越大并行收益越明显；
+// XA 和 DDL 处理前会先提交之前的缓冲，天然成为屏障。
+// 部分分区失败时整批从检查点重放，已提交的分区会再写一次：覆盖写入可以重复执行，
+// 而无键表和历史表每次写入都追加新行，批次中含这类表时不并行，按原顺序串行写入。
+// 不同行之间通过唯一索引相互依赖（如交换唯一值）时并发写入可能冲突，这类表不宜开启。
+
+func cdcApplyWorkers(task *models.SyncTask) int {
+	if task != nil && task.CDCApplyWorkers > 1 {
+		return task.CDCApplyWorkers
+	}
+	return 1
+}
+
+// cdcParallelSafe 判断一批操作能否并行写入：重放会产生重复行的表不参与并行
+func cdcParallelSafe(operations []cdcOperation) bool {
+	for _, op := range operations {
+		if keylessRowIdentity(op.mapping) || writesHistory(op.mapping) {
+			return false
+		}
+	}
+	return true
+}
+
+// partitionCDCOperations 按目标表和行标识值把操作分到固定数量的分区
+func partitionCDCOperations(operations []cdcOperation, workers int) [][]cdcOperation {
+	partitions := make([][]cdcOperation, workers)
+	for _, op := range operations {
+		index := cdcPartitionHash(op) % uint32(workers)
+		partitions[index] = append(partitions[index], op)
+	}
+	return partitions
+}
+
+func cdcPartitionHash(op cdcOperation) uint32 {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(op.mapping.TargetTable))
+	if keylessRowIdentity(op.mapping) || writesHistory(op.mapping) {
+		return hash.Sum32()
+	}
+	for _, key := range primaryKeyColumns(op.mapping.SourcePrimaryKey) {
+		for i, column := range op.columns {
+			if column == key && i < len(op.values) {
+				_, _ = hash.Write([]byte{0})
+				_, _ = hash.Write([]byte(valueString(normalizeMySQLScannedValue(op.values[i]))))
+				break
+			}
+		}
+	}
+	return hash.Sum32()
+}
+
+// applyCDCPartitions 并发写入各分区，等待全部完成后汇总一次任务进度，返回第一个错误
+func applyCDCPartitions(db *gorm.DB, partitions [][]cdcOperation, task *models.SyncTask, systemDB *gorm.DB, streamStarted time.Time) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(partitions))
+	started := time.Now()
+	for i, operations := range partitions {
+		if len(operations) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, operations []cdcOperation) {
+			defer wg.Done()
+			errs[i] = writeCDCOperations(db, operations, task, systemDB, nil)
+		}(i, operations)
+	}
+	wg.Wait()
+	committed := 0
+	var firstErr error
+	for i, err := range errs {
+		if err == nil {
+			committed += len(partitions[i])
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if committed > 0 && task != nil && systemDB != nil && !streamStarted.IsZero() {
+		applyCDCProgress(systemDB, task.ID, committed, time.Since(started), streamStarted, committed)
+	}
+	return firstErr
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestPartitionCDCOperations(t *testing.T) {
+	keyed := &models.SyncTaskTable{TargetTable: "orders", SourcePrimaryKey: "id", RowIdentity: rowIdentityPrimaryKey}
+	keyless := &models.SyncTaskTable{TargetTable: "logs", RowIdentity: rowIdentityAppendOnly}
+	var operations []cdcOperation
+	for round := 0; round < 3; round++ {
+		for id := int64(1); id <= 20; id++ {
+			operations = append(operations, cdcOperation{kind: "upsert", mapping: keyed, columns: []string{"id", "round"}, values: []interface{}{id, round}})
+			operations = append(operations, cdcOperation{kind: "upsert", mapping: keyless, columns: []string{"id", "round"}, values: []interface{}{id, round}})
+		}
+	}
+	partitions := partitionCDCOperations(operations, 4)
+	used, keylessPartitions := 0, 0
+	rowPartition := map[interface{}]int{}
+	for index, partition := range partitions {
+		if len(partition) > 0 {
+			used++
+		}
+		lastRound := map[interface{}]int{}
+		hasKeyless := false
+		for _, op := range partition {
+			if op.mapping == keyless {
+				hasKeyless = true
+				continue
+			}
+			id, round := op.values[0], op.values[1].(int)
+			if previous, ok := rowPartition[id]; ok && previous != index {
+				t.Fatalf("row %v split across partitions %d and %d", id, previous, index)
+			}
+			rowPartition[id] = index
+			if last, ok := lastRound[id]; ok && last > round {
+				t.Fatalf("row %v out of order in partition %d", id, index)
+			}
+			lastRound[id] = round
+		}
+		if hasKeyless {
+			keylessPartitions++
+		}
+	}
+	if used < 2 || keylessPartitions != 1 {
+		t.Fatalf("used %d partitions, keyless table in %d partitions", used, keylessPartitions)
+	}
+	if cdcApplyWorkers(nil) != 1 || cdcApplyWorkers(&models.SyncTask{CDCApplyWorkers: 4}) != 4 {
+		t.Fatalf("unexpected worker count")
+	}
+}
+
+func TestCDCParallelSafe(t *testing.T) {
+	keyed := &models.SyncTaskTable{TargetTable: "orders", SourcePrimaryKey: "id", RowIdentity: rowIdentityPrimaryKey, WriteMode: writeModeUpsert}
+	history := &models.SyncTaskTable{TargetTable: "orders_history", SourcePrimaryKey: "id", RowIdentity: rowIdentityPrimaryKey, WriteMode: writeModeHistory}
+	keyless := &models.SyncTaskTable{TargetTable: "logs", RowIdentity: rowIdentityAppendOnly}
+	tests := []struct {
+		name     string
+		mappings []*models.SyncTaskTable
+		want     bool
+	}{
+		{name: "upsert only", mappings: []*models.SyncTaskTable{keyed, keyed}, want: true},
+		{name: "with history table", mappings: []*models.SyncTaskTable{keyed, history}},
+		{name: "with append-only table", mappings: []*models.SyncTaskTable{keyless, keyed}},
+	}
+	for _, tt := range tests {
+		operations := make([]cdcOperation, 0, len(tt.mappings))
+		for _, mapping := range tt.mappings {
+			operations = append(operations, cdcOperation{kind: "upsert", mapping: mapping})
+		}
+		if got := cdcParallelSafe(operations); got != tt.want {
+			t.Fatalf("%s: cdcParallelSafe = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
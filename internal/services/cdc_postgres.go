@@ -0,0 +1,553 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/redgreat/mergewong/internal/database"
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// PostgreSQL 源通过逻辑复制（pgoutput）做增量同步：每个任务独占一个同名的复制槽和发布，
+// 检查点记录已写入目标库的提交 LSN，行变更转换成与 Binlog 相同的操作后走同一条目标写入链路。
+
+const pgStandbyStatusInterval = 10 * time.Second
+
+// postgresReplicationName 是任务的复制槽和发布名称
+func postgresReplicationName(taskID uint) string {
+	return fmt.Sprintf("mergewong_task_%d", taskID)
+}
+
+// ensurePostgresPublication 让发布恰好包含任务的源表
+func ensurePostgresPublication(db *gorm.DB, task *models.SyncTask) error {
+	if len(task.TaskTables) == 0 {
+		return fmt.Errorf("任务没有同步表")
+	}
+	dialect := dialectOf(db)
+	tables := make([]string, len(task.TaskTables))
+	for i := range task.TaskTables {
+		tables[i] = dialect.quoteTable(sourceTableName(&task.TaskTables[i]))
+	}
+	name := postgresReplicationName(task.ID)
+	var count int64
+	if err := db.Raw("SELECT count(*) FROM pg_publication WHERE pubname = ?", name).Scan(&count).Error; err != nil {
+		return err
+	}
+	statement := "CREATE PUBLICATION " + dialect.quote(name) + " FOR TABLE " + strings.Join(tables, ", ")
+	if count > 0 {
+		statement = "ALTER PUBLICATION " + dialect.quote(name) + " SET TABLE " + strings.Join(tables, ", ")
+	}
+	return db.Exec(statement).Error
+}
+
+// ensurePostgresSlot 返回复制槽已确认的 LSN，槽不存在时创建并返回创建位置
+func ensurePostgresSlot(db *gorm.DB, name string) (string, bool, error) {
+	var slots []string
+	if err := db.Raw("SELECT COALESCE(confirmed_flush_lsn, restart_lsn)::text FROM pg_replication_slots WHERE slot_name = ?", name).Scan(&slots).Error; err != nil {
+		return "", false, err
+	}
+	if len(slots) > 0 {
+		return slots[0], false, nil
+	}
+	var lsn string
+	if err := db.Raw("SELECT lsn::text FROM pg_create_logical_replication_slot(?, 'pgoutput')", name).Scan(&lsn).Error; err != nil {
+		return "", false, err
+	}
+	return lsn, true, nil
+}
+
+// dropPostgresReplication 删除任务的复制槽和发布，避免源库为已删除的任务保留 WAL
+func dropPostgresReplication(connectionName string, taskID uint) error {
+	db, err := database.GetManager().GetConnection(connectionName)
+	if err != nil {
+		return err
+	}
+	name := postgresReplicationName(taskID)
+	if err := db.Exec("SELECT pg_drop_replication_slot(slot_name) FROM pg_replication_slots WHERE slot_name = ?", name).Error; err != nil {
+		return err
+	}
+	return db.Exec("DROP PUBLICATION IF EXISTS " + dialectOf(db).quote(name)).Error
+}
+
+// loadOrCreatePostgresCheckpoint 每次启动都校正发布和复制槽；已有检查点而槽丢失时，槽保留的 WAL 已无法找回，按缺口处理
+func (m *CDCManager) loadOrCreatePostgresCheckpoint(task *models.SyncTask) (*models.SyncCDCCheckpoint, error) {
+	sourceDB, err := database.GetManager().GetConnection(task.SourceDB)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensurePostgresPublication(sourceDB, task); err != nil {
+		return nil, fmt.Errorf("创建发布失败: %w", err)
+	}
+	lsn, created, err := ensurePostgresSlot(sourceDB, postgresReplicationName(task.ID))
+	if err != nil {
+		return nil, fmt.Errorf("创建复制槽失败: %w", err)
+	}
+	var checkpoint models.SyncCDCCheckpoint
+	err = m.service.systemDB.Where("task_id = ?", task.ID).First(&checkpoint).Error
+	if err == nil {
+		if created && checkpoint.LSN != "" {
+			if err := m.recoverPostgresSlotLoss(sourceDB, task, &checkpoint, lsn); err != nil {
+				return nil, err
+			}
+		} else if checkpoint.LSN == "" {
+			checkpoint.LSN = lsn
+			if err := m.service.systemDB.Model(&checkpoint).Updates(map[string]interface{}{"lsn": lsn, "last_event_at": nil}).Error; err != nil {
+				return nil, err
+			}
+		}
+		return &checkpoint, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	checkpoint = models.SyncCDCCheckpoint{TaskID: task.ID, LSN: lsn, SnapshotCompleted: true}
+	log.Printf("任务 %d 首次进入 CDC，已创建复制槽 %s，从 %s 开始追数", task.ID, postgresReplicationName(task.ID), lsn)
+	if err := m.service.systemDB.Create(&checkpoint).Error; err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// recoverPostgresSlotLoss 处理检查点存在但复制槽丢失的情况。fail 策略删除刚重建的槽，下次启动仍按缺口处理，任务停止并预警；
+// PostgreSQL 源不支持全量初始化，其他策略从新槽的当前位置继续，任务标记为可能不一致并预警
+func (m *CDCManager) recoverPostgresSlotLoss(sourceDB *gorm.DB, task *models.SyncTask, checkpoint *models.SyncCDCCheckpoint, lsn string) error {
+	name := postgresReplicationName(task.ID)
+	old := cdcCheckpointLabel(checkpoint)
+	policy, _ := normalizeBinlogPurgePolicy(task.BinlogPurgePolicy)
+	if policy == binlogPurgePolicyFail {
+		if err := sourceDB.Exec("SELECT pg_drop_replication_slot(?)", name).Error; err != nil {
+			log.Printf("任务 %d 删除重建的复制槽 %s 失败: %v", task.ID, name, err)
+		}
+		m.service.RecordTaskEvent(task, "replication_slot_lost", "cdc", "failed", "复制槽丢失，检查点之后的变更无法读取，任务已停止", "位点 "+old, 0, 0)
+		return fmt.Errorf("复制槽 %s 丢失，检查点 %s 之后的变更无法读取，按恢复策略停止同步，请人工确认后重新初始化", name, old)
+	}
+	checkpoint.LSN = lsn
+	if err := m.service.systemDB.Model(checkpoint).Updates(map[string]interface{}{"lsn": lsn, "last_event_at": nil}).Error; err != nil {
+		return err
+	}
+	_ = m.service.UpdateTask(task.ID, map[string]interface{}{"possibly_inconsistent": true})
+	task.PossiblyInconsistent = true
+	detail := fmt.Sprintf("原 %s → 新 %s", old, cdcCheckpointLabel(checkpoint))
+	m.service.RecordTaskEvent(task, "checkpoint_reset", "cdc", "running", "复制槽丢失，已重新创建并从当前位置继续，期间变更可能缺失", detail, 0, 0)
+	content := fmt.Sprintf("CDC 复制槽丢失，已从当前位置继续，数据可能不一致\n任务：%s\n%s", task.Name, detail)
+	_ = NewAlertService().SendTaskAlert(context.Background(), task, "error", content)
+	return nil
+}
+
+// pgConnValue 引用 keyword/value 连接串中的值
+func pgConnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+func connectPostgresReplication(ctx context.Context, source *models.DatabaseConnection) (*pgconn.PgConn, error) {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable replication=database",
+		pgConnValue(source.Host), source.Port, pgConnValue(source.Username), pgConnValue(source.Password), pgConnValue(source.Database))
+	config, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	config.Fallbacks = nil
+	return pgconn.ConnectConfig(ctx, config)
+}
+
+func startPostgresReplication(ctx context.Context, conn *pgconn.PgConn, name string, start pgLSN) error {
+	query := fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL %s (proto_version '1', publication_names '%s')", quoteIdentifier("postgres", name), start, name)
+	conn.Frontend().Send(&pgproto3.Query{String: query})
+	if err := conn.Frontend().Flush(); err != nil {
+		return err
+	}
+	for {
+		message, err := conn.ReceiveMessage(ctx)
+		if err != nil {
+			return err
+		}
+		switch message := message.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(message)
+		}
+	}
+}
+
+func sendPostgresStandbyStatus(conn *pgconn.PgConn, flushed pgLSN) error {
+	conn.Frontend().Send(&pgproto3.CopyData{Data: pgStandbyStatus(flushed, time.Now())})
+	return conn.Frontend().Flush()
+}
+
+func (m *CDCManager) streamPostgres(ctx context.Context, task *models.SyncTask, source *models.DatabaseConnection, checkpoint *models.SyncCDCCheckpoint) error {
+	start, err := parsePGLSN(checkpoint.LSN)
+	if err != nil {
+		return err
+	}
+	sourceDB, err := database.GetManager().GetConnection(task.SourceDB)
+	if err != nil {
+		return err
+	}
+	targetDB, err := database.GetManager().GetConnection(task.TargetDB)
+	if err != nil {
+		return err
+	}
+	var schema string
+	if err := sourceDB.Raw("SELECT current_schema()").Scan(&schema).Error; err != nil {
+		return err
+	}
+	mappings := map[string]*models.SyncTaskTable{}
+	for i := range task.TaskTables {
+		if task.TaskTables[i].SyncState == "active" {
+			if err := resolveRowFilterTypes(task.SourceDB, &task.TaskTables[i]); err != nil {
+				return err
+			}
+			mappings[cdcMappingKey(&task.TaskTables[i], schema)] = &task.TaskTables[i]
+		}
+	}
+	conn, err := connectPostgresReplication(ctx, source)
+	if err != nil {
+		return fmt.Errorf("建立逻辑复制连接失败: %w", err)
+	}
+	defer conn.Close(context.Background())
+	if err := startPostgresReplication(ctx, conn, postgresReplicationName(task.ID), start); err != nil {
+		return fmt.Errorf("启动逻辑复制失败: %w", err)
+	}
+
+	relations := map[uint32]*pgRelation{}
+	// operations 是进行中的源事务，batch 是已提交待写入的若干小事务
+	var operations, batch []cdcOperation
+	var batchLSN pgLSN
+	var batchTime, batchStarted time.Time
+	inTransaction := false
+	// pauseErr 记录事务内 TRUNCATE 触发的暂停，等该事务提交并落检查点后再退出，恢复时不会重复处理
+	var pauseErr error
+	acknowledged := start
+	streamStarted := time.Now()
+	lastStatus := time.Time{}
+	lastMetricsUpdate := time.Time{}
+	lastMetricsLog := time.Time{}
+	lastMetricsRows := int64(0)
+	lastMetricsOps := cdcOperationMetrics{}
+	var sessionRows int64
+	var opMetrics cdcOperationMetrics
+	_ = m.service.UpdateTask(task.ID, map[string]interface{}{"runtime_status": "catching_up", "phase_started_at": &streamStarted, "last_run_message": "增量追数中"})
+	startTitle := "逻辑复制增量同步开始"
+	if task.RowsProcessed > 0 {
+		startTitle = "逻辑复制增量同步继续"
+	}
+	m.service.RecordTaskEvent(task, "cdc_started", "cdc", "running", startTitle, "起始位点 "+cdcCheckpointLabel(checkpoint), 0, 0)
+
+	flush := func() error {
+		if err := applyCDCTransaction(targetDB, batch, task, m.service.systemDB, streamStarted); err != nil {
+			return err
+		}
+		sessionRows += int64(len(batch))
+		batch = batch[:0]
+		if err := m.advancePostgresCheckpoint(task, checkpoint, batchLSN, sessionRows, streamStarted, batchTime, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+			return err
+		}
+		// 已写入目标库的位置才回报给源库，之前的 WAL 可被回收
+		acknowledged = batchLSN
+		return nil
+	}
+	for {
+		if len(batch) > 0 && time.Since(batchStarted) >= cdcMergeMaxWait {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if time.Since(lastStatus) >= pgStandbyStatusInterval {
+			if err := sendPostgresStandbyStatus(conn, acknowledged); err != nil {
+				return err
+			}
+			lastStatus = time.Now()
+		}
+		receiveCtx, cancel := context.WithTimeout(ctx, time.Second)
+		message, err := conn.ReceiveMessage(receiveCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if pgconn.Timeout(err) {
+				continue
+			}
+			return err
+		}
+		var data []byte
+		switch message := message.(type) {
+		case *pgproto3.CopyData:
+			data = message.Data
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(message)
+		default:
+			continue
+		}
+		copyData, err := parsePGCopyData(data)
+		if err != nil {
+			return err
+		}
+		if keepalive, ok := copyData.(*pgKeepalive); ok {
+			// 空闲时源库之前的变更都已处理，可以直接确认到 walEnd，避免无关表的 WAL 堆积
+			if !inTransaction && len(batch) == 0 && keepalive.walEnd > acknowledged {
+				acknowledged = keepalive.walEnd
+			}
+			if keepalive.replyRequested {
+				lastStatus = time.Time{}
+			}
+			continue
+		}
+		xlog := copyData.(*pgXLogData)
+		decoded, err := parsePGOutput(xlog.data, relations)
+		if err != nil {
+			return err
+		}
+		switch msg := decoded.(type) {
+		case *pgBegin:
+			inTransaction = true
+		case *pgCommit:
+			inTransaction = false
+			if len(batch) == 0 {
+				batchStarted = time.Now()
+			}
+			batch = append(batch, operations...)
+			operations = operations[:0]
+			batchLSN, batchTime = msg.endLSN, msg.commitTime
+			if pauseErr != nil {
+				lastMetricsUpdate = time.Time{}
+				if err := flush(); err != nil {
+					return err
+				}
+				return pauseErr
+			}
+			if len(batch) >= cdcMaxBatchRows(task) || time.Since(batchStarted) >= cdcMergeMaxWait || len(batch) == 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case *pgInsert:
+			relation, mapping := relations[msg.relationID], postgresMapping(mappings, relations, msg.relationID)
+			if mapping == nil {
+				continue
+			}
+			start := len(operations)
+			operations = appendCDCRowsOperations(operations, replication.WRITE_ROWS_EVENTv2, mapping, relation.columnNames(), [][]interface{}{msg.tuple.values}, &opMetrics)
+			tagCDCPosition(operations[start:], xlog.walStart.String())
+		case *pgUpdate:
+			relation, mapping := relations[msg.relationID], postgresMapping(mappings, relations, msg.relationID)
+			if mapping == nil {
+				continue
+			}
+			var old *pgTuple
+			if msg.oldFull {
+				old = msg.old
+			}
+			found, err := fillPostgresUnchanged(sourceDB, mapping, relation, msg.tuple, old)
+			if err != nil {
+				return err
+			}
+			if !found {
+				// 源行已被后续事务删除，随后的 DELETE 会清理目标行
+				continue
+			}
+			before := msg.tuple
+			if msg.old != nil {
+				before = msg.old
+			}
+			start := len(operations)
+			operations = appendCDCRowsOperations(operations, replication.UPDATE_ROWS_EVENTv2, mapping, relation.columnNames(), [][]interface{}{before.values, msg.tuple.values}, &opMetrics)
+			tagCDCPosition(operations[start:], xlog.walStart.String())
+		case *pgDelete:
+			relation, mapping := relations[msg.relationID], postgresMapping(mappings, relations, msg.relationID)
+			if mapping == nil {
+				continue
+			}
+			start := len(operations)
+			operations = appendCDCRowsOperations(operations, replication.DELETE_ROWS_EVENTv2, mapping, relation.columnNames(), [][]interface{}{msg.old.values}, &opMetrics)
+			tagCDCPosition(operations[start:], xlog.walStart.String())
+		case *pgTruncate:
+			// TRUNCATE 与 Binlog 中的同名 DDL 一样按任务 DDL 策略处理
+			for _, id := range msg.relationIDs {
+				relation := relations[id]
+				if relation == nil || postgresMapping(mappings, relations, id) == nil {
+					continue
+				}
+				if len(batch) > 0 {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+				if err := applyCDCTransaction(targetDB, operations, task, m.service.systemDB, streamStarted); err != nil {
+					return err
+				}
+				operations = operations[:0]
+				ddl := &cdcDDL{kind: "truncate", tables: []cdcDDLTable{{schema: relation.namespace, name: relation.name}}}
+				statement := "TRUNCATE TABLE " + dialectOf(sourceDB).quoteTable(relation.namespace+"."+relation.name)
+				if err := m.handleCDCDDL(task, targetDB, ddl, statement, mappings, map[string][]string{}); errors.Is(err, errCDCPausedByDDL) {
+					pauseErr = err
+				} else if err != nil {
+					return err
+				}
+			}
+		}
+		// 内存保护：进行中的事务超过 100000 行时提前拆单写入，upsert 幂等保证最终一致性
+		if len(operations) >= 100000 {
+			log.Printf("[CDC] 任务 %d 内存保护触发: 缓存 %d 行，提前写入", task.ID, len(operations))
+			if len(batch) > 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			if err := applyCDCTransaction(targetDB, operations, task, m.service.systemDB, streamStarted); err != nil {
+				return err
+			}
+			operations = operations[:0]
+		}
+	}
+}
+
+func postgresMapping(mappings map[string]*models.SyncTaskTable, relations map[uint32]*pgRelation, relationID uint32) *models.SyncTaskTable {
+	relation := relations[relationID]
+	if relation == nil {
+		return nil
+	}
+	return mappings[cdcTableKey(relation.namespace, relation.name)]
+}
+
+// fillPostgresUnchanged 补齐更新消息中未传输的 TOAST 列：优先取旧行，否则按行标识回源查询；源行已不存在时返回 false
+func fillPostgresUnchanged(db *gorm.DB, mapping *models.SyncTaskTable, relation *pgRelation, tuple, old *pgTuple) (bool, error) {
+	missing := []int{}
+	for i, unchanged := range tuple.unchanged {
+		if !unchanged {
+			continue
+		}
+		if old != nil && !old.unchanged[i] {
+			tuple.values[i], tuple.unchanged[i] = old.values[i], false
+			continue
+		}
+		missing = append(missing, i)
+	}
+	if len(missing) == 0 {
+		return true, nil
+	}
+	keys := primaryKeyColumns(mapping.SourcePrimaryKey)
+	if len(keys) == 0 {
+		return false, fmt.Errorf("表 %s 无行标识，无法补齐未变化的大字段，请将 REPLICA IDENTITY 设为 FULL", sourceTableName(mapping))
+	}
+	dialect := dialectOf(db)
+	columns := make([]string, len(missing))
+	for i, index := range missing {
+		columns[i] = dialect.quote(relation.columns[index].name)
+	}
+	conditions := make([]string, len(keys))
+	args := make([]interface{}, len(keys))
+	for k, key := range keys {
+		conditions[k] = dialect.quote(key) + " = ?"
+		for i, column := range relation.columns {
+			if column.name == key {
+				args[k] = tuple.values[i]
+			}
+		}
+	}
+	rows, err := db.Raw("SELECT "+strings.Join(columns, ", ")+" FROM "+dialect.quoteTable(sourceTableName(mapping))+" WHERE "+strings.Join(conditions, " AND "), args...).Rows()
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	values := make([]interface{}, len(missing))
+	pointers := make([]interface{}, len(missing))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return false, err
+	}
+	for i, index := range missing {
+		tuple.values[index], tuple.unchanged[index] = values[i], false
+	}
+	return true, nil
+}
+
+// advancePostgresCheckpoint 与 advanceCheckpoint 相同，但记录 LSN
+func (m *CDCManager) advancePostgresCheckpoint(task *models.SyncTask, checkpoint *models.SyncCDCCheckpoint, lsn pgLSN, sessionRows int64, started, eventTime time.Time, lastMetricsUpdate, lastMetricsLog *time.Time, lastMetricsRows *int64, lastMetricsOps *cdcOperationMetrics, opMetrics cdcOperationMetrics) error {
+	now := time.Now()
+	if !lastMetricsUpdate.IsZero() && now.Sub(*lastMetricsUpdate) < 3*time.Second {
+		return nil
+	}
+	*lastMetricsUpdate = now
+	checkpoint.LSN, checkpoint.LastEventAt = lsn.String(), &now
+	if err := m.service.systemDB.Model(checkpoint).Updates(map[string]interface{}{"lsn": checkpoint.LSN, "last_event_at": &now}).Error; err != nil {
+		return err
+	}
+	return m.reportCDCProgress(task, now, "LSN "+checkpoint.LSN, eventTime, sessionRows, started, lastMetricsLog, lastMetricsRows, lastMetricsOps, opMetrics)
+}
+
+// precheckPostgresSource 检查逻辑复制的前置条件，对应 MySQL 源的 Binlog 格式和权限检查
+func precheckPostgresSource(db *gorm.DB, add func(level, object, message string)) {
+	var walLevel string
+	if err := db.Raw("SHOW wal_level").Scan(&walLevel).Error; err != nil || walLevel != "logical" {
+		add("error", "WAL", "源库 wal_level 必须为 logical")
+	} else {
+		add("success", "WAL", "wal_level 为 logical")
+	}
+	var privileged bool
+	if err := db.Raw("SELECT rolreplication OR rolsuper FROM pg_roles WHERE rolname = current_user").Scan(&privileged).Error; err != nil || !privileged {
+		add("error", "源端权限", "CDC 账号需要 REPLICATION 属性才能创建复制槽和读取逻辑复制流")
+	} else {
+		add("success", "源端权限", "账号具备 REPLICATION 属性")
+	}
+	var freeSlots int64
+	if err := db.Raw("SELECT current_setting('max_replication_slots')::int - (SELECT count(*) FROM pg_replication_slots)").Scan(&freeSlots).Error; err == nil && freeSlots <= 0 {
+		add("warning", "复制槽", "max_replication_slots 已用尽，首次启动时将无法创建复制槽")
+	}
+	add("warning", "发布", "任务启动时会创建发布，账号需为同步表的属主；删除任务时会一并删除复制槽和发布，停止的任务会让源库保留 WAL")
+}
+
+// postgresReplicaIdentity 检查源表的 REPLICA IDENTITY 能否提供行标识所需的旧行数据
+func postgresReplicaIdentity(db *gorm.DB, mapping *models.SyncTaskTable) error {
+	var identity struct {
+		Mode          string
+		IdentityIndex string
+		HasPrimary    bool
+	}
+	err := db.Raw(`SELECT c.relreplident AS mode,
+		COALESCE((SELECT i.indexrelid::regclass::text FROM pg_index i WHERE i.indrelid = c.oid AND i.indisreplident), '') AS identity_index,
+		EXISTS (SELECT 1 FROM pg_index i WHERE i.indrelid = c.oid AND i.indisprimary) AS has_primary
+		FROM pg_class c WHERE c.oid = to_regclass(?)`, sourceTableName(mapping)).Scan(&identity).Error
+	if err != nil {
+		return fmt.Errorf("读取 REPLICA IDENTITY 失败: %w", err)
+	}
+	if identity.Mode == "d" && !identity.HasPrimary {
+		// 没有主键时 DEFAULT 等同于 NOTHING
+		identity.Mode = "n"
+	}
+	if identity.Mode == "f" {
+		return nil
+	}
+	switch mapping.RowIdentity {
+	case rowIdentityFullRow:
+		return fmt.Errorf("整行匹配删除模式要求源表 REPLICA IDENTITY FULL")
+	case rowIdentityUniqueIndex:
+		index := identity.IdentityIndex[strings.LastIndex(identity.IdentityIndex, ".")+1:]
+		if identity.Mode != "i" || strings.Trim(index, `"`) != mapping.IdentityIndex {
+			return fmt.Errorf("源表 REPLICA IDENTITY 必须设为 USING INDEX %s 或 FULL", mapping.IdentityIndex)
+		}
+	case rowIdentityAppendOnly:
+		if identity.Mode == "n" {
+			return fmt.Errorf("源表没有可用的 REPLICA IDENTITY，加入发布后源端 UPDATE/DELETE 会报错，请添加主键或设为 FULL")
+		}
+	default:
+		if identity.Mode != "d" {
+			return fmt.Errorf("源表 REPLICA IDENTITY 必须为 DEFAULT（主键）或 FULL")
+		}
+	}
+	return nil
+}
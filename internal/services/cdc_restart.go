@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+// 服务启动时自动恢复上次仍在运行（catching_up/cdc_running/retrying）的 CDC 任务。恢复前先按检查点清理 XA 缓存残留：
+// 已提交且位点不晚于检查点的缓存直接删除；PREPARE 位点晚于检查点的缓存也删除，重放 Binlog 时会重新写入；
+// 其余为尚未提交或提交需重放的事务，保留。检查点位点的有效性由 StartTask 校验。
+// 同一源连接上的任务按间隔依次启动，避免重启后同时向源库发起大量 Binlog 订阅。多实例部署时由先取得 run 租约的实例恢复。
+
+var cdcResumeRuntimeStatuses = []string{"catching_up", "cdc_running", "retrying"}
+
+func (m *CDCManager) StartAll() {
+	var tasks []models.SyncTask
+	if err := m.service.systemDB.Select("id, source_db").
+		Where("status = ? AND validation_status = ? AND sync_type IN ? AND runtime_status IN ?", 1, "passed", []string{"cdc", "full_cdc"}, cdcResumeRuntimeStatuses).
+		Order("id").Find(&tasks).Error; err != nil {
+		log.Printf("加载待恢复的 CDC 任务失败: %v", err)
+		return
+	}
+	if len(tasks) == 0 {
+		log.Println("CDC Manager 已就绪，没有需要自动恢复的任务")
+		return
+	}
+	stagger := time.Duration(envPositiveInt("MERGEWONG_CDC_RESTART_STAGGER_SECONDS", 5)) * time.Second
+	delays := cdcRestartDelays(tasks, stagger)
+	log.Printf("CDC Manager 已就绪，%d 个任务将自动恢复", len(tasks))
+	for _, task := range tasks {
+		m.resuming.Store(task.ID, true)
+		go func(taskID uint, delay time.Duration) {
+			defer m.resuming.Delete(taskID)
+			time.Sleep(delay)
+			m.resumeCDCTask(taskID, "服务启动后自动恢复 CDC 同步")
+		}(task.ID, delays[task.ID])
+	}
+}
+
+// cdcRestartDelays 按源连接分组，同一源上的任务依次错开 stagger 启动，不同源之间互不等待
+func cdcRestartDelays(tasks []models.SyncTask, stagger time.Duration) map[uint]time.Duration {
+	delays := make(map[uint]time.Duration, len(tasks))
+	perSource := map[string]int{}
+	for _, task := range tasks {
+		delays[task.ID] = time.Duration(perSource[task.SourceDB]) * stagger
+		perSource[task.SourceDB]++
+	}
+	return delays
+}
+
+// resumeCDCTask 恢复上次仍在运行的 CDC 任务，message 记入恢复事件；先取得 run 租约，避免多个实例同时清理 XA 缓存
+func (m *CDCManager) resumeCDCTask(taskID uint, message string) {
+	task, err := m.service.GetTask(taskID)
+	if err != nil {
+		log.Printf("CDC 任务 %d 自动恢复失败(获取任务): %v", taskID, err)
+		return
+	}
+	// 等待期间任务可能已被手动启动或暂停
+	if m.IsRunning(taskID) || !containsString(cdcResumeRuntimeStatuses, task.RuntimeStatus) {
+		return
+	}
+	if err := acquireTaskLease(taskID, taskLeaseRun); err != nil {
+		log.Printf("CDC 任务 %d 跳过自动恢复: %v", taskID, err)
+		return
+	}
+	if task.CDCCheckpoint == nil {
+		releaseTaskLease(taskID, taskLeaseRun)
+		m.service.recordCDCFailure(task, fmt.Errorf("自动恢复失败: 检查点缺失，无法确认续传位点，请确认后手动启动"))
+		return
+	}
+	if err := m.reconcileXAPrepared(task); err != nil {
+		releaseTaskLease(taskID, taskLeaseRun)
+		m.service.recordCDCFailure(task, fmt.Errorf("自动恢复失败: 清理 XA 缓存残留失败: %w", err))
+		return
+	}
+	if err := m.StartTask(taskID, RunTriggerRecovery); err != nil {
+		if errors.Is(err, ErrTaskLeaseHeld) {
+			log.Printf("CDC 任务 %d 跳过自动恢复: %v", taskID, err)
+			return
+		}
+		m.service.recordCDCFailure(task, fmt.Errorf("自动恢复失败: %w", err))
+		return
+	}
+	log.Printf("CDC 任务 %d 已自动恢复", taskID)
+	m.service.RecordTaskEvent(task, "cdc_auto_resumed", "cdc", "running", message, "实例 "+InstanceID()+" 从位点 "+cdcCheckpointLabel(task.CDCCheckpoint)+" 继续", 0, 0)
+}
+
+// reconcileXAPrepared 按检查点清理 XA 缓存残留，PostgreSQL 源没有 XA 缓存
+func (m *CDCManager) reconcileXAPrepared(task *models.SyncTask) error {
+	checkpoint := task.CDCCheckpoint
+	if checkpoint == nil || checkpoint.BinlogFile == "" {
+		return nil
+	}
+	var records []models.SyncXAPreparedTransaction
+	if err := m.service.systemDB.Select("id, xid_key, binlog_file, binlog_position, resolved_file, resolved_position").
+		Where("task_id = ?", task.ID).Find(&records).Error; err != nil {
+		return err
+	}
+	var stale []uint
+	for _, record := range records {
+		if xaPreparedStale(record, checkpoint.BinlogFile, checkpoint.BinlogPosition) {
+			stale = append(stale, record.ID)
+		}
+	}
+	if len(stale) > 0 {
+		if err := m.service.systemDB.Where("id IN ?", stale).Delete(&models.SyncXAPreparedTransaction{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(records) > 0 {
+		m.service.RecordTaskEvent(task, "xa_reconciled", "cdc", "success", "已清理 XA 缓存残留",
+			fmt.Sprintf("检查点 %s；清理 %d 条，保留 %d 条待提交事务", cdcCheckpointLabel(checkpoint), len(stale), len(records)-len(stale)), 0, 0)
+	}
+	return nil
+}
+
+// xaPreparedStale 判断缓存在检查点处是否已无用；位点无法比较（如主从切换后文件名变化）时保留
+func xaPreparedStale(record models.SyncXAPreparedTransaction, file string, pos uint32) bool {
+	if record.ResolvedFile != "" {
+		cmp, ok := compareBinlogPosition(record.ResolvedFile, record.ResolvedPosition, file, pos)
+		return ok && cmp <= 0
+	}
+	cmp, ok := compareBinlogPosition(record.BinlogFile, record.BinlogPosition, file, pos)
+	return ok && cmp > 0
+}
+
+// compareBinlogPosition 比较两个 Binlog 位点，文件名前缀不同时返回 false
+func compareBinlogPosition(fileA string, posA uint32, fileB string, posB uint32) (int, bool) {
+	prefixA, seqA, okA := splitBinlogFile(fileA)
+	prefixB, seqB, okB := splitBinlogFile(fileB)
+	if !okA || !okB || prefixA != prefixB {
+		return 0, false
+	}
+	switch {
+	case seqA != seqB:
+		if seqA < seqB {
+			return -1, true
+		}
+		return 1, true
+	case posA < posB:
+		return -1, true
+	case posA > posB:
+		return 1, true
+	}
+	return 0, true
+}
+
+func splitBinlogFile(file string) (string, uint64, bool) {
+	dot := strings.LastIndex(file, ".")
+	if dot < 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseUint(file[dot+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return file[:dot], seq, true
+}
+
+// resolveXAPrepared 标记 XA 事务已在 file:pos 写入目标
+func (m *CDCManager) resolveXAPrepared(taskID uint, xidKey, file string, pos uint32) error {
+	var prepared models.SyncXAPreparedTransaction
+	if err := m.loadXAPreparedRecord(taskID, xidKey, &prepared); err != nil {
+		return err
+	}
+	if err := m.service.systemDB.Model(&prepared).Updates(map[string]interface{}{"resolved_file": file, "resolved_position": pos}).Error; err != nil {
+		return err
+	}
+	m.xaResolved.Store(taskID, true)
+	return nil
+}
+
+// purgeResolvedXAPrepared 在检查点落盘后删除提交位点不晚于检查点的 XA 缓存
+func (m *CDCManager) purgeResolvedXAPrepared(taskID uint, file string, pos uint32) error {
+	if _, ok := m.xaResolved.LoadAndDelete(taskID); !ok {
+		return nil
+	}
+	var records []models.SyncXAPreparedTransaction
+	if err := m.service.systemDB.Select("id, resolved_file, resolved_position").
+		Where("task_id = ? AND resolved_file <> ''", taskID).Find(&records).Error; err != nil {
+		return err
+	}
+	var ids []uint
+	for _, record := range records {
+		cmp, ok := compareBinlogPosition(record.ResolvedFile, record.ResolvedPosition, file, pos)
+		if ok && cmp <= 0 {
+			ids = append(ids, record.ID)
+		} else if ok {
+			m.xaResolved.Store(taskID, true)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return m.service.systemDB.Where("id IN ?", ids).Delete(&models.SyncXAPreparedTransaction{}).Error
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestCDCRestartDelays(t *testing.T) {
+	tasks := []models.SyncTask{{ID: 1, SourceDB: "a"}, {ID: 2, SourceDB: "b"}, {ID: 3, SourceDB: "a"}, {ID: 4, SourceDB: "a"}}
+	delays := cdcRestartDelays(tasks, 5*time.Second)
+	want := map[uint]time.Duration{1: 0, 2: 0, 3: 5 * time.Second, 4: 10 * time.Second}
+	for id, delay := range want {
+		if delays[id] != delay {
+			t.Fatalf("task %d delay = %s, want %s", id, delays[id], delay)
+		}
+	}
+}
+
+func TestXAPreparedStale(t *testing.T) {
+	tests := []struct {
+		name   string
+		record models.SyncXAPreparedTransaction
+		want   bool
+	}{
+		{name: "pending before checkpoint", record: models.SyncXAPreparedTransaction{BinlogFile: "mysql-bin.000010", BinlogPosition: 500}, want: false},
+		{name: "prepare after checkpoint", record: models.SyncXAPreparedTransaction{BinlogFile: "mysql-bin.000010", BinlogPosition: 1500}, want: true},
+		{name: "prepare in next file", record: models.SyncXAPreparedTransaction{BinlogFile: "mysql-bin.000011", BinlogPosition: 4}, want: true},
+		{name: "committed before checkpoint", record: models.SyncXAPreparedTransaction{BinlogFile: "mysql-bin.000009", BinlogPosition: 900, ResolvedFile: "mysql-bin.000010", ResolvedPosition: 1000}, want: true},
+		{name: "committed after checkpoint", record: models.SyncXAPreparedTransaction{BinlogFile: "mysql-bin.000010", BinlogPosition: 900, ResolvedFile: "mysql-bin.000010", ResolvedPosition: 1200}, want: false},
+		{name: "other server files", record: models.SyncXAPreparedTransaction{BinlogFile: "replica-bin.000002", BinlogPosition: 1500}, want: false},
+	}
+	for _, tt := range tests {
+		if got := xaPreparedStale(tt.record, "mysql-bin.000010", 1000); got != tt.want {
+			t.Fatalf("%s: got %v", tt.name, got)
+		}
+	}
+}
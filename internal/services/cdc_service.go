@@ -3,9 +3,11 @@ package services
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,7 +18,6 @@ import (
 	"sync"
 	"time"
 
-	gomysql "github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/redgreat/mergewong/internal/database"
 	"github.com/redgreat/mergewong/internal/models"
@@ -24,10 +25,12 @@ import (
 )
 
 type cdcOperation struct {
-	kind    string
-	mapping *models.SyncTaskTable
-	columns []string
-	values  []interface{}
+	kind     string
+	mapping  *models.SyncTaskTable
+	columns  []string
+	values   []interface{}
+	position string
+	change   string // insert、update、delete，历史模式写入操作类型
 }
 
 type cdcOperationRecord struct {
@@ -35,6 +38,10 @@ type cdcOperationRecord struct {
 	TaskTableID uint          `json:"task_table_id"`
 	Columns     []string      `json:"columns"`
 	Values      []interface{} `json:"values"`
+	// Types 与 Values 一一对应，标记 JSON 无法原样表示的值；旧记录没有该字段，按原值使用
+	Types    []string `json:"types,omitempty"`
+	Position string   `json:"position,omitempty"`
+	Change   string   `json:"change,omitempty"`
 }
 
 type cdcOperationMetrics struct {
@@ -48,12 +55,21 @@ type CDCManager struct {
 	mu      sync.Mutex
 	workers map[uint]cdcWorker
 	nextID  uint64
+	// readers 按源连接 ID 共享 Binlog 读取器，dedicated 记录已改为独立读取的任务
+	readerMu  sync.Mutex
+	readers   map[uint]*sharedBinlogReader
+	dedicated map[uint]bool
+	// xaResolved 记录有已提交、待检查点越过后清理的 XA 缓存的任务
+	xaResolved sync.Map
+	// resuming 记录服务启动后等待错峰恢复的任务，租约心跳不重复接管
+	resuming sync.Map
 }
 
 type cdcWorker struct {
-	id     uint64
-	cancel context.CancelFunc
-	done   chan struct{}
+	id        uint64
+	cancel    context.CancelFunc
+	done      chan struct{}
+	startedAt time.Time
 }
 
 var cdcManager *CDCManager
@@ -113,16 +129,14 @@ func xaDebugReport(hypothesisID, location, msg string, data map[string]interface
 // #endregion
 
 func GetCDCManager() *CDCManager {
-	cdcOnce.Do(func() { cdcManager = &CDCManager{service: NewSyncService(), workers: map[uint]cdcWorker{}} })
+	cdcOnce.Do(func() {
+		cdcManager = &CDCManager{service: NewSyncService(), workers: map[uint]cdcWorker{}, readers: map[uint]*sharedBinlogReader{}, dedicated: map[uint]bool{}}
+	})
 	return cdcManager
 }
 
-func (m *CDCManager) StartAll() {
-	// 启动后不再自动恢复 CDC 任务，由用户手动开启
-	log.Println("CDC Manager 已就绪，等待用户手动启动任务")
-}
-
-func (m *CDCManager) StartTask(taskID uint) error {
+// StartTask 启动任务的 CDC 会话，trigger 记入执行记录
+func (m *CDCManager) StartTask(taskID uint, trigger string) error {
 	task, err := m.service.GetTask(taskID)
 	if err != nil {
 		return err
@@ -134,60 +148,114 @@ func (m *CDCManager) StartTask(taskID uint) error {
 		return fmt.Errorf("该任务不是 Binlog CDC 任务")
 	}
 	m.StopTask(taskID)
+	if m.IsRunning(taskID) {
+		return fmt.Errorf("上一个 CDC 会话尚未退出，请稍后重试")
+	}
+	// 多实例部署时同一任务只在持有 run 租约的实例上运行
+	if err := acquireTaskLease(taskID, taskLeaseRun); err != nil {
+		return err
+	}
 	// 启动前检查 binlog 位点是否仍然有效，无效则自动重置
+	// 有 GTID 集合时按 GTID 校验，主从切换后文件名变化不影响恢复
 	checkpoint := task.CDCCheckpoint
 	if checkpoint != nil && checkpoint.BinlogFile != "" && checkpoint.SnapshotCompleted {
-		if err := m.ensureBinlogPositionValid(task, checkpoint); err != nil {
-			// 如果位点无效，自动重置到当前位点继续
-			log.Printf("CDC 任务 %d 检查点位点 %s:%d 无效，自动重置到当前位点", taskID, checkpoint.BinlogFile, checkpoint.BinlogPosition)
-			file, pos, posErr := currentMySQLPosition(task.SourceDB)
-			if posErr == nil {
-				checkpoint.BinlogFile = file
-				checkpoint.BinlogPosition = pos
-				_ = m.service.systemDB.Model(checkpoint).Updates(map[string]interface{}{"binlog_file": file, "binlog_position": pos, "last_event_at": nil}).Error
-				m.service.RecordTaskEvent(task, "checkpoint_reset", "cdc", "running",
-					"Binlog 位点被清理，已自动从当前位点恢复",
-					fmt.Sprintf("原 %s:%d → 新 %s:%d", checkpoint.BinlogFile, checkpoint.BinlogPosition, file, pos), 0, 0)
+		validate := m.ensureBinlogPositionValid
+		if useGTIDResume(task, checkpoint) {
+			validate = m.ensureGTIDSetValid
+		}
+		if err := validate(task, checkpoint); err != nil {
+			// 位点无效时按任务的 Binlog 清理恢复策略处理，不再静默跳到当前位点
+			log.Printf("CDC 任务 %d 检查点位点 %s 无效: %v", taskID, cdcCheckpointLabel(checkpoint), err)
+			if err := m.recoverBinlogPurge(task, checkpoint, err); err != nil {
+				releaseTaskLease(taskID, taskLeaseRun)
+				return err
 			}
 		}
 	}
+	startCheckpoint := ""
+	if checkpoint != nil {
+		startCheckpoint = cdcCheckpointLabel(checkpoint)
+	}
+	run := beginTaskRun(m.service.systemDB, task, trigger, startCheckpoint)
 	ctx, cancel := context.WithCancel(context.Background())
 	m.mu.Lock()
 	m.nextID++
 	workerID := m.nextID
 	done := make(chan struct{})
-	m.workers[taskID] = cdcWorker{id: workerID, cancel: cancel, done: done}
+	m.workers[taskID] = cdcWorker{id: workerID, cancel: cancel, done: done, startedAt: time.Now()}
 	m.mu.Unlock()
 	go func() {
 		defer close(done)
-		err := m.run(ctx, task)
-		if err != nil && ctx.Err() == nil {
+		err := m.runWithRetry(ctx, task)
+		if errors.Is(err, errCDCPausedByDDL) {
+			log.Printf("CDC 任务 %d 因源表 DDL 暂停", taskID)
+			run.finish("paused", "源表 DDL 暂停", nil, cdcRunCheckpoint(m.service.systemDB, taskID))
+		} else if errors.Is(err, errCDCSubscriptionStalled) && ctx.Err() == nil {
+			run.finish("stopped", "共享订阅停滞，改为独立读取", err, cdcRunCheckpoint(m.service.systemDB, taskID))
+			go m.detachStalledTask(task)
+		} else if errors.Is(err, ErrTaskLeaseLost) {
+			// 任务已归其他实例，不再改写任务状态或预警
+			log.Printf("CDC 任务 %d 失去租约，停止写入", taskID)
+			run.finish("stopped", "租约失效，停止会话", err, cdcRunCheckpoint(m.service.systemDB, taskID))
+		} else if err != nil && ctx.Err() == nil {
 			log.Printf("CDC 任务 %d 停止: %v", taskID, err)
+			run.finish("failed", "CDC 同步失败", err, cdcRunCheckpoint(m.service.systemDB, taskID))
 			m.service.recordCDCFailure(task, err)
-			if strings.Contains(err.Error(), "Could not find first log file name in binary log index file") {
+			if isBinlogPurgedError(err) {
 				go m.autoRecoverFromBinlogPurge(taskID)
 			}
 		} else {
+			run.finish("stopped", "CDC 会话已停止", nil, cdcRunCheckpoint(m.service.systemDB, taskID))
 			m.service.recordCDCStopped(task)
 		}
 		m.mu.Lock()
+		current := false
 		if worker, ok := m.workers[taskID]; ok && worker.id == workerID {
 			delete(m.workers, taskID)
+			current = true
 		}
 		m.mu.Unlock()
+		// 已被同一任务的新会话替换时租约归新会话
+		if current {
+			releaseTaskLease(taskID, taskLeaseRun)
+		}
 	}()
 	return nil
 }
 
+// runWithRetry 运行 CDC 会话，临时故障时从检查点重新订阅；会话持续运行一段时间后再失败，重试次数重新计算
+func (m *CDCManager) runWithRetry(ctx context.Context, task *models.SyncTask) error {
+	attempt := 0
+	for {
+		started := time.Now()
+		err := m.run(ctx, task)
+		if err == nil || ctx.Err() != nil || errors.Is(err, errCDCPausedByDDL) || errors.Is(err, errCDCSubscriptionStalled) || errors.Is(err, ErrTaskLeaseLost) {
+			return err
+		}
+		if time.Since(started) >= transientRetryHealthyAfter {
+			attempt = 0
+		}
+		attempt++
+		if err := m.service.retryTransientFailure(ctx, task, "cdc", attempt, err); err != nil {
+			return err
+		}
+		log.Printf("CDC 任务 %d 第 %d 次重试", task.ID, attempt)
+	}
+}
+
+// StopTask 取消会话并等待其退出，最多等待一个租约时长；超时后会话仍登记为运行中，退出时自行清理并释放租约
 func (m *CDCManager) StopTask(taskID uint) {
 	m.mu.Lock()
 	worker := m.workers[taskID]
 	m.mu.Unlock()
 	if worker.cancel != nil {
 		worker.cancel()
+		// 等待会话真正退出，避免旧会话仍在写入时新会话或其他实例已开始同步
 		select {
 		case <-worker.done:
-		case <-time.After(10 * time.Second):
+		case <-time.After(taskLeaseTTL()):
+			log.Printf("CDC 任务 %d 等待会话退出超时，会话可能阻塞在目标库写入或源库读取", taskID)
+			return
 		}
 	}
 	m.mu.Lock()
@@ -208,6 +276,7 @@ func (m *CDCManager) ensureBinlogPositionValid(task *models.SyncTask, checkpoint
 	return sourceDB.Raw("SHOW BINLOG EVENTS IN '" + checkpoint.BinlogFile + "' FROM " + fmt.Sprint(checkpoint.BinlogPosition) + " LIMIT 1").Scan(&dummy).Error
 }
 
+// autoRecoverFromBinlogPurge 在运行中读到 Binlog 已清理时重新启动任务，由 StartTask 的位点校验按策略恢复
 func (m *CDCManager) autoRecoverFromBinlogPurge(taskID uint) {
 	time.Sleep(3 * time.Second)
 	task, err := m.service.GetTask(taskID)
@@ -215,25 +284,13 @@ func (m *CDCManager) autoRecoverFromBinlogPurge(taskID uint) {
 		log.Printf("CDC 任务 %d 自动恢复失败(获取任务): %v", taskID, err)
 		return
 	}
-	file, pos, err := currentMySQLPosition(task.SourceDB)
-	if err != nil {
-		log.Printf("CDC 任务 %d 自动恢复失败(获取位点): %v", taskID, err)
-		return
-	}
-	if err := m.service.systemDB.Model(&models.SyncCDCCheckpoint{}).
-		Where("task_id = ?", taskID).
-		Updates(map[string]interface{}{
-			"binlog_file":        file,
-			"binlog_position":    pos,
-			"snapshot_completed": true,
-		}).Error; err != nil {
-		log.Printf("CDC 任务 %d 自动恢复失败(更新检查点): %v", taskID, err)
+	if policy, _ := normalizeBinlogPurgePolicy(task.BinlogPurgePolicy); policy == binlogPurgePolicyFail {
+		m.service.RecordTaskEvent(task, "binlog_purged", "cdc", "failed", "检查点之后的 Binlog 已被清理，任务已停止", "位点 "+cdcCheckpointLabel(task.CDCCheckpoint), 0, 0)
 		return
 	}
-	log.Printf("CDC 任务 %d checkpoint 已重置到当前位点 %s:%d，重新启动", taskID, file, pos)
-	m.service.RecordTaskEvent(task, "cdc_auto_recover", "cdc", "running", "Binlog 被清理，自动从当前位点恢复", fmt.Sprintf("新位点 %s:%d", file, pos), 0, 0)
-	if err := m.StartTask(taskID); err != nil {
+	if err := m.StartTask(taskID, RunTriggerRecovery); err != nil {
 		log.Printf("CDC 任务 %d 自动恢复失败(重启): %v", taskID, err)
+		m.service.recordCDCFailure(task, fmt.Errorf("Binlog 清理后自动恢复失败: %w", err))
 	}
 }
 
@@ -268,14 +325,23 @@ func (m *CDCManager) run(ctx context.Context, task *models.SyncTask) error {
 	if err := m.service.systemDB.Where("name = ?", task.SourceDB).First(&source).Error; err != nil {
 		return err
 	}
+	if source.Type == "postgres" && task.SyncType != "cdc" {
+		return fmt.Errorf("PostgreSQL 源暂仅支持 CDC 增量同步")
+	}
 	checkpoint, err := m.loadOrCreateCheckpoint(task, &source)
 	if err != nil {
 		return err
 	}
-	if task.SyncType == "full_cdc" && !checkpoint.SnapshotCompleted {
+	// Binlog 清理按 resnapshot 策略恢复时 CDC 任务也会重新全量初始化
+	if !checkpoint.SnapshotCompleted {
 		m.service.RecordTaskEvent(task, "snapshot_started", "snapshot", "running", "全量数据初始化开始", "", 0, 0)
 		started := time.Now()
-		rows, err := m.service.syncValidatedTask(task)
+		var rows int64
+		if task.SnapshotMode == snapshotModeConsistent {
+			rows, err = m.service.syncConsistentSnapshot(ctx, task, checkpoint)
+		} else {
+			rows, err = m.service.syncValidatedTask(task)
+		}
 		if err != nil {
 			return fmt.Errorf("全量初始化失败: %w", err)
 		}
@@ -287,6 +353,7 @@ func (m *CDCManager) run(ctx context.Context, task *models.SyncTask) error {
 		elapsed := time.Since(started)
 		_ = m.service.UpdateTask(task.ID, map[string]interface{}{"runtime_status": "catching_up", "rows_processed": rows, "rows_per_second": float64(rows) / elapsed.Seconds(), "phase_started_at": time.Now()})
 		m.service.RecordTaskEvent(task, "snapshot_completed", "snapshot", "success", "全量数据初始化完成", "", rows, elapsed.Milliseconds())
+		m.service.checkSnapshotInconsistency(task)
 	}
 	if task.SyncType == "cdc" {
 		if err := ensureCDCTargetTables(task); err != nil {
@@ -316,7 +383,10 @@ func ensureCDCTargetTables(task *models.SyncTask) error {
 		if len(mapping.FieldMapping) > 0 {
 			return fmt.Errorf("目标表 %s 不存在时不能使用字段改名", mapping.TargetTable)
 		}
-		if err := createMySQLTableLike(sourceDB, targetDB, mapping.SourceTable, mapping.TargetTable); err != nil {
+		if dialectOf(sourceDB).name() != "mysql" {
+			return fmt.Errorf("PostgreSQL 源需预先创建目标表 %s", mapping.TargetTable)
+		}
+		if err := createTargetTableLike(sourceDB, targetDB, mapping.SourceTable, mapping.TargetTable); err != nil {
 			return err
 		}
 	}
@@ -324,6 +394,9 @@ func ensureCDCTargetTables(task *models.SyncTask) error {
 }
 
 func (m *CDCManager) loadOrCreateCheckpoint(task *models.SyncTask, source *models.DatabaseConnection) (*models.SyncCDCCheckpoint, error) {
+	if source.Type == "postgres" {
+		return m.loadOrCreatePostgresCheckpoint(task)
+	}
 	var checkpoint models.SyncCDCCheckpoint
 	err := m.service.systemDB.Where("task_id = ?", task.ID).First(&checkpoint).Error
 	if err == nil {
@@ -332,12 +405,12 @@ func (m *CDCManager) loadOrCreateCheckpoint(task *models.SyncTask, source *model
 	if err != gorm.ErrRecordNotFound {
 		return nil, err
 	}
-	file, pos, err := currentMySQLPosition(task.SourceDB)
+	status, err := currentMySQLMasterStatus(task.SourceDB)
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("任务 %d 首次进入 CDC，未找到 Binlog 检查点，记录当前位点 %s:%d 后开始初始化/追数", task.ID, file, pos)
-	checkpoint = models.SyncCDCCheckpoint{TaskID: task.ID, BinlogFile: file, BinlogPosition: pos, SnapshotCompleted: task.SyncType == "cdc"}
+	checkpoint = models.SyncCDCCheckpoint{TaskID: task.ID, BinlogFile: status.File, BinlogPosition: status.Position, GTIDSet: status.ExecutedGTIDSet, ServerUUID: status.ServerUUID, SnapshotCompleted: task.SyncType == "cdc"}
+	log.Printf("任务 %d 首次进入 CDC，未找到 Binlog 检查点，记录当前位点 %s 后开始初始化/追数", task.ID, cdcCheckpointLabel(&checkpoint))
 	if err := m.service.systemDB.Create(&checkpoint).Error; err != nil {
 		return nil, err
 	}
@@ -345,38 +418,52 @@ func (m *CDCManager) loadOrCreateCheckpoint(task *models.SyncTask, source *model
 }
 
 func currentMySQLPosition(connectionName string) (string, uint32, error) {
-	db, err := database.GetManager().GetConnection(connectionName)
+	status, err := currentMySQLMasterStatus(connectionName)
 	if err != nil {
 		return "", 0, err
 	}
-	var status struct {
-		File     string `gorm:"column:File"`
-		Position uint32 `gorm:"column:Position"`
-	}
-	if err := db.Raw("SHOW MASTER STATUS").Scan(&status).Error; err != nil {
-		return "", 0, fmt.Errorf("读取 Binlog 位点失败: %w", err)
+	return status.File, status.Position, nil
+}
+
+// cdcCheckpointLabel 用于日志和事件详情，GTID 集合存在时一并展示
+func cdcCheckpointLabel(checkpoint *models.SyncCDCCheckpoint) string {
+	if checkpoint.LSN != "" {
+		return "LSN " + checkpoint.LSN
 	}
-	if status.File == "" {
-		return "", 0, fmt.Errorf("读取 Binlog 位点失败：源库未返回 Master Status")
+	label := fmt.Sprintf("%s:%d", checkpoint.BinlogFile, checkpoint.BinlogPosition)
+	if checkpoint.GTIDSet != "" {
+		label += " GTID " + checkpoint.GTIDSet
 	}
-	return status.File, status.Position, nil
+	return label
+}
+
+func isBinlogPurgedError(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "Could not find first log file name in binary log index file") ||
+		strings.Contains(message, "purged binary logs containing GTIDs")
 }
 
 func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *models.DatabaseConnection, checkpoint *models.SyncCDCCheckpoint) error {
-	syncer := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{ServerID: 410000 + uint32(task.ID), Flavor: "mysql", Host: source.Host, Port: uint16(source.Port), User: source.Username, Password: source.Password, Charset: source.Charset, ParseTime: true, HeartbeatPeriod: 10 * time.Second})
-	defer syncer.Close()
-	streamer, err := syncer.StartSync(gomysql.Position{Name: checkpoint.BinlogFile, Pos: checkpoint.BinlogPosition})
+	if source.Type == "postgres" {
+		return m.streamPostgres(ctx, task, source, checkpoint)
+	}
+	streamer, err := m.openBinlogSource(task, source, checkpoint)
 	if err != nil {
 		return err
 	}
+	defer streamer.Close()
+	gtidTracker := newCDCGTIDTracker(checkpoint.GTIDSet)
 	targetDB, err := database.GetManager().GetConnection(task.TargetDB)
 	if err != nil {
 		return err
 	}
 	mappings := map[string]*models.SyncTaskTable{}
+	knownTables := map[string]bool{}
 	for i := range task.TaskTables {
+		key := cdcMappingKey(&task.TaskTables[i], source.Database)
+		knownTables[key] = true
 		if task.TaskTables[i].SyncState == "active" {
-			mappings[task.TaskTables[i].SourceTable] = &task.TaskTables[i]
+			mappings[key] = &task.TaskTables[i]
 		}
 	}
 	columnCache := map[string][]string{}
@@ -397,7 +484,7 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 	if checkpoint.SnapshotCompleted && task.RowsProcessed > 0 {
 		startTitle = "Binlog 增量同步继续"
 	}
-	m.service.RecordTaskEvent(task, "cdc_started", "cdc", "running", startTitle, fmt.Sprintf("起始位点 %s:%d", checkpoint.BinlogFile, checkpoint.BinlogPosition), 0, 0)
+	m.service.RecordTaskEvent(task, "cdc_started", "cdc", "running", startTitle, "起始位点 "+cdcCheckpointLabel(checkpoint), 0, 0)
 	for {
 		event, err := streamer.GetEvent(ctx)
 		if err != nil {
@@ -410,7 +497,7 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 				return err
 			}
 			sessionRows += bufRows
-			if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+			if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, mergeBuf.lastGTID, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 				return err
 			}
 			mergeBuf.clear(currentFile, event.Header.LogPos, event.Header.Timestamp)
@@ -423,7 +510,7 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 					return err
 				}
 				sessionRows += bufRows
-				if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+				if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, mergeBuf.lastGTID, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 					return err
 				}
 				mergeBuf.clear(currentFile, event.Header.LogPos, event.Header.Timestamp)
@@ -445,7 +532,7 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 			}
 			operations = operations[:0]
 			sessionRows += applied
-			if err := m.advanceCheckpoint(task, checkpoint, currentFile, event.Header.LogPos, sessionRows, streamStarted, event.Header.Timestamp, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+			if err := m.advanceCheckpoint(task, checkpoint, currentFile, event.Header.LogPos, gtidTracker.commit(), sessionRows, streamStarted, event.Header.Timestamp, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 				return err
 			}
 			continue
@@ -453,42 +540,33 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 		switch e := event.Event.(type) {
 		case *replication.RotateEvent:
 			currentFile = string(e.NextLogName)
+		case *replication.PreviousGTIDsEvent:
+			gtidTracker.observePrevious(e)
+		case *replication.GTIDEvent:
+			gtidTracker.observe(e)
 		case *replication.RowsEvent:
-			if string(e.Table.Schema) != source.Database {
-				continue
-			}
-			mapping := mappings[string(e.Table.Table)]
+			mapping := mappings[cdcTableKey(string(e.Table.Schema), string(e.Table.Table))]
 			if mapping == nil {
+				m.discoverPatternShard(task, string(e.Table.Schema), string(e.Table.Table), source.Database, knownTables)
 				continue
 			}
-			columns := columnCache[mapping.SourceTable]
+			columns := columnCache[sourceTableName(mapping)]
 			if len(columns) == 0 {
-				columns, err = mysqlColumnNames(task.SourceDB, mapping.SourceTable)
+				columns, err = mysqlColumnNames(task.SourceDB, sourceTableName(mapping))
 				if err != nil {
 					return err
 				}
-				columnCache[mapping.SourceTable] = columns
+				if err := resolveRowFilterTypes(task.SourceDB, mapping); err != nil {
+					return err
+				}
+				columnCache[sourceTableName(mapping)] = columns
 			}
 			if int(e.ColumnCount) != len(columns) {
-				return fmt.Errorf("表 %s Binlog 列数与当前表结构不一致", mapping.SourceTable)
-			}
-			switch event.Header.EventType {
-			case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
-				for _, row := range e.Rows {
-					operations = append(operations, cdcOperation{kind: "upsert", mapping: mapping, columns: columns, values: row})
-					opMetrics.Insert++
-				}
-			case replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
-				for i := 1; i < len(e.Rows); i += 2 {
-					operations = append(operations, cdcOperation{kind: "upsert", mapping: mapping, columns: columns, values: e.Rows[i]})
-					opMetrics.Update++
-				}
-			case replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2:
-				for _, row := range e.Rows {
-					operations = append(operations, cdcOperation{kind: "delete", mapping: mapping, columns: columns, values: row})
-					opMetrics.Delete++
-				}
+				return fmt.Errorf("表 %s Binlog 列数与当前表结构不一致", sourceTableName(mapping))
 			}
+			start := len(operations)
+			operations = appendCDCRowsOperations(operations, event.Header.EventType, mapping, columns, e.Rows, &opMetrics)
+			tagCDCPosition(operations[start:], fmt.Sprintf("%s:%d", currentFile, event.Header.LogPos))
 			// 大事务进行中时每 5000 行输出一次进度
 			if len(operations)%5000 == 0 {
 				log.Printf("[CDC] 任务 %d 大事务进行中: 已缓存 %d 行 (i:%d u:%d d:%d) 位点 %s:%d", task.ID, len(operations), opMetrics.Insert, opMetrics.Update, opMetrics.Delete, currentFile, event.Header.LogPos)
@@ -504,7 +582,7 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 						return err
 					}
 					sessionRows += bufRows
-					if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+					if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, mergeBuf.lastGTID, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 						return err
 					}
 					mergeBuf.clear(currentFile, event.Header.LogPos, event.Header.Timestamp)
@@ -527,14 +605,14 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 				}
 				bufRows := int64(mergeBuf.size())
 				sessionRows += bufRows
-				if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+				if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, mergeBuf.lastGTID, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 					return err
 				}
 				mergeBuf.clear(currentFile, event.Header.LogPos, event.Header.Timestamp)
 			}
 			if applied < int64(cdcTxnMergeThreshold) && applied > 0 {
 				// 小事务：进合并缓冲
-				mergeBuf.append(operations, currentFile, event.Header.LogPos, event.Header.Timestamp)
+				mergeBuf.append(operations, currentFile, event.Header.LogPos, gtidTracker.commit(), event.Header.Timestamp)
 				operations = operations[:0]
 				// 如果缓冲已凑满批次大小或超时，立即 flush
 				if mergeBuf.ready() && mergeBuf.size() >= cdcMaxBatchRows(task) {
@@ -543,7 +621,7 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 						return err
 					}
 					sessionRows += bufRows
-					if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+					if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, mergeBuf.lastGTID, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 						return err
 					}
 					mergeBuf.clear(currentFile, event.Header.LogPos, event.Header.Timestamp)
@@ -557,7 +635,7 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 					return err
 				}
 				sessionRows += bufRows
-				if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+				if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, mergeBuf.lastGTID, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 					return err
 				}
 				mergeBuf.clear(currentFile, event.Header.LogPos, event.Header.Timestamp)
@@ -571,7 +649,7 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 				}
 				operations = operations[:0]
 				sessionRows += applied
-				if err := m.advanceCheckpoint(task, checkpoint, currentFile, event.Header.LogPos, sessionRows, streamStarted, event.Header.Timestamp, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+				if err := m.advanceCheckpoint(task, checkpoint, currentFile, event.Header.LogPos, gtidTracker.commit(), sessionRows, streamStarted, event.Header.Timestamp, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 					return err
 				}
 			}
@@ -591,7 +669,7 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 						return err
 					}
 					sessionRows += bufRows
-					if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+					if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, mergeBuf.lastGTID, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 						return err
 					}
 					mergeBuf.clear(currentFile, event.Header.LogPos, event.Header.Timestamp)
@@ -635,7 +713,10 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 							// #endregion
 							return err
 						}
-						deletePrepared = true
+						// 检查点按间隔落盘，缓存先标记为已提交，等检查点越过后再删，中途崩溃重放 COMMIT 时仍能找到
+						if err := m.resolveXAPrepared(task.ID, xidKey, currentFile, event.Header.LogPos); err != nil {
+							return err
+						}
 					}
 				case "rollback":
 					operations = operations[:0]
@@ -646,16 +727,43 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 					}
 				}
 				sessionRows += applied
-				if err := m.advanceCheckpoint(task, checkpoint, currentFile, event.Header.LogPos, sessionRows, streamStarted, event.Header.Timestamp, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+				if err := m.advanceCheckpoint(task, checkpoint, currentFile, event.Header.LogPos, gtidTracker.commit(), sessionRows, streamStarted, event.Header.Timestamp, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+					return err
+				}
+				continue
+			}
+			if ddl, ok := parseCDCDDL(rawQuery, string(e.Schema)); ok {
+				// DDL 前先写完合并缓冲，保证目标表结构变化发生在之前的数据之后
+				if mergeBuf.size() > 0 {
+					bufRows := int64(mergeBuf.size())
+					if err := mergeBuf.flush(targetDB); err != nil {
+						return err
+					}
+					sessionRows += bufRows
+					if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, mergeBuf.lastGTID, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+						return err
+					}
+					mergeBuf.clear(currentFile, event.Header.LogPos, event.Header.Timestamp)
+				}
+				ddlErr := m.handleCDCDDL(task, targetDB, ddl, rawQuery, mappings, columnCache)
+				if ddlErr != nil && !errors.Is(ddlErr, errCDCPausedByDDL) {
+					return ddlErr
+				}
+				// DDL 处理完立即落检查点，暂停后恢复不会重复处理同一条 DDL
+				lastMetricsUpdate = time.Time{}
+				if err := m.advanceCheckpoint(task, checkpoint, currentFile, event.Header.LogPos, gtidTracker.commit(), sessionRows, streamStarted, event.Header.Timestamp, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 					return err
 				}
+				if ddlErr != nil {
+					return ddlErr
+				}
 				continue
 			}
 			if query == "COMMIT" {
 				applied := int64(len(operations))
 				// 小事务进合并缓冲
 				if applied < int64(cdcTxnMergeThreshold) && applied > 0 {
-					mergeBuf.append(operations, currentFile, event.Header.LogPos, event.Header.Timestamp)
+					mergeBuf.append(operations, currentFile, event.Header.LogPos, gtidTracker.commit(), event.Header.Timestamp)
 					operations = operations[:0]
 					if mergeBuf.size() >= cdcMaxBatchRows(task) {
 						bufRows := int64(mergeBuf.size())
@@ -663,7 +771,7 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 							return err
 						}
 						sessionRows += bufRows
-						if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+						if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, mergeBuf.lastGTID, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 							return err
 						}
 						mergeBuf.clear(currentFile, event.Header.LogPos, event.Header.Timestamp)
@@ -677,7 +785,7 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 						return err
 					}
 					sessionRows += bufRows
-					if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+					if err := m.advanceCheckpoint(task, checkpoint, mergeBuf.lastFile, mergeBuf.lastPos, mergeBuf.lastGTID, sessionRows, streamStarted, mergeBuf.lastEventTs, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 						return err
 					}
 					mergeBuf.clear(currentFile, event.Header.LogPos, event.Header.Timestamp)
@@ -688,7 +796,7 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 					}
 					operations = operations[:0]
 					sessionRows += applied
-					if err := m.advanceCheckpoint(task, checkpoint, currentFile, event.Header.LogPos, sessionRows, streamStarted, event.Header.Timestamp, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
+					if err := m.advanceCheckpoint(task, checkpoint, currentFile, event.Header.LogPos, gtidTracker.commit(), sessionRows, streamStarted, event.Header.Timestamp, &lastMetricsUpdate, &lastMetricsLog, &lastMetricsRows, &lastMetricsOps, opMetrics); err != nil {
 						return err
 					}
 				}
@@ -697,19 +805,36 @@ func (m *CDCManager) stream(ctx context.Context, task *models.SyncTask, source *
 	}
 }
 
-func (m *CDCManager) advanceCheckpoint(task *models.SyncTask, checkpoint *models.SyncCDCCheckpoint, file string, pos uint32, sessionRows int64, started time.Time, eventTimestamp uint32, lastMetricsUpdate, lastMetricsLog *time.Time, lastMetricsRows *int64, lastMetricsOps *cdcOperationMetrics, opMetrics cdcOperationMetrics) error {
+func (m *CDCManager) advanceCheckpoint(task *models.SyncTask, checkpoint *models.SyncCDCCheckpoint, file string, pos uint32, gtidSet string, sessionRows int64, started time.Time, eventTimestamp uint32, lastMetricsUpdate, lastMetricsLog *time.Time, lastMetricsRows *int64, lastMetricsOps *cdcOperationMetrics, opMetrics cdcOperationMetrics) error {
 	now := time.Now()
 	if !lastMetricsUpdate.IsZero() && now.Sub(*lastMetricsUpdate) < 3*time.Second {
 		return nil
 	}
 	*lastMetricsUpdate = now
 	checkpoint.BinlogFile, checkpoint.BinlogPosition, checkpoint.LastEventAt = file, pos, &now
-	if err := m.service.systemDB.Model(checkpoint).Updates(map[string]interface{}{"binlog_file": file, "binlog_position": pos, "last_event_at": &now, "snapshot_completed": checkpoint.SnapshotCompleted}).Error; err != nil {
+	updates := map[string]interface{}{"binlog_file": file, "binlog_position": pos, "server_uuid": checkpoint.ServerUUID, "last_event_at": &now, "snapshot_completed": checkpoint.SnapshotCompleted}
+	// 位点模式下尚未建立 GTID 基线时不覆盖已有集合
+	if gtidSet != "" {
+		checkpoint.GTIDSet = gtidSet
+		updates["gtid_set"] = gtidSet
+	}
+	if err := m.service.systemDB.Model(checkpoint).Updates(updates).Error; err != nil {
 		return err
 	}
+	if err := m.purgeResolvedXAPrepared(task.ID, file, pos); err != nil {
+		return err
+	}
+	eventTime := time.Time{}
+	if eventTimestamp > 0 {
+		eventTime = time.Unix(int64(eventTimestamp), 0)
+	}
+	return m.reportCDCProgress(task, now, fmt.Sprintf("%s:%d", file, pos), eventTime, sessionRows, started, lastMetricsLog, lastMetricsRows, lastMetricsOps, opMetrics)
+}
+
+// reportCDCProgress 按最近提交事件的时间更新任务延迟、吞吐和指标快照
+func (m *CDCManager) reportCDCProgress(task *models.SyncTask, now time.Time, position string, eventTime time.Time, sessionRows int64, started time.Time, lastMetricsLog *time.Time, lastMetricsRows *int64, lastMetricsOps *cdcOperationMetrics, opMetrics cdcOperationMetrics) error {
 	delay := int64(0)
-	eventTime := time.Unix(int64(eventTimestamp), 0)
-	if eventTimestamp > 0 && now.After(eventTime) {
+	if !eventTime.IsZero() && now.After(eventTime) {
 		delay = int64(now.Sub(eventTime).Seconds())
 	}
 	elapsed := time.Since(started).Seconds()
@@ -725,9 +850,9 @@ func (m *CDCManager) advanceCheckpoint(task *models.SyncTask, checkpoint *models
 		return err
 	}
 	// #region debug-point E:checkpoint_advanced
-	xaDebugReport("E", "cdc_service.go:advanceCheckpoint", "推进 checkpoint/指标", map[string]interface{}{"task_id": task.ID, "file": file, "pos": pos, "delay_seconds": delay, "runtime_status": runtimeStatus, "session_rows": sessionRows, "op_metrics": opMetrics})
+	xaDebugReport("E", "cdc_service.go:advanceCheckpoint", "推进 checkpoint/指标", map[string]interface{}{"task_id": task.ID, "position": position, "delay_seconds": delay, "runtime_status": runtimeStatus, "session_rows": sessionRows, "op_metrics": opMetrics})
 	// #endregion
-	log.Printf("[CDC] 任务 %d 位点 %s:%d 延迟 %ds 吞吐 %.0f rows/s 累计 %d 行 ops={i:%d u:%d d:%d}", task.ID, file, pos, delay, speed, sessionRows, opMetrics.Insert, opMetrics.Update, opMetrics.Delete)
+	log.Printf("[CDC] 任务 %d 位点 %s 延迟 %ds 吞吐 %.0f rows/s 累计 %d 行 ops={i:%d u:%d d:%d}", task.ID, position, delay, speed, sessionRows, opMetrics.Insert, opMetrics.Update, opMetrics.Delete)
 	return m.service.RecordCDCMetricSnapshot(task, now, delay, speed, sessionRows, lastMetricsLog, lastMetricsRows, lastMetricsOps, opMetrics)
 }
 
@@ -740,7 +865,7 @@ func mysqlColumnNames(connectionName, table string) ([]string, error) {
 }
 
 func mysqlColumnNamesFromDB(db *gorm.DB, table string) ([]string, error) {
-	columns, err := describeMySQLTable(db, table)
+	columns, err := dialectOf(db).describeTable(db, table)
 	if err != nil {
 		return nil, err
 	}
@@ -873,23 +998,86 @@ func xaKey(formatID uint32, gtrid, bqual []byte) string {
 	return fmt.Sprintf("%d:%s:%s", formatID, hex.EncodeToString(gtrid), hex.EncodeToString(bqual))
 }
 
-func normalizeXAPreparedValue(value interface{}) interface{} {
-	if t, ok := value.(time.Time); ok {
-		if t.IsZero() {
-			return value
+// 持久化行值的类型标记：字节按 base64、时间按 RFC3339Nano（保留纳秒和时区）、整数按十进制字符串保存，避免 JSON 往返丢失精度
+const (
+	cdcValueBytes = "bytes"
+	cdcValueTime  = "time"
+	cdcValueInt   = "int"
+	cdcValueUint  = "uint"
+)
+
+// encodeCDCValue 把行值转换为可 JSON 序列化的值和类型标记，无需标记的值类型为空
+func encodeCDCValue(value interface{}) (interface{}, string) {
+	switch v := value.(type) {
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), cdcValueBytes
+	case time.Time:
+		return v.Format(time.RFC3339Nano), cdcValueTime
+	case *time.Time:
+		if v == nil {
+			return nil, ""
 		}
-		return t.Format("2006-01-02 15:04:05")
+		return v.Format(time.RFC3339Nano), cdcValueTime
+	case int:
+		return strconv.FormatInt(int64(v), 10), cdcValueInt
+	case int8:
+		return strconv.FormatInt(int64(v), 10), cdcValueInt
+	case int16:
+		return strconv.FormatInt(int64(v), 10), cdcValueInt
+	case int32:
+		return strconv.FormatInt(int64(v), 10), cdcValueInt
+	case int64:
+		return strconv.FormatInt(v, 10), cdcValueInt
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), cdcValueUint
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), cdcValueUint
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), cdcValueUint
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), cdcValueUint
+	case uint64:
+		return strconv.FormatUint(v, 10), cdcValueUint
+	}
+	return value, ""
+}
+
+// decodeCDCValue 按类型标记还原 encodeCDCValue 保存的值
+func decodeCDCValue(value interface{}, kind string) (interface{}, error) {
+	text, ok := value.(string)
+	if kind == "" || !ok {
+		return value, nil
+	}
+	switch kind {
+	case cdcValueBytes:
+		return base64.StdEncoding.DecodeString(text)
+	case cdcValueTime:
+		return time.Parse(time.RFC3339Nano, text)
+	case cdcValueInt:
+		return strconv.ParseInt(text, 10, 64)
+	case cdcValueUint:
+		return strconv.ParseUint(text, 10, 64)
+	}
+	return nil, fmt.Errorf("未知的值类型 %s", kind)
+}
+
+// operationValues 还原记录中的行值
+func (r cdcOperationRecord) operationValues() ([]interface{}, error) {
+	if len(r.Types) == 0 {
+		return r.Values, nil
 	}
-	if t, ok := value.(*time.Time); ok {
-		if t == nil {
-			return nil
-		}
-		if t.IsZero() {
-			return *t
+	if len(r.Types) != len(r.Values) {
+		return nil, fmt.Errorf("行值与类型标记数量不一致")
+	}
+	values := make([]interface{}, len(r.Values))
+	for i, value := range r.Values {
+		decoded, err := decodeCDCValue(value, r.Types[i])
+		if err != nil {
+			return nil, fmt.Errorf("字段 %d 的值无法还原: %w", i+1, err)
 		}
-		return t.Format("2006-01-02 15:04:05")
+		values[i] = decoded
 	}
-	return normalizeMySQLScannedValue(value)
+	return values, nil
 }
 
 func (m *CDCManager) saveXAPrepared(taskID uint, xidKey, file string, pos uint32, operations []cdcOperation) error {
@@ -901,18 +1089,26 @@ func (m *CDCManager) saveXAPrepared(taskID uint, xidKey, file string, pos uint32
 	}
 	records := make([]cdcOperationRecord, 0, len(operations))
 	for _, op := range operations {
-		values := make([]interface{}, len(op.values))
-		for i := range op.values {
-			values[i] = normalizeXAPreparedValue(op.values[i])
-		}
-		records = append(records, cdcOperationRecord{Kind: op.kind, TaskTableID: op.mapping.ID, Columns: op.columns, Values: values})
+		records = append(records, cdcOperationRecordOf(op))
 	}
 	bytes, err := json.Marshal(records)
 	if err != nil {
 		return err
 	}
 	prepared := models.SyncXAPreparedTransaction{TaskID: taskID, XIDKey: xidKey, BinlogFile: file, BinlogPosition: pos, OperationsJSON: string(bytes)}
-	return m.service.systemDB.Where("task_id = ? AND xid_key = ?", taskID, xidKey).Assign(prepared).FirstOrCreate(&prepared).Error
+	// 同一 XID 再次 PREPARE 时清掉旧的提交标记，避免新事务被当作已提交清理
+	assign := map[string]interface{}{"binlog_file": file, "binlog_position": pos, "operations_json": string(bytes), "resolved_file": "", "resolved_position": 0}
+	return m.service.systemDB.Where("task_id = ? AND xid_key = ?", taskID, xidKey).Assign(assign).FirstOrCreate(&prepared).Error
+}
+
+// cdcOperationRecordOf 把行操作转换为可持久化的 JSON 记录，行值带类型标记以便原样还原
+func cdcOperationRecordOf(op cdcOperation) cdcOperationRecord {
+	values := make([]interface{}, len(op.values))
+	types := make([]string, len(op.values))
+	for i := range op.values {
+		values[i], types[i] = encodeCDCValue(op.values[i])
+	}
+	return cdcOperationRecord{Kind: op.kind, TaskTableID: op.mapping.ID, Columns: op.columns, Values: values, Types: types, Position: op.position, Change: op.change}
 }
 
 func (m *CDCManager) loadXAPreparedOperations(task *models.SyncTask, xidKey string) ([]cdcOperation, error) {
@@ -934,7 +1130,11 @@ func (m *CDCManager) loadXAPreparedOperations(task *models.SyncTask, xidKey stri
 		if mapping == nil {
 			return nil, fmt.Errorf("XA prepared 事务引用了不存在的同步表: %d", record.TaskTableID)
 		}
-		operations = append(operations, cdcOperation{kind: record.Kind, mapping: mapping, columns: record.Columns, values: record.Values})
+		values, err := record.operationValues()
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, cdcOperation{kind: record.Kind, mapping: mapping, columns: record.Columns, values: values, position: record.Position, change: record.Change})
 	}
 	return operations, nil
 }
@@ -997,6 +1197,7 @@ type cdcMergeBuffer struct {
 	// 记录缓冲内涉及的文件位点，供推进 checkpoint 使用
 	lastFile     string
 	lastPos      uint32
+	lastGTID     string
 	lastEventTs  uint32
 	lastAppended time.Time
 }
@@ -1006,10 +1207,11 @@ func newCDCMergeBuffer(task *models.SyncTask, systemDB *gorm.DB, streamStarted t
 }
 
 // append 将一个小事务的 operations 追加到缓冲
-func (b *cdcMergeBuffer) append(ops []cdcOperation, file string, pos, eventTs uint32) {
+func (b *cdcMergeBuffer) append(ops []cdcOperation, file string, pos uint32, gtidSet string, eventTs uint32) {
 	b.ops = append(b.ops, ops...)
 	b.lastFile = file
 	b.lastPos = pos
+	b.lastGTID = gtidSet
 	b.lastEventTs = eventTs
 	b.lastAppended = time.Now()
 }
@@ -1044,6 +1246,7 @@ func (b *cdcMergeBuffer) clear(file string, pos, eventTs uint32) {
 	b.ops = b.ops[:0]
 	b.lastFile = file
 	b.lastPos = pos
+	b.lastGTID = ""
 	b.lastEventTs = eventTs
 	b.lastAppended = time.Time{}
 }
@@ -1077,38 +1280,113 @@ func applyCDCProgress(systemDB *gorm.DB, taskID uint, batchRows int, batchDurati
 	}).Error
 }
 
+// appendCDCRowsOperations 把一个行事件转换为待应用操作。
+// 仅追加模式跳过更新和删除；整行匹配删除模式把更新拆成删除旧行加写入新行；历史模式保留全部变更。
+// 配置行过滤时不满足过滤的新行不写入，新行移出过滤范围的 UPDATE 转为删除目标行。删除不存在的目标行没有副作用，
+// 而 PostgreSQL 的旧行镜像可能只有行标识列，因此只有历史模式（会记录每次删除）才按旧行镜像跳过范围外的删除。
+func appendCDCRowsOperations(operations []cdcOperation, eventType replication.EventType, mapping *models.SyncTaskTable, columns []string, rows [][]interface{}, metrics *cdcOperationMetrics) []cdcOperation {
+	if metrics == nil {
+		metrics = &cdcOperationMetrics{}
+	}
+	history := writesHistory(mapping)
+	switch eventType {
+	case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
+		for _, row := range rows {
+			if !cdcRowInFilter(mapping, columns, row) {
+				continue
+			}
+			operations = append(operations, cdcOperation{kind: "upsert", mapping: mapping, columns: columns, values: row, change: "insert"})
+			metrics.Insert++
+		}
+	case replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
+		if mapping.RowIdentity == rowIdentityAppendOnly && !history {
+			return operations
+		}
+		for i := 1; i < len(rows); i += 2 {
+			if !cdcRowInFilter(mapping, columns, rows[i]) {
+				if !history || cdcRowInFilter(mapping, columns, rows[i-1]) {
+					operations = append(operations, cdcOperation{kind: "delete", mapping: mapping, columns: columns, values: rows[i-1], change: "delete"})
+					metrics.Delete++
+				}
+				continue
+			}
+			if mapping.RowIdentity == rowIdentityFullRow && !history {
+				operations = append(operations, cdcOperation{kind: "delete", mapping: mapping, columns: columns, values: rows[i-1], change: "update"})
+			}
+			operations = append(operations, cdcOperation{kind: "upsert", mapping: mapping, columns: columns, values: rows[i], change: "update"})
+			metrics.Update++
+		}
+	case replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2:
+		if mapping.RowIdentity == rowIdentityAppendOnly && !history {
+			return operations
+		}
+		for _, row := range rows {
+			if history && !cdcRowInFilter(mapping, columns, row) {
+				continue
+			}
+			operations = append(operations, cdcOperation{kind: "delete", mapping: mapping, columns: columns, values: row, change: "delete"})
+			metrics.Delete++
+		}
+	}
+	return operations
+}
+
 func applyCDCTransaction(db *gorm.DB, operations []cdcOperation, task *models.SyncTask, systemDB *gorm.DB, streamStarted time.Time) error {
+	if task != nil {
+		if err := checkTaskLeaseFence(task.ID); err != nil {
+			return err
+		}
+	}
+	operations, err := applyCDCRowPlugins(operations)
+	if err != nil {
+		return err
+	}
+	if workers := cdcApplyWorkers(task); workers > 1 && len(operations) > 1 && cdcParallelSafe(operations) {
+		err = applyCDCPartitions(db, partitionCDCOperations(operations, workers), task, systemDB, streamStarted)
+	} else {
+		err = applyCDCOperations(db, operations, task, systemDB, streamStarted)
+	}
+	if err == nil && task != nil {
+		recordCDCRunRows(task.ID, operations)
+	}
+	return err
+}
+
+// applyCDCOperations 按表映射合并写入一组操作，每写完一批更新一次任务进度
+func applyCDCOperations(db *gorm.DB, operations []cdcOperation, task *models.SyncTask, systemDB *gorm.DB, streamStarted time.Time) error {
+	var progress func(batchRows int, batchDuration time.Duration, processedTotal int)
+	// 轮询增量没有 CDC 会话起点，不按 CDC 方式更新任务速率
+	if task != nil && systemDB != nil && !streamStarted.IsZero() {
+		progress = func(batchRows int, batchDuration time.Duration, processedTotal int) {
+			applyCDCProgress(systemDB, task.ID, batchRows, batchDuration, streamStarted, processedTotal)
+		}
+	}
+	return writeCDCOperations(db, operations, task, systemDB, progress)
+}
+
+// writeCDCOperations 写入一组操作，progress 非空时每写完一批回调一次。
+// upsert 按表映射合并为批量写入，delete 逐条执行；删除前若同一行标识还有待写入的 upsert，先写入该表映射的待写批次，
+// 保证同一行的变更按源库顺序生效（如行移出过滤范围后又移回、软删除后重新插入）
+func writeCDCOperations(db *gorm.DB, operations []cdcOperation, task *models.SyncTask, systemDB *gorm.DB, progress func(batchRows int, batchDuration time.Duration, processedTotal int)) error {
 	if len(operations) == 0 {
 		return nil
 	}
-	// 1. 按 (mapping) 分组：upsert 行合并为批量，delete 逐条处理
+	taskID := uint(0)
+	if task != nil {
+		taskID = task.ID
+	}
 	type upsertGroup struct {
-		mapping *models.SyncTaskTable
-		columns []string
-		rows    []map[string]interface{}
+		mapping    *models.SyncTaskTable
+		columns    []string
+		rows       []map[string]interface{}
+		ops        []cdcOperation
+		identities map[string]bool
 	}
 	groups := make(map[*models.SyncTaskTable]*upsertGroup)
-	var deletes []cdcOperation
-	for _, op := range operations {
-		if op.kind == "upsert" {
-			g := groups[op.mapping]
-			if g == nil {
-				g = &upsertGroup{mapping: op.mapping, columns: op.columns}
-				groups[op.mapping] = g
-			}
-			row := make(map[string]interface{}, len(op.columns))
-			for i, column := range op.columns {
-				row[column] = normalizeMySQLScannedValue(op.values[i])
-			}
-			g.rows = append(g.rows, row)
-		} else {
-			deletes = append(deletes, op)
-		}
-	}
 	// 每批次独立提交，避免单个大事务导致 undo 膨胀和锁竞争
 	// 每写完一批就更新一次任务延迟和速率，避免大事务期间前端指标不刷新
 	processedTotal := 0
-	for _, g := range groups {
+	flush := func(g *upsertGroup) error {
 		batchSize := cdcMaxBatchRows(task)
 		rows := g.rows
 		for start := 0; start < len(rows); start += batchSize {
@@ -1117,34 +1395,138 @@ func applyCDCTransaction(db *gorm.DB, operations []cdcOperation, task *models.Sy
 				end = len(rows)
 			}
 			batchStart := time.Now()
-			if err := writeMySQLBatch(db, g.mapping, g.columns, rows[start:end]); err != nil {
-				return err
+			if err := writeTargetBatch(db, g.mapping, g.columns, rows[start:end]); err != nil {
+				if err := applyFailedOperations(db, g.ops[start:end], task, systemDB, err); err != nil {
+					return err
+				}
 			}
 			processedTotal += end - start
-			if task != nil && systemDB != nil {
-				applyCDCProgress(systemDB, task.ID, end-start, time.Since(batchStart), streamStarted, processedTotal)
+			if progress != nil {
+				progress(end-start, time.Since(batchStart), processedTotal)
+			}
+			log.Printf("[CDC] 大事务写入进度: task=%d batch=%d total=%d/%d 行", taskID, end-start, processedTotal, len(operations))
+		}
+		if len(rows) > 0 {
+			log.Printf("[CDC] 大事务写入完成: task=%d 总行数 %d 批大小 %d", taskID, len(rows), batchSize)
+		}
+		g.rows, g.ops, g.identities = nil, nil, map[string]bool{}
+		return nil
+	}
+	for _, op := range operations {
+		// 历史模式的删除也作为新行写入，与其他变更按原顺序进入同一组
+		if op.kind == "upsert" || writesHistory(op.mapping) {
+			g := groups[op.mapping]
+			if g == nil {
+				g = &upsertGroup{mapping: op.mapping, columns: op.columns, identities: map[string]bool{}}
+				groups[op.mapping] = g
+			} else if op.mapping.PluginID != nil {
+				// 插件输出的字段可能逐行不同，分组字段取并集
+				g.columns = pluginColumns(g.columns, []map[string]interface{}{cdcOperationRow(op)})
+			}
+			g.rows = append(g.rows, cdcOperationRow(op))
+			g.ops = append(g.ops, op)
+			g.identities[cdcOperationIdentity(op)] = true
+			continue
+		}
+		if g := groups[op.mapping]; g != nil && g.identities[cdcOperationIdentity(op)] {
+			if err := flush(g); err != nil {
+				return err
 			}
-			log.Printf("[CDC] 大事务写入进度: task=%d batch=%d total=%d/%d 行", task.ID, end-start, processedTotal, len(operations))
 		}
-		log.Printf("[CDC] 大事务写入完成: task=%d 总行数 %d 批大小 %d", task.ID, len(rows), batchSize)
+		if err := applyCDCDelete(db, op); err != nil {
+			if err := applyFailedOperations(db, []cdcOperation{op}, task, systemDB, err); err != nil {
+				return err
+			}
+		}
+	}
+	for _, g := range groups {
+		if err := flush(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cdcOperationIdentity 返回操作定位的目标行：有行标识时为标识列取值，无键表为整行取值
+func cdcOperationIdentity(op cdcOperation) string {
+	if keys := primaryKeyColumns(op.mapping.SourcePrimaryKey); len(keys) > 0 && !keylessRowIdentity(op.mapping) {
+		return rowPrimaryKey(cdcOperationRow(op), keys)
 	}
-	// delete 操作也独立提交
-	for _, op := range deletes {
+	values := make([]string, len(op.values))
+	for i, value := range op.values {
+		values[i] = valueString(normalizeMySQLScannedValue(value))
+	}
+	return encodePrimaryKey(values)
+}
+
+// applyCDCDelete 按表映射的删除方式处理删除：忽略、标记软删除或按行标识删除目标行。
+// 全行匹配模式下 UPDATE 拆出的删除只是替换旧行，始终物理删除。
+func applyCDCDelete(db *gorm.DB, op cdcOperation) error {
+	sourceDelete := op.change != "update"
+	switch {
+	case sourceDelete && op.mapping.DeleteMode == deleteModeIgnore:
+		return nil
+	case sourceDelete && softDeletes(op.mapping):
+		return markCDCDeleted(db, op)
+	case op.mapping.RowIdentity == rowIdentityFullRow:
+		return deleteCDCFullRow(db, op)
+	}
+	dialect := dialectOf(db)
+	conditions, args, err := cdcIdentityConditions(dialect, op)
+	if err != nil {
+		return err
+	}
+	return db.Exec("DELETE FROM "+dialect.quoteTable(op.mapping.TargetTable)+" WHERE "+strings.Join(conditions, " AND "), args...).Error
+}
+
+// cdcIdentityConditions 生成按行标识定位目标行的条件，目标为分片合并表时附加分片过滤条件
+func cdcIdentityConditions(dialect sqlDialect, op cdcOperation) ([]string, []interface{}, error) {
+	sourceKeys, targetKeys := primaryKeyColumns(op.mapping.SourcePrimaryKey), primaryKeyColumns(op.mapping.TargetPrimaryKey)
+	if len(sourceKeys) == 0 || len(sourceKeys) != len(targetKeys) {
+		return nil, nil, fmt.Errorf("表 %s 主键映射不完整", op.mapping.SourceTable)
+	}
+	conditions := make([]string, len(sourceKeys))
+	args := make([]interface{}, len(sourceKeys))
+	for k, key := range sourceKeys {
 		pkIndex := -1
 		for i, column := range op.columns {
-			if column == op.mapping.SourcePrimaryKey {
+			if column == key {
 				pkIndex = i
 				break
 			}
 		}
 		if pkIndex < 0 {
-			return fmt.Errorf("表 %s 缺少主键列", op.mapping.SourceTable)
-		}
-		if err := db.Exec("DELETE FROM "+quoteMySQL(op.mapping.TargetTable)+" WHERE "+quoteMySQL(op.mapping.TargetPrimaryKey)+" = ?", normalizeMySQLScannedValue(op.values[pkIndex])).Error; err != nil {
-			return err
+			return nil, nil, fmt.Errorf("表 %s 缺少主键列 %s", op.mapping.SourceTable, key)
 		}
+		conditions[k] = dialect.quote(targetKeys[k]) + " = ?"
+		args[k] = normalizeMySQLScannedValue(op.values[pkIndex])
 	}
-	return nil
+	conditions, args = targetShardFilter(op.mapping).applyQuoted(dialect.quote, conditions, args)
+	return conditions, args, nil
+}
+
+// deleteCDCFullRow 按旧行全部同步字段匹配目标行，只删除一条以保留其余重复行
+func deleteCDCFullRow(db *gorm.DB, op cdcOperation) error {
+	pairs, err := syncColumnPairs(db, op.mapping, op.columns)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]interface{}, len(op.columns))
+	for i, column := range op.columns {
+		values[column] = normalizeMySQLScannedValue(op.values[i])
+	}
+	dialect := dialectOf(db)
+	conditions := make([]string, len(pairs))
+	args := make([]interface{}, len(pairs))
+	for i, pair := range pairs {
+		conditions[i] = dialect.nullSafeEqual(pair.target)
+		args[i] = values[pair.source]
+	}
+	if len(conditions) == 0 {
+		return fmt.Errorf("表 %s 没有可匹配的同步字段", op.mapping.SourceTable)
+	}
+	conditions, args = targetShardFilter(op.mapping).applyQuoted(dialect.quote, conditions, args)
+	return db.Exec(dialect.deleteOneQuery(op.mapping.TargetTable, conditions), args...).Error
 }
 
 func (s *SyncService) recordCDCFailure(task *models.SyncTask, err error) {
@@ -1161,7 +1543,7 @@ func (s *SyncService) recordCDCStopped(task *models.SyncTask) {
 	var checkpoint models.SyncCDCCheckpoint
 	detail := ""
 	if err := s.systemDB.Where("task_id = ?", task.ID).First(&checkpoint).Error; err == nil {
-		detail = fmt.Sprintf("停留位点 %s:%d", checkpoint.BinlogFile, checkpoint.BinlogPosition)
+		detail = "停留位点 " + cdcCheckpointLabel(&checkpoint)
 	}
 	s.RecordTaskEvent(task, "cdc_stopped", "cdc", "success", "Binlog 增量同步已停止", detail, 0, 0)
 }
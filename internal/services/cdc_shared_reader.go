@@ -0,0 +1,425 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/redgreat/mergewong/internal/database"
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+// 同一源连接上的多个 CDC 任务共用一个 Binlog dump：读取器按位点把事件分发给各任务的订阅，
+// 每个订阅有独立缓冲并按自己的检查点跳过已处理的事件。检查点落后于读取器的新订阅先用独立的追赶读取，
+// 追上共享位点后再加入，不让读取器回退重放。订阅持续积压累计超过等待时长时读取器不再等待它，
+// 该任务从自己的检查点重启并改为独立读取，不会长时间拖住其他任务。
+
+const (
+	cdcSharedReaderBuffer       = 1024
+	cdcSharedReaderStallTimeout = 30 * time.Second
+)
+
+// Binlog dump 的 server_id 按用途分段，每段按 ID 取模，不同用途之间不会冲突。独立、追赶和加表读取按任务编号，
+// 任务同一时刻只由持有租约的实例运行；共享读取器每个实例各自运行，按实例 ID 和源连接编号取哈希，
+// 避免多个实例以同一 server_id 注册时源库互相踢掉对方的 dump
+const (
+	binlogServerIDRange           = 500000000
+	binlogServerIDDedicated       = 1000000000
+	binlogServerIDShared          = 1500000000
+	binlogServerIDCatchup         = 2000000000
+	binlogServerIDTableOnboarding = 2500000000
+)
+
+func binlogServerID(base uint32, id uint) uint32 {
+	return base + uint32(id%binlogServerIDRange)
+}
+
+func sharedBinlogServerID(instance string, sourceID uint) uint32 {
+	hash := fnv.New32a()
+	fmt.Fprintf(hash, "%s/%d", instance, sourceID)
+	return binlogServerID(binlogServerIDShared, uint(hash.Sum32()))
+}
+
+var errCDCSubscriptionStalled = errors.New("共享 Binlog 读取等待超时")
+
+// cdcSharedReaderEnabled 默认开启，MERGEWONG_CDC_SHARED_READER=0 时每个任务独立读取
+func cdcSharedReaderEnabled() bool {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("MERGEWONG_CDC_SHARED_READER")))
+	return value != "0" && value != "false" && value != "off"
+}
+
+// cdcEventSource 是 stream 消费 Binlog 事件的来源
+type cdcEventSource interface {
+	GetEvent(ctx context.Context) (*replication.BinlogEvent, error)
+	Close()
+}
+
+type dedicatedBinlogSource struct {
+	syncer   *replication.BinlogSyncer
+	streamer *replication.BinlogStreamer
+}
+
+func (s *dedicatedBinlogSource) GetEvent(ctx context.Context) (*replication.BinlogEvent, error) {
+	return s.streamer.GetEvent(ctx)
+}
+
+func (s *dedicatedBinlogSource) Close() { s.syncer.Close() }
+
+func newBinlogSyncer(serverID uint32, source *models.DatabaseConnection) *replication.BinlogSyncer {
+	return replication.NewBinlogSyncer(replication.BinlogSyncerConfig{ServerID: serverID, Flavor: "mysql", Host: source.Host, Port: uint16(source.Port), User: source.Username, Password: source.Password, Charset: source.Charset, ParseTime: true, HeartbeatPeriod: 10 * time.Second})
+}
+
+// openDedicatedBinlogSource 为单个任务建立独立 dump，有 GTID 集合时按 GTID 恢复
+func openDedicatedBinlogSource(task *models.SyncTask, source *models.DatabaseConnection, checkpoint *models.SyncCDCCheckpoint) (cdcEventSource, error) {
+	syncer := newBinlogSyncer(binlogServerID(binlogServerIDDedicated, task.ID), source)
+	var streamer *replication.BinlogStreamer
+	var err error
+	if useGTIDResume(task, checkpoint) {
+		gtidSet, parseErr := parseGTIDSet(checkpoint.GTIDSet)
+		if parseErr != nil {
+			syncer.Close()
+			return nil, parseErr
+		}
+		streamer, err = syncer.StartSyncGTID(gtidSet)
+	} else {
+		streamer, err = syncer.StartSync(gomysql.Position{Name: checkpoint.BinlogFile, Pos: checkpoint.BinlogPosition})
+	}
+	if err != nil {
+		syncer.Close()
+		return nil, err
+	}
+	return &dedicatedBinlogSource{syncer: syncer, streamer: streamer}, nil
+}
+
+// openBinlogSource 优先订阅源连接的共享读取器，共享读取器按文件位点读取。有 GTID 集合的检查点只有确认文件位点
+// 属于当前源库（server_uuid 一致）时才加入，否则（如主从切换后新主库有同名文件）按 GTID 独立读取，
+// 之后推进的检查点会记下当前源库，下次启动即可加入共享读取器。任务曾因消费过慢被摘除时也独立读取
+func (m *CDCManager) openBinlogSource(task *models.SyncTask, source *models.DatabaseConnection, checkpoint *models.SyncCDCCheckpoint) (cdcEventSource, error) {
+	m.readerMu.Lock()
+	dedicated := m.dedicated[task.ID]
+	m.readerMu.Unlock()
+	serverUUID := ""
+	if sourceDB, err := database.GetManager().GetConnection(task.SourceDB); err == nil {
+		serverUUID = mysqlServerUUID(sourceDB)
+	}
+	confirmed := serverUUID != "" && checkpoint.ServerUUID == serverUUID
+	// 本次会话读到的位点都来自当前源库，随检查点一起持久化
+	checkpoint.ServerUUID = serverUUID
+	if dedicated || !cdcSharedReaderEnabled() || (useGTIDResume(task, checkpoint) && (!confirmed || m.ensureBinlogPositionValid(task, checkpoint) != nil)) {
+		return openDedicatedBinlogSource(task, source, checkpoint)
+	}
+	return m.subscribeBinlog(task, source, gomysql.Position{Name: checkpoint.BinlogFile, Pos: checkpoint.BinlogPosition})
+}
+
+type sharedBinlogItem struct {
+	event *replication.BinlogEvent
+	file  string
+}
+
+type sharedBinlogReader struct {
+	manager *CDCManager
+	source  models.DatabaseConnection
+	joinMu  sync.Mutex
+	mu      sync.Mutex
+	subs    map[uint]*binlogSubscription
+	// position 是已开始分发的最后一个事件位点，晚于它加入的订阅不会漏事件
+	position gomysql.Position
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+type binlogSubscription struct {
+	reader  *sharedBinlogReader
+	task    *models.SyncTask
+	items   chan sharedBinlogItem
+	stopped chan struct{}
+	once    sync.Once
+	err     error
+	// last 是已交给任务的最后位点，读取器回退重放时据此跳过重复事件
+	last gomysql.Position
+	// catchup 非空时订阅尚未加入读取器，事件来自独立的追赶读取
+	catchup     *dedicatedBinlogSource
+	catchupFile string
+	// blockedSince 是缓冲开始积压的时间，只由读取器协程访问
+	blockedSince time.Time
+}
+
+func (m *CDCManager) subscribeBinlog(task *models.SyncTask, source *models.DatabaseConnection, start gomysql.Position) (cdcEventSource, error) {
+	m.readerMu.Lock()
+	reader := m.readers[source.ID]
+	if reader == nil {
+		reader = &sharedBinlogReader{manager: m, source: *source, subs: map[uint]*binlogSubscription{}}
+		m.readers[source.ID] = reader
+	}
+	m.readerMu.Unlock()
+	return reader.subscribe(task, start)
+}
+
+func (r *sharedBinlogReader) subscribe(task *models.SyncTask, start gomysql.Position) (*binlogSubscription, error) {
+	r.joinMu.Lock()
+	defer r.joinMu.Unlock()
+	sub := &binlogSubscription{reader: r, task: task, items: make(chan sharedBinlogItem, cdcSharedReaderBuffer), stopped: make(chan struct{}), last: start}
+	r.mu.Lock()
+	running := r.cancel != nil
+	behind := running && start.Compare(r.position) < 0
+	if !behind {
+		r.subs[task.ID] = sub
+	}
+	r.mu.Unlock()
+	if behind {
+		// 读取器已越过新订阅的检查点：独立追赶到共享位点后再加入，其他任务不受影响
+		syncer := newBinlogSyncer(binlogServerID(binlogServerIDCatchup, task.ID), &r.source)
+		streamer, err := syncer.StartSync(start)
+		if err != nil {
+			syncer.Close()
+			return nil, err
+		}
+		sub.catchup, sub.catchupFile = &dedicatedBinlogSource{syncer: syncer, streamer: streamer}, start.Name
+		log.Printf("[CDC] 任务 %d 检查点 %s:%d 落后于共享 Binlog 读取器 %s，先独立追赶", task.ID, start.Name, start.Pos, r.source.Name)
+		return sub, nil
+	}
+	if running {
+		return sub, nil
+	}
+	r.restart(start)
+	log.Printf("[CDC] 共享 Binlog 读取器 %s 从 %s:%d 开始，订阅任务 %d", r.source.Name, start.Name, start.Pos, task.ID)
+	return sub, nil
+}
+
+// join 在追赶读取到达共享位点后把订阅加入读取器；读取器已空闲停止时从订阅位点重新启动
+func (r *sharedBinlogReader) join(sub *binlogSubscription) bool {
+	r.joinMu.Lock()
+	defer r.joinMu.Unlock()
+	r.mu.Lock()
+	running := r.cancel != nil
+	if running && sub.last.Compare(r.position) < 0 {
+		r.mu.Unlock()
+		return false
+	}
+	r.subs[sub.task.ID] = sub
+	r.mu.Unlock()
+	if !running {
+		r.restart(sub.last)
+		log.Printf("[CDC] 共享 Binlog 读取器 %s 从 %s:%d 开始，订阅任务 %d", r.source.Name, sub.last.Name, sub.last.Pos, sub.task.ID)
+	}
+	return true
+}
+
+func (r *sharedBinlogReader) restart(start gomysql.Position) {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	if done != nil {
+		<-done
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done = make(chan struct{})
+	r.mu.Lock()
+	r.cancel, r.done, r.position = cancel, done, start
+	r.mu.Unlock()
+	go func() {
+		defer close(done)
+		r.run(ctx, start)
+	}()
+}
+
+func (r *sharedBinlogReader) run(ctx context.Context, start gomysql.Position) {
+	syncer := newBinlogSyncer(sharedBinlogServerID(InstanceID(), r.source.ID), &r.source)
+	defer syncer.Close()
+	streamer, err := syncer.StartSync(start)
+	if err != nil {
+		r.failAll(ctx, err)
+		return
+	}
+	file := start.Name
+	for {
+		event, err := streamer.GetEvent(ctx)
+		if err != nil {
+			r.failAll(ctx, err)
+			return
+		}
+		if rotate, ok := event.Event.(*replication.RotateEvent); ok {
+			file = string(rotate.NextLogName)
+		}
+		r.mu.Lock()
+		if event.Header.LogPos > 0 {
+			r.position = gomysql.Position{Name: file, Pos: event.Header.LogPos}
+		}
+		subs := make([]*binlogSubscription, 0, len(r.subs))
+		for _, sub := range r.subs {
+			subs = append(subs, sub)
+		}
+		r.mu.Unlock()
+		for _, sub := range subs {
+			if !sub.deliver(ctx, sharedBinlogItem{event: event, file: file}) && ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// failAll 在读取器出错时结束所有订阅，由各任务按原有失败流程处理；读取器被主动停止时不算失败
+func (r *sharedBinlogReader) failAll(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	log.Printf("[CDC] 共享 Binlog 读取器 %s 停止: %v", r.source.Name, err)
+	r.mu.Lock()
+	subs := r.subs
+	r.subs = map[uint]*binlogSubscription{}
+	r.cancel = nil
+	r.mu.Unlock()
+	for _, sub := range subs {
+		sub.stop(err)
+	}
+}
+
+func (r *sharedBinlogReader) unsubscribe(sub *binlogSubscription) {
+	r.mu.Lock()
+	if r.subs[sub.task.ID] == sub {
+		delete(r.subs, sub.task.ID)
+	}
+	idle := len(r.subs) == 0
+	cancel := r.cancel
+	if idle {
+		r.cancel = nil
+	}
+	r.mu.Unlock()
+	if idle && cancel != nil {
+		cancel()
+	}
+}
+
+// deliver 把事件放入订阅缓冲；缓冲从开始积压起累计超过等待时长仍未消化到一半以下时摘除该订阅，
+// 避免消费者每次只腾出一个位置时读取器反复等待
+func (s *binlogSubscription) deliver(ctx context.Context, item sharedBinlogItem) bool {
+	select {
+	case s.items <- item:
+		if len(s.items) < cap(s.items)/2 {
+			s.blockedSince = time.Time{}
+		}
+		return true
+	case <-s.stopped:
+		return false
+	case <-ctx.Done():
+		return false
+	default:
+	}
+	if s.blockedSince.IsZero() {
+		s.blockedSince = time.Now()
+	}
+	wait := cdcSharedReaderStallTimeout - time.Since(s.blockedSince)
+	if wait <= 0 {
+		s.reader.unsubscribe(s)
+		s.stop(errCDCSubscriptionStalled)
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case s.items <- item:
+		return true
+	case <-s.stopped:
+		return false
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		s.reader.unsubscribe(s)
+		s.stop(errCDCSubscriptionStalled)
+		return false
+	}
+}
+
+func (s *binlogSubscription) stop(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.stopped)
+	})
+}
+
+func (s *binlogSubscription) GetEvent(ctx context.Context) (*replication.BinlogEvent, error) {
+	for s.catchup != nil {
+		event, err := s.catchup.GetEvent(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if rotate, ok := event.Event.(*replication.RotateEvent); ok {
+			s.catchupFile = string(rotate.NextLogName)
+		}
+		accepted := s.accept(event, s.catchupFile)
+		if event.Header.LogPos > 0 && s.reader.join(s) {
+			s.catchup.Close()
+			s.catchup = nil
+		}
+		if accepted {
+			return event, nil
+		}
+	}
+	for {
+		var item sharedBinlogItem
+		select {
+		case item = <-s.items:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.stopped:
+			select {
+			case item = <-s.items:
+			default:
+				return nil, s.err
+			}
+		}
+		if s.accept(item.event, item.file) {
+			return item.event, nil
+		}
+	}
+}
+
+// accept 跳过检查点及之前的事件；Rotate 只在切到更新的位点时转交，避免重放时文件名回退
+func (s *binlogSubscription) accept(event *replication.BinlogEvent, file string) bool {
+	if rotate, ok := event.Event.(*replication.RotateEvent); ok {
+		next := gomysql.Position{Name: string(rotate.NextLogName), Pos: uint32(rotate.Position)}
+		if next.Compare(s.last) <= 0 {
+			return false
+		}
+		s.last = next
+		return true
+	}
+	position := gomysql.Position{Name: file, Pos: event.Header.LogPos}
+	if event.Header.LogPos == 0 || position.Compare(s.last) <= 0 {
+		return false
+	}
+	s.last = position
+	return true
+}
+
+func (s *binlogSubscription) Close() {
+	if s.catchup != nil {
+		s.catchup.Close()
+		s.catchup = nil
+	}
+	s.reader.unsubscribe(s)
+	s.stop(context.Canceled)
+}
+
+// detachStalledTask 让被共享读取器摘除的任务从检查点重启，之后在本进程内改为独立读取
+func (m *CDCManager) detachStalledTask(task *models.SyncTask) {
+	m.readerMu.Lock()
+	m.dedicated[task.ID] = true
+	m.readerMu.Unlock()
+	log.Printf("[CDC] 任务 %d 消费过慢，已从共享 Binlog 读取器摘除，改为独立读取", task.ID)
+	m.service.RecordTaskEvent(task, "cdc_reader_detached", "cdc", "running", "消费落后，已切换为独立 Binlog 读取", fmt.Sprintf("缓冲积压累计超过 %s，任务从检查点重启", cdcSharedReaderStallTimeout), 0, 0)
+	if err := m.StartTask(task.ID, RunTriggerRecovery); err != nil {
+		log.Printf("[CDC] 任务 %d 切换独立读取后重启失败: %v", task.ID, err)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestBinlogSubscriptionAccept(t *testing.T) {
+	rows := func(pos uint32) *replication.BinlogEvent {
+		return &replication.BinlogEvent{Header: &replication.EventHeader{LogPos: pos}, Event: &replication.RowsEvent{}}
+	}
+	rotate := func(name string) *replication.BinlogEvent {
+		return &replication.BinlogEvent{Header: &replication.EventHeader{}, Event: &replication.RotateEvent{NextLogName: []byte(name), Position: 4}}
+	}
+	sub := &binlogSubscription{last: gomysql.Position{Name: "mysql-bin.000002", Pos: 500}}
+	tests := []struct {
+		name  string
+		event *replication.BinlogEvent
+		file  string
+		want  bool
+	}{
+		{name: "replayed rotate", event: rotate("mysql-bin.000001"), file: "mysql-bin.000001"},
+		{name: "replayed event", event: rows(900), file: "mysql-bin.000001"},
+		{name: "rotate to checkpoint file", event: rotate("mysql-bin.000002"), file: "mysql-bin.000002"},
+		{name: "at checkpoint", event: rows(500), file: "mysql-bin.000002"},
+		{name: "after checkpoint", event: rows(620), file: "mysql-bin.000002", want: true},
+		{name: "replayed after accept", event: rows(620), file: "mysql-bin.000002"},
+		{name: "next file", event: rotate("mysql-bin.000003"), file: "mysql-bin.000003", want: true},
+		{name: "first event in next file", event: rows(120), file: "mysql-bin.000003", want: true},
+	}
+	for _, tt := range tests {
+		if got := sub.accept(tt.event, tt.file); got != tt.want {
+			t.Fatalf("%s: accept = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBinlogSubscriptionDeliverStallIsCumulative(t *testing.T) {
+	reader := &sharedBinlogReader{subs: map[uint]*binlogSubscription{}}
+	sub := &binlogSubscription{reader: reader, task: &models.SyncTask{ID: 1}, items: make(chan sharedBinlogItem, 2), stopped: make(chan struct{})}
+	reader.subs[1] = sub
+	item := sharedBinlogItem{event: &replication.BinlogEvent{Header: &replication.EventHeader{LogPos: 100}}}
+	sub.items <- item
+	sub.items <- item
+	sub.blockedSince = time.Now().Add(-cdcSharedReaderStallTimeout)
+	if sub.deliver(context.Background(), item) {
+		t.Fatalf("deliver should give up once the backlog has lasted longer than the stall timeout")
+	}
+	if !errors.Is(sub.err, errCDCSubscriptionStalled) {
+		t.Fatalf("err = %v, want %v", sub.err, errCDCSubscriptionStalled)
+	}
+	if _, ok := reader.subs[1]; ok {
+		t.Fatalf("stalled subscription should be removed from the reader")
+	}
+
+	sub = &binlogSubscription{reader: reader, task: &models.SyncTask{ID: 2}, items: make(chan sharedBinlogItem, 4), stopped: make(chan struct{})}
+	sub.blockedSince = time.Now().Add(-time.Second)
+	if !sub.deliver(context.Background(), item) || !sub.blockedSince.IsZero() {
+		t.Fatalf("draining below half the buffer should reset the backlog timer")
+	}
+	sub.items <- item
+	sub.items <- item
+	sub.blockedSince = time.Now().Add(-time.Second)
+	if !sub.deliver(context.Background(), item) || sub.blockedSince.IsZero() {
+		t.Fatalf("a buffer still more than half full should keep the backlog timer")
+	}
+}
+
+func TestSharedBinlogReaderJoin(t *testing.T) {
+	reader := &sharedBinlogReader{subs: map[uint]*binlogSubscription{}, cancel: func() {}, position: gomysql.Position{Name: "mysql-bin.000003", Pos: 800}}
+	sub := &binlogSubscription{reader: reader, task: &models.SyncTask{ID: 7}, last: gomysql.Position{Name: "mysql-bin.000003", Pos: 400}}
+	if reader.join(sub) {
+		t.Fatalf("subscription behind the shared position should keep catching up")
+	}
+	sub.last.Pos = 800
+	if !reader.join(sub) || reader.subs[7] != sub {
+		t.Fatalf("subscription at the shared position should join the reader")
+	}
+}
+
+func TestBinlogServerIDRangesDoNotOverlap(t *testing.T) {
+	bases := []uint32{binlogServerIDDedicated, binlogServerIDShared, binlogServerIDCatchup, binlogServerIDTableOnboarding}
+	ids := []uint{1, 10000, 99999, binlogServerIDRange - 1, binlogServerIDRange + 3}
+	seen := map[uint32]uint32{}
+	for _, base := range bases {
+		for _, id := range ids {
+			serverID := binlogServerID(base, id)
+			if serverID < base || serverID >= base+binlogServerIDRange {
+				t.Fatalf("server id %d for id %d escapes range %d", serverID, id, base)
+			}
+			if other, ok := seen[serverID]; ok && other != base {
+				t.Fatalf("server id %d used by ranges %d and %d", serverID, other, base)
+			}
+			seen[serverID] = base
+		}
+	}
+}
+
+func TestSharedBinlogServerIDPerInstance(t *testing.T) {
+	first, second := sharedBinlogServerID("node-a", 3), sharedBinlogServerID("node-b", 3)
+	if first == second {
+		t.Fatalf("instances share server id %d for the same source", first)
+	}
+	if first != sharedBinlogServerID("node-a", 3) {
+		t.Fatalf("server id should be stable for an instance and source")
+	}
+	for _, serverID := range []uint32{first, second, sharedBinlogServerID("node-a", 4)} {
+		if serverID < binlogServerIDShared || serverID >= binlogServerIDShared+binlogServerIDRange {
+			t.Fatalf("server id %d escapes the shared range", serverID)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/redgreat/mergewong/internal/database"
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// 全量 + CDC 的快照方式。replay 先记录 Binlog 位点再无锁分页读取，读到的行可能晚于位点，靠回放位点之后的 Binlog 收敛；
+// consistent 在短暂读锁内让所有读取会话同时开启 CONSISTENT SNAPSHOT 事务并读取位点，解锁后各分片都从这组会话读取，
+// 快照恰好等于位点时刻的数据，CDC 只需回放快照之后的变更。
+const (
+	snapshotModeReplay     = "replay"
+	snapshotModeConsistent = "consistent"
+)
+
+func normalizeSnapshotMode(mode string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", snapshotModeReplay:
+		return snapshotModeReplay, nil
+	case snapshotModeConsistent:
+		return snapshotModeConsistent, nil
+	default:
+		return "", fmt.Errorf("不支持的快照方式: %s", mode)
+	}
+}
+
+// snapshotLockWaitSeconds 限制加读锁的等待时间，源库有长事务时宁可失败也不让排队的读锁长时间阻塞业务写入
+func snapshotLockWaitSeconds() int {
+	return envPositiveInt("MERGEWONG_SNAPSHOT_LOCK_WAIT_SECONDS", 10)
+}
+
+// consistentSnapshot 是一组处于同一一致性读视图的源库会话，以及该时刻的 Binlog 位点
+type consistentSnapshot struct {
+	conns    []*sql.Conn
+	sessions chan *gorm.DB
+	status   *mysqlMasterStatus
+	lockMode string
+}
+
+// consistentSnapshots 保存正在全量初始化的任务所用的快照，分片读取时从中借用会话
+var consistentSnapshots sync.Map
+
+// openConsistentSnapshot 优先用 FLUSH TABLES WITH READ LOCK，没有 RELOAD 权限时退回 LOCK TABLES 只锁同步表；
+// 锁只在开启会话和读取位点期间持有。只锁同步表时其他表的写入仍会推进位点，但这些事件不属于同步对象，不影响一致性。
+func openConsistentSnapshot(ctx context.Context, db *gorm.DB, tables []string, size int) (*consistentSnapshot, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if limit := sqlDB.Stats().MaxOpenConnections; limit > 0 && size > limit-2 {
+		// 给加锁会话和统计行数、切分分片的查询留出连接
+		size = limit - 2
+	}
+	if size < 1 {
+		size = 1
+	}
+	lockConn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer lockConn.Close()
+	if _, err := lockConn.ExecContext(ctx, fmt.Sprintf("SET SESSION lock_wait_timeout = %d", snapshotLockWaitSeconds())); err != nil {
+		return nil, err
+	}
+	snapshot := &consistentSnapshot{sessions: make(chan *gorm.DB, size), lockMode: "global"}
+	if _, err := lockConn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err != nil {
+		locks := make([]string, len(tables))
+		for i, table := range tables {
+			locks[i] = quoteMySQLTable(table) + " READ"
+		}
+		if _, tableErr := lockConn.ExecContext(ctx, "LOCK TABLES "+strings.Join(locks, ",")); tableErr != nil {
+			return nil, fmt.Errorf("建立一致性快照加读锁失败: %v；%v", err, tableErr)
+		}
+		snapshot.lockMode = "tables"
+	}
+	unlocked := false
+	unlock := func() {
+		if !unlocked {
+			unlocked = true
+			_, _ = lockConn.ExecContext(context.Background(), "UNLOCK TABLES")
+		}
+	}
+	defer unlock()
+	for i := 0; i < size; i++ {
+		conn, err := sqlDB.Conn(ctx)
+		if err != nil {
+			snapshot.close()
+			return nil, err
+		}
+		snapshot.conns = append(snapshot.conns, conn)
+		if _, err := conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY"); err != nil {
+			snapshot.close()
+			return nil, fmt.Errorf("开启一致性快照事务失败: %w", err)
+		}
+		session := db.Session(&gorm.Session{NewDB: true, Context: ctx})
+		session.Statement.ConnPool = conn
+		snapshot.sessions <- session
+	}
+	lockSession := db.Session(&gorm.Session{NewDB: true, Context: ctx})
+	lockSession.Statement.ConnPool = lockConn
+	status, err := mysqlMasterStatusOf(lockSession)
+	unlock()
+	if err != nil {
+		snapshot.close()
+		return nil, err
+	}
+	snapshot.status = status
+	return snapshot, nil
+}
+
+func (s *consistentSnapshot) acquire() *gorm.DB {
+	return <-s.sessions
+}
+
+func (s *consistentSnapshot) release(session *gorm.DB) {
+	s.sessions <- session
+}
+
+func (s *consistentSnapshot) close() {
+	for _, conn := range s.conns {
+		_, _ = conn.ExecContext(context.Background(), "COMMIT")
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+// snapshotReader 返回任务当前一致性快照的读取会话；未使用一致性快照时直接用源连接
+func snapshotReader(taskID uint, sourceDB *gorm.DB) (*gorm.DB, func()) {
+	value, ok := consistentSnapshots.Load(taskID)
+	if !ok {
+		return sourceDB, func() {}
+	}
+	snapshot := value.(*consistentSnapshot)
+	session := snapshot.acquire()
+	return session, func() { snapshot.release(session) }
+}
+
+// syncConsistentSnapshot 建立一致性快照，把 CDC 起点改为快照时刻的位点后执行全量初始化。
+// 快照无法跨进程保留，中断后重新开始时丢弃已完成的分片，整体重新建立快照。
+func (s *SyncService) syncConsistentSnapshot(ctx context.Context, task *models.SyncTask, checkpoint *models.SyncCDCCheckpoint) (int64, error) {
+	sourceDB, err := database.GetManager().GetConnection(task.SourceDB)
+	if err != nil {
+		return 0, err
+	}
+	tableIDs := s.systemDB.Model(&models.SyncTaskTable{}).Select("id").Where("task_id = ?", task.ID)
+	if err := s.systemDB.Where("task_table_id IN (?)", tableIDs).Delete(&models.SyncCheckpoint{}).Error; err != nil {
+		return 0, err
+	}
+	if err := s.systemDB.Where("task_table_id IN (?)", tableIDs).Delete(&models.SyncSnapshotShardCheckpoint{}).Error; err != nil {
+		return 0, err
+	}
+	tables := make([]string, len(task.TaskTables))
+	for i := range task.TaskTables {
+		tables[i] = sourceTableName(&task.TaskTables[i])
+	}
+	snapshot, err := openConsistentSnapshot(ctx, sourceDB, tables, snapshotTableWorkers(task)*snapshotShardWorkers(task))
+	if err != nil {
+		return 0, err
+	}
+	defer snapshot.close()
+	old := cdcCheckpointLabel(checkpoint)
+	checkpoint.BinlogFile, checkpoint.BinlogPosition, checkpoint.GTIDSet, checkpoint.ServerUUID = snapshot.status.File, snapshot.status.Position, snapshot.status.ExecutedGTIDSet, snapshot.status.ServerUUID
+	if err := s.systemDB.Model(checkpoint).Updates(map[string]interface{}{"binlog_file": checkpoint.BinlogFile, "binlog_position": checkpoint.BinlogPosition, "gtid_set": checkpoint.GTIDSet, "server_uuid": checkpoint.ServerUUID}).Error; err != nil {
+		return 0, err
+	}
+	lock := "全局读锁"
+	if snapshot.lockMode == "tables" {
+		lock = "同步表读锁"
+	}
+	s.RecordTaskEvent(task, "snapshot_consistent", "snapshot", "success", "一致性快照已建立", fmt.Sprintf("%s，%d 个读取会话，CDC 起点 %s → %s", lock, len(snapshot.conns), old, cdcCheckpointLabel(checkpoint)), 0, 0)
+	consistentSnapshots.Store(task.ID, snapshot)
+	defer consistentSnapshots.Delete(task.ID)
+	return s.syncValidatedTask(task)
+}
@@ -134,6 +134,17 @@ func (s *DBService) GetTableSchema(dbName, tableName string) ([]map[string]inter
 		return nil, fmt.Errorf("非法表名")
 	}
 	var schema []map[string]interface{}
+	if dialect := dialectOf(db); dialect.name() != "mysql" {
+		// 非 MySQL 库没有 DESCRIBE，按方言读取后返回与 DESCRIBE 相同的字段名
+		columns, err := dialect.describeTable(db, tableName)
+		if err != nil {
+			return nil, err
+		}
+		for _, column := range columns {
+			schema = append(schema, map[string]interface{}{"Field": column.Field, "Type": column.Type, "Key": column.Key})
+		}
+		return schema, nil
+	}
 	sql := fmt.Sprintf("DESCRIBE %s", quoteIdentifier(db.Dialector.Name(), tableName))
 
 	rows, err := db.Raw(sql).Rows()
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	mssql "github.com/microsoft/go-mssqldb"
+	"github.com/redgreat/mergewong/internal/database"
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// CDC 和全量写入目标库遇到数据错误时的处理策略。stop 直接停止任务；skip 把出错的行记入死信队列后继续；
+// retry 在逐行写入遇到锁等待超时、死锁等暂时性错误时按间隔重试，数据错误重试也无法成功，同样直接记入死信后继续。
+// 连接中断、权限不足等非数据错误（retry 重试用尽后的暂时性错误）停止当前写入，由任务级重试处理。
+const (
+	applyErrorPolicyStop  = "stop"
+	applyErrorPolicySkip  = "skip"
+	applyErrorPolicyRetry = "retry"
+)
+
+func normalizeApplyErrorPolicy(policy string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "", applyErrorPolicyStop:
+		return applyErrorPolicyStop, nil
+	case applyErrorPolicySkip:
+		return applyErrorPolicySkip, nil
+	case applyErrorPolicyRetry:
+		return applyErrorPolicyRetry, nil
+	default:
+		return "", fmt.Errorf("不支持的写入失败策略: %s", policy)
+	}
+}
+
+func normalizeApplyErrorSettings(policy string, retryTimes int) (string, error) {
+	policy, err := normalizeApplyErrorPolicy(policy)
+	if err != nil {
+		return "", err
+	}
+	if policy == applyErrorPolicyRetry && (retryTimes < 1 || retryTimes > 10) {
+		return "", fmt.Errorf("重试次数需在 1 到 10 之间")
+	}
+	return policy, nil
+}
+
+// isApplyDataError 判断写入错误是否由行数据本身引起（截断、越界、字符集、约束冲突），这类错误重启任务也无法恢复
+func isApplyDataError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1048, 1062, 1264, 1265, 1292, 1366, 1406, 1451, 1452, 1582, 3819:
+			return true
+		}
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 22 类为数据异常，23 类为完整性约束冲突
+		return strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")
+	}
+	var sqlserverErr mssql.Error
+	if errors.As(err, &sqlserverErr) {
+		switch sqlserverErr.Number {
+		case 241, 242, 245, 515, 547, 2601, 2627, 2628, 8114, 8115, 8152:
+			return true
+		}
+	}
+	return false
+}
+
+// applyRetryable 表示按 retry 策略应重试的逐行写入错误
+func applyRetryable(policy string, err error) bool {
+	return policy == applyErrorPolicyRetry && err != nil && isTransientError(err)
+}
+
+// applyRetryDelay 是 retry 策略第 attempt 次重试前的等待时间
+func applyRetryDelay(attempt int) time.Duration {
+	return time.Duration(attempt) * 500 * time.Millisecond
+}
+
+// tagCDCPosition 记录操作来自的源库位点，进入死信队列时用于定位
+func tagCDCPosition(operations []cdcOperation, position string) {
+	for i := range operations {
+		operations[i].position = position
+	}
+}
+
+// applyFailedOperations 在批量写入失败后按任务策略逐行处理：能写入的行照常写入，retry 策略重试暂时性错误，
+// 因数据错误失败的行立即记入死信队列；策略为 stop、错误既不是数据错误也不可重试或没有系统库时原样返回错误
+func applyFailedOperations(db *gorm.DB, operations []cdcOperation, task *models.SyncTask, systemDB *gorm.DB, batchErr error) error {
+	if task == nil || systemDB == nil {
+		return batchErr
+	}
+	policy, err := normalizeApplyErrorPolicy(task.ApplyErrorPolicy)
+	if err != nil || policy == applyErrorPolicyStop || (!isApplyDataError(batchErr) && !applyRetryable(policy, batchErr)) {
+		return batchErr
+	}
+	for _, op := range operations {
+		applyErr := batchErr
+		if len(operations) > 1 {
+			applyErr = applyCDCOperation(db, op)
+		}
+		attempts := 1
+		for applyRetryable(policy, applyErr) && attempts <= task.ApplyRetryTimes {
+			time.Sleep(applyRetryDelay(attempts))
+			applyErr = applyCDCOperation(db, op)
+			attempts++
+		}
+		if applyErr == nil {
+			continue
+		}
+		if !isApplyDataError(applyErr) {
+			return applyErr
+		}
+		if err := recordDeadLetter(systemDB, task, op, applyErr, attempts); err != nil {
+			return fmt.Errorf("%w；写入死信队列失败: %v", applyErr, err)
+		}
+	}
+	return nil
+}
+
+// writeSnapshotRows 写入一批全量或轮询增量读取的行，批量写入失败时与 CDC 一样按任务的写入失败策略逐行处理
+func writeSnapshotRows(db *gorm.DB, task *models.SyncTask, systemDB *gorm.DB, mapping *models.SyncTaskTable, columns []string, rows []map[string]interface{}) error {
+	batchErr := writeTargetBatch(db, mapping, columns, rows)
+	if batchErr == nil {
+		return nil
+	}
+	operations := make([]cdcOperation, len(rows))
+	for i, row := range rows {
+		values := make([]interface{}, len(columns))
+		for j, column := range columns {
+			values[j] = row[column]
+		}
+		operations[i] = cdcOperation{kind: "upsert", mapping: mapping, columns: columns, values: values, change: "snapshot"}
+	}
+	return applyFailedOperations(db, operations, task, systemDB, batchErr)
+}
+
+// applyCDCOperation 单独写入一条行操作
+func applyCDCOperation(db *gorm.DB, op cdcOperation) error {
+	if op.kind != "upsert" && !writesHistory(op.mapping) {
+		return applyCDCDelete(db, op)
+	}
+	return writeTargetBatch(db, op.mapping, op.columns, []map[string]interface{}{cdcOperationRow(op)})
+}
+
+func cdcOperationRow(op cdcOperation) map[string]interface{} {
+	row := make(map[string]interface{}, len(op.columns)+2)
+	for i, column := range op.columns {
+		row[column] = normalizeMySQLScannedValue(op.values[i])
+	}
+	if writesHistory(op.mapping) {
+		row[historyOpSource], row[historyPositionSource] = historyOperation(op), op.position
+	}
+	return row
+}
+
+func recordDeadLetter(systemDB *gorm.DB, task *models.SyncTask, op cdcOperation, applyErr error, attempts int) error {
+	record, err := json.Marshal(cdcOperationRecordOf(op))
+	if err != nil {
+		return err
+	}
+	primaryKey := ""
+	if keys := primaryKeyColumns(op.mapping.SourcePrimaryKey); len(keys) > 0 {
+		primaryKey = rowPrimaryKey(cdcOperationRow(op), keys)
+	}
+	letter := models.SyncDeadLetter{
+		TaskID: task.ID, TaskTableID: op.mapping.ID, SourceTable: sourceTableName(op.mapping), TargetTable: op.mapping.TargetTable,
+		Operation: op.kind, PrimaryKey: primaryKey, OperationJSON: string(record), Position: op.position,
+		Error: applyErr.Error(), Attempts: attempts, Status: "pending",
+	}
+	if err := systemDB.Create(&letter).Error; err != nil {
+		return err
+	}
+	recordRunError(task.ID)
+	phase := "cdc"
+	switch {
+	case task.SyncType == "incremental":
+		phase = "incremental"
+	case op.change == "snapshot":
+		phase = "snapshot"
+	}
+	log.Printf("[%s] 任务 %d 表 %s 行 %s 写入失败已记入死信: %v", strings.ToUpper(phase), task.ID, letter.SourceTable, primaryKey, applyErr)
+	(&SyncService{systemDB: systemDB}).RecordTaskEvent(task, "dead_letter", phase, "failed", "行写入失败已跳过并记入死信队列", fmt.Sprintf("表 %s 主键 %s 位点 %s：%v", letter.SourceTable, primaryKey, op.position, applyErr), 1, 0)
+	return nil
+}
+
+// ListDeadLetters 分页查询任务的死信记录，status 为空时返回全部
+func (s *SyncService) ListDeadLetters(taskID uint, status string, page, pageSize int) ([]models.SyncDeadLetter, int64, error) {
+	var total int64
+	query := s.systemDB.Model(&models.SyncDeadLetter{}).Where("task_id = ?", taskID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var letters []models.SyncDeadLetter
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&letters).Error
+	return letters, total, err
+}
+
+// ReplayDeadLetters 按记录的列值重新写入目标库，ids 为空时重放任务全部待处理记录。
+// 重放写入的是出错时的行版本，若源行之后已有更新且已同步，重放 upsert 会覆盖为旧值，需确认后再操作。
+func (s *SyncService) ReplayDeadLetters(taskID uint, ids []uint) (int, int, error) {
+	task, err := s.GetTask(taskID)
+	if err != nil {
+		return 0, 0, err
+	}
+	targetDB, err := database.GetManager().GetConnection(task.TargetDB)
+	if err != nil {
+		return 0, 0, err
+	}
+	query := s.systemDB.Where("task_id = ? AND status = ?", taskID, "pending")
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	var letters []models.SyncDeadLetter
+	if err := query.Order("id ASC").Find(&letters).Error; err != nil {
+		return 0, 0, err
+	}
+	tableByID := map[uint]*models.SyncTaskTable{}
+	for i := range task.TaskTables {
+		tableByID[task.TaskTables[i].ID] = &task.TaskTables[i]
+	}
+	replayed, failed := 0, 0
+	for _, letter := range letters {
+		applyErr := replayDeadLetter(targetDB, tableByID, &letter)
+		if applyErr != nil {
+			failed++
+			if err := s.systemDB.Model(&letter).Updates(map[string]interface{}{"error": applyErr.Error(), "attempts": gorm.Expr("attempts + 1")}).Error; err != nil {
+				return replayed, failed, err
+			}
+			continue
+		}
+		replayed++
+		now := time.Now()
+		if err := s.systemDB.Model(&letter).Updates(map[string]interface{}{"status": "replayed", "replayed_at": &now, "attempts": gorm.Expr("attempts + 1")}).Error; err != nil {
+			return replayed, failed, err
+		}
+	}
+	if len(letters) > 0 {
+		s.RecordTaskEvent(task, "dead_letter_replay", "cdc", "success", "死信重放完成", fmt.Sprintf("成功 %d 行，失败 %d 行", replayed, failed), int64(replayed), 0)
+	}
+	return replayed, failed, nil
+}
+
+func replayDeadLetter(targetDB *gorm.DB, tableByID map[uint]*models.SyncTaskTable, letter *models.SyncDeadLetter) error {
+	var record cdcOperationRecord
+	if err := json.Unmarshal([]byte(letter.OperationJSON), &record); err != nil {
+		return err
+	}
+	mapping := tableByID[record.TaskTableID]
+	if mapping == nil {
+		return fmt.Errorf("同步表已从任务中移除: %s", letter.SourceTable)
+	}
+	values, err := record.operationValues()
+	if err != nil {
+		return err
+	}
+	return applyCDCOperation(targetDB, cdcOperation{kind: record.Kind, mapping: mapping, columns: record.Columns, values: values, position: record.Position, change: record.Change})
+}
+
+// DiscardDeadLetters 把待处理的死信标记为已忽略，ids 为空时忽略任务全部待处理记录
+func (s *SyncService) DiscardDeadLetters(taskID uint, ids []uint) (int64, error) {
+	query := s.systemDB.Model(&models.SyncDeadLetter{}).Where("task_id = ? AND status = ?", taskID, "pending")
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	result := query.Update("status", "discarded")
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	mssql "github.com/microsoft/go-mssqldb"
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestIsApplyDataError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "mysql too long", err: &mysql.MySQLError{Number: 1406}, want: true},
+		{name: "mysql wrapped duplicate", err: fmt.Errorf("%w；写入字段数=3", &mysql.MySQLError{Number: 1062}), want: true},
+		{name: "mysql access denied", err: &mysql.MySQLError{Number: 1142}, want: false},
+		{name: "postgres numeric overflow", err: &pgconn.PgError{Code: "22003"}, want: true},
+		{name: "postgres unique violation", err: &pgconn.PgError{Code: "23505"}, want: true},
+		{name: "postgres undefined table", err: &pgconn.PgError{Code: "42P01"}, want: false},
+		{name: "sqlserver truncation", err: mssql.Error{Number: 8152}, want: true},
+		{name: "sqlserver login", err: mssql.Error{Number: 18456}, want: false},
+		{name: "connection", err: errors.New("driver: bad connection"), want: false},
+	}
+	for _, tt := range tests {
+		if got := isApplyDataError(tt.err); got != tt.want {
+			t.Fatalf("%s: isApplyDataError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeApplyErrorSettings(t *testing.T) {
+	if policy, err := normalizeApplyErrorSettings("", 0); err != nil || policy != applyErrorPolicyStop {
+		t.Fatalf("empty policy = %q, %v", policy, err)
+	}
+	if policy, err := normalizeApplyErrorSettings(" Skip ", 0); err != nil || policy != applyErrorPolicySkip {
+		t.Fatalf("skip policy = %q, %v", policy, err)
+	}
+	if _, err := normalizeApplyErrorSettings("retry", 0); err == nil {
+		t.Fatalf("retry without times should fail")
+	}
+	if _, err := normalizeApplyErrorSettings("ignore", 3); err == nil {
+		t.Fatalf("unknown policy should fail")
+	}
+}
+
+func TestApplyRetryable(t *testing.T) {
+	lockWait := &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+	truncated := &mysql.MySQLError{Number: 1406, Message: "Data too long"}
+	tests := []struct {
+		policy string
+		err    error
+		want   bool
+	}{
+		{policy: applyErrorPolicyRetry, err: lockWait, want: true},
+		{policy: applyErrorPolicyRetry, err: deadlock, want: true},
+		{policy: applyErrorPolicyRetry, err: truncated},
+		{policy: applyErrorPolicySkip, err: lockWait},
+		{policy: applyErrorPolicyRetry},
+	}
+	for _, tt := range tests {
+		if got := applyRetryable(tt.policy, tt.err); got != tt.want {
+			t.Fatalf("%s %v: got %v, want %v", tt.policy, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCDCOperationRecordRoundTrip(t *testing.T) {
+	zone := time.FixedZone("UTC+8", 8*3600)
+	at := time.Date(2026, 3, 1, 12, 30, 45, 123456789, zone)
+	binary := []byte{0x00, 0xff, 0x10, '"'}
+	values := []interface{}{int64(9007199254740993), uint64(18446744073709551615), "0012", binary, at, (*time.Time)(nil), nil, 1.5}
+	op := cdcOperation{kind: "upsert", mapping: &models.SyncTaskTable{ID: 4}, columns: []string{"id", "big", "code", "blob", "at", "deleted_at", "memo", "ratio"}, values: values}
+	encoded, err := json.Marshal(cdcOperationRecordOf(op))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record cdcOperationRecord
+	if err := json.Unmarshal(encoded, &record); err != nil {
+		t.Fatal(err)
+	}
+	got, err := record.operationValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != int64(9007199254740993) || got[1] != uint64(18446744073709551615) || got[2] != "0012" {
+		t.Fatalf("numbers and strings = %v %v %v", got[0], got[1], got[2])
+	}
+	if !bytes.Equal(got[3].([]byte), binary) {
+		t.Fatalf("bytes = %v", got[3])
+	}
+	if decoded := got[4].(time.Time); !decoded.Equal(at) || decoded.Format(time.RFC3339Nano) != at.Format(time.RFC3339Nano) {
+		t.Fatalf("time = %v, want %v", decoded, at)
+	}
+	if got[5] != nil || got[6] != nil || got[7] != 1.5 {
+		t.Fatalf("nil and float values = %v %v %v", got[5], got[6], got[7])
+	}
+
+	legacy := cdcOperationRecord{Values: []interface{}{"2026-03-01 12:30:45", float64(7)}}
+	if got, err := legacy.operationValues(); err != nil || got[0] != "2026-03-01 12:30:45" || got[1] != float64(7) {
+		t.Fatalf("legacy record values = %v %v", got, err)
+	}
+}
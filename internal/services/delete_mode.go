@@ -0,0 +1,138 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// 删除方式决定源端删除如何作用到目标表。delete 按行标识删除；ignore 保留目标行，适合归档库；
+// soft_flag 把目标表的标记列置为 1，soft_time 把标记列置为删除时间。源行重新写入时标记列会被清除。
+const (
+	deleteModeDelete   = "delete"
+	deleteModeIgnore   = "ignore"
+	deleteModeSoftFlag = "soft_flag"
+	deleteModeSoftTime = "soft_time"
+)
+
+// softDeleteSource 是写入时承载软删除标记列值的内部列名
+const softDeleteSource = "\x00soft_delete"
+
+func normalizeDeleteMode(value string) (string, error) {
+	switch strings.TrimSpace(value) {
+	case "", deleteModeDelete:
+		return deleteModeDelete, nil
+	case deleteModeIgnore:
+		return deleteModeIgnore, nil
+	case deleteModeSoftFlag:
+		return deleteModeSoftFlag, nil
+	case deleteModeSoftTime:
+		return deleteModeSoftTime, nil
+	default:
+		return "", fmt.Errorf("不支持的删除方式: %s", value)
+	}
+}
+
+// validateDeleteMode 规范化表映射的删除方式和标记列，需在 validateWriteMode 之后调用
+func validateDeleteMode(table *models.SyncTaskTable) error {
+	mode, err := normalizeDeleteMode(table.DeleteMode)
+	if err != nil {
+		return err
+	}
+	table.DeleteMode, table.DeleteColumn = mode, strings.TrimSpace(table.DeleteColumn)
+	if !softDeletes(table) {
+		table.DeleteColumn = ""
+	} else if !taskIdentifierPattern.MatchString(table.DeleteColumn) {
+		return fmt.Errorf("软删除需要指定合法的目标标记列")
+	}
+	if mode != deleteModeDelete && writesHistory(table) {
+		return fmt.Errorf("历史模式已按新行记录删除，不能再配置删除方式")
+	}
+	if softDeletes(table) && keylessRowIdentity(table) {
+		return fmt.Errorf("无键模式无法定位目标行，不能使用软删除")
+	}
+	return nil
+}
+
+// softDeletes 表示该表的删除转为更新目标表标记列
+func softDeletes(mapping *models.SyncTaskTable) bool {
+	return mapping.DeleteMode == deleteModeSoftFlag || mapping.DeleteMode == deleteModeSoftTime
+}
+
+// softDeleteValue 返回标记列在行被删除（deleted 为真）或重新写入时的值
+func softDeleteValue(mapping *models.SyncTaskTable, deleted bool) interface{} {
+	if mapping.DeleteMode == deleteModeSoftTime {
+		if deleted {
+			return time.Now()
+		}
+		return nil
+	}
+	if deleted {
+		return 1
+	}
+	return 0
+}
+
+// withSoftDeleteReset 为写入行补上未删除的标记值，源端删除后又重新插入的行在目标表恢复为有效行
+func withSoftDeleteReset(mapping *models.SyncTaskTable, batch []map[string]interface{}) []map[string]interface{} {
+	value := softDeleteValue(mapping, false)
+	rows := make([]map[string]interface{}, len(batch))
+	for i, row := range batch {
+		copied := make(map[string]interface{}, len(row)+1)
+		for column, v := range row {
+			copied[column] = v
+		}
+		copied[softDeleteSource] = value
+		rows[i] = copied
+	}
+	return rows
+}
+
+// markCDCDeleted 按行标识把目标行标记为已删除
+func markCDCDeleted(db *gorm.DB, op cdcOperation) error {
+	dialect := dialectOf(db)
+	conditions, args, err := cdcIdentityConditions(dialect, op)
+	if err != nil {
+		return err
+	}
+	args = append([]interface{}{softDeleteValue(op.mapping, true)}, args...)
+	return db.Exec("UPDATE "+dialect.quoteTable(op.mapping.TargetTable)+" SET "+dialect.quote(op.mapping.DeleteColumn)+" = ? WHERE "+strings.Join(conditions, " AND "), args...).Error
+}
+
+// precheckDeleteMode 检查软删除标记列，targetColumns 为空表示目标表不存在
+func precheckDeleteMode(mapping *models.SyncTaskTable, sourceColumns, targetColumns []mysqlColumn) (problem, warning string) {
+	switch mapping.DeleteMode {
+	case deleteModeIgnore:
+		return "", "忽略删除：源端删除的行保留在目标表，数据比对不再报告目标多余数据"
+	case deleteModeSoftFlag, deleteModeSoftTime:
+		column, ok := findColumn(targetColumns, mapping.DeleteColumn)
+		if len(targetColumns) == 0 {
+			return "软删除需预先创建目标表，并包含标记列 " + mapping.DeleteColumn, ""
+		}
+		if !ok {
+			return "目标表缺少软删除标记列: " + mapping.DeleteColumn, ""
+		}
+		if isPrimaryKeyColumn(mapping.TargetPrimaryKey, mapping.DeleteColumn) {
+			return "软删除标记列不能是行标识列: " + mapping.DeleteColumn, ""
+		}
+		for _, source := range sourceColumns {
+			if !ignoredField(mapping, source.Field) && mappedColumn(mapping.FieldMapping, source.Field) == mapping.DeleteColumn {
+				return "软删除标记列不能同时映射源字段: " + source.Field, ""
+			}
+		}
+		columnType := strings.ToLower(column.Type)
+		if mapping.DeleteMode == deleteModeSoftTime && !strings.Contains(columnType, "date") && !strings.Contains(columnType, "time") {
+			return "", fmt.Sprintf("软删除标记列 %s(%s) 不是时间类型，删除时会写入当前时间", column.Field, column.Type)
+		}
+		if mapping.DeleteMode == deleteModeSoftFlag && !strings.Contains(columnType, "int") && !strings.Contains(columnType, "bit") && !strings.Contains(columnType, "bool") {
+			return "", fmt.Sprintf("软删除标记列 %s(%s) 不是整数或布尔类型，删除时写入 1，恢复时写入 0", column.Field, column.Type)
+		}
+		if mapping.DeleteMode == deleteModeSoftTime {
+			return "", "软删除：源行重新写入时标记列会置为 NULL，请确认该列允许为空"
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestValidateDeleteMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		table   models.SyncTaskTable
+		want    string
+		column  string
+		wantErr bool
+	}{
+		{name: "default", table: models.SyncTaskTable{DeleteColumn: "is_deleted"}, want: deleteModeDelete},
+		{name: "soft flag", table: models.SyncTaskTable{DeleteMode: " soft_flag ", DeleteColumn: " is_deleted "}, want: deleteModeSoftFlag, column: "is_deleted"},
+		{name: "soft time without column", table: models.SyncTaskTable{DeleteMode: deleteModeSoftTime}, wantErr: true},
+		{name: "ignore on full row", table: models.SyncTaskTable{DeleteMode: deleteModeIgnore, RowIdentity: rowIdentityFullRow}, want: deleteModeIgnore},
+		{name: "soft on full row", table: models.SyncTaskTable{DeleteMode: deleteModeSoftFlag, DeleteColumn: "is_deleted", RowIdentity: rowIdentityFullRow}, wantErr: true},
+		{name: "ignore with history", table: models.SyncTaskTable{DeleteMode: deleteModeIgnore, WriteMode: writeModeHistory}, wantErr: true},
+		{name: "unknown", table: models.SyncTaskTable{DeleteMode: "archive"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		table := tt.table
+		err := validateDeleteMode(&table)
+		if tt.wantErr {
+			if err == nil {
+				t.Fatalf("%s: expected error", tt.name)
+			}
+			continue
+		}
+		if err != nil || table.DeleteMode != tt.want || table.DeleteColumn != tt.column {
+			t.Fatalf("%s: got mode %q column %q err %v", tt.name, table.DeleteMode, table.DeleteColumn, err)
+		}
+	}
+}
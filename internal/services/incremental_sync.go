@@ -0,0 +1,272 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// 轮询增量同步：每次执行按 (增量字段, 行标识) 组合游标读取上次之后写入或更新的行，用于拿不到 Binlog/逻辑复制权限的源库。
+// 增量字段需随写入单调递增（如 updated_at、自增 id）；同一增量值的行再按行标识排序，分批读取不会遗漏或重复。
+// 物理删除无法感知，配置软删除列后该列为真的行按表的删除方式作用到目标表。
+
+func (s *SyncService) syncIncrementalTable(task *models.SyncTask, mapping *models.SyncTaskTable, sourceDB, targetDB *gorm.DB) (int64, error) {
+	if mapping.IncrementalKey == "" {
+		return 0, fmt.Errorf("未配置增量字段")
+	}
+	if keylessRowIdentity(mapping) || mapping.SourcePrimaryKey == "" || mapping.TargetPrimaryKey == "" {
+		return 0, fmt.Errorf("缺少预检查主键信息")
+	}
+	if !targetDB.Migrator().HasTable(mapping.TargetTable) {
+		if dialectOf(sourceDB).name() != "mysql" {
+			return 0, fmt.Errorf("非 MySQL 源需预先创建目标表")
+		}
+		if writesHistory(mapping) {
+			return 0, fmt.Errorf("历史模式需预先创建目标表")
+		}
+		if softDeletes(mapping) {
+			return 0, fmt.Errorf("软删除需预先创建包含标记列的目标表")
+		}
+		if len(mapping.Transforms) > 0 {
+			return 0, fmt.Errorf("字段转换需预先创建目标表")
+		}
+		if mapping.PluginID != nil {
+			return 0, fmt.Errorf("行处理插件需预先创建目标表")
+		}
+		if len(mapping.FieldMapping) > 0 {
+			return 0, fmt.Errorf("目标表不存在时暂不支持字段改名")
+		}
+		if err := createTargetTableLike(sourceDB, targetDB, mapping.SourceTable, mapping.TargetTable); err != nil {
+			return 0, err
+		}
+	}
+	var checkpoint models.SyncCheckpoint
+	if err := s.systemDB.Where("task_table_id = ?", mapping.ID).First(&checkpoint).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return 0, err
+	}
+	checkpoint.TaskTableID = mapping.ID
+	_ = updateTaskTableProgress(s.systemDB, mapping.ID, map[string]interface{}{"sync_state": "catching_up", "progress_message": "正在轮询增量"})
+	var total int64
+	for {
+		if err := checkTaskPaused(s.systemDB, task.ID); err != nil {
+			return total, err
+		}
+		batch, columns, lastCursor, lastPK, err := readIncrementalBatch(task, mapping, sourceDB, &checkpoint)
+		if err != nil {
+			return total, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if err := applyIncrementalBatch(targetDB, task, s.systemDB, mapping, columns, batch); err != nil {
+			return total, err
+		}
+		checkpoint.CursorValue, checkpoint.CursorPrimaryKey = lastCursor, lastPK
+		if err := saveCheckpoint(s.systemDB, &checkpoint); err != nil {
+			return total, err
+		}
+		total += int64(len(batch))
+		if err := updateTaskTableProgress(s.systemDB, mapping.ID, map[string]interface{}{"progress_message": fmt.Sprintf("本次已同步 %d 行，游标 %s", total, lastCursor)}); err != nil {
+			return total, err
+		}
+		if len(batch) < snapshotBatchSize(task) {
+			break
+		}
+	}
+	message := "增量已同步，等待下次轮询"
+	if checkpoint.CursorValue != "" {
+		message = "增量已同步至 " + checkpoint.CursorValue
+	}
+	return total, updateTaskTableProgress(s.systemDB, mapping.ID, map[string]interface{}{"sync_state": "active", "progress_percent": 100, "progress_message": message})
+}
+
+// applyIncrementalBatch 写入一批变化行，软删除的行改为按行标识删除目标行；写入失败的行与 CDC 一样按任务的写入失败策略处理
+func applyIncrementalBatch(db *gorm.DB, task *models.SyncTask, systemDB *gorm.DB, mapping *models.SyncTaskTable, columns []string, batch []map[string]interface{}) error {
+	upserts := make([]map[string]interface{}, 0, len(batch))
+	var deletes []cdcOperation
+	for _, row := range batch {
+		if mapping.SoftDeleteColumn == "" || !softDeleted(row[mapping.SoftDeleteColumn]) {
+			if writesHistory(mapping) {
+				row[historyOpSource] = "upsert"
+			}
+			upserts = append(upserts, row)
+			continue
+		}
+		values := make([]interface{}, len(columns))
+		for i, column := range columns {
+			values[i] = row[column]
+		}
+		deletes = append(deletes, cdcOperation{kind: "delete", mapping: mapping, columns: columns, values: values, change: "delete"})
+	}
+	upsertColumns, upserts, err := applyRowPluginBatch(mapping, "upsert", columns, upserts)
+	if err != nil {
+		return err
+	}
+	if len(upserts) > 0 {
+		if err := writeSnapshotRows(db, task, systemDB, mapping, upsertColumns, upserts); err != nil {
+			return err
+		}
+		recordRunRows(task.ID, sourceTableName(mapping), len(upserts), batchBytes(upserts))
+	}
+	return applyCDCTransaction(db, deletes, task, systemDB, time.Time{})
+}
+
+func readIncrementalBatch(task *models.SyncTask, mapping *models.SyncTaskTable, db *gorm.DB, checkpoint *models.SyncCheckpoint) ([]map[string]interface{}, []string, string, string, error) {
+	dialect := dialectOf(db)
+	pkColumns := primaryKeyColumns(mapping.SourcePrimaryKey)
+	sourceColumns, err := selectableSourceColumns(task, mapping, db)
+	if err != nil {
+		return nil, nil, "", "", err
+	}
+	if len(sourceColumns) == 0 {
+		return nil, nil, "", "", fmt.Errorf("没有可读取的同步字段")
+	}
+	// 增量字段和软删除列即使被忽略也要读出，写入目标时按忽略字段过滤
+	for _, column := range []string{mapping.IncrementalKey, mapping.SoftDeleteColumn} {
+		if column != "" && !containsString(sourceColumns, column) {
+			sourceColumns = append(sourceColumns, column)
+		}
+	}
+	cursorColumns := append([]string{mapping.IncrementalKey}, pkColumns...)
+	if isPrimaryKeyColumn(mapping.SourcePrimaryKey, mapping.IncrementalKey) {
+		cursorColumns = []string{mapping.IncrementalKey}
+		for _, column := range pkColumns {
+			if column != mapping.IncrementalKey {
+				cursorColumns = append(cursorColumns, column)
+			}
+		}
+	}
+	key := dialect.quote(mapping.IncrementalKey)
+	query := "SELECT " + strings.Join(quoteAll(dialect.quote, sourceColumns), ",") + " FROM " + dialect.quoteTable(sourceTableName(mapping))
+	wheres := []string{key + " IS NOT NULL"}
+	params := []interface{}{}
+	if checkpoint.CursorValue != "" {
+		pkValues, err := decodePrimaryKey(checkpoint.CursorPrimaryKey, len(pkColumns))
+		if err != nil {
+			return nil, nil, "", "", err
+		}
+		values := map[string]string{mapping.IncrementalKey: checkpoint.CursorValue}
+		for i, column := range pkColumns {
+			if column != mapping.IncrementalKey {
+				values[column] = pkValues[i]
+			}
+		}
+		cursor := make([]interface{}, len(cursorColumns))
+		for i, column := range cursorColumns {
+			cursor[i] = values[column]
+		}
+		condition, args := keysetAfterCondition(dialect.quote, cursorColumns, cursor)
+		wheres = append(wheres, condition)
+		params = append(params, args...)
+	}
+	if mapping.CustomWhere != "" {
+		wheres = append(wheres, "("+mapping.CustomWhere+")")
+	}
+	filters, filterArgs := rowFilterSQL(dialect.quote, mapping.RowFilter)
+	wheres, params = append(wheres, filters...), append(params, filterArgs...)
+	query += " WHERE " + strings.Join(wheres, " AND ") + " ORDER BY " + strings.Join(quoteAll(dialect.quote, cursorColumns), ",") + dialect.limit(snapshotBatchSize(task))
+	rows, err := db.Raw(query, params...).Rows()
+	if err != nil {
+		return nil, nil, "", "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, "", "", err
+	}
+	batch := []map[string]interface{}{}
+	lastCursor, lastPK := "", ""
+	for rows.Next() {
+		values, pointers := make([]interface{}, len(columns)), make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, nil, "", "", err
+		}
+		row := map[string]interface{}{}
+		for i, column := range columns {
+			row[column] = normalizeMySQLScannedValue(values[i])
+		}
+		lastCursor = cursorString(row[mapping.IncrementalKey], dialect.name() == "postgres")
+		lastPK = rowPrimaryKey(row, pkColumns)
+		batch = append(batch, row)
+	}
+	return batch, columns, lastCursor, lastPK, rows.Err()
+}
+
+// keysetAfterCondition 生成 (a > ?) OR (a = ? AND b > ?) 形式的游标条件，不依赖各库对行值比较的支持
+func keysetAfterCondition(quote func(string) string, columns []string, values []interface{}) (string, []interface{}) {
+	branches := make([]string, len(columns))
+	args := []interface{}{}
+	for i := range columns {
+		parts := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			parts = append(parts, quote(columns[j])+" = ?")
+			args = append(args, values[j])
+		}
+		parts = append(parts, quote(columns[i])+" > ?")
+		args = append(args, values[i])
+		branches[i] = "(" + strings.Join(parts, " AND ") + ")"
+	}
+	return "(" + strings.Join(branches, " OR ") + ")", args
+}
+
+// cursorString 把增量字段值保存为可回传给源库比较的文本；withZone 为 PostgreSQL 保留时区，timestamptz 才能按原时刻比较
+func cursorString(value interface{}, withZone bool) string {
+	if t, ok := value.(time.Time); ok {
+		if withZone {
+			return t.Format("2006-01-02 15:04:05.999999999Z07:00")
+		}
+		return t.Format("2006-01-02 15:04:05.999999999")
+	}
+	return valueString(value)
+}
+
+// softDeleted 判断软删除列的值是否表示已删除：非零数值、真值、非空时间或除 0/false 外的非空文本
+func softDeleted(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case int32:
+		return v != 0
+	case int:
+		return v != 0
+	case uint64:
+		return v != 0
+	case float64:
+		return v != 0
+	case time.Time:
+		return !v.IsZero()
+	case string:
+		text := strings.TrimSpace(v)
+		if number, err := strconv.ParseFloat(text, 64); err == nil {
+			return number != 0
+		}
+		return text != "" && !strings.EqualFold(text, "false")
+	default:
+		return valueString(v) != "0"
+	}
+}
+
+func checkTaskPaused(db *gorm.DB, taskID uint) error {
+	if err := checkTaskLeaseFence(taskID); err != nil {
+		return err
+	}
+	var runtime struct{ RuntimeStatus string }
+	if err := db.Model(&models.SyncTask{}).Select("runtime_status").Where("id = ?", taskID).Scan(&runtime).Error; err != nil {
+		return err
+	}
+	if runtime.RuntimeStatus == "paused" {
+		return ErrTaskPaused
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKeysetAfterCondition(t *testing.T) {
+	condition, args := keysetAfterCondition(quoteMySQL, []string{"updated_at", "tenant_id", "id"}, []interface{}{"2024-05-01 08:00:00", "7", "42"})
+	want := "((`updated_at` > ?) OR (`updated_at` = ? AND `tenant_id` > ?) OR (`updated_at` = ? AND `tenant_id` = ? AND `id` > ?))"
+	if condition != want {
+		t.Fatalf("condition = %s, want %s", condition, want)
+	}
+	wantArgs := []interface{}{"2024-05-01 08:00:00", "2024-05-01 08:00:00", "7", "2024-05-01 08:00:00", "7", "42"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("args = %v, want %v", args, wantArgs)
+	}
+	if condition, _ := keysetAfterCondition(sqlserverTarget{}.quote, []string{"id"}, []interface{}{"1"}); condition != "(([id] > ?))" {
+		t.Fatalf("single column condition = %s", condition)
+	}
+}
+
+func TestCursorString(t *testing.T) {
+	value := time.Date(2024, 5, 1, 8, 0, 0, 120000000, time.FixedZone("CST", 8*3600))
+	if got := cursorString(value, false); got != "2024-05-01 08:00:00.12" {
+		t.Fatalf("cursorString = %s", got)
+	}
+	if got := cursorString(value, true); got != "2024-05-01 08:00:00.12+08:00" {
+		t.Fatalf("cursorString with zone = %s", got)
+	}
+	if got := cursorString(int64(42), false); got != "42" {
+		t.Fatalf("cursorString = %s", got)
+	}
+}
+
+func TestSoftDeleted(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  bool
+	}{
+		{value: nil, want: false},
+		{value: true, want: true},
+		{value: int64(0), want: false},
+		{value: int64(1), want: true},
+		{value: "0", want: false},
+		{value: "1", want: true},
+		{value: "", want: false},
+		{value: "false", want: false},
+		{value: "Y", want: true},
+		{value: time.Time{}, want: false},
+		{value: time.Now(), want: true},
+	}
+	for _, tt := range tests {
+		if got := softDeleted(tt.value); got != tt.want {
+			t.Fatalf("softDeleted(%#v) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
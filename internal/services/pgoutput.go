@@ -0,0 +1,338 @@
+package services
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PostgreSQL 逻辑复制流的最小解码：CopyData 外层的 XLogData/keepalive，以及 pgoutput 协议 v1 的
+// Begin/Commit/Relation/Insert/Update/Delete/Truncate 消息。列值以文本格式传输，按类型 OID 转成 Go 值。
+
+// pgEpoch 是复制协议时间戳的起点，单位为微秒
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type pgLSN uint64
+
+func (lsn pgLSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(lsn>>32), uint32(lsn))
+}
+
+func parsePGLSN(value string) (pgLSN, error) {
+	high, low, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return 0, fmt.Errorf("LSN 格式不正确: %s", value)
+	}
+	h, err := strconv.ParseUint(high, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("LSN 格式不正确: %s", value)
+	}
+	l, err := strconv.ParseUint(low, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("LSN 格式不正确: %s", value)
+	}
+	return pgLSN(h<<32 | l), nil
+}
+
+func pgTime(micros int64) time.Time {
+	return pgEpoch.Add(time.Duration(micros) * time.Microsecond)
+}
+
+type pgXLogData struct {
+	walStart pgLSN
+	data     []byte
+}
+
+type pgKeepalive struct {
+	walEnd         pgLSN
+	replyRequested bool
+}
+
+// parsePGCopyData 解析复制流 CopyData 的负载，返回 *pgXLogData 或 *pgKeepalive
+func parsePGCopyData(data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("复制消息为空")
+	}
+	switch data[0] {
+	case 'w':
+		if len(data) < 25 {
+			return nil, fmt.Errorf("XLogData 长度异常")
+		}
+		return &pgXLogData{walStart: pgLSN(binary.BigEndian.Uint64(data[1:])), data: data[25:]}, nil
+	case 'k':
+		if len(data) < 18 {
+			return nil, fmt.Errorf("keepalive 长度异常")
+		}
+		return &pgKeepalive{walEnd: pgLSN(binary.BigEndian.Uint64(data[1:])), replyRequested: data[17] == 1}, nil
+	default:
+		return nil, fmt.Errorf("未知复制消息类型 %q", data[0])
+	}
+}
+
+// pgStandbyStatus 生成备库状态回报，flushed 之前的 WAL 可被源库回收
+func pgStandbyStatus(flushed pgLSN, now time.Time) []byte {
+	data := make([]byte, 34)
+	data[0] = 'r'
+	binary.BigEndian.PutUint64(data[1:], uint64(flushed))
+	binary.BigEndian.PutUint64(data[9:], uint64(flushed))
+	binary.BigEndian.PutUint64(data[17:], uint64(flushed))
+	binary.BigEndian.PutUint64(data[25:], uint64(now.Sub(pgEpoch).Microseconds()))
+	return data
+}
+
+type pgRelationColumn struct {
+	name    string
+	typeOID uint32
+	key     bool
+}
+
+type pgRelation struct {
+	id        uint32
+	namespace string
+	name      string
+	identity  byte
+	columns   []pgRelationColumn
+}
+
+func (r *pgRelation) columnNames() []string {
+	names := make([]string, len(r.columns))
+	for i, column := range r.columns {
+		names[i] = column.name
+	}
+	return names
+}
+
+// pgTuple 是一行列值；unchanged 标记未随更新传输的 TOAST 列
+type pgTuple struct {
+	values    []interface{}
+	unchanged []bool
+}
+
+type pgBegin struct {
+	finalLSN   pgLSN
+	commitTime time.Time
+}
+
+type pgCommit struct {
+	endLSN     pgLSN
+	commitTime time.Time
+}
+
+type pgInsert struct {
+	relationID uint32
+	tuple      *pgTuple
+}
+
+// pgUpdate 的旧行只在 REPLICA IDENTITY FULL（oldFull）时包含全部列，否则仅在键变化时携带键列
+type pgUpdate struct {
+	relationID uint32
+	old        *pgTuple
+	oldFull    bool
+	tuple      *pgTuple
+}
+
+type pgDelete struct {
+	relationID uint32
+	old        *pgTuple
+}
+
+type pgTruncate struct {
+	relationIDs []uint32
+}
+
+type pgReader struct {
+	data []byte
+	err  error
+}
+
+func (r *pgReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = fmt.Errorf("pgoutput 消息长度异常")
+		return nil
+	}
+	value := r.data[:n]
+	r.data = r.data[n:]
+	return value
+}
+
+func (r *pgReader) byte() byte {
+	if value := r.take(1); value != nil {
+		return value[0]
+	}
+	return 0
+}
+
+func (r *pgReader) uint16() uint16 {
+	if value := r.take(2); value != nil {
+		return binary.BigEndian.Uint16(value)
+	}
+	return 0
+}
+
+func (r *pgReader) uint32() uint32 {
+	if value := r.take(4); value != nil {
+		return binary.BigEndian.Uint32(value)
+	}
+	return 0
+}
+
+func (r *pgReader) uint64() uint64 {
+	if value := r.take(8); value != nil {
+		return binary.BigEndian.Uint64(value)
+	}
+	return 0
+}
+
+func (r *pgReader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	end := strings.IndexByte(string(r.data), 0)
+	if end < 0 {
+		r.err = fmt.Errorf("pgoutput 字符串未结束")
+		return ""
+	}
+	value := string(r.data[:end])
+	r.data = r.data[end+1:]
+	return value
+}
+
+// parsePGOutput 解码一条 pgoutput 消息；Origin、Type 等与数据无关的消息返回 nil
+func parsePGOutput(data []byte, relations map[uint32]*pgRelation) (interface{}, error) {
+	r := &pgReader{data: data}
+	var message interface{}
+	switch r.byte() {
+	case 'B':
+		finalLSN := pgLSN(r.uint64())
+		message = &pgBegin{finalLSN: finalLSN, commitTime: pgTime(int64(r.uint64()))}
+		r.uint32()
+	case 'C':
+		r.byte()
+		r.uint64()
+		endLSN := pgLSN(r.uint64())
+		message = &pgCommit{endLSN: endLSN, commitTime: pgTime(int64(r.uint64()))}
+	case 'R':
+		relation := &pgRelation{id: r.uint32(), namespace: r.cstring(), name: r.cstring(), identity: r.byte()}
+		count := int(r.uint16())
+		for i := 0; i < count && r.err == nil; i++ {
+			flags := r.byte()
+			column := pgRelationColumn{name: r.cstring(), typeOID: r.uint32(), key: flags&1 == 1}
+			r.uint32()
+			relation.columns = append(relation.columns, column)
+		}
+		if r.err == nil {
+			relations[relation.id] = relation
+		}
+		return nil, r.err
+	case 'I':
+		insert := &pgInsert{relationID: r.uint32()}
+		if kind := r.byte(); kind != 'N' && r.err == nil {
+			return nil, fmt.Errorf("INSERT 消息缺少新行")
+		}
+		insert.tuple = r.tuple(relations[insert.relationID])
+		message = insert
+	case 'U':
+		update := &pgUpdate{relationID: r.uint32()}
+		relation := relations[update.relationID]
+		kind := r.byte()
+		if kind == 'K' || kind == 'O' {
+			update.old, update.oldFull = r.tuple(relation), kind == 'O'
+			kind = r.byte()
+		}
+		if kind != 'N' && r.err == nil {
+			return nil, fmt.Errorf("UPDATE 消息缺少新行")
+		}
+		update.tuple = r.tuple(relation)
+		message = update
+	case 'D':
+		remove := &pgDelete{relationID: r.uint32()}
+		if kind := r.byte(); kind != 'K' && kind != 'O' && r.err == nil {
+			return nil, fmt.Errorf("DELETE 消息缺少旧行")
+		}
+		remove.old = r.tuple(relations[remove.relationID])
+		message = remove
+	case 'T':
+		count := int(r.uint32())
+		r.byte()
+		truncate := &pgTruncate{}
+		for i := 0; i < count && r.err == nil; i++ {
+			truncate.relationIDs = append(truncate.relationIDs, r.uint32())
+		}
+		message = truncate
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return message, nil
+}
+
+func (r *pgReader) tuple(relation *pgRelation) *pgTuple {
+	if relation == nil && r.err == nil {
+		r.err = fmt.Errorf("行消息引用了未知的关系")
+	}
+	count := int(r.uint16())
+	if r.err != nil {
+		return nil
+	}
+	if count != len(relation.columns) {
+		r.err = fmt.Errorf("表 %s.%s 行数据列数 %d 与关系定义 %d 不一致", relation.namespace, relation.name, count, len(relation.columns))
+		return nil
+	}
+	tuple := &pgTuple{values: make([]interface{}, count), unchanged: make([]bool, count)}
+	for i := 0; i < count && r.err == nil; i++ {
+		switch kind := r.byte(); kind {
+		case 'n':
+		case 'u':
+			tuple.unchanged[i] = true
+		case 't':
+			text := r.take(int(r.uint32()))
+			if r.err == nil {
+				tuple.values[i], r.err = pgTextValue(relation.columns[i].typeOID, string(text))
+			}
+		default:
+			r.err = fmt.Errorf("未知列数据类型 %q", kind)
+		}
+	}
+	return tuple
+}
+
+// PostgreSQL 内置类型 OID
+const (
+	pgBoolOID        = 16
+	pgByteaOID       = 17
+	pgInt8OID        = 20
+	pgInt2OID        = 21
+	pgInt4OID        = 23
+	pgFloat4OID      = 700
+	pgFloat8OID      = 701
+	pgTimestamptzOID = 1184
+)
+
+// pgTextValue 把文本格式的列值转成写入目标库时各驱动都能接受的 Go 值；其余类型保留文本由目标库转换
+func pgTextValue(typeOID uint32, text string) (interface{}, error) {
+	switch typeOID {
+	case pgBoolOID:
+		return text == "t", nil
+	case pgInt2OID, pgInt4OID, pgInt8OID:
+		return strconv.ParseInt(text, 10, 64)
+	case pgFloat4OID, pgFloat8OID:
+		return strconv.ParseFloat(text, 64)
+	case pgByteaOID:
+		return hex.DecodeString(strings.TrimPrefix(text, `\x`))
+	case pgTimestamptzOID:
+		for _, layout := range []string{"2006-01-02 15:04:05.999999999Z07:00:00", "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999Z07"} {
+			if value, err := time.Parse(layout, text); err == nil {
+				return value.Local(), nil
+			}
+		}
+		return nil, fmt.Errorf("无法解析时间戳 %s", text)
+	default:
+		return text, nil
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePGLSN(t *testing.T) {
+	tests := map[string]pgLSN{
+		"0/0":         0,
+		"0/16B3748":   0x16B3748,
+		"16/B374D848": 0x16<<32 | 0xB374D848,
+	}
+	for text, want := range tests {
+		got, err := parsePGLSN(text)
+		if err != nil || got != want {
+			t.Fatalf("parsePGLSN(%s) = %v, %v, want %v", text, got, err, want)
+		}
+		if got.String() != text {
+			t.Fatalf("String() = %s, want %s", got.String(), text)
+		}
+	}
+	for _, text := range []string{"", "16B3748", "G/0", "0/100000000"} {
+		if _, err := parsePGLSN(text); err == nil {
+			t.Fatalf("parsePGLSN(%q) should fail", text)
+		}
+	}
+}
+
+type pgMessageBuilder []byte
+
+func (b pgMessageBuilder) byte(value byte) pgMessageBuilder { return append(b, value) }
+
+func (b pgMessageBuilder) uint16(value uint16) pgMessageBuilder {
+	return binary.BigEndian.AppendUint16(b, value)
+}
+
+func (b pgMessageBuilder) uint32(value uint32) pgMessageBuilder {
+	return binary.BigEndian.AppendUint32(b, value)
+}
+
+func (b pgMessageBuilder) cstring(value string) pgMessageBuilder {
+	return append(append(b, value...), 0)
+}
+
+func (b pgMessageBuilder) text(value string) pgMessageBuilder {
+	return append(b.byte('t').uint32(uint32(len(value))), value...)
+}
+
+func TestParsePGOutput(t *testing.T) {
+	relations := map[uint32]*pgRelation{}
+	relation := pgMessageBuilder{}.byte('R').uint32(7).cstring("public").cstring("orders").byte('d').uint16(3).
+		byte(1).cstring("id").uint32(pgInt8OID).uint32(0xFFFFFFFF).
+		byte(0).cstring("paid").uint32(pgBoolOID).uint32(0xFFFFFFFF).
+		byte(0).cstring("memo").uint32(25).uint32(0xFFFFFFFF)
+	if message, err := parsePGOutput(relation, relations); err != nil || message != nil {
+		t.Fatalf("relation = %v, %v", message, err)
+	}
+	if got := relations[7].columnNames(); !reflect.DeepEqual(got, []string{"id", "paid", "memo"}) || !relations[7].columns[0].key {
+		t.Fatalf("relation columns = %v", relations[7].columns)
+	}
+
+	insert := pgMessageBuilder{}.byte('I').uint32(7).byte('N').uint16(3).text("42").text("t").byte('n')
+	message, err := parsePGOutput(insert, relations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := message.(*pgInsert).tuple.values; !reflect.DeepEqual(got, []interface{}{int64(42), true, nil}) {
+		t.Fatalf("insert values = %#v", got)
+	}
+
+	update := pgMessageBuilder{}.byte('U').uint32(7).byte('K').uint16(3).text("41").byte('n').byte('n').
+		byte('N').uint16(3).text("42").text("f").byte('u')
+	message, err = parsePGOutput(update, relations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := message.(*pgUpdate)
+	if got.old.values[0] != int64(41) || got.tuple.values[1] != false || !got.tuple.unchanged[2] {
+		t.Fatalf("update = %#v %#v", got.old, got.tuple)
+	}
+
+	if _, err := parsePGOutput(pgMessageBuilder{}.byte('D').uint32(8).byte('K').uint16(1).text("1"), relations); err == nil {
+		t.Fatal("unknown relation should fail")
+	}
+}
+
+func TestPGTextValue(t *testing.T) {
+	tests := []struct {
+		oid  uint32
+		text string
+		want interface{}
+	}{
+		{oid: pgInt4OID, text: "-7", want: int64(-7)},
+		{oid: pgFloat8OID, text: "1.5", want: 1.5},
+		{oid: pgByteaOID, text: `\x0aff`, want: []byte{0x0a, 0xff}},
+		{oid: pgTimestamptzOID, text: "2024-05-01 08:00:00.5+08", want: time.Date(2024, 5, 1, 0, 0, 0, 500000000, time.UTC).Local()},
+		{oid: 1700, text: "12.30", want: "12.30"},
+	}
+	for _, tt := range tests {
+		got, err := pgTextValue(tt.oid, tt.text)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("pgTextValue(%d, %s) = %#v, %v, want %#v", tt.oid, tt.text, got, err, tt.want)
+		}
+	}
+}
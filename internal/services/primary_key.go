@@ -0,0 +1,171 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// 主键列以逗号分隔存放在 SourcePrimaryKey/TargetPrimaryKey 中，顺序与主键索引一致。
+// 单列主键的游标、分片边界和差异记录仍保存原始值，复合主键保存 JSON 数组编码的元组。
+
+func primaryKeyColumns(pk string) []string {
+	columns := []string{}
+	for _, column := range strings.Split(pk, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+func mappedPrimaryKey(mapping models.FieldMapping, pk string) string {
+	columns := primaryKeyColumns(pk)
+	for i, column := range columns {
+		columns[i] = mappedColumn(mapping, column)
+	}
+	return strings.Join(columns, ",")
+}
+
+func isPrimaryKeyColumn(pk, column string) bool {
+	return containsString(primaryKeyColumns(pk), column)
+}
+
+// samePrimaryKey 比较两个主键的列集合，忽略顺序
+func samePrimaryKey(left, right string) bool {
+	leftColumns, rightColumns := primaryKeyColumns(left), primaryKeyColumns(right)
+	if len(leftColumns) == 0 || len(leftColumns) != len(rightColumns) {
+		return false
+	}
+	for _, column := range leftColumns {
+		if !containsString(rightColumns, column) {
+			return false
+		}
+	}
+	return true
+}
+
+// mysqlIndex 是 SHOW KEYS 按索引聚合后的结果，Columns 按 Seq_in_index 排序
+type mysqlIndex struct {
+	Name     string
+	Columns  []string
+	Unique   bool
+	Nullable bool
+}
+
+func mysqlIndexes(db *gorm.DB, table string) ([]mysqlIndex, error) {
+	var keys []struct {
+		KeyName    string `gorm:"column:Key_name"`
+		NonUnique  int    `gorm:"column:Non_unique"`
+		SeqInIndex int    `gorm:"column:Seq_in_index"`
+		ColumnName string `gorm:"column:Column_name"`
+		Null       string `gorm:"column:Null"`
+	}
+	if err := db.Raw("SHOW KEYS FROM " + quoteMySQLTable(table)).Scan(&keys).Error; err != nil {
+		return nil, err
+	}
+	indexes := []mysqlIndex{}
+	positions := map[string]int{}
+	for _, key := range keys {
+		i, ok := positions[key.KeyName]
+		if !ok {
+			i = len(indexes)
+			positions[key.KeyName] = i
+			indexes = append(indexes, mysqlIndex{Name: key.KeyName, Unique: key.NonUnique == 0})
+		}
+		index := &indexes[i]
+		if key.SeqInIndex != len(index.Columns)+1 {
+			return nil, fmt.Errorf("读取索引 %s 列顺序失败", key.KeyName)
+		}
+		index.Columns = append(index.Columns, key.ColumnName)
+		if strings.EqualFold(key.Null, "YES") {
+			index.Nullable = true
+		}
+	}
+	return indexes, nil
+}
+
+// tablePrimaryKey 按索引列顺序读取主键列，保证元组比较能走主键索引
+func tablePrimaryKey(db *gorm.DB, table string) (string, error) {
+	indexes, err := dialectOf(db).indexes(db, table)
+	if err != nil {
+		return "", err
+	}
+	for _, index := range indexes {
+		if index.Name == "PRIMARY" {
+			return strings.Join(index.Columns, ","), nil
+		}
+	}
+	return "", nil
+}
+
+func encodePrimaryKey(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	encoded, _ := json.Marshal(values)
+	return string(encoded)
+}
+
+func decodePrimaryKey(encoded string, size int) ([]string, error) {
+	if size <= 1 {
+		return []string{encoded}, nil
+	}
+	var values []string
+	if err := json.Unmarshal([]byte(encoded), &values); err != nil || len(values) != size {
+		return nil, fmt.Errorf("复合主键值格式不正确: %s", encoded)
+	}
+	return values, nil
+}
+
+func rowPrimaryKey(row map[string]interface{}, columns []string) string {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		values[i] = valueString(row[column])
+	}
+	return encodePrimaryKey(values)
+}
+
+// primaryKeyCondition 生成 `a` > ? 或 (`a`,`b`) > (?,?) 形式的比较条件
+func primaryKeyCondition(columns []string, op string) string {
+	if len(columns) == 1 {
+		return quoteMySQL(columns[0]) + " " + op + " ?"
+	}
+	return "(" + primaryKeyOrder(columns) + ") " + op + " (" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+}
+
+func primaryKeyOrder(columns []string) string {
+	return strings.Join(quotedColumns(columns), ",")
+}
+
+func primaryKeyArgs(encoded string, columns []string) ([]interface{}, error) {
+	values, err := decodePrimaryKey(encoded, len(columns))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(values))
+	for i := range values {
+		args[i] = values[i]
+	}
+	return args, nil
+}
+
+// primaryKeyInCondition 生成按一组主键取数的 IN 条件及参数
+func primaryKeyInCondition(columns []string, encodedKeys []string) (string, []interface{}, error) {
+	args := make([]interface{}, 0, len(encodedKeys)*len(columns))
+	for _, encoded := range encodedKeys {
+		values, err := primaryKeyArgs(encoded, columns)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, values...)
+	}
+	if len(columns) == 1 {
+		return quoteMySQL(columns[0]) + " IN (" + strings.TrimSuffix(strings.Repeat("?,", len(encodedKeys)), ",") + ")", args, nil
+	}
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+	return "(" + primaryKeyOrder(columns) + ") IN (" + strings.TrimSuffix(strings.Repeat(tuple+",", len(encodedKeys)), ",") + ")", args, nil
+}
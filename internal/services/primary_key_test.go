@@ -0,0 +1,61 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrimaryKeyEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		row     map[string]interface{}
+		encoded string
+	}{
+		{name: "single", columns: []string{"id"}, row: map[string]interface{}{"id": int64(42)}, encoded: "42"},
+		{name: "composite", columns: []string{"tenant_id", "order_no"}, row: map[string]interface{}{"tenant_id": int64(7), "order_no": []byte("A,1")}, encoded: `["7","A,1"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := rowPrimaryKey(tt.row, tt.columns)
+			if encoded != tt.encoded {
+				t.Fatalf("encoded = %q, want %q", encoded, tt.encoded)
+			}
+			values, err := decodePrimaryKey(encoded, len(tt.columns))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(values) != len(tt.columns) {
+				t.Fatalf("decoded %v", values)
+			}
+		})
+	}
+
+	if _, err := decodePrimaryKey("42", 2); err == nil {
+		t.Fatal("expected error for single value with composite key")
+	}
+}
+
+func TestPrimaryKeyConditions(t *testing.T) {
+	columns := primaryKeyColumns("tenant_id, order_no")
+	if got := primaryKeyCondition(columns, ">"); got != "(`tenant_id`,`order_no`) > (?,?)" {
+		t.Fatalf("condition = %q", got)
+	}
+	if got := primaryKeyCondition([]string{"id"}, "<="); got != "`id` <= ?" {
+		t.Fatalf("single condition = %q", got)
+	}
+	condition, args, err := primaryKeyInCondition(columns, []string{`["1","a"]`, `["2","b"]`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if condition != "(`tenant_id`,`order_no`) IN ((?,?),(?,?))" {
+		t.Fatalf("in condition = %q", condition)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"1", "a", "2", "b"}) {
+		t.Fatalf("args = %v", args)
+	}
+	if !samePrimaryKey("a,b", "b,a") || samePrimaryKey("a", "a,b") {
+		t.Fatal("samePrimaryKey mismatch")
+	}
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/database"
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// 源端读取限流作用于全量读取和数据比对，CDC 只读 Binlog 不受影响。任务限流只约束本任务，
+// 连接限流由使用该源连接的全部任务共享，降速时段内再取时段上限，多个上限同时生效时取最严格的。
+// 连接配置了活跃线程或复制延迟阈值时，每批读取后探测源库负载，超过阈值即暂停读取并逐步拉长等待，恢复后继续。
+
+const (
+	sourceLoadProbeInterval = 2 * time.Second
+	sourceLoadMaxBackoff    = 30 * time.Second
+)
+
+var (
+	readLimiters    sync.Map // key -> *readLimiter
+	sourceLoadCache sync.Map // 连接名 -> sourceLoad
+)
+
+// readLimiter 按平均速率记账：每批读取后把消耗折算为时长累加到 next，调用方等待到 next 再读下一批
+type readLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+func (l *readLimiter) reserve(amount, perSecond float64, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(amount / perSecond * float64(time.Second)))
+	return l.next.Sub(now)
+}
+
+func reserveRead(key string, amount, perSecond float64, now time.Time) time.Duration {
+	if perSecond <= 0 || amount <= 0 {
+		return 0
+	}
+	limiter, _ := readLimiters.LoadOrStore(key, &readLimiter{})
+	return limiter.(*readLimiter).reserve(amount, perSecond, now)
+}
+
+type sourceLoad struct {
+	checkedAt      time.Time
+	threadsRunning int
+	replicaLag     int // -1 表示未配置复制或延迟未知
+}
+
+// readThrottle 是一次全量读取或数据比对的限流器；stopped 在任务暂停或作业取消时返回错误，report 输出限流状态
+type readThrottle struct {
+	task     *models.SyncTask
+	sourceDB *gorm.DB
+	stopped  func() error
+	report   func(message string)
+}
+
+// wait 记入本批读取的行数和字节数，按限流等待并在源库负载过高时暂停
+func (t readThrottle) wait(rows int, bytes int64) error {
+	connection := loadThrottleConnection(t.task.SourceDB)
+	now := time.Now()
+	delay := maxDuration(
+		reserveRead(fmt.Sprintf("task:%d:rows", t.task.ID), float64(rows), float64(t.task.ReadRowsPerSecond), now),
+		reserveRead(fmt.Sprintf("task:%d:bytes", t.task.ID), float64(bytes), float64(t.task.ReadBytesPerSecond), now),
+	)
+	if connection != nil {
+		// 连接上限和降速时段共用一个记账器，取生效中的最严格值
+		rowLimit, byteLimit := int64(connection.ReadRowsPerSecond), connection.ReadBytesPerSecond
+		if window, ok := activeThrottleWindow(connection.ThrottleWindows, now); ok {
+			rowLimit, byteLimit = minPositive(rowLimit, int64(window.RowsPerSecond)), minPositive(byteLimit, window.BytesPerSecond)
+		}
+		delay = maxDuration(delay,
+			reserveRead("conn:"+connection.Name+":rows", float64(rows), float64(rowLimit), now),
+			reserveRead("conn:"+connection.Name+":bytes", float64(bytes), float64(byteLimit), now),
+		)
+	}
+	if err := t.sleep(delay); err != nil {
+		return err
+	}
+	if connection == nil || (connection.ThrottleThreadsRunning <= 0 && connection.ThrottleReplicaLagSeconds <= 0) {
+		return nil
+	}
+	backoff := time.Second
+	for {
+		reason := sourceOverloaded(connection, t.sourceDB)
+		if reason == "" {
+			return nil
+		}
+		if t.report != nil {
+			t.report(fmt.Sprintf("源库负载过高（%s），%s 后重试读取", reason, backoff))
+		}
+		if err := t.sleep(backoff); err != nil {
+			return err
+		}
+		if backoff *= 2; backoff > sourceLoadMaxBackoff {
+			backoff = sourceLoadMaxBackoff
+		}
+	}
+}
+
+// sleep 分段等待，期间任务暂停或作业取消时提前返回
+func (t readThrottle) sleep(delay time.Duration) error {
+	for delay > 0 {
+		step := delay
+		if step > time.Second {
+			step = time.Second
+		}
+		time.Sleep(step)
+		delay -= step
+		if t.stopped != nil {
+			if err := t.stopped(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func loadThrottleConnection(name string) *models.DatabaseConnection {
+	systemDB, err := database.GetManager().GetConnection("system")
+	if err != nil {
+		return nil
+	}
+	var connection models.DatabaseConnection
+	if err := systemDB.Where("name = ?", name).First(&connection).Error; err != nil {
+		return nil
+	}
+	return &connection
+}
+
+// activeThrottleWindow 返回当前所在的降速时段
+func activeThrottleWindow(windows models.ThrottleWindows, now time.Time) (models.ThrottleWindow, bool) {
+	minute := now.Hour()*60 + now.Minute()
+	for _, window := range windows {
+		start, startErr := parseWindowMinute(window.Start)
+		end, endErr := parseWindowMinute(window.End)
+		if startErr != nil || endErr != nil {
+			continue
+		}
+		if (start <= end && minute >= start && minute < end) || (start > end && (minute >= start || minute < end)) {
+			return window, true
+		}
+	}
+	return models.ThrottleWindow{}, false
+}
+
+func parseWindowMinute(value string) (int, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("时间 %s 格式应为 HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// ValidateThrottle 校验连接的读取限流配置
+func (s *ConnectionService) ValidateThrottle(connection *models.DatabaseConnection) error {
+	if connection.ReadRowsPerSecond < 0 || connection.ReadBytesPerSecond < 0 || connection.ThrottleThreadsRunning < 0 || connection.ThrottleReplicaLagSeconds < 0 {
+		return fmt.Errorf("限流配置不能小于 0")
+	}
+	for i, window := range connection.ThrottleWindows {
+		start, err := parseWindowMinute(window.Start)
+		if err != nil {
+			return fmt.Errorf("降速时段 %d %w", i+1, err)
+		}
+		end, err := parseWindowMinute(window.End)
+		if err != nil {
+			return fmt.Errorf("降速时段 %d %w", i+1, err)
+		}
+		if start == end {
+			return fmt.Errorf("降速时段 %d 开始和结束时间不能相同", i+1)
+		}
+		if window.RowsPerSecond <= 0 && window.BytesPerSecond <= 0 {
+			return fmt.Errorf("降速时段 %d 需设置行数或字节上限", i+1)
+		}
+		if window.RowsPerSecond < 0 || window.BytesPerSecond < 0 {
+			return fmt.Errorf("降速时段 %d 上限不能小于 0", i+1)
+		}
+	}
+	return nil
+}
+
+// sourceOverloaded 探测源库负载，超过阈值时返回原因；探测结果按连接缓存，多个读取协程共用
+func sourceOverloaded(connection *models.DatabaseConnection, db *gorm.DB) string {
+	var load sourceLoad
+	if cached, ok := sourceLoadCache.Load(connection.Name); ok && time.Since(cached.(sourceLoad).checkedAt) < sourceLoadProbeInterval {
+		load = cached.(sourceLoad)
+	} else {
+		load = probeSourceLoad(db)
+		sourceLoadCache.Store(connection.Name, load)
+	}
+	if connection.ThrottleThreadsRunning > 0 && load.threadsRunning > connection.ThrottleThreadsRunning {
+		return fmt.Sprintf("活跃线程 %d 超过 %d", load.threadsRunning, connection.ThrottleThreadsRunning)
+	}
+	if connection.ThrottleReplicaLagSeconds > 0 && load.replicaLag > connection.ThrottleReplicaLagSeconds {
+		return fmt.Sprintf("复制延迟 %d 秒超过 %d 秒", load.replicaLag, connection.ThrottleReplicaLagSeconds)
+	}
+	return ""
+}
+
+// probeSourceLoad 读取活跃线程数和复制延迟，探测失败的指标按未知处理，不阻塞读取
+func probeSourceLoad(db *gorm.DB) sourceLoad {
+	load := sourceLoad{checkedAt: time.Now(), replicaLag: -1}
+	if dialectOf(db).name() == "postgres" {
+		_ = db.Raw("SELECT COUNT(*) FROM pg_stat_activity WHERE state = 'active'").Scan(&load.threadsRunning).Error
+		var lag *float64
+		if err := db.Raw("SELECT EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())").Scan(&lag).Error; err == nil && lag != nil {
+			load.replicaLag = int(*lag)
+		}
+		return load
+	}
+	var variable struct {
+		VariableName string `gorm:"column:Variable_name"`
+		Value        string `gorm:"column:Value"`
+	}
+	if err := db.Raw("SHOW GLOBAL STATUS LIKE 'Threads_running'").Scan(&variable).Error; err == nil {
+		load.threadsRunning, _ = strconv.Atoi(variable.Value)
+	}
+	for _, query := range []string{"SHOW REPLICA STATUS", "SHOW SLAVE STATUS"} {
+		status := map[string]interface{}{}
+		if err := db.Raw(query).Scan(&status).Error; err != nil {
+			continue
+		}
+		for _, column := range []string{"Seconds_Behind_Source", "Seconds_Behind_Master"} {
+			if value, ok := status[column]; ok && value != nil {
+				if lag, err := strconv.Atoi(valueString(value)); err == nil {
+					load.replicaLag = lag
+				}
+			}
+		}
+		break
+	}
+	return load
+}
+
+// batchBytes 估算一批行的数据量
+func batchBytes(batch []map[string]interface{}) int64 {
+	var total int64
+	for _, row := range batch {
+		for _, value := range row {
+			total += valueBytes(value)
+		}
+	}
+	return total
+}
+
+func valueBytes(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	default:
+		return 8
+	}
+}
+
+func minPositive(values ...int64) int64 {
+	var result int64
+	for _, value := range values {
+		if value > 0 && (result == 0 || value < result) {
+			result = value
+		}
+	}
+	return result
+}
+
+func maxDuration(values ...time.Duration) time.Duration {
+	var result time.Duration
+	for _, value := range values {
+		if value > result {
+			result = value
+		}
+	}
+	return result
+}
+
+// repairThrottle 返回数据比对使用的限流器，作业取消时停止等待
+func repairThrottle(ctx context.Context, task *models.SyncTask, sourceDB *gorm.DB) readThrottle {
+	return readThrottle{task: task, sourceDB: sourceDB, stopped: ctx.Err}
+}
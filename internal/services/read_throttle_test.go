@@ -0,0 +1,71 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestActiveThrottleWindow(t *testing.T) {
+	windows := models.ThrottleWindows{
+		{Start: "09:00", End: "18:00", RowsPerSecond: 500},
+		{Start: "22:30", End: "02:00", BytesPerSecond: 1 << 20},
+	}
+	tests := []struct {
+		clock string
+		want  int
+		ok    bool
+	}{
+		{clock: "08:59", ok: false},
+		{clock: "09:00", want: 500, ok: true},
+		{clock: "17:59", want: 500, ok: true},
+		{clock: "18:00", ok: false},
+		{clock: "23:15", ok: true},
+		{clock: "01:59", ok: true},
+		{clock: "02:00", ok: false},
+	}
+	for _, tt := range tests {
+		now, _ := time.ParseInLocation("15:04", tt.clock, time.Local)
+		window, ok := activeThrottleWindow(windows, now)
+		if ok != tt.ok || window.RowsPerSecond != tt.want {
+			t.Fatalf("%s: got %+v, %v", tt.clock, window, ok)
+		}
+	}
+}
+
+func TestReadLimiterReserve(t *testing.T) {
+	limiter := &readLimiter{}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if wait := limiter.reserve(1000, 500, now); wait != 2*time.Second {
+		t.Fatalf("first batch wait = %s", wait)
+	}
+	// 第二批在第一批的配额用完前读出，需要叠加等待
+	if wait := limiter.reserve(500, 500, now.Add(time.Second)); wait != 2*time.Second {
+		t.Fatalf("second batch wait = %s", wait)
+	}
+	// 空闲期间不累积配额
+	if wait := limiter.reserve(500, 500, now.Add(time.Minute)); wait != time.Second {
+		t.Fatalf("idle batch wait = %s", wait)
+	}
+	if minPositive(0, 300, 200) != 200 || minPositive(0, 0) != 0 {
+		t.Fatalf("minPositive")
+	}
+}
+
+func TestValidateThrottle(t *testing.T) {
+	service := &ConnectionService{}
+	valid := &models.DatabaseConnection{ReadRowsPerSecond: 1000, ThrottleWindows: models.ThrottleWindows{{Start: "22:00", End: "06:00", RowsPerSecond: 100}}}
+	if err := service.ValidateThrottle(valid); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+	for _, windows := range []models.ThrottleWindows{
+		{{Start: "9:00am", End: "18:00", RowsPerSecond: 100}},
+		{{Start: "09:00", End: "09:00", RowsPerSecond: 100}},
+		{{Start: "09:00", End: "18:00"}},
+	} {
+		if err := service.ValidateThrottle(&models.DatabaseConnection{ThrottleWindows: windows}); err == nil {
+			t.Fatalf("%+v: expected error", windows)
+		}
+	}
+}
@@ -73,6 +73,11 @@ func (s *RepairService) ListDiffs(jobID uint, page, pageSize int) ([]RepairDiffV
 }
 
 func (s *RepairService) StartCompare(taskID uint, req RepairCompareRequest) (*models.SyncRepairJob, error) {
+	return s.startCompare(taskID, req, "", false)
+}
+
+// startCompare 发起比对，trigger 标记自动发起的来源，autoApply 为 true 时比对发现差异后自动补数
+func (s *RepairService) startCompare(taskID uint, req RepairCompareRequest, trigger string, autoApply bool) (*models.SyncRepairJob, error) {
 	task, err := NewSyncService().GetTask(taskID)
 	if err != nil {
 		return nil, err
@@ -84,11 +89,17 @@ func (s *RepairService) StartCompare(taskID uint, req RepairCompareRequest) (*mo
 	if task.ValidationStatus != "passed" {
 		return nil, fmt.Errorf("任务预检查尚未通过")
 	}
+	if targetDB, err := database.GetManager().GetConnection(task.TargetDB); err == nil && dialectOf(targetDB).name() != "mysql" {
+		return nil, fmt.Errorf("数据比对暂仅支持 MySQL 目标库")
+	}
+	if sourceDB, err := database.GetManager().GetConnection(task.SourceDB); err == nil && dialectOf(sourceDB).name() != "mysql" {
+		return nil, fmt.Errorf("数据比对暂仅支持 MySQL 源库")
+	}
 	if err := s.ensureNoRunningJob(taskID); err != nil {
 		return nil, err
 	}
 	now := time.Now()
-	job := &models.SyncRepairJob{TaskID: taskID, JobType: "compare", Status: "running", CutoffTime: req.CutoffTime, CutoffFrom: req.CutoffFrom, CutoffColumn: req.CutoffColumn, TableCutoffs: req.TableCutoffs, Message: "正在对比", StartedAt: &now}
+	job := &models.SyncRepairJob{TaskID: taskID, JobType: "compare", Status: "running", CutoffTime: req.CutoffTime, CutoffFrom: req.CutoffFrom, CutoffColumn: req.CutoffColumn, TableCutoffs: req.TableCutoffs, Trigger: trigger, AutoApply: autoApply, Message: "正在对比", StartedAt: &now}
 	if err := s.systemDB.Create(job).Error; err != nil {
 		return nil, err
 	}
@@ -112,7 +123,7 @@ func (s *RepairService) StartRepair(taskID, compareJobID uint) (*models.SyncRepa
 		return nil, fmt.Errorf("对比任务不存在")
 	}
 	now := time.Now()
-	job := &models.SyncRepairJob{TaskID: taskID, JobType: "repair", Status: "running", SourceJobID: compare.ID, CutoffTime: compare.CutoffTime, CutoffColumn: compare.CutoffColumn, Message: "正在补数", PreviousStatus: task.RuntimeStatus, StartedAt: &now}
+	job := &models.SyncRepairJob{TaskID: taskID, JobType: "repair", Status: "running", SourceJobID: compare.ID, CutoffTime: compare.CutoffTime, CutoffColumn: compare.CutoffColumn, Trigger: compare.Trigger, Message: "正在补数", PreviousStatus: task.RuntimeStatus, StartedAt: &now}
 	if err := s.systemDB.Create(job).Error; err != nil {
 		return nil, err
 	}
@@ -184,6 +195,10 @@ func (s *RepairService) compareJob(ctx context.Context, job *models.SyncRepairJo
 				continue
 			}
 		}
+		// 无键表无法按行定位，历史表同一行有多条记录，插件输出的行无法由源行推算，都不参与比对
+		if keylessRowIdentity(table) || writesHistory(table) || table.PluginID != nil {
+			continue
+		}
 		if err := s.compareTable(ctx, job, task, table, sourceDB, targetDB); err != nil {
 			return err
 		}
@@ -200,7 +215,8 @@ func (s *RepairService) compareTable(ctx context.Context, job *models.SyncRepair
 	if err != nil {
 		return err
 	}
-	sourceAllColumns, err := mysqlColumnNamesFromDB(sourceDB, mapping.SourceTable)
+	pairs = withTransformPairs(mapping, pairs)
+	sourceAllColumns, err := mysqlColumnNamesFromDB(sourceDB, sourceTableName(mapping))
 	if err != nil {
 		return err
 	}
@@ -213,35 +229,43 @@ func (s *RepairService) compareTable(ctx context.Context, job *models.SyncRepair
 			cutoffColumn = job.CutoffColumn
 		}
 	}
-	sourceTotal, err := countRepairRowsRange(sourceDB, mapping.SourceTable, cutoffColumn, job.CutoffFrom, job.CutoffTime)
+	sourceTotal, err := countRepairRowsRange(sourceDB, sourceTableName(mapping), sourceRowFilter(mapping), cutoffColumn, job.CutoffFrom, job.CutoffTime)
 	if err != nil {
 		return err
 	}
 	// 目标端行数统计也按相同条件过滤
-	targetTotal, err := countRepairRowsRange(targetDB, mapping.TargetTable, cutoffColumn, job.CutoffFrom, job.CutoffTime)
+	targetTotal, err := countRepairRowsRange(targetDB, mapping.TargetTable, targetShardFilter(mapping), cutoffColumn, job.CutoffFrom, job.CutoffTime)
 	if err != nil {
 		return err
 	}
 	s.addJobTotal(job.ID, sourceTotal+targetTotal)
+	throttle := repairThrottle(ctx, task, sourceDB)
 	lastPK := ""
 	for {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
-		rows, err := readRepairRowsRange(sourceDB, mapping.SourceTable, mapping.SourcePrimaryKey, sourcePairColumns(pairs), lastPK, cutoffColumn, job.CutoffFrom, job.CutoffTime)
+		rows, err := readRepairRowsRange(sourceDB, sourceTableName(mapping), mapping.SourcePrimaryKey, sourceRowFilter(mapping), sourcePairColumns(pairs), lastPK, cutoffColumn, job.CutoffFrom, job.CutoffTime)
 		if err != nil {
 			return err
 		}
 		if len(rows) == 0 {
 			break
 		}
-		targetRows, err := readRowsByPKs(targetDB, mapping.TargetTable, mapping.TargetPrimaryKey, targetPairColumns(pairs), repairRowPKs(rows, mapping.SourcePrimaryKey))
+		if err := throttle.wait(len(rows), batchBytes(rows)); err != nil {
+			return err
+		}
+		targetRows, err := readRowsByPKs(targetDB, mapping.TargetTable, mapping.TargetPrimaryKey, targetShardFilter(mapping), targetPairColumns(pairs), repairRowPKs(rows, mapping.SourcePrimaryKey))
 		if err != nil {
 			return err
 		}
 		diffs := make([]models.SyncRepairDiff, 0)
 		for _, row := range rows {
-			lastPK = valueString(row[mapping.SourcePrimaryKey])
+			lastPK = rowPrimaryKey(row, primaryKeyColumns(mapping.SourcePrimaryKey))
+			// 源行按写入时相同的转换计算后再比较
+			if row, err = transformRow(mapping, pairs, row); err != nil {
+				return err
+			}
 			sourceHash := hashRepairRow(row, pairs, true)
 			targetRow := targetRows[lastPK]
 			if targetRow == nil {
@@ -258,32 +282,48 @@ func (s *RepairService) compareTable(ctx context.Context, job *models.SyncRepair
 		}
 		s.bumpJobProgress(job.ID, int64(len(rows)), 0, 0)
 	}
-	return s.compareTargetExtras(ctx, job, mapping, sourceDB, targetDB, pairs, cutoffColumn)
+	if sharedPatternTarget(mapping) {
+		// 目标表由多个分片共享且没有来源分片列，无法判断目标多余行属于哪个分片
+		return nil
+	}
+	if mapping.DeleteMode == deleteModeIgnore {
+		// 忽略删除的表，目标多余数据是预期保留的已删除行
+		return nil
+	}
+	return s.compareTargetExtras(ctx, job, mapping, sourceDB, targetDB, pairs, cutoffColumn, throttle)
 }
 
-func (s *RepairService) compareTargetExtras(ctx context.Context, job *models.SyncRepairJob, mapping *models.SyncTaskTable, sourceDB, targetDB *gorm.DB, pairs []syncColumnPair, cutoffColumn string) error {
+func (s *RepairService) compareTargetExtras(ctx context.Context, job *models.SyncRepairJob, mapping *models.SyncTaskTable, sourceDB, targetDB *gorm.DB, pairs []syncColumnPair, cutoffColumn string, throttle readThrottle) error {
+	columns := targetPairColumns(pairs)
+	if softDeletes(mapping) {
+		columns = append(columns, mapping.DeleteColumn)
+	}
 	lastPK := ""
 	for {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
 		// 目标端也按相同时间段过滤
-		rows, err := readRepairRowsRange(targetDB, mapping.TargetTable, mapping.TargetPrimaryKey, targetPairColumns(pairs), lastPK, cutoffColumn, job.CutoffFrom, job.CutoffTime)
+		rows, err := readRepairRowsRange(targetDB, mapping.TargetTable, mapping.TargetPrimaryKey, targetShardFilter(mapping), columns, lastPK, cutoffColumn, job.CutoffFrom, job.CutoffTime)
 		if err != nil {
 			return err
 		}
 		if len(rows) == 0 {
 			return nil
 		}
-		sourceRows, err := readRowsByPKsWithCutoff(sourceDB, mapping.SourceTable, mapping.SourcePrimaryKey, []string{mapping.SourcePrimaryKey}, repairRowPKs(rows, mapping.TargetPrimaryKey), cutoffColumn, job.CutoffTime)
+		sourceRows, err := readRowsByPKsWithCutoff(sourceDB, sourceTableName(mapping), mapping.SourcePrimaryKey, sourceRowFilter(mapping), primaryKeyColumns(mapping.SourcePrimaryKey), repairRowPKs(rows, mapping.TargetPrimaryKey), cutoffColumn, job.CutoffTime)
 		if err != nil {
 			return err
 		}
+		if err := throttle.wait(len(sourceRows), 0); err != nil {
+			return err
+		}
 		diffs := make([]models.SyncRepairDiff, 0)
 		for _, row := range rows {
-			targetPK := valueString(row[mapping.TargetPrimaryKey])
+			targetPK := rowPrimaryKey(row, primaryKeyColumns(mapping.TargetPrimaryKey))
 			sourceRow := sourceRows[targetPK]
-			if sourceRow == nil {
+			// 已软删除的目标行本就没有对应源行
+			if sourceRow == nil && !(softDeletes(mapping) && softDeleted(row[mapping.DeleteColumn])) {
 				// 按时间段追数时，源端在时间范围内的数据不应缺失；全量对比则标记
 				diffs = append(diffs, newRepairDiff(job, mapping, targetPK, targetPK, "missing_source", "", hashRepairRow(row, pairs, false), "源端缺少数据"))
 			}
@@ -312,7 +352,7 @@ func (s *RepairService) repairJob(ctx context.Context, job *models.SyncRepairJob
 	if err != nil {
 		return err
 	}
-	wasRunning := task.RuntimeStatus == "initializing" || task.RuntimeStatus == "catching_up" || task.RuntimeStatus == "cdc_running"
+	wasRunning := task.RuntimeStatus == "initializing" || task.RuntimeStatus == "catching_up" || task.RuntimeStatus == "cdc_running" || task.RuntimeStatus == "retrying"
 	if wasRunning {
 		if err := syncSvc.PauseTask(task.ID); err != nil {
 			return err
@@ -321,7 +361,7 @@ func (s *RepairService) repairJob(ctx context.Context, job *models.SyncRepairJob
 	_ = syncSvc.UpdateTask(task.ID, map[string]interface{}{"repair_status": "repairing", "last_run_message": "正在补数，预警已暂停"})
 	defer func() {
 		if wasRunning {
-			_ = syncSvc.ResumeTask(task.ID)
+			_ = syncSvc.ResumeTask(task.ID, RunTriggerSystem)
 		} else {
 			_ = syncSvc.UpdateTask(task.ID, map[string]interface{}{"repair_status": "idle"})
 		}
@@ -370,10 +410,17 @@ func (s *RepairService) repairJob(ctx context.Context, job *models.SyncRepairJob
 				end = len(tableDiffs)
 			}
 			chunk := tableDiffs[start:end]
-			rowsByPK, err := readSourceRowsByPKs(sourceDB, mapping.SourceTable, mapping.SourcePrimaryKey, sourceColumns, repairDiffPKs(chunk))
+			rowsByPK, err := readSourceRowsByPKs(sourceDB, sourceTableName(mapping), mapping.SourcePrimaryKey, sourceColumns, repairDiffPKs(chunk))
 			if err != nil {
 				return err
 			}
+			fetched := make([]map[string]interface{}, 0, len(rowsByPK))
+			for _, row := range rowsByPK {
+				fetched = append(fetched, row)
+			}
+			if err := repairThrottle(ctx, task, sourceDB).wait(len(fetched), batchBytes(fetched)); err != nil {
+				return err
+			}
 			writeRows := make([]map[string]interface{}, 0, len(chunk))
 			repairedIDs := make([]uint, 0, len(chunk))
 			skippedIDs := make([]uint, 0)
@@ -387,7 +434,7 @@ func (s *RepairService) repairJob(ctx context.Context, job *models.SyncRepairJob
 				repairedIDs = append(repairedIDs, diff.ID)
 			}
 			if len(writeRows) > 0 {
-				if err := writeMySQLBatch(targetDB, mapping, sourceColumns, writeRows); err != nil {
+				if err := writeTargetBatch(targetDB, mapping, sourceColumns, writeRows); err != nil {
 					_ = s.systemDB.Model(&models.SyncRepairDiff{}).Where("id IN ?", repairedIDs).Updates(map[string]interface{}{"status": "failed", "message": err.Error()}).Error
 					return err
 				}
@@ -423,6 +470,9 @@ func (s *RepairService) finishJob(ctx context.Context, job *models.SyncRepairJob
 	// 只更新状态不是 canceling 的记录，避免 CancelJob 强制更新后被覆盖
 	_ = s.systemDB.Model(job).Where("status != ?", "canceling").Updates(updates).Error
 	_ = NewSyncService().UpdateTask(job.TaskID, map[string]interface{}{"repair_status": "idle"})
+	if job.Trigger == repairTriggerBinlogPurge {
+		s.finishGapJob(job, err)
+	}
 }
 
 func (s *RepairService) enrichDiffs(diffs []models.SyncRepairDiff) ([]RepairDiffView, error) {
@@ -461,11 +511,15 @@ func (s *RepairService) enrichDiffs(diffs []models.SyncRepairDiff) ([]RepairDiff
 		if err != nil {
 			return nil, err
 		}
-		sourceRow, err := readSingleSourceRow(sourceDB, mapping.SourceTable, mapping.SourcePrimaryKey, sourcePairColumns(pairs), diff.SourcePK)
+		pairs = withTransformPairs(mapping, pairs)
+		sourceRow, err := readSingleSourceRow(sourceDB, sourceTableName(mapping), mapping.SourcePrimaryKey, sourceRowFilter(mapping), sourcePairColumns(pairs), diff.SourcePK)
 		if err != nil {
 			return nil, err
 		}
-		targetRow, err := readSingleSourceRow(targetDB, mapping.TargetTable, mapping.TargetPrimaryKey, targetPairColumns(pairs), diff.TargetPK)
+		if sourceRow, err = transformRow(mapping, pairs, sourceRow); err != nil {
+			return nil, err
+		}
+		targetRow, err := readSingleSourceRow(targetDB, mapping.TargetTable, mapping.TargetPrimaryKey, targetShardFilter(mapping), targetPairColumns(pairs), diff.TargetPK)
 		if err != nil {
 			return nil, err
 		}
@@ -507,11 +561,11 @@ func (s *RepairService) bumpJobProgress(jobID uint, processed, diffs, repaired i
 }
 
 func countRepairRows(db *gorm.DB, table, cutoffColumn string, cutoffTime *time.Time) (int64, error) {
-	return countRepairRowsRange(db, table, cutoffColumn, nil, cutoffTime)
+	return countRepairRowsRange(db, table, shardFilter{}, cutoffColumn, nil, cutoffTime)
 }
 
-func countRepairRowsRange(db *gorm.DB, table, cutoffColumn string, fromTime, toTime *time.Time) (int64, error) {
-	query := "SELECT COUNT(*) AS cnt FROM " + quoteMySQL(table)
+func countRepairRowsRange(db *gorm.DB, table string, filter shardFilter, cutoffColumn string, fromTime, toTime *time.Time) (int64, error) {
+	query := "SELECT COUNT(*) AS cnt FROM " + quoteMySQLTable(table)
 	params := []interface{}{}
 	wheres := []string{}
 	if cutoffColumn != "" {
@@ -524,6 +578,7 @@ func countRepairRowsRange(db *gorm.DB, table, cutoffColumn string, fromTime, toT
 			params = append(params, *toTime)
 		}
 	}
+	wheres, params = filter.apply(wheres, params)
 	if len(wheres) > 0 {
 		query += " WHERE " + strings.Join(wheres, " AND ")
 	}
@@ -535,17 +590,22 @@ func countRepairRowsRange(db *gorm.DB, table, cutoffColumn string, fromTime, toT
 }
 
 func readRepairRows(db *gorm.DB, table, pk string, columns []string, lastPK, cutoffColumn string, cutoffTime *time.Time) ([]map[string]interface{}, error) {
-	return readRepairRowsRange(db, table, pk, columns, lastPK, cutoffColumn, nil, cutoffTime)
+	return readRepairRowsRange(db, table, pk, shardFilter{}, columns, lastPK, cutoffColumn, nil, cutoffTime)
 }
 
-func readRepairRowsRange(db *gorm.DB, table, pk string, columns []string, lastPK, cutoffColumn string, fromTime, toTime *time.Time) ([]map[string]interface{}, error) {
+func readRepairRowsRange(db *gorm.DB, table, pk string, filter shardFilter, columns []string, lastPK, cutoffColumn string, fromTime, toTime *time.Time) ([]map[string]interface{}, error) {
 	selectList := quotedColumns(columns)
-	query := "SELECT " + strings.Join(selectList, ",") + " FROM " + quoteMySQL(table)
+	query := "SELECT " + strings.Join(selectList, ",") + " FROM " + quoteMySQLTable(table)
+	pkColumns := primaryKeyColumns(pk)
 	params := []interface{}{}
 	wheres := []string{}
 	if lastPK != "" {
-		wheres = append(wheres, quoteMySQL(pk)+" > ?")
-		params = append(params, lastPK)
+		pkArgs, err := primaryKeyArgs(lastPK, pkColumns)
+		if err != nil {
+			return nil, err
+		}
+		wheres = append(wheres, primaryKeyCondition(pkColumns, ">"))
+		params = append(params, pkArgs...)
 	}
 	if cutoffColumn != "" {
 		if fromTime != nil {
@@ -557,15 +617,22 @@ func readRepairRowsRange(db *gorm.DB, table, pk string, columns []string, lastPK
 			params = append(params, *toTime)
 		}
 	}
+	wheres, params = filter.apply(wheres, params)
 	if len(wheres) > 0 {
 		query += " WHERE " + strings.Join(wheres, " AND ")
 	}
-	query += " ORDER BY " + quoteMySQL(pk) + fmt.Sprintf(" LIMIT %d", repairBatchSize)
+	query += " ORDER BY " + primaryKeyOrder(pkColumns) + fmt.Sprintf(" LIMIT %d", repairBatchSize)
 	return scanRows(db, query, params...)
 }
 
-func readSingleSourceRow(db *gorm.DB, table, pk string, columns []string, pkValue string) (map[string]interface{}, error) {
-	rows, err := scanRows(db, "SELECT "+strings.Join(quotedColumns(columns), ",")+" FROM "+quoteMySQL(table)+" WHERE "+quoteMySQL(pk)+" = ? LIMIT 1", pkValue)
+func readSingleSourceRow(db *gorm.DB, table, pk string, filter shardFilter, columns []string, pkValue string) (map[string]interface{}, error) {
+	pkColumns := primaryKeyColumns(pk)
+	args, err := primaryKeyArgs(pkValue, pkColumns)
+	if err != nil {
+		return nil, err
+	}
+	wheres, args := filter.apply([]string{primaryKeyCondition(pkColumns, "=")}, args)
+	rows, err := scanRows(db, "SELECT "+strings.Join(quotedColumns(columns), ",")+" FROM "+quoteMySQLTable(table)+" WHERE "+strings.Join(wheres, " AND ")+" LIMIT 1", args...)
 	if err != nil || len(rows) == 0 {
 		return nil, err
 	}
@@ -573,34 +640,36 @@ func readSingleSourceRow(db *gorm.DB, table, pk string, columns []string, pkValu
 }
 
 func readSourceRowsByPKs(db *gorm.DB, table, pk string, columns []string, pkValues []string) (map[string]map[string]interface{}, error) {
-	return readRowsByPKs(db, table, pk, columns, pkValues)
+	return readRowsByPKs(db, table, pk, shardFilter{}, columns, pkValues)
 }
 
-func readRowsByPKs(db *gorm.DB, table, pk string, columns []string, pkValues []string) (map[string]map[string]interface{}, error) {
-	return readRowsByPKsWithCutoff(db, table, pk, columns, pkValues, "", nil)
+func readRowsByPKs(db *gorm.DB, table, pk string, filter shardFilter, columns []string, pkValues []string) (map[string]map[string]interface{}, error) {
+	return readRowsByPKsWithCutoff(db, table, pk, filter, columns, pkValues, "", nil)
 }
 
-func readRowsByPKsWithCutoff(db *gorm.DB, table, pk string, columns []string, pkValues []string, cutoffColumn string, cutoffTime *time.Time) (map[string]map[string]interface{}, error) {
+func readRowsByPKsWithCutoff(db *gorm.DB, table, pk string, filter shardFilter, columns []string, pkValues []string, cutoffColumn string, cutoffTime *time.Time) (map[string]map[string]interface{}, error) {
 	if len(pkValues) == 0 {
 		return map[string]map[string]interface{}{}, nil
 	}
-	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(pkValues)), ",")
-	args := make([]interface{}, len(pkValues))
-	for i := range pkValues {
-		args[i] = pkValues[i]
+	pkColumns := primaryKeyColumns(pk)
+	condition, args, err := primaryKeyInCondition(pkColumns, pkValues)
+	if err != nil {
+		return nil, err
 	}
-	query := "SELECT " + strings.Join(quotedColumns(columns), ",") + " FROM " + quoteMySQL(table) + " WHERE " + quoteMySQL(pk) + " IN (" + placeholders + ")"
+	wheres := []string{condition}
 	if cutoffTime != nil && cutoffColumn != "" {
-		query += " AND " + quoteMySQL(cutoffColumn) + " <= ?"
+		wheres = append(wheres, quoteMySQL(cutoffColumn)+" <= ?")
 		args = append(args, *cutoffTime)
 	}
+	wheres, args = filter.apply(wheres, args)
+	query := "SELECT " + strings.Join(quotedColumns(columns), ",") + " FROM " + quoteMySQLTable(table) + " WHERE " + strings.Join(wheres, " AND ")
 	rows, err := scanRows(db, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	result := map[string]map[string]interface{}{}
 	for _, row := range rows {
-		result[valueString(row[pk])] = row
+		result[rowPrimaryKey(row, pkColumns)] = row
 	}
 	return result, nil
 }
@@ -608,8 +677,9 @@ func readRowsByPKsWithCutoff(db *gorm.DB, table, pk string, columns []string, pk
 func repairRowPKs(rows []map[string]interface{}, pk string) []string {
 	pks := make([]string, 0, len(rows))
 	seen := map[string]bool{}
+	pkColumns := primaryKeyColumns(pk)
 	for _, row := range rows {
-		value := valueString(row[pk])
+		value := rowPrimaryKey(row, pkColumns)
 		if value == "" || seen[value] {
 			continue
 		}
@@ -637,8 +707,12 @@ func repairDiffPKs(diffs []models.SyncRepairDiff) []string {
 }
 
 func sourcePKExists(db *gorm.DB, table, pk, pkValue, cutoffColumn string, cutoffTime *time.Time) (bool, error) {
-	query := "SELECT " + quoteMySQL(pk) + " FROM " + quoteMySQL(table) + " WHERE " + quoteMySQL(pk) + " = ?"
-	params := []interface{}{pkValue}
+	pkColumns := primaryKeyColumns(pk)
+	params, err := primaryKeyArgs(pkValue, pkColumns)
+	if err != nil {
+		return false, err
+	}
+	query := "SELECT " + primaryKeyOrder(pkColumns) + " FROM " + quoteMySQLTable(table) + " WHERE " + primaryKeyCondition(pkColumns, "=")
 	if cutoffTime != nil && cutoffColumn != "" {
 		query += " AND " + quoteMySQL(cutoffColumn) + " <= ?"
 		params = append(params, *cutoffTime)
@@ -713,8 +787,12 @@ func compareRepairFields(sourceRow, targetRow map[string]interface{}, pairs []sy
 	for _, pair := range pairs {
 		sourceValue := valueFromRow(sourceRow, pair.source)
 		targetValue := valueFromRow(targetRow, pair.target)
+		sourceField := pair.source
+		if strings.HasPrefix(sourceField, transformSourcePrefix) {
+			sourceField = "(计算列)"
+		}
 		fields = append(fields, RepairFieldDiff{
-			SourceField: pair.source,
+			SourceField: sourceField,
 			TargetField: pair.target,
 			SourceValue: displayRepairValue(sourceValue),
 			TargetValue: displayRepairValue(targetValue),
@@ -821,10 +899,13 @@ func normalizeTimeComparable(value time.Time) string {
 	return value.Format("2006-01-02 15:04:05.999999")
 }
 
+// sourcePairColumns 返回需要从源表读取的字段，计算列由转换表达式生成，不从源表读取
 func sourcePairColumns(pairs []syncColumnPair) []string {
-	columns := make([]string, len(pairs))
+	columns := make([]string, 0, len(pairs))
 	for i := range pairs {
-		columns[i] = pairs[i].source
+		if !strings.HasPrefix(pairs[i].source, transformSourcePrefix) {
+			columns = append(columns, pairs[i].source)
+		}
 	}
 	return columns
 }
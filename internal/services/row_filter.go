@@ -0,0 +1,249 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/database"
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+// 行过滤是表映射的结构化条件，多条之间为 AND。全量和轮询增量读取、数据比对时翻译为 SQL，
+// CDC 时在内存中按行镜像求值，保证各阶段同步的是同一批行。与 SQL 一致，NULL 只满足 is_null。
+
+var rowFilterOperators = map[string]string{
+	"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<=",
+	"in": "IN", "not_in": "NOT IN", "is_null": "IS NULL", "not_null": "IS NOT NULL",
+}
+
+// validateRowFilter 规范化行过滤条件
+func validateRowFilter(filter models.RowFilter) (models.RowFilter, error) {
+	if len(filter) == 0 {
+		return nil, nil
+	}
+	normalized := make(models.RowFilter, 0, len(filter))
+	for _, condition := range filter {
+		condition.Column, condition.Op = strings.TrimSpace(condition.Column), strings.ToLower(strings.TrimSpace(condition.Op))
+		if !taskIdentifierPattern.MatchString(condition.Column) {
+			return nil, fmt.Errorf("行过滤字段 %s 不合法", condition.Column)
+		}
+		if _, ok := rowFilterOperators[condition.Op]; !ok {
+			return nil, fmt.Errorf("行过滤字段 %s 不支持的条件: %s", condition.Column, condition.Op)
+		}
+		switch condition.Op {
+		case "is_null", "not_null":
+			condition.Value, condition.Values = "", nil
+		case "in", "not_in":
+			if len(condition.Values) == 0 {
+				return nil, fmt.Errorf("行过滤字段 %s 至少需要一个取值", condition.Column)
+			}
+			condition.Value = ""
+		default:
+			condition.Values = nil
+		}
+		normalized = append(normalized, condition)
+	}
+	return normalized, nil
+}
+
+// rowFilterSQL 把行过滤翻译为 WHERE 条件和参数
+func rowFilterSQL(quote func(string) string, filter models.RowFilter) ([]string, []interface{}) {
+	conditions := make([]string, 0, len(filter))
+	var args []interface{}
+	for _, condition := range filter {
+		column, operator := quote(condition.Column), rowFilterOperators[condition.Op]
+		switch condition.Op {
+		case "is_null", "not_null":
+			conditions = append(conditions, column+" "+operator)
+		case "in", "not_in":
+			conditions = append(conditions, column+" "+operator+" ("+strings.TrimSuffix(strings.Repeat("?,", len(condition.Values)), ",")+")")
+			for _, value := range condition.Values {
+				args = append(args, value)
+			}
+		default:
+			conditions = append(conditions, column+" "+operator+" ?")
+			args = append(args, condition.Value)
+		}
+	}
+	return conditions, args
+}
+
+// rowFilterMatches 按行镜像求值行过滤；行镜像缺少过滤字段时视为不满足
+func rowFilterMatches(filter models.RowFilter, columns []string, row []interface{}) bool {
+	for _, condition := range filter {
+		index := -1
+		for i, column := range columns {
+			if column == condition.Column {
+				index = i
+				break
+			}
+		}
+		if index < 0 || index >= len(row) {
+			return false
+		}
+		if !rowFilterConditionMatches(condition, normalizeMySQLScannedValue(row[index])) {
+			return false
+		}
+	}
+	return true
+}
+
+func rowFilterConditionMatches(condition models.RowFilterCondition, value interface{}) bool {
+	switch condition.Op {
+	case "is_null":
+		return value == nil
+	case "not_null":
+		return value != nil
+	}
+	if value == nil {
+		return false
+	}
+	switch condition.Op {
+	case "in", "not_in":
+		found := false
+		for _, literal := range condition.Values {
+			if compareFilterValue(value, condition, literal) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (condition.Op == "in")
+	}
+	cmp := compareFilterValue(value, condition, condition.Value)
+	switch condition.Op {
+	case "eq":
+		return cmp == 0
+	case "ne":
+		return cmp != 0
+	case "gt":
+		return cmp > 0
+	case "ge":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	case "le":
+		return cmp <= 0
+	}
+	return false
+}
+
+// compareFilterValue 比较行值和条件字面量，与源库对同一条件的求值保持一致：数值字段按数值比较
+// （DECIMAL 在行镜像中为字符串），时间类型按时间比较；字符串字段按字符串比较，排序规则大小写不敏感时忽略大小写，
+// 不把形似数字的字符串转为数值。未解析到字段类别时，两侧都能解析为数字才按数值比较
+func compareFilterValue(value interface{}, condition models.RowFilterCondition, literal string) int {
+	literal = strings.TrimSpace(literal)
+	if condition.ColumnKind == "string" {
+		text := valueString(value)
+		if condition.FoldCase {
+			return strings.Compare(strings.ToLower(text), strings.ToLower(literal))
+		}
+		return strings.Compare(text, literal)
+	}
+	switch v := value.(type) {
+	case bool:
+		if v {
+			value = int64(1)
+		} else {
+			value = int64(0)
+		}
+	case time.Time:
+		for _, layout := range []string{"2006-01-02 15:04:05.999999", "2006-01-02T15:04:05Z07:00", "2006-01-02"} {
+			if parsed, err := time.ParseInLocation(layout, literal, v.Location()); err == nil {
+				return v.Compare(parsed)
+			}
+		}
+		return strings.Compare(v.Format("2006-01-02 15:04:05"), literal)
+	}
+	text := valueString(value)
+	if number, err := strconv.ParseFloat(text, 64); err == nil {
+		if target, err := strconv.ParseFloat(literal, 64); err == nil {
+			switch {
+			case number < target:
+				return -1
+			case number > target:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(text, literal)
+}
+
+// rowFilterColumnKind 把源表字段类型归为行过滤的比较类别
+func rowFilterColumnKind(columnType string) string {
+	switch baseType := mysqlBaseType(columnType); {
+	case strings.Contains(baseType, "int"), baseType == "decimal", baseType == "numeric", baseType == "float", baseType == "double",
+		baseType == "real", baseType == "double precision", baseType == "year", baseType == "bit", baseType == "money":
+		return "number"
+	case baseType == "date", strings.HasPrefix(baseType, "datetime"), strings.HasPrefix(baseType, "timestamp"):
+		return "time"
+	case baseType == "boolean", baseType == "bool":
+		return ""
+	}
+	return "string"
+}
+
+// resolveRowFilterTypes 按源表结构填充行过滤字段的比较类别；MySQL 的 _ci 排序规则按大小写不敏感比较
+func resolveRowFilterTypes(connectionName string, mapping *models.SyncTaskTable) error {
+	if len(mapping.RowFilter) == 0 {
+		return nil
+	}
+	db, err := database.GetManager().GetConnection(connectionName)
+	if err != nil {
+		return err
+	}
+	table := sourceTableName(mapping)
+	type filterColumn struct {
+		Field     string `gorm:"column:Field"`
+		Type      string `gorm:"column:Type"`
+		Collation string `gorm:"column:Collation"`
+	}
+	var columns []filterColumn
+	if dialectOf(db).name() == "mysql" {
+		if !validTableReference(table) {
+			return fmt.Errorf("非法表名")
+		}
+		if err := db.Raw("SHOW FULL COLUMNS FROM " + quoteMySQLTable(table)).Scan(&columns).Error; err != nil {
+			return err
+		}
+	} else {
+		described, err := dialectOf(db).describeTable(db, table)
+		if err != nil {
+			return err
+		}
+		for _, column := range described {
+			columns = append(columns, filterColumn{Field: column.Field, Type: column.Type})
+		}
+	}
+	for i := range mapping.RowFilter {
+		condition := &mapping.RowFilter[i]
+		for _, column := range columns {
+			if column.Field == condition.Column {
+				condition.ColumnKind = rowFilterColumnKind(column.Type)
+				condition.FoldCase = strings.HasSuffix(strings.ToLower(column.Collation), "_ci")
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// cdcRowInFilter 表示行镜像在表映射的过滤范围内，未配置过滤时始终为真
+func cdcRowInFilter(mapping *models.SyncTaskTable, columns []string, row []interface{}) bool {
+	return len(mapping.RowFilter) == 0 || rowFilterMatches(mapping.RowFilter, columns, row)
+}
+
+// precheckRowFilter 检查行过滤字段是否存在于源表
+func precheckRowFilter(task *models.SyncTask, mapping *models.SyncTaskTable, sourceColumns []mysqlColumn) (problem, warning string) {
+	for _, condition := range mapping.RowFilter {
+		if !hasColumn(sourceColumns, condition.Column) {
+			return "行过滤字段不存在: " + condition.Column, ""
+		}
+	}
+	if mapping.CustomWhere != "" && task.SyncType != "full" && task.SyncType != "incremental" {
+		return "", "自定义 WHERE 条件只作用于全量读取，CDC 阶段不会过滤，需要持续过滤时请改用行过滤"
+	}
+	return "", ""
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestRowFilterMatches(t *testing.T) {
+	columns := []string{"id", "status", "amount", "created_at", "memo"}
+	row := []interface{}{int64(7), []byte("paid"), "12.50", time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC), nil}
+	tests := []struct {
+		name      string
+		condition models.RowFilterCondition
+		want      bool
+	}{
+		{name: "eq bytes", condition: models.RowFilterCondition{Column: "status", Op: "eq", Value: "paid"}, want: true},
+		{name: "numeric ge", condition: models.RowFilterCondition{Column: "id", Op: "ge", Value: "10"}, want: false},
+		{name: "decimal gt", condition: models.RowFilterCondition{Column: "amount", Op: "gt", Value: "9.99"}, want: true},
+		{name: "time ge date", condition: models.RowFilterCondition{Column: "created_at", Op: "ge", Value: "2024-03-01"}, want: true},
+		{name: "time lt", condition: models.RowFilterCondition{Column: "created_at", Op: "lt", Value: "2024-02-01 00:00:00"}, want: false},
+		{name: "in", condition: models.RowFilterCondition{Column: "status", Op: "in", Values: []string{"new", "paid"}}, want: true},
+		{name: "not in", condition: models.RowFilterCondition{Column: "id", Op: "not_in", Values: []string{"7"}}, want: false},
+		{name: "null ne", condition: models.RowFilterCondition{Column: "memo", Op: "ne", Value: "x"}, want: false},
+		{name: "is null", condition: models.RowFilterCondition{Column: "memo", Op: "is_null"}, want: true},
+		{name: "missing column", condition: models.RowFilterCondition{Column: "region", Op: "not_null"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := rowFilterMatches(models.RowFilter{tt.condition}, columns, row); got != tt.want {
+			t.Fatalf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRowFilterMatchesColumnType(t *testing.T) {
+	columns := []string{"code", "name", "qty"}
+	row := []interface{}{"007", []byte("Alice"), int64(7)}
+	tests := []struct {
+		name      string
+		condition models.RowFilterCondition
+		want      bool
+	}{
+		{name: "zero padded string eq", condition: models.RowFilterCondition{Column: "code", Op: "eq", Value: "7", ColumnKind: "string"}, want: false},
+		{name: "zero padded string exact", condition: models.RowFilterCondition{Column: "code", Op: "eq", Value: "007", ColumnKind: "string"}, want: true},
+		{name: "zero padded string gt", condition: models.RowFilterCondition{Column: "code", Op: "gt", Value: "10", ColumnKind: "string"}, want: false},
+		{name: "zero padded unresolved", condition: models.RowFilterCondition{Column: "code", Op: "eq", Value: "7"}, want: true},
+		{name: "ci collation eq", condition: models.RowFilterCondition{Column: "name", Op: "eq", Value: "alice", ColumnKind: "string", FoldCase: true}, want: true},
+		{name: "ci collation in", condition: models.RowFilterCondition{Column: "name", Op: "in", Values: []string{"BOB", "ALICE"}, ColumnKind: "string", FoldCase: true}, want: true},
+		{name: "ci collation lt", condition: models.RowFilterCondition{Column: "name", Op: "lt", Value: "b", ColumnKind: "string", FoldCase: true}, want: true},
+		{name: "bin collation eq", condition: models.RowFilterCondition{Column: "name", Op: "eq", Value: "alice", ColumnKind: "string"}, want: false},
+		{name: "number padded literal", condition: models.RowFilterCondition{Column: "qty", Op: "eq", Value: "007", ColumnKind: "number"}, want: true},
+	}
+	for _, tt := range tests {
+		if got := rowFilterMatches(models.RowFilter{tt.condition}, columns, row); got != tt.want {
+			t.Fatalf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRowFilterColumnKind(t *testing.T) {
+	tests := map[string]string{
+		"bigint(20) unsigned": "number", "decimal(10,2)": "number", "double precision": "number", "tinyint(1)": "number",
+		"datetime(3)": "time", "timestamp without time zone": "time", "date": "time",
+		"varchar(32)": "string", "char(4)": "string", "text": "string", "enum('a','b')": "string", "boolean": "",
+	}
+	for columnType, want := range tests {
+		if got := rowFilterColumnKind(columnType); got != want {
+			t.Fatalf("%s: got %q, want %q", columnType, got, want)
+		}
+	}
+}
+
+func TestRowFilterSQL(t *testing.T) {
+	filter := models.RowFilter{
+		{Column: "status", Op: "in", Values: []string{"new", "paid"}},
+		{Column: "deleted_at", Op: "is_null"},
+		{Column: "amount", Op: "ge", Value: "10"},
+	}
+	conditions, args := rowFilterSQL(quoteMySQL, filter)
+	wantConditions := []string{"`status` IN (?,?)", "`deleted_at` IS NULL", "`amount` >= ?"}
+	if !reflect.DeepEqual(conditions, wantConditions) || !reflect.DeepEqual(args, []interface{}{"new", "paid", "10"}) {
+		t.Fatalf("got %v %v", conditions, args)
+	}
+	if _, err := validateRowFilter(models.RowFilter{{Column: "status", Op: "in"}}); err == nil {
+		t.Fatalf("in without values should fail")
+	}
+	if _, err := validateRowFilter(models.RowFilter{{Column: "status", Op: "like", Value: "%a"}}); err == nil {
+		t.Fatalf("unknown operator should fail")
+	}
+}
+
+func TestAppendCDCRowsOperationsRowFilter(t *testing.T) {
+	columns := []string{"id", "status"}
+	filter := models.RowFilter{{Column: "status", Op: "eq", Value: "open"}}
+	tests := []struct {
+		name      string
+		writeMode string
+		eventType replication.EventType
+		rows      [][]interface{}
+		kinds     []string
+	}{
+		{name: "insert outside", eventType: replication.WRITE_ROWS_EVENTv2, rows: [][]interface{}{{int64(1), "closed"}, {int64(2), "open"}}, kinds: []string{"upsert"}},
+		{name: "update moves out", eventType: replication.UPDATE_ROWS_EVENTv2, rows: [][]interface{}{{int64(1), "open"}, {int64(1), "closed"}}, kinds: []string{"delete"}},
+		{name: "update moves in", eventType: replication.UPDATE_ROWS_EVENTv2, rows: [][]interface{}{{int64(1), "closed"}, {int64(1), "open"}}, kinds: []string{"upsert"}},
+		{name: "update stays out", eventType: replication.UPDATE_ROWS_EVENTv2, rows: [][]interface{}{{int64(1), "closed"}, {int64(1), "draft"}}, kinds: []string{"delete"}},
+		{name: "history update stays out", writeMode: writeModeHistory, eventType: replication.UPDATE_ROWS_EVENTv2, rows: [][]interface{}{{int64(1), "closed"}, {int64(1), "draft"}}},
+		{name: "history delete outside", writeMode: writeModeHistory, eventType: replication.DELETE_ROWS_EVENTv2, rows: [][]interface{}{{int64(1), "closed"}}},
+	}
+	for _, tt := range tests {
+		mapping := &models.SyncTaskTable{RowIdentity: rowIdentityPrimaryKey, WriteMode: tt.writeMode, RowFilter: filter}
+		operations := appendCDCRowsOperations(nil, tt.eventType, mapping, columns, tt.rows, nil)
+		if len(operations) != len(tt.kinds) {
+			t.Fatalf("%s: got %d operations, want %d", tt.name, len(operations), len(tt.kinds))
+		}
+		for i, op := range operations {
+			if op.kind != tt.kinds[i] {
+				t.Fatalf("%s: operation %d kind = %s, want %s", tt.name, i, op.kind, tt.kinds[i])
+			}
+		}
+	}
+}
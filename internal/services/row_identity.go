@@ -0,0 +1,100 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// 行标识方式决定快照分页、幂等写入和 CDC 删除如何定位目标行。
+// 主键和非空唯一索引可以精确定位；无键表只能仅追加或按整行匹配删除，保证较弱。
+const (
+	rowIdentityPrimaryKey  = "primary_key"
+	rowIdentityUniqueIndex = "unique_index"
+	rowIdentityAppendOnly  = "append_only"
+	rowIdentityFullRow     = "full_row"
+)
+
+func normalizeRowIdentity(value string) (string, error) {
+	switch strings.TrimSpace(value) {
+	case "", rowIdentityPrimaryKey:
+		return rowIdentityPrimaryKey, nil
+	case rowIdentityUniqueIndex:
+		return rowIdentityUniqueIndex, nil
+	case rowIdentityAppendOnly:
+		return rowIdentityAppendOnly, nil
+	case rowIdentityFullRow:
+		return rowIdentityFullRow, nil
+	default:
+		return "", fmt.Errorf("不支持的行标识方式: %s", value)
+	}
+}
+
+// keylessRowIdentity 表示该表没有可定位单行的键
+func keylessRowIdentity(mapping *models.SyncTaskTable) bool {
+	return mapping.RowIdentity == rowIdentityAppendOnly || mapping.RowIdentity == rowIdentityFullRow
+}
+
+func keylessRowIdentityWarning(mapping *models.SyncTaskTable) string {
+	if mapping.RowIdentity == rowIdentityAppendOnly {
+		return "仅追加模式：只同步 INSERT，源端 UPDATE/DELETE 不会同步到目标；全量中断续传或 CDC 位点回放可能产生重复行，且不参与数据比对"
+	}
+	return "整行匹配删除模式：UPDATE/DELETE 按旧行全部同步字段匹配目标的一行；重复行只处理一条，浮点和大字段可能匹配不准，全量续传或位点回放可能产生重复行，且不参与数据比对"
+}
+
+// sourceRowIdentity 按映射配置解析源表行标识列，返回逗号分隔的列清单；无键模式返回空串
+func sourceRowIdentity(db *gorm.DB, mapping *models.SyncTaskTable) (string, error) {
+	switch mapping.RowIdentity {
+	case rowIdentityAppendOnly, rowIdentityFullRow:
+		return "", nil
+	case rowIdentityUniqueIndex:
+		indexes, err := dialectOf(db).indexes(db, sourceTableName(mapping))
+		if err != nil {
+			return "", fmt.Errorf("读取源表索引失败: %w", err)
+		}
+		for _, index := range indexes {
+			if index.Name != mapping.IdentityIndex {
+				continue
+			}
+			if !index.Unique {
+				return "", fmt.Errorf("索引 %s 不是唯一索引，不能作为行标识", index.Name)
+			}
+			if index.Nullable {
+				return "", fmt.Errorf("唯一索引 %s 包含可为 NULL 的列，不能作为行标识", index.Name)
+			}
+			return strings.Join(index.Columns, ","), nil
+		}
+		return "", fmt.Errorf("源表不存在唯一索引 %s", mapping.IdentityIndex)
+	default:
+		pk, err := tablePrimaryKey(db, sourceTableName(mapping))
+		if err != nil {
+			return "", fmt.Errorf("读取源表主键失败: %w", err)
+		}
+		if pk == "" {
+			return "", fmt.Errorf("源表没有主键；可指定非空唯一索引作为行标识，或改用仅追加、整行匹配删除模式")
+		}
+		return pk, nil
+	}
+}
+
+// targetHasRowIdentity 确认目标表存在与行标识列集合（含来源分片列）一致的键，保证幂等写入命中同一行
+func targetHasRowIdentity(db *gorm.DB, mapping *models.SyncTaskTable) (bool, string, error) {
+	indexes, err := dialectOf(db).indexes(db, mapping.TargetTable)
+	if err != nil {
+		return false, "", err
+	}
+	keys := []string{}
+	for _, index := range indexes {
+		if !index.Unique || (mapping.RowIdentity == rowIdentityPrimaryKey && index.Name != "PRIMARY") {
+			continue
+		}
+		key := strings.Join(index.Columns, ",")
+		if samePrimaryKey(key, shardTargetIdentity(mapping)) {
+			return true, key, nil
+		}
+		keys = append(keys, "("+key+")")
+	}
+	return false, strings.Join(keys, "、"), nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestAppendCDCRowsOperations(t *testing.T) {
+	rows := [][]interface{}{{int64(1), "old"}, {int64(1), "new"}}
+	tests := []struct {
+		name      string
+		identity  string
+		writeMode string
+		eventType replication.EventType
+		kinds     []string
+	}{
+		{name: "primary key update", identity: rowIdentityPrimaryKey, eventType: replication.UPDATE_ROWS_EVENTv2, kinds: []string{"upsert"}},
+		{name: "full row update", identity: rowIdentityFullRow, eventType: replication.UPDATE_ROWS_EVENTv2, kinds: []string{"delete", "upsert"}},
+		{name: "append only update", identity: rowIdentityAppendOnly, eventType: replication.UPDATE_ROWS_EVENTv2},
+		{name: "append only delete", identity: rowIdentityAppendOnly, eventType: replication.DELETE_ROWS_EVENTv2},
+		{name: "append only insert", identity: rowIdentityAppendOnly, eventType: replication.WRITE_ROWS_EVENTv2, kinds: []string{"upsert", "upsert"}},
+		{name: "full row delete", identity: rowIdentityFullRow, eventType: replication.DELETE_ROWS_EVENTv2, kinds: []string{"delete", "delete"}},
+		{name: "history append only update", identity: rowIdentityAppendOnly, writeMode: writeModeHistory, eventType: replication.UPDATE_ROWS_EVENTv2, kinds: []string{"upsert"}},
+		{name: "history full row update", identity: rowIdentityFullRow, writeMode: writeModeHistory, eventType: replication.UPDATE_ROWS_EVENTv2, kinds: []string{"upsert"}},
+		{name: "history append only delete", identity: rowIdentityAppendOnly, writeMode: writeModeHistory, eventType: replication.DELETE_ROWS_EVENTv2, kinds: []string{"delete", "delete"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping := &models.SyncTaskTable{RowIdentity: tt.identity, WriteMode: tt.writeMode}
+			operations := appendCDCRowsOperations(nil, tt.eventType, mapping, []string{"id", "memo"}, rows, nil)
+			if len(operations) != len(tt.kinds) {
+				t.Fatalf("got %d operations, want %d", len(operations), len(tt.kinds))
+			}
+			for i, op := range operations {
+				if op.kind != tt.kinds[i] {
+					t.Fatalf("operation %d kind = %s, want %s", i, op.kind, tt.kinds[i])
+				}
+			}
+			if tt.identity == rowIdentityFullRow && tt.writeMode == "" && tt.eventType == replication.UPDATE_ROWS_EVENTv2 && operations[0].values[1] != "old" {
+				t.Fatalf("full row delete should match the before image, got %v", operations[0].values)
+			}
+		})
+	}
+}
+
+func TestCDCOperationIdentity(t *testing.T) {
+	keyed := &models.SyncTaskTable{SourcePrimaryKey: "id", RowIdentity: rowIdentityPrimaryKey}
+	keyless := &models.SyncTaskTable{RowIdentity: rowIdentityFullRow}
+	columns := []string{"id", "memo"}
+	upsert := cdcOperation{kind: "upsert", mapping: keyed, columns: columns, values: []interface{}{int64(1), "new"}}
+	exit := cdcOperation{kind: "delete", mapping: keyed, columns: columns, values: []interface{}{int64(1), []byte("old")}}
+	other := cdcOperation{kind: "delete", mapping: keyed, columns: columns, values: []interface{}{int64(2), "new"}}
+	if cdcOperationIdentity(upsert) != cdcOperationIdentity(exit) {
+		t.Fatalf("operations on the same key should share an identity")
+	}
+	if cdcOperationIdentity(upsert) == cdcOperationIdentity(other) {
+		t.Fatalf("operations on different keys should not share an identity")
+	}
+	before := cdcOperation{kind: "delete", mapping: keyless, columns: columns, values: []interface{}{int64(1), []byte("a")}}
+	after := cdcOperation{kind: "upsert", mapping: keyless, columns: columns, values: []interface{}{int64(1), "a"}}
+	changed := cdcOperation{kind: "upsert", mapping: keyless, columns: columns, values: []interface{}{int64(1), "b"}}
+	if cdcOperationIdentity(before) != cdcOperationIdentity(after) || cdcOperationIdentity(before) == cdcOperationIdentity(changed) {
+		t.Fatalf("keyless identity should compare the whole row")
+	}
+}
@@ -0,0 +1,460 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/database"
+	"github.com/redgreat/mergewong/internal/models"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"gorm.io/gorm"
+)
+
+// 行处理插件是上传的 WASM 模块，在纯 Go 运行时中沙箱执行：只提供不含文件系统、环境变量和网络的 WASI，
+// 内存页数和单次调用耗时都有上限。模块需导出 memory、alloc(size i32) i32 和 transform(ptr, len i32) i64：
+// 输入为 {"op","table","row"} 的 JSON，op 为 snapshot（全量）、upsert（轮询增量）或 CDC 的 insert、update、delete，
+// 整行匹配模式下 UPDATE 拆出的旧行镜像为 update_before；返回值高 32 位为输出地址、低 32 位为长度，长度 0 表示丢弃该行；
+// 输出为 {"rows":[...]}、{"drop":true} 或 {"error":"..."}。同一插件名每次上传生成新版本，已发布版本不可修改。
+
+const (
+	pluginMaxModuleSize   = 16 << 20
+	pluginDefaultTimeout  = 200
+	pluginMaxTimeout      = 10000
+	pluginExportAlloc     = "alloc"
+	pluginExportTransform = "transform"
+)
+
+var (
+	pluginRuntimeOnce sync.Once
+	pluginRuntime     wazero.Runtime
+	pluginRuntimeErr  error
+	// 已编译模块按插件 ID 缓存，版本发布后内容不变，无需失效
+	compiledPlugins sync.Map
+)
+
+type compiledPlugin struct {
+	name    string
+	version int
+	timeout time.Duration
+	module  wazero.CompiledModule
+}
+
+func rowPluginRuntime() (wazero.Runtime, error) {
+	pluginRuntimeOnce.Do(func() {
+		ctx := context.Background()
+		config := wazero.NewRuntimeConfig().
+			WithCloseOnContextDone(true).
+			WithMemoryLimitPages(uint32(envPositiveInt("MERGEWONG_PLUGIN_MEMORY_PAGES", 512)))
+		pluginRuntime = wazero.NewRuntimeWithConfig(ctx, config)
+		if _, err := wasi_snapshot_preview1.Instantiate(ctx, pluginRuntime); err != nil {
+			pluginRuntimeErr = fmt.Errorf("初始化插件运行时失败: %w", err)
+		}
+	})
+	return pluginRuntime, pluginRuntimeErr
+}
+
+// compilePluginModule 编译模块并检查导出项
+func compilePluginModule(module []byte) (wazero.CompiledModule, error) {
+	runtime, err := rowPluginRuntime()
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := runtime.CompileModule(context.Background(), module)
+	if err != nil {
+		return nil, fmt.Errorf("WASM 模块无效: %w", err)
+	}
+	if _, ok := compiled.ExportedMemories()["memory"]; !ok {
+		_ = compiled.Close(context.Background())
+		return nil, fmt.Errorf("WASM 模块未导出 memory")
+	}
+	functions := compiled.ExportedFunctions()
+	for name, want := range map[string]string{pluginExportAlloc: "i32->i32", pluginExportTransform: "i32,i32->i64"} {
+		definition, ok := functions[name]
+		if !ok {
+			_ = compiled.Close(context.Background())
+			return nil, fmt.Errorf("WASM 模块未导出函数 %s", name)
+		}
+		if got := pluginSignature(definition); got != want {
+			_ = compiled.Close(context.Background())
+			return nil, fmt.Errorf("WASM 函数 %s 签名应为 %s，实际为 %s", name, want, got)
+		}
+	}
+	return compiled, nil
+}
+
+func pluginSignature(definition api.FunctionDefinition) string {
+	names := func(types []api.ValueType) string {
+		parts := make([]string, len(types))
+		for i, t := range types {
+			parts[i] = api.ValueTypeName(t)
+		}
+		return strings.Join(parts, ",")
+	}
+	return names(definition.ParamTypes()) + "->" + names(definition.ResultTypes())
+}
+
+func loadCompiledPlugin(pluginID uint) (*compiledPlugin, error) {
+	if cached, ok := compiledPlugins.Load(pluginID); ok {
+		return cached.(*compiledPlugin), nil
+	}
+	systemDB, err := database.GetManager().GetConnection("system")
+	if err != nil {
+		return nil, err
+	}
+	var plugin models.SyncPlugin
+	if err := systemDB.First(&plugin, pluginID).Error; err != nil {
+		return nil, fmt.Errorf("行处理插件 %d 不存在: %w", pluginID, err)
+	}
+	compiled, err := compilePluginModule(plugin.Module)
+	if err != nil {
+		return nil, fmt.Errorf("插件 %s v%d %w", plugin.Name, plugin.Version, err)
+	}
+	timeout := plugin.TimeoutMs
+	if timeout <= 0 {
+		timeout = pluginDefaultTimeout
+	}
+	loaded := &compiledPlugin{name: plugin.Name, version: plugin.Version, timeout: time.Duration(timeout) * time.Millisecond, module: compiled}
+	if actual, loadedBefore := compiledPlugins.LoadOrStore(pluginID, loaded); loadedBefore {
+		_ = compiled.Close(context.Background())
+		return actual.(*compiledPlugin), nil
+	}
+	return loaded, nil
+}
+
+// rowPluginSession 是一批行共用的插件实例，实例内存在批次间不保留
+type rowPluginSession struct {
+	plugin    *compiledPlugin
+	instance  api.Module
+	alloc     api.Function
+	transform api.Function
+}
+
+func openRowPlugin(pluginID uint) (*rowPluginSession, error) {
+	plugin, err := loadCompiledPlugin(pluginID)
+	if err != nil {
+		return nil, err
+	}
+	runtime, err := rowPluginRuntime()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), plugin.timeout)
+	defer cancel()
+	// 名称留空允许同一模块并发实例化；反应堆模块的初始化函数为 _initialize
+	instance, err := runtime.InstantiateModule(ctx, plugin.module, wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, fmt.Errorf("插件 %s v%d 实例化失败: %w", plugin.name, plugin.version, err)
+	}
+	return &rowPluginSession{plugin: plugin, instance: instance, alloc: instance.ExportedFunction(pluginExportAlloc), transform: instance.ExportedFunction(pluginExportTransform)}, nil
+}
+
+func (p *rowPluginSession) close() {
+	if p != nil && p.instance != nil {
+		_ = p.instance.Close(context.Background())
+	}
+}
+
+type pluginOutput struct {
+	Rows  []map[string]interface{} `json:"rows"`
+	Drop  bool                     `json:"drop"`
+	Error string                   `json:"error"`
+}
+
+// transformRow 调用插件处理一行，返回零到多行；以 \x00 开头的内部列不传给插件，并原样带到每个输出行
+func (p *rowPluginSession) transformRow(op, table string, row map[string]interface{}) ([]map[string]interface{}, error) {
+	input := make(map[string]interface{}, len(row))
+	internal := map[string]interface{}{}
+	for column, value := range row {
+		if strings.HasPrefix(column, "\x00") {
+			internal[column] = value
+			continue
+		}
+		input[column] = pluginInputValue(value)
+	}
+	payload, err := json.Marshal(map[string]interface{}{"op": op, "table": table, "row": input})
+	if err != nil {
+		return nil, fmt.Errorf("插件 %s 输入编码失败: %w", p.plugin.name, err)
+	}
+	output, err := p.call(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(output) == 0 {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	decoder.UseNumber()
+	var result pluginOutput
+	if err := decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("插件 %s v%d 输出不是合法 JSON: %w", p.plugin.name, p.plugin.version, err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("插件 %s v%d 处理失败: %s", p.plugin.name, p.plugin.version, result.Error)
+	}
+	if result.Drop {
+		return nil, nil
+	}
+	rows := make([]map[string]interface{}, 0, len(result.Rows))
+	for _, out := range result.Rows {
+		converted := make(map[string]interface{}, len(out)+len(internal))
+		for column, value := range out {
+			if !taskIdentifierPattern.MatchString(column) {
+				return nil, fmt.Errorf("插件 %s v%d 输出字段名不合法: %s", p.plugin.name, p.plugin.version, column)
+			}
+			converted[column] = pluginOutputValue(value)
+		}
+		for column, value := range internal {
+			converted[column] = value
+		}
+		rows = append(rows, converted)
+	}
+	return rows, nil
+}
+
+func (p *rowPluginSession) call(payload []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.plugin.timeout)
+	defer cancel()
+	wrap := func(err error) error {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("插件 %s v%d 执行超过 %s", p.plugin.name, p.plugin.version, p.plugin.timeout)
+		}
+		return fmt.Errorf("插件 %s v%d 执行失败: %w", p.plugin.name, p.plugin.version, err)
+	}
+	results, err := p.alloc.Call(ctx, uint64(len(payload)))
+	if err != nil {
+		return nil, wrap(err)
+	}
+	ptr := uint32(results[0])
+	if !p.instance.Memory().Write(ptr, payload) {
+		return nil, fmt.Errorf("插件 %s v%d alloc 返回的地址越界", p.plugin.name, p.plugin.version)
+	}
+	results, err = p.transform.Call(ctx, uint64(ptr), uint64(len(payload)))
+	if err != nil {
+		return nil, wrap(err)
+	}
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+	if outLen == 0 {
+		return nil, nil
+	}
+	output, ok := p.instance.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("插件 %s v%d 输出地址越界", p.plugin.name, p.plugin.version)
+	}
+	return append([]byte(nil), output...), nil
+}
+
+// pluginInputValue 把行值转为 JSON 友好的形式：二进制按字符串、时间按 MySQL 文本格式
+func pluginInputValue(value interface{}) interface{} {
+	switch v := normalizeMySQLScannedValue(value).(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	default:
+		return v
+	}
+}
+
+// pluginOutputValue 整数转为 int64，其他数字保留原文避免 DECIMAL 精度丢失，对象和数组写为 JSON 文本
+func pluginOutputValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if number, err := v.Int64(); err == nil {
+			return number
+		}
+		return v.String()
+	case map[string]interface{}, []interface{}:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	default:
+		return v
+	}
+}
+
+// applyRowPluginBatch 用表映射的插件处理全量或轮询增量读出的一批行，返回的字段包含插件新增的字段
+func applyRowPluginBatch(mapping *models.SyncTaskTable, op string, columns []string, batch []map[string]interface{}) ([]string, []map[string]interface{}, error) {
+	if mapping.PluginID == nil || len(batch) == 0 {
+		return columns, batch, nil
+	}
+	session, err := openRowPlugin(*mapping.PluginID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer session.close()
+	rows := make([]map[string]interface{}, 0, len(batch))
+	for _, row := range batch {
+		out, err := session.transformRow(op, mapping.SourceTable, row)
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, out...)
+	}
+	return pluginColumns(columns, rows), rows, nil
+}
+
+// applyCDCRowPlugins 用插件处理 CDC 操作，每个映射一个实例；删除以 delete 传给插件，输出行仍按删除处理
+func applyCDCRowPlugins(operations []cdcOperation) ([]cdcOperation, error) {
+	sessions := map[uint]*rowPluginSession{}
+	defer func() {
+		for _, session := range sessions {
+			session.close()
+		}
+	}()
+	result := make([]cdcOperation, 0, len(operations))
+	for _, op := range operations {
+		if op.mapping.PluginID == nil {
+			result = append(result, op)
+			continue
+		}
+		session := sessions[*op.mapping.PluginID]
+		if session == nil {
+			opened, err := openRowPlugin(*op.mapping.PluginID)
+			if err != nil {
+				return nil, err
+			}
+			session, sessions[*op.mapping.PluginID] = opened, opened
+		}
+		kind := pluginOperation(op)
+		row := make(map[string]interface{}, len(op.columns))
+		for i, column := range op.columns {
+			row[column] = op.values[i]
+		}
+		out, err := session.transformRow(kind, op.mapping.SourceTable, row)
+		if err != nil {
+			return nil, err
+		}
+		columns := pluginColumns(op.columns, out)
+		for _, outRow := range out {
+			values := make([]interface{}, len(columns))
+			for i, column := range columns {
+				values[i] = outRow[column]
+			}
+			result = append(result, cdcOperation{kind: op.kind, mapping: op.mapping, columns: columns, values: values, position: op.position, change: op.change})
+		}
+	}
+	return result, nil
+}
+
+// pluginOperation 返回传给插件的 op；UPDATE 拆出的旧行删除与新行区分开
+func pluginOperation(op cdcOperation) string {
+	switch {
+	case op.kind == "delete" && op.change == "update":
+		return "update_before"
+	case op.kind == "delete":
+		return "delete"
+	case op.change != "":
+		return op.change
+	}
+	return op.kind
+}
+
+// pluginColumns 在原字段后按名称追加插件新增的字段
+func pluginColumns(columns []string, rows []map[string]interface{}) []string {
+	known := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		known[column] = true
+	}
+	var extra []string
+	for _, row := range rows {
+		for column := range row {
+			if !known[column] && !strings.HasPrefix(column, "\x00") {
+				known[column] = true
+				extra = append(extra, column)
+			}
+		}
+	}
+	if len(extra) == 0 {
+		return columns
+	}
+	sort.Strings(extra)
+	return append(append([]string(nil), columns...), extra...)
+}
+
+// UploadPlugin 校验并保存插件模块，同名插件的版本号递增
+func (s *SyncService) UploadPlugin(name, description string, timeoutMs int, module []byte) (*models.SyncPlugin, error) {
+	name = strings.TrimSpace(name)
+	if !taskIdentifierPattern.MatchString(name) {
+		return nil, fmt.Errorf("插件名称只能包含字母、数字和下划线")
+	}
+	if len(module) == 0 || len(module) > pluginMaxModuleSize {
+		return nil, fmt.Errorf("插件模块大小需在 1 字节到 %d MB 之间", pluginMaxModuleSize>>20)
+	}
+	if timeoutMs == 0 {
+		timeoutMs = pluginDefaultTimeout
+	}
+	if timeoutMs < 1 || timeoutMs > pluginMaxTimeout {
+		return nil, fmt.Errorf("单次调用超时需在 1 到 %d 毫秒之间", pluginMaxTimeout)
+	}
+	compiled, err := compilePluginModule(module)
+	if err != nil {
+		return nil, err
+	}
+	_ = compiled.Close(context.Background())
+	sum := sha256.Sum256(module)
+	plugin := models.SyncPlugin{Name: name, Description: strings.TrimSpace(description), TimeoutMs: timeoutMs, Checksum: hex.EncodeToString(sum[:]), Size: int64(len(module)), Module: module}
+	var latest struct{ Version int }
+	if err := s.systemDB.Model(&models.SyncPlugin{}).Select("COALESCE(MAX(version), 0) AS version").Where("name = ?", name).Scan(&latest).Error; err != nil {
+		return nil, err
+	}
+	plugin.Version = latest.Version + 1
+	if err := s.systemDB.Create(&plugin).Error; err != nil {
+		return nil, err
+	}
+	plugin.Module = nil
+	return &plugin, nil
+}
+
+// ListPlugins 返回全部插件版本，不含模块内容
+func (s *SyncService) ListPlugins() ([]models.SyncPlugin, error) {
+	var plugins []models.SyncPlugin
+	err := s.systemDB.Omit("module").Order("name ASC, version DESC").Find(&plugins).Error
+	return plugins, err
+}
+
+// DeletePlugin 删除未被任何表映射引用的插件版本
+func (s *SyncService) DeletePlugin(id uint) error {
+	var refs int64
+	if err := s.systemDB.Model(&models.SyncTaskTable{}).Where("plugin_id = ?", id).Count(&refs).Error; err != nil {
+		return err
+	}
+	if refs > 0 {
+		return fmt.Errorf("插件仍被 %d 个表映射引用，不能删除", refs)
+	}
+	result := s.systemDB.Delete(&models.SyncPlugin{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("插件不存在")
+	}
+	if cached, ok := compiledPlugins.LoadAndDelete(id); ok {
+		_ = cached.(*compiledPlugin).module.Close(context.Background())
+	}
+	return nil
+}
+
+// precheckRowPlugin 检查插件是否存在；插件输出的字段无法预先推断，要求目标表预先建好
+func precheckRowPlugin(systemDB *gorm.DB, mapping *models.SyncTaskTable, targetExists bool) (problem, warning string) {
+	if mapping.PluginID == nil {
+		return "", ""
+	}
+	var plugin models.SyncPlugin
+	if err := systemDB.Omit("module").First(&plugin, *mapping.PluginID).Error; err != nil {
+		return fmt.Sprintf("行处理插件 %d 不存在", *mapping.PluginID), ""
+	}
+	if !targetExists {
+		return fmt.Sprintf("使用行处理插件 %s v%d 时目标表需预先创建", plugin.Name, plugin.Version), ""
+	}
+	return "", fmt.Sprintf("使用行处理插件 %s v%d，数据比对将跳过该表", plugin.Name, plugin.Version)
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+// testPluginModule 手工拼装插件模块：alloc 固定返回 1024，transform 执行 body；output 非空时作为数据段放在 2048
+func testPluginModule(body []byte, output string) []byte {
+	section := func(id byte, content ...byte) []byte {
+		return append(append([]byte{id}, uleb128(uint64(len(content)))...), content...)
+	}
+	name := func(value string) []byte { return append([]byte{byte(len(value))}, value...) }
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	module = append(module, section(1, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e)...)
+	module = append(module, section(3, 0x02, 0x00, 0x01)...)
+	module = append(module, section(5, 0x01, 0x00, 0x01)...)
+	exports := []byte{0x03}
+	exports = append(append(exports, name("memory")...), 0x02, 0x00)
+	exports = append(append(exports, name("alloc")...), 0x00, 0x00)
+	exports = append(append(exports, name("transform")...), 0x00, 0x01)
+	module = append(module, section(7, exports...)...)
+	transform := append(append([]byte{0x00}, body...), 0x0b)
+	code := []byte{0x02, 0x05, 0x00, 0x41, 0x80, 0x08, 0x0b}
+	code = append(append(code, uleb128(uint64(len(transform)))...), transform...)
+	module = append(module, section(10, code...)...)
+	if output != "" {
+		data := append([]byte{0x01, 0x00, 0x41, 0x80, 0x10, 0x0b}, uleb128(uint64(len(output)))...)
+		module = append(module, section(11, append(data, output...)...)...)
+	}
+	return module
+}
+
+func uleb128(value uint64) []byte {
+	var out []byte
+	for {
+		b := byte(value & 0x7f)
+		value >>= 7
+		if value == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func sleb128(value int64) []byte {
+	var out []byte
+	for {
+		b := byte(value & 0x7f)
+		value >>= 7
+		if (value == 0 && b&0x40 == 0) || (value == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+// registerTestPlugin 编译模块并放入缓存，避免依赖系统库
+func registerTestPlugin(t *testing.T, id uint, module []byte, timeout time.Duration) *models.SyncTaskTable {
+	t.Helper()
+	compiled, err := compilePluginModule(module)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	compiledPlugins.Store(id, &compiledPlugin{name: "test", version: 1, timeout: timeout, module: compiled})
+	t.Cleanup(func() {
+		compiledPlugins.Delete(id)
+		_ = compiled.Close(context.Background())
+	})
+	return &models.SyncTaskTable{SourceTable: "orders", PluginID: &id}
+}
+
+func TestRowPluginTransform(t *testing.T) {
+	output := `{"rows":[{"id":1,"name":"a"},{"id":2,"name":"b","amount":12.50,"meta":{"k":"v"}}]}`
+	body := append([]byte{0x42}, sleb128(int64(2048)<<32|int64(len(output)))...)
+	mapping := registerTestPlugin(t, 990001, testPluginModule(body, output), time.Second)
+	batch := []map[string]interface{}{{"id": int64(1), "name": []byte("x"), "created_at": time.Now()}}
+	columns, rows, err := applyRowPluginBatch(mapping, "snapshot", []string{"id", "name"}, batch)
+	if err != nil {
+		t.Fatalf("applyRowPluginBatch: %v", err)
+	}
+	if !reflect.DeepEqual(columns, []string{"id", "name", "amount", "meta"}) || len(rows) != 2 {
+		t.Fatalf("columns = %v, rows = %v", columns, rows)
+	}
+	if rows[0]["id"] != int64(1) || rows[1]["amount"] != "12.50" || rows[1]["meta"] != `{"k":"v"}` {
+		t.Fatalf("rows = %v", rows)
+	}
+
+	operations, err := applyCDCRowPlugins([]cdcOperation{{kind: "delete", mapping: mapping, columns: []string{"id", "name"}, values: []interface{}{int64(1), "x"}, change: "delete"}})
+	if err != nil || len(operations) != 2 || operations[1].kind != "delete" || len(operations[1].columns) != 4 {
+		t.Fatalf("operations = %+v, %v", operations, err)
+	}
+}
+
+func TestRowPluginDropAndTimeout(t *testing.T) {
+	drop := registerTestPlugin(t, 990002, testPluginModule([]byte{0x42, 0x00}, ""), time.Second)
+	_, rows, err := applyRowPluginBatch(drop, "upsert", []string{"id"}, []map[string]interface{}{{"id": int64(1)}})
+	if err != nil || len(rows) != 0 {
+		t.Fatalf("drop: rows = %v, err = %v", rows, err)
+	}
+	loop := registerTestPlugin(t, 990003, testPluginModule([]byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x42, 0x00}, ""), 20*time.Millisecond)
+	_, _, err = applyRowPluginBatch(loop, "upsert", []string{"id"}, []map[string]interface{}{{"id": int64(1)}})
+	if err == nil || !strings.Contains(err.Error(), "执行超过") {
+		t.Fatalf("timeout: err = %v", err)
+	}
+	if _, err := compilePluginModule([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}); err == nil {
+		t.Fatalf("module without exports should be rejected")
+	}
+}
+
+func TestPluginOperation(t *testing.T) {
+	tests := []struct {
+		op   cdcOperation
+		want string
+	}{
+		{op: cdcOperation{kind: "upsert", change: "insert"}, want: "insert"},
+		{op: cdcOperation{kind: "upsert", change: "update"}, want: "update"},
+		{op: cdcOperation{kind: "delete", change: "update"}, want: "update_before"},
+		{op: cdcOperation{kind: "delete", change: "delete"}, want: "delete"},
+		{op: cdcOperation{kind: "upsert", change: "snapshot"}, want: "snapshot"},
+		{op: cdcOperation{kind: "upsert"}, want: "upsert"},
+	}
+	for _, tt := range tests {
+		if got := pluginOperation(tt.op); got != tt.want {
+			t.Fatalf("%s/%s: got %q, want %q", tt.op.kind, tt.op.change, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/database"
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// SchemaDriftService 定期比对源表、目标表结构与预检查通过时的基线
+type SchemaDriftService struct {
+	systemDB *gorm.DB
+}
+
+func NewSchemaDriftService() *SchemaDriftService {
+	db, _ := database.GetManager().GetConnection("system")
+	return &SchemaDriftService{systemDB: db}
+}
+
+// CheckSchemaDrift 巡检所有已启用任务的表映射，发现结构漂移时记录并预警
+func (s *SchemaDriftService) CheckSchemaDrift(ctx context.Context) error {
+	var tasks []models.SyncTask
+	if err := s.systemDB.Preload("AlertChannel").Preload("TaskTables", "sync_state NOT IN ?", []string{"pending", "failed"}).
+		Where("status = ? AND validation_status = ?", 1, "passed").Find(&tasks).Error; err != nil {
+		return err
+	}
+	for i := range tasks {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		task := &tasks[i]
+		drifts, failures, err := s.checkTask(task)
+		if err != nil {
+			log.Printf("任务 %d 表结构巡检失败: %v", task.ID, err)
+			failures = append(failures, err.Error())
+		}
+		if len(drifts) == 0 && len(failures) == 0 {
+			_ = NewAlertService().ResolveTaskAlertSilent(task.ID, "schema_drift")
+			continue
+		}
+		lines := drifts
+		if len(failures) > 0 {
+			// 表被删除或改名时读取结构会失败，同样属于需要人工处理的漂移
+			lines = append(append([]string{}, drifts...), "以下表结构无法读取（可能已删除或改名）：")
+			lines = append(lines, failures...)
+		}
+		content := fmt.Sprintf("数据同步任务表结构漂移\n任务：%s\n%s\n处理后请重新执行预检查以确认新结构", task.Name, strings.Join(lines, "\n"))
+		_ = NewAlertService().SendTaskAlert(ctx, task, "schema_drift", content)
+	}
+	return nil
+}
+
+// checkTask 逐表巡检，单表失败不影响其余表，失败项单独返回
+func (s *SchemaDriftService) checkTask(task *models.SyncTask) ([]string, []string, error) {
+	sourceDB, err := database.GetManager().GetConnection(task.SourceDB)
+	if err != nil {
+		return nil, nil, err
+	}
+	targetDB, err := database.GetManager().GetConnection(task.TargetDB)
+	if err != nil {
+		return nil, nil, err
+	}
+	drifts, failures := []string{}, []string{}
+	for i := range task.TaskTables {
+		mapping := &task.TaskTables[i]
+		changes, err := s.checkTable(task, mapping, sourceDB, targetDB)
+		if err != nil {
+			log.Printf("任务 %d 表 %s 结构巡检失败: %v", task.ID, mapping.SourceTable, err)
+			failures = append(failures, mapping.SourceTable+" → "+mapping.TargetTable+": "+err.Error())
+			continue
+		}
+		for _, change := range changes {
+			drifts = append(drifts, mapping.SourceTable+" → "+mapping.TargetTable+": "+change)
+		}
+	}
+	return drifts, failures, nil
+}
+
+// readSchemaColumns 读取表映射两端的当前结构
+func readSchemaColumns(mapping *models.SyncTaskTable, sourceDB, targetDB *gorm.DB) ([]mysqlColumn, []mysqlColumn, error) {
+	sourceColumns, err := dialectOf(sourceDB).describeTable(sourceDB, sourceTableName(mapping))
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取源表结构失败: %w", err)
+	}
+	targetColumns, err := describeTargetTable(targetDB, mapping.TargetTable)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取目标表结构失败: %w", err)
+	}
+	return sourceColumns, targetColumns, nil
+}
+
+func newSchemaState(task *models.SyncTask, mapping *models.SyncTaskTable, sourceColumns, targetColumns []mysqlColumn, now time.Time) models.SyncSchemaState {
+	sourceSchema, sourceFingerprint := schemaFingerprint(sourceColumns)
+	targetSchema, targetFingerprint := schemaFingerprint(targetColumns)
+	return models.SyncSchemaState{TaskID: task.ID, TaskTableID: mapping.ID, SourceFingerprint: sourceFingerprint, TargetFingerprint: targetFingerprint, SourceSchema: sourceSchema, TargetSchema: targetSchema, CheckedAt: &now}
+}
+
+// recordSchemaBaselines 以预检查通过时的结构作为漂移基线；目标表尚未创建的映射留到首次巡检再建立
+func recordSchemaBaselines(tx *gorm.DB, task *models.SyncTask, sourceDB, targetDB *gorm.DB) error {
+	if err := tx.Where("task_id = ?", task.ID).Delete(&models.SyncSchemaState{}).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range task.TaskTables {
+		mapping := &task.TaskTables[i]
+		if mapping.ID == 0 || !targetDB.Migrator().HasTable(mapping.TargetTable) {
+			continue
+		}
+		sourceColumns, targetColumns, err := readSchemaColumns(mapping, sourceDB, targetDB)
+		if err != nil {
+			return fmt.Errorf("表 %s 记录结构基线失败: %w", mapping.SourceTable, err)
+		}
+		state := newSchemaState(task, mapping, sourceColumns, targetColumns, now)
+		if err := tx.Create(&state).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTable 返回该表映射当前的漂移项；没有基线时（目标表由首次执行创建）只记录基线
+func (s *SchemaDriftService) checkTable(task *models.SyncTask, mapping *models.SyncTaskTable, sourceDB, targetDB *gorm.DB) ([]string, error) {
+	sourceColumns, targetColumns, err := readSchemaColumns(mapping, sourceDB, targetDB)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	var state models.SyncSchemaState
+	err = s.systemDB.Where("task_table_id = ?", mapping.ID).First(&state).Error
+	if err == gorm.ErrRecordNotFound {
+		state = newSchemaState(task, mapping, sourceColumns, targetColumns, now)
+		return nil, s.systemDB.Create(&state).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	changes := schemaStateChanges(&state, sourceColumns, targetColumns)
+	updates := map[string]interface{}{"checked_at": &now, "drift_detected": len(changes) > 0, "drift_detail": models.StringList(changes)}
+	if len(changes) == 0 {
+		updates["detected_at"] = nil
+	} else if !state.DriftDetected || !sameStrings(state.DriftDetail, changes) {
+		updates["detected_at"] = &now
+		detail := strings.Join(changes, "\n")
+		NewSyncService().RecordTaskEvent(task, "schema_drift", "schema", "failed", "表结构漂移: "+mapping.SourceTable+" → "+mapping.TargetTable, detail, 0, 0)
+	}
+	if err := s.systemDB.Model(&state).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// schemaStateChanges 对比基线与两端当前结构
+func schemaStateChanges(state *models.SyncSchemaState, sourceColumns, targetColumns []mysqlColumn) []string {
+	_, sourceFingerprint := schemaFingerprint(sourceColumns)
+	_, targetFingerprint := schemaFingerprint(targetColumns)
+	changes := []string{}
+	if state.SourceFingerprint != sourceFingerprint {
+		changes = append(changes, diffSchemaColumns("源表", state.SourceSchema, sourceColumns)...)
+	}
+	if state.TargetFingerprint != targetFingerprint {
+		changes = append(changes, diffSchemaColumns("目标表", state.TargetSchema, targetColumns)...)
+	}
+	return changes
+}
+
+type schemaColumn struct {
+	Field string `json:"field"`
+	Type  string `json:"type"`
+	Key   string `json:"key"`
+}
+
+// schemaFingerprint 序列化字段名、类型和主键标记，并返回其 SHA-256
+func schemaFingerprint(columns []mysqlColumn) (string, string) {
+	items := make([]schemaColumn, 0, len(columns))
+	for _, column := range columns {
+		key := ""
+		if strings.EqualFold(column.Key, "PRI") {
+			key = "PRI"
+		}
+		items = append(items, schemaColumn{Field: column.Field, Type: strings.ToLower(column.Type), Key: key})
+	}
+	payload, _ := json.Marshal(items)
+	sum := sha256.Sum256(payload)
+	return string(payload), hex.EncodeToString(sum[:])
+}
+
+// diffSchemaColumns 对比基线与当前结构，列出新增、删除、类型变化和主键变化
+func diffSchemaColumns(side, baseline string, current []mysqlColumn) []string {
+	var previous []schemaColumn
+	if err := json.Unmarshal([]byte(baseline), &previous); err != nil {
+		return []string{side + "结构已变化"}
+	}
+	currentSchema, _ := schemaFingerprint(current)
+	var next []schemaColumn
+	_ = json.Unmarshal([]byte(currentSchema), &next)
+
+	before := map[string]schemaColumn{}
+	beforeKeys, afterKeys := []string{}, []string{}
+	for _, column := range previous {
+		before[column.Field] = column
+		if column.Key == "PRI" {
+			beforeKeys = append(beforeKeys, column.Field)
+		}
+	}
+	changes := []string{}
+	seen := map[string]bool{}
+	for _, column := range next {
+		seen[column.Field] = true
+		if column.Key == "PRI" {
+			afterKeys = append(afterKeys, column.Field)
+		}
+		old, ok := before[column.Field]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s新增字段 %s(%s)", side, column.Field, column.Type))
+		} else if old.Type != column.Type {
+			changes = append(changes, fmt.Sprintf("%s字段 %s 类型变化 %s → %s", side, column.Field, old.Type, column.Type))
+		}
+	}
+	for _, column := range previous {
+		if !seen[column.Field] {
+			changes = append(changes, fmt.Sprintf("%s删除字段 %s", side, column.Field))
+		}
+	}
+	if !sameStrings(beforeKeys, afterKeys) {
+		changes = append(changes, fmt.Sprintf("%s主键变化 (%s) → (%s)", side, strings.Join(beforeKeys, ", "), strings.Join(afterKeys, ", ")))
+	}
+	if len(changes) == 0 {
+		changes = append(changes, side+"字段顺序变化")
+	}
+	return changes
+}
+
+func sameStrings(left, right []string) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if left[i] != right[i] {
+			return false
+		}
+	}
+	return true
+}
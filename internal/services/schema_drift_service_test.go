@@ -0,0 +1,71 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestDiffSchemaColumns(t *testing.T) {
+	baseline, _ := schemaFingerprint([]mysqlColumn{
+		{Field: "id", Type: "bigint", Key: "PRI"},
+		{Field: "name", Type: "varchar(32)"},
+		{Field: "note", Type: "text"},
+	})
+	tests := []struct {
+		name    string
+		current []mysqlColumn
+		want    []string
+	}{
+		{
+			name: "add drop and type change",
+			current: []mysqlColumn{
+				{Field: "id", Type: "bigint", Key: "PRI"},
+				{Field: "name", Type: "VARCHAR(64)"},
+				{Field: "email", Type: "varchar(128)"},
+			},
+			want: []string{"源表字段 name 类型变化 varchar(32) → varchar(64)", "源表新增字段 email(varchar(128))", "源表删除字段 note"},
+		},
+		{
+			name: "primary key change",
+			current: []mysqlColumn{
+				{Field: "id", Type: "bigint", Key: "PRI"},
+				{Field: "name", Type: "varchar(32)", Key: "PRI"},
+				{Field: "note", Type: "text"},
+			},
+			want: []string{"源表主键变化 (id) → (id, name)"},
+		},
+		{
+			name: "order only",
+			current: []mysqlColumn{
+				{Field: "name", Type: "varchar(32)"},
+				{Field: "id", Type: "bigint", Key: "pri"},
+				{Field: "note", Type: "text"},
+			},
+			want: []string{"源表字段顺序变化"},
+		},
+	}
+	for _, tt := range tests {
+		if got := diffSchemaColumns("源表", baseline, tt.current); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if got := diffSchemaColumns("目标表", "not json", nil); !reflect.DeepEqual(got, []string{"目标表结构已变化"}) {
+		t.Fatalf("invalid baseline: got %v", got)
+	}
+}
+
+func TestSchemaStateChanges(t *testing.T) {
+	source := []mysqlColumn{{Field: "id", Type: "int", Key: "PRI"}}
+	target := []mysqlColumn{{Field: "id", Type: "int", Key: "PRI"}, {Field: "extra", Type: "int"}}
+	state := newSchemaState(&models.SyncTask{}, &models.SyncTaskTable{}, source, target, time.Now())
+	if changes := schemaStateChanges(&state, source, target); len(changes) != 0 {
+		t.Fatalf("unchanged schema reported drift: %v", changes)
+	}
+	changes := schemaStateChanges(&state, source, target[:1])
+	if !reflect.DeepEqual(changes, []string{"目标表删除字段 extra"}) {
+		t.Fatalf("got %v", changes)
+	}
+}
@@ -0,0 +1,494 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/redgreat/mergewong/internal/database"
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// 分表合并：SyncTablePattern 在预检查时展开成每个分片一条 SyncTaskTable，
+// 快照、CDC 和比对都按普通表映射处理分片，只是多个分片写入同一张目标表。
+// 配置来源分片列时，目标端按 `列 = 库.表` 限定每个分片自己的行。
+
+func validateTablePatterns(patterns []models.SyncTablePattern) error {
+	seen := map[string]bool{}
+	for i := range patterns {
+		pattern := &patterns[i]
+		pattern.SourcePattern = strings.TrimSpace(pattern.SourcePattern)
+		pattern.TargetTable = strings.TrimSpace(pattern.TargetTable)
+		pattern.DiscriminatorColumn = strings.TrimSpace(pattern.DiscriminatorColumn)
+		if pattern.SourcePattern == "" || len(pattern.SourcePattern) > 100 {
+			return fmt.Errorf("分表匹配规则不能为空且不能超过 100 个字符")
+		}
+		if _, err := compileTablePattern(pattern.SourcePattern); err != nil {
+			return err
+		}
+		if !taskIdentifierPattern.MatchString(pattern.TargetTable) {
+			return fmt.Errorf("分表规则 %s 的目标表名不正确", pattern.SourcePattern)
+		}
+		if pattern.DiscriminatorColumn != "" && !taskIdentifierPattern.MatchString(pattern.DiscriminatorColumn) {
+			return fmt.Errorf("分表规则 %s 的来源分片列名不正确", pattern.SourcePattern)
+		}
+		schemas, err := normalizeIdentifierList(pattern.SourceSchemas)
+		if err != nil {
+			return fmt.Errorf("分表规则 %s 的源库不正确: %w", pattern.SourcePattern, err)
+		}
+		pattern.SourceSchemas = schemas
+		key := strings.Join(schemas, ",") + "|" + pattern.SourcePattern
+		if seen[key] {
+			return fmt.Errorf("分表规则 %s 重复", pattern.SourcePattern)
+		}
+		seen[key] = true
+		cleaned, err := normalizeFieldMapping(pattern.FieldMapping)
+		if err != nil {
+			return fmt.Errorf("分表规则 %s 字段映射不正确: %w", pattern.SourcePattern, err)
+		}
+		pattern.FieldMapping = cleaned
+		ignored, err := normalizeIdentifierList(pattern.IgnoredFields)
+		if err != nil {
+			return fmt.Errorf("分表规则 %s 忽略字段不正确: %w", pattern.SourcePattern, err)
+		}
+		pattern.IgnoredFields = ignored
+		confirmed, err := normalizeIdentifierPairList(pattern.TypeMismatchIgnores)
+		if err != nil {
+			return fmt.Errorf("分表规则 %s 类型忽略确认不正确: %w", pattern.SourcePattern, err)
+		}
+		pattern.TypeMismatchIgnores = confirmed
+		identity, err := normalizeRowIdentity(pattern.RowIdentity)
+		if err != nil {
+			return fmt.Errorf("分表规则 %s %w", pattern.SourcePattern, err)
+		}
+		pattern.RowIdentity, pattern.IdentityIndex = identity, strings.TrimSpace(pattern.IdentityIndex)
+		if identity != rowIdentityUniqueIndex {
+			pattern.IdentityIndex = ""
+		} else if pattern.IdentityIndex == "" {
+			return fmt.Errorf("分表规则 %s 使用唯一索引作为行标识时必须指定索引名", pattern.SourcePattern)
+		}
+		if err := validatePatternTableOptions(pattern); err != nil {
+			return fmt.Errorf("分表规则 %s %w", pattern.SourcePattern, err)
+		}
+	}
+	return nil
+}
+
+// validatePatternTableOptions 按单表映射的规则校验分表规则的写入方式、删除方式、行过滤和字段转换，并回写规范化后的值
+func validatePatternTableOptions(pattern *models.SyncTablePattern) error {
+	var table models.SyncTaskTable
+	applyTablePattern(&table, pattern)
+	if err := validateWriteMode(&table); err != nil {
+		return err
+	}
+	if err := validateDeleteMode(&table); err != nil {
+		return err
+	}
+	filter, err := validateRowFilter(table.RowFilter)
+	if err != nil {
+		return err
+	}
+	table.RowFilter = filter
+	if err := validateTransforms(&table); err != nil {
+		return err
+	}
+	pattern.WriteMode, pattern.VersionColumn = table.WriteMode, table.VersionColumn
+	pattern.DeleteMode, pattern.DeleteColumn = table.DeleteMode, table.DeleteColumn
+	pattern.RowFilter, pattern.Transforms = table.RowFilter, table.Transforms
+	return nil
+}
+
+// sameTablePatterns 比较两组分表规则的配置是否一致，忽略 ID 和排序字段
+func sameTablePatterns(current, next []models.SyncTablePattern) bool {
+	if len(current) != len(next) {
+		return false
+	}
+	for i := range current {
+		if tablePatternSignature(&current[i]) != tablePatternSignature(&next[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func tablePatternSignature(p *models.SyncTablePattern) string {
+	plugin := uint(0)
+	if p.PluginID != nil {
+		plugin = *p.PluginID
+	}
+	return fmt.Sprintf("%v|%s|%s|%s|%v|%v|%v|%s|%s|%s|%v|%d|%v|%s|%s|%s|%s", []string(p.SourceSchemas), p.SourcePattern, p.TargetTable, p.DiscriminatorColumn, map[string]string(p.FieldMapping), []string(p.IgnoredFields), []string(p.TypeMismatchIgnores), p.CustomWhere, p.RowIdentity, p.IdentityIndex,
+		map[string]string(p.Transforms), plugin, []models.RowFilterCondition(p.RowFilter), p.WriteMode, p.VersionColumn, p.DeleteMode, p.DeleteColumn)
+}
+
+// compileTablePattern 编译分表规则，规则需要匹配完整表名
+func compileTablePattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("分表匹配规则 %s 不是合法的正则表达式: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// patternMatches 判断源库中的表是否属于该分表规则；未配置源库时只匹配连接默认库
+func patternMatches(pattern *models.SyncTablePattern, schema, table, defaultSchema string) bool {
+	schemas := []string(pattern.SourceSchemas)
+	if len(schemas) == 0 {
+		schemas = []string{defaultSchema}
+	}
+	if !containsString(schemas, schema) {
+		return false
+	}
+	re, err := compileTablePattern(pattern.SourcePattern)
+	return err == nil && re.MatchString(table)
+}
+
+// patternShardTable 由分表规则生成某个分片的表映射；默认库的分片不带库名
+func patternShardTable(pattern *models.SyncTablePattern, schema, table, defaultSchema string) models.SyncTaskTable {
+	if schema == defaultSchema {
+		schema = ""
+	}
+	shard := models.SyncTaskTable{TaskID: pattern.TaskID, SourceSchema: schema, SourceTable: table}
+	applyTablePattern(&shard, pattern)
+	return shard
+}
+
+// applyTablePattern 把分表规则的映射配置写到分片上，分片自身的检查点、进度和行标识列不变
+func applyTablePattern(shard *models.SyncTaskTable, pattern *models.SyncTablePattern) {
+	patternID := pattern.ID
+	shard.TargetTable = pattern.TargetTable
+	shard.PatternID = &patternID
+	shard.DiscriminatorColumn = pattern.DiscriminatorColumn
+	shard.FieldMapping = pattern.FieldMapping
+	shard.IgnoredFields = pattern.IgnoredFields
+	shard.TypeMismatchIgnores = pattern.TypeMismatchIgnores
+	shard.CustomWhere = pattern.CustomWhere
+	shard.RowIdentity = pattern.RowIdentity
+	shard.IdentityIndex = pattern.IdentityIndex
+	shard.Transforms = pattern.Transforms
+	shard.PluginID = pattern.PluginID
+	shard.RowFilter = pattern.RowFilter
+	shard.WriteMode = pattern.WriteMode
+	shard.VersionColumn = pattern.VersionColumn
+	shard.DeleteMode = pattern.DeleteMode
+	shard.DeleteColumn = pattern.DeleteColumn
+}
+
+// sourceTableName 返回源表引用名，跨库分片为 库.表
+func sourceTableName(mapping *models.SyncTaskTable) string {
+	if mapping.SourceSchema == "" {
+		return mapping.SourceTable
+	}
+	return mapping.SourceSchema + "." + mapping.SourceTable
+}
+
+// cdcTableKey 是 Binlog 行事件路由到表映射使用的键
+func cdcTableKey(schema, table string) string {
+	return schema + "." + table
+}
+
+func cdcMappingKey(mapping *models.SyncTaskTable, defaultSchema string) string {
+	if mapping.SourceSchema == "" {
+		return cdcTableKey(defaultSchema, mapping.SourceTable)
+	}
+	return cdcTableKey(mapping.SourceSchema, mapping.SourceTable)
+}
+
+// quoteMySQLTable 引用表名，支持 库.表 形式
+func quoteMySQLTable(name string) string {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return quoteMySQL(schema) + "." + quoteMySQL(table)
+	}
+	return quoteMySQL(name)
+}
+
+// validTableReference 校验 表 或 库.表 形式的表引用
+func validTableReference(name string) bool {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return taskIdentifierPattern.MatchString(schema) && taskIdentifierPattern.MatchString(table)
+	}
+	return taskIdentifierPattern.MatchString(name)
+}
+
+// shardDiscriminatorSource 是写入时承载来源分片值的内部列名，不会与真实字段冲突
+const shardDiscriminatorSource = "\x00shard_source"
+
+func withShardDiscriminator(mapping *models.SyncTaskTable, batch []map[string]interface{}) []map[string]interface{} {
+	value := sourceTableName(mapping)
+	rows := make([]map[string]interface{}, len(batch))
+	for i, row := range batch {
+		copied := make(map[string]interface{}, len(row)+1)
+		for column, v := range row {
+			copied[column] = v
+		}
+		copied[shardDiscriminatorSource] = value
+		rows[i] = copied
+	}
+	return rows
+}
+
+// shardFilter 把目标表中的读取和删除限定在某个分片写入的行上；未配置来源分片列时为空。
+// 读取源表时也用来附加表映射的行过滤条件。
+type shardFilter struct {
+	column string
+	value  string
+	rows   models.RowFilter
+}
+
+func targetShardFilter(mapping *models.SyncTaskTable) shardFilter {
+	if mapping.DiscriminatorColumn == "" {
+		return shardFilter{}
+	}
+	return shardFilter{column: mapping.DiscriminatorColumn, value: sourceTableName(mapping)}
+}
+
+func (f shardFilter) apply(wheres []string, params []interface{}) ([]string, []interface{}) {
+	return f.applyQuoted(quoteMySQL, wheres, params)
+}
+
+func (f shardFilter) applyQuoted(quote func(string) string, wheres []string, params []interface{}) ([]string, []interface{}) {
+	if len(f.rows) > 0 {
+		conditions, args := rowFilterSQL(quote, f.rows)
+		wheres, params = append(wheres, conditions...), append(params, args...)
+	}
+	if f.column == "" {
+		return wheres, params
+	}
+	return append(wheres, quote(f.column)+" = ?"), append(params, f.value)
+}
+
+// sourceRowFilter 把源表读取限定在表映射的行过滤范围内
+func sourceRowFilter(mapping *models.SyncTaskTable) shardFilter {
+	return shardFilter{rows: mapping.RowFilter}
+}
+
+// sharedPatternTarget 表示目标表由多个分片共享且无法区分行的来源
+func sharedPatternTarget(mapping *models.SyncTaskTable) bool {
+	return mapping.PatternID != nil && mapping.DiscriminatorColumn == ""
+}
+
+// shardTargetIdentity 是目标表上用于幂等写入的键：行标识加来源分片列
+func shardTargetIdentity(mapping *models.SyncTaskTable) string {
+	if mapping.DiscriminatorColumn == "" || mapping.TargetPrimaryKey == "" {
+		return mapping.TargetPrimaryKey
+	}
+	return mapping.TargetPrimaryKey + "," + mapping.DiscriminatorColumn
+}
+
+func listMySQLTables(db *gorm.DB, schema string) ([]string, error) {
+	var tables []string
+	err := db.Raw("SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME", schema).Scan(&tables).Error
+	return tables, err
+}
+
+func currentMySQLSchema(db *gorm.DB) (string, error) {
+	var schema string
+	if err := db.Raw("SELECT DATABASE()").Row().Scan(&schema); err != nil {
+		return "", err
+	}
+	return schema, nil
+}
+
+// expandTablePattern 列出分表规则当前匹配的全部分片；已有分片沿用原记录以保留检查点和进度，映射配置按规则更新
+func expandTablePattern(db *gorm.DB, pattern *models.SyncTablePattern, defaultSchema string, existing []models.SyncTaskTable) ([]models.SyncTaskTable, error) {
+	re, err := compileTablePattern(pattern.SourcePattern)
+	if err != nil {
+		return nil, err
+	}
+	schemas := []string(pattern.SourceSchemas)
+	if len(schemas) == 0 {
+		schemas = []string{defaultSchema}
+	}
+	shards := []models.SyncTaskTable{}
+	for _, schema := range schemas {
+		tables, err := listMySQLTables(db, schema)
+		if err != nil {
+			return nil, fmt.Errorf("读取源库 %s 表清单失败: %w", schema, err)
+		}
+		for _, table := range tables {
+			if !re.MatchString(table) {
+				continue
+			}
+			shard := patternShardTable(pattern, schema, table, defaultSchema)
+			for _, current := range existing {
+				if current.PatternID != nil && *current.PatternID == pattern.ID && current.SourceSchema == shard.SourceSchema && current.SourceTable == shard.SourceTable {
+					shard = current
+					applyTablePattern(&shard, pattern)
+					break
+				}
+			}
+			shards = append(shards, shard)
+		}
+	}
+	return shards, nil
+}
+
+// diffShardColumns 对比分片与基准分片的同步字段，列出缺失、多余、类型和主键差异
+func diffShardColumns(reference, candidate []mysqlColumn, mapping *models.SyncTaskTable) []string {
+	index := func(columns []mysqlColumn) map[string]mysqlColumn {
+		result := map[string]mysqlColumn{}
+		for _, column := range columns {
+			if !ignoredField(mapping, column.Field) {
+				result[column.Field] = column
+			}
+		}
+		return result
+	}
+	left, right := index(reference), index(candidate)
+	diffs := []string{}
+	for _, column := range reference {
+		other, ok := right[column.Field]
+		if _, synced := left[column.Field]; !synced {
+			continue
+		}
+		if !ok {
+			diffs = append(diffs, "缺少字段 "+column.Field)
+			continue
+		}
+		if mysqlBaseType(column.Type) != mysqlBaseType(other.Type) {
+			diffs = append(diffs, fmt.Sprintf("字段 %s 类型 %s 与基准分片 %s 不一致", column.Field, other.Type, column.Type))
+		}
+		if strings.EqualFold(column.Key, "PRI") != strings.EqualFold(other.Key, "PRI") {
+			diffs = append(diffs, fmt.Sprintf("字段 %s 主键定义与基准分片不一致", column.Field))
+		}
+	}
+	for _, column := range candidate {
+		if _, ok := left[column.Field]; !ok && !ignoredField(mapping, column.Field) {
+			diffs = append(diffs, "多出字段 "+column.Field)
+		}
+	}
+	return diffs
+}
+
+// precheckPatternShards 检查分片结构与第一个分片一致，以及目标表上的来源分片列
+func precheckPatternShards(sourceDB, targetDB *gorm.DB, pattern *models.SyncTablePattern, shards []models.SyncTaskTable) []string {
+	problems := []string{}
+	reference, err := describeMySQLTable(sourceDB, sourceTableName(&shards[0]))
+	if err != nil {
+		return []string{"读取基准分片 " + sourceTableName(&shards[0]) + " 结构失败: " + err.Error()}
+	}
+	for i := 1; i < len(shards); i++ {
+		columns, err := describeMySQLTable(sourceDB, sourceTableName(&shards[i]))
+		if err != nil {
+			problems = append(problems, "读取分片 "+sourceTableName(&shards[i])+" 结构失败: "+err.Error())
+			continue
+		}
+		if diffs := diffShardColumns(reference, columns, &shards[i]); len(diffs) > 0 {
+			problems = append(problems, fmt.Sprintf("分片 %s 与基准分片 %s 结构不一致: %s", sourceTableName(&shards[i]), sourceTableName(&shards[0]), strings.Join(diffs, "；")))
+		}
+	}
+	if pattern.DiscriminatorColumn == "" {
+		if len(shards) < 2 {
+			return problems
+		}
+		identity, err := sourceRowIdentity(sourceDB, &shards[0])
+		if err != nil {
+			return append(problems, err.Error())
+		}
+		if shardLocalIdentity(reference, identity) {
+			problems = append(problems, fmt.Sprintf("行标识 (%s) 是各分片独立的自增列，未配置来源分片列时不同分片的行会互相覆盖；请配置来源分片列并加入目标表的主键或唯一索引", identity))
+		}
+		return problems
+	}
+	for _, column := range reference {
+		if !ignoredField(&shards[0], column.Field) && mappedColumn(pattern.FieldMapping, column.Field) == pattern.DiscriminatorColumn {
+			problems = append(problems, "来源分片列 "+pattern.DiscriminatorColumn+" 与同步字段重名")
+		}
+	}
+	targetColumns, err := describeTargetTable(targetDB, pattern.TargetTable)
+	if err != nil {
+		return append(problems, "读取目标表结构失败: "+err.Error())
+	}
+	column, ok := findColumn(targetColumns, pattern.DiscriminatorColumn)
+	if !ok {
+		return append(problems, "目标表缺少来源分片列 "+pattern.DiscriminatorColumn)
+	}
+	if baseType := targetBaseType(column.Type); !containsString([]string{"varchar", "char", "character varying", "character", "text", "nvarchar", "nchar"}, baseType) {
+		problems = append(problems, fmt.Sprintf("来源分片列 %s 必须是字符类型，当前为 %s", pattern.DiscriminatorColumn, column.Type))
+	}
+	return problems
+}
+
+// shardLocalIdentity 判断行标识是否全部由自增列组成：各分片独立生成，合并到同一目标表必然冲突
+func shardLocalIdentity(columns []mysqlColumn, identity string) bool {
+	if identity == "" {
+		return false
+	}
+	for _, name := range strings.Split(identity, ",") {
+		column, ok := findColumn(columns, strings.TrimSpace(name))
+		if !ok || !strings.Contains(strings.ToLower(column.Extra), "auto_increment") {
+			return false
+		}
+	}
+	return true
+}
+
+// onboardPatternShard 把 CDC 运行期间新建且匹配分表规则的分片按在线加表流程纳入任务
+func (s *SyncService) onboardPatternShard(task *models.SyncTask, pattern *models.SyncTablePattern, schema, table, defaultSchema string) error {
+	sourceDB, err := database.GetManager().GetConnection(task.SourceDB)
+	if err != nil {
+		return err
+	}
+	shard := patternShardTable(pattern, schema, table, defaultSchema)
+	var reference models.SyncTaskTable
+	if err := s.systemDB.Where("task_id = ? AND pattern_id = ? AND sync_state = ?", task.ID, pattern.ID, "active").First(&reference).Error; err != nil {
+		return fmt.Errorf("分表规则 %s 没有已生效的基准分片，请重新预检查: %w", pattern.SourcePattern, err)
+	}
+	referenceColumns, err := describeMySQLTable(sourceDB, sourceTableName(&reference))
+	if err != nil {
+		return err
+	}
+	columns, err := describeMySQLTable(sourceDB, sourceTableName(&shard))
+	if err != nil {
+		return err
+	}
+	if diffs := diffShardColumns(referenceColumns, columns, &shard); len(diffs) > 0 {
+		return fmt.Errorf("新分片 %s 与基准分片 %s 结构不一致: %s", sourceTableName(&shard), sourceTableName(&reference), strings.Join(diffs, "；"))
+	}
+	pk, err := sourceRowIdentity(sourceDB, &shard)
+	if err != nil {
+		return err
+	}
+	if pk != reference.SourcePrimaryKey && !samePrimaryKey(pk, reference.SourcePrimaryKey) {
+		return fmt.Errorf("新分片 %s 行标识 (%s) 与基准分片 (%s) 不一致", sourceTableName(&shard), pk, reference.SourcePrimaryKey)
+	}
+	file, pos, err := currentMySQLPosition(task.SourceDB)
+	if err != nil {
+		return err
+	}
+	var count int64
+	if err := s.systemDB.Model(&models.SyncTaskTable{}).Where("task_id = ?", task.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	shard.TaskID, shard.Position = task.ID, int(count)
+	shard.SourcePrimaryKey, shard.TargetPrimaryKey = pk, mappedPrimaryKey(shard.FieldMapping, pk)
+	shard.SyncState, shard.OnboardingFile, shard.OnboardingPosition = "initializing", file, pos
+	shard.ProgressMessage = "新分片等待独立初始化链路启动"
+	if err := s.systemDB.Create(&shard).Error; err != nil {
+		return err
+	}
+	s.RecordTaskEvent(task, "pattern_shard_added", "object_onboarding", "running", "发现匹配分表规则的新分片", fmt.Sprintf("%s → %s（规则 %s）", sourceTableName(&shard), shard.TargetTable, pattern.SourcePattern), 0, 0)
+	go s.runTableOnboarding(task.ID, []uint{shard.ID})
+	return nil
+}
+
+// discoverPatternShard 处理未映射表的行事件；每个表在本次链路中只判断一次
+func (m *CDCManager) discoverPatternShard(task *models.SyncTask, schema, table, defaultSchema string, known map[string]bool) {
+	key := cdcTableKey(schema, table)
+	if known[key] || len(task.TablePatterns) == 0 {
+		return
+	}
+	known[key] = true
+	for i := range task.TablePatterns {
+		pattern := &task.TablePatterns[i]
+		if !patternMatches(pattern, schema, table, defaultSchema) {
+			continue
+		}
+		if err := m.service.onboardPatternShard(task, pattern, schema, table, defaultSchema); err != nil {
+			log.Printf("[CDC] 任务 %d 新分片 %s 纳入同步失败: %v", task.ID, key, err)
+			m.service.RecordTaskEvent(task, "pattern_shard_failed", "object_onboarding", "failed", "新分片纳入同步失败", key+"\n"+err.Error(), 0, 0)
+		}
+		return
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestPatternMatches(t *testing.T) {
+	pattern := &models.SyncTablePattern{SourcePattern: `order_\d+`, SourceSchemas: models.StringList{"shop_a", "shop_b"}}
+	tests := []struct {
+		schema string
+		table  string
+		want   bool
+	}{
+		{schema: "shop_a", table: "order_01", want: true},
+		{schema: "shop_b", table: "order_2", want: true},
+		{schema: "shop_a", table: "order_01_bak", want: false},
+		{schema: "shop_c", table: "order_01", want: false},
+	}
+	for _, tt := range tests {
+		if got := patternMatches(pattern, tt.schema, tt.table, "app"); got != tt.want {
+			t.Fatalf("patternMatches(%s.%s) = %v, want %v", tt.schema, tt.table, got, tt.want)
+		}
+	}
+
+	shard := patternShardTable(&models.SyncTablePattern{ID: 3, SourcePattern: `order_\d+`, TargetTable: "orders", DiscriminatorColumn: "shard"}, "app", "order_01", "app")
+	if shard.SourceSchema != "" || sourceTableName(&shard) != "order_01" || *shard.PatternID != 3 {
+		t.Fatalf("default schema shard = %+v", shard)
+	}
+	shard = patternShardTable(&models.SyncTablePattern{ID: 3, SourcePattern: `order_\d+`, TargetTable: "orders", DiscriminatorColumn: "shard"}, "shop_a", "order_01", "app")
+	if got := quoteMySQLTable(sourceTableName(&shard)); got != "`shop_a`.`order_01`" {
+		t.Fatalf("quoted = %s", got)
+	}
+	wheres, params := targetShardFilter(&shard).apply([]string{"`id` = ?"}, []interface{}{1})
+	if len(wheres) != 2 || wheres[1] != "`shard` = ?" || params[1] != "shop_a.order_01" {
+		t.Fatalf("shard filter = %v %v", wheres, params)
+	}
+}
+
+func TestDiffShardColumns(t *testing.T) {
+	reference := []mysqlColumn{{Field: "id", Type: "bigint", Key: "PRI"}, {Field: "amount", Type: "decimal(10,2)"}, {Field: "memo", Type: "varchar(64)"}}
+	tests := []struct {
+		name      string
+		candidate []mysqlColumn
+		ignored   models.StringList
+		diffs     int
+	}{
+		{name: "same", candidate: []mysqlColumn{{Field: "id", Type: "bigint unsigned", Key: "PRI"}, {Field: "amount", Type: "decimal(12,2)"}, {Field: "memo", Type: "varchar(128)"}}},
+		{name: "missing and extra", candidate: []mysqlColumn{{Field: "id", Type: "bigint", Key: "PRI"}, {Field: "amount", Type: "decimal(10,2)"}, {Field: "note", Type: "text"}}, diffs: 2},
+		{name: "type and key", candidate: []mysqlColumn{{Field: "id", Type: "varchar(32)"}, {Field: "amount", Type: "decimal(10,2)"}, {Field: "memo", Type: "varchar(64)"}}, diffs: 2},
+		{name: "ignored column", candidate: []mysqlColumn{{Field: "id", Type: "bigint", Key: "PRI"}, {Field: "amount", Type: "decimal(10,2)"}}, ignored: models.StringList{"memo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs := diffShardColumns(reference, tt.candidate, &models.SyncTaskTable{IgnoredFields: tt.ignored})
+			if len(diffs) != tt.diffs {
+				t.Fatalf("diffs = %v, want %d", diffs, tt.diffs)
+			}
+		})
+	}
+}
+
+func TestShardLocalIdentity(t *testing.T) {
+	columns := []mysqlColumn{{Field: "id", Type: "bigint", Key: "PRI", Extra: "auto_increment"}, {Field: "tenant_id", Type: "int", Key: "PRI"}, {Field: "order_no", Type: "varchar(32)", Key: "UNI"}}
+	tests := []struct {
+		identity string
+		want     bool
+	}{
+		{identity: "id", want: true},
+		{identity: "id,tenant_id", want: false},
+		{identity: "order_no", want: false},
+		{identity: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := shardLocalIdentity(columns, tt.identity); got != tt.want {
+			t.Fatalf("shardLocalIdentity(%q) = %v, want %v", tt.identity, got, tt.want)
+		}
+	}
+}
+
+func TestTablePatternOptions(t *testing.T) {
+	plugin := uint(5)
+	pattern := models.SyncTablePattern{
+		ID: 3, SourcePattern: `order_\d+`, TargetTable: "orders", RowIdentity: rowIdentityPrimaryKey,
+		WriteMode: " newer_only ", VersionColumn: " updated_at ", DeleteMode: deleteModeSoftFlag, DeleteColumn: " is_deleted ",
+		RowFilter:  models.RowFilter{{Column: "tenant_id", Op: "eq", Value: "7"}},
+		Transforms: models.FieldMapping{"memo": "trim(memo)"}, PluginID: &plugin,
+	}
+	patterns := []models.SyncTablePattern{pattern}
+	if err := validateTablePatterns(patterns); err != nil {
+		t.Fatalf("validateTablePatterns: %v", err)
+	}
+	if patterns[0].WriteMode != writeModeNewerOnly || patterns[0].VersionColumn != "updated_at" || patterns[0].DeleteColumn != "is_deleted" {
+		t.Fatalf("normalized pattern = %+v", patterns[0])
+	}
+
+	shard := patternShardTable(&patterns[0], "app", "order_01", "app")
+	if shard.WriteMode != writeModeNewerOnly || shard.VersionColumn != "updated_at" || shard.DeleteMode != deleteModeSoftFlag || shard.DeleteColumn != "is_deleted" ||
+		len(shard.RowFilter) != 1 || shard.Transforms["memo"] != "trim(memo)" || shard.PluginID == nil || *shard.PluginID != plugin {
+		t.Fatalf("shard options not copied: %+v", shard)
+	}
+
+	existing := shard
+	existing.ID, existing.SyncState, existing.SourcePrimaryKey, existing.SnapshotProcessed = 11, "active", "id", 42
+	patterns[0].WriteMode, patterns[0].VersionColumn = writeModeUpsert, ""
+	applyTablePattern(&existing, &patterns[0])
+	if existing.ID != 11 || existing.SyncState != "active" || existing.SourcePrimaryKey != "id" || existing.SnapshotProcessed != 42 || existing.WriteMode != writeModeUpsert {
+		t.Fatalf("existing shard after reapplying pattern = %+v", existing)
+	}
+
+	invalid := []models.SyncTablePattern{{SourcePattern: `log_\d+`, TargetTable: "logs", RowIdentity: rowIdentityAppendOnly, WriteMode: writeModeInsertIgnore}}
+	if err := validateTablePatterns(invalid); err == nil {
+		t.Fatalf("keyless pattern with insert_ignore should be rejected")
+	}
+	if sameTablePatterns([]models.SyncTablePattern{pattern}, patterns) {
+		t.Fatalf("changing the write mode should change the pattern signature")
+	}
+}
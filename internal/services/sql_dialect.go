@@ -0,0 +1,665 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 按方言生成 SQL：目标端可以是 MySQL、PostgreSQL 或 SQL Server，PostgreSQL 源也借此读取表结构和索引。
+// 占位符统一写 ?，由 gorm 按方言转换为 $n、@pn 等形式。
+
+type sqlDialect interface {
+	name() string
+	quote(identifier string) string
+	quoteTable(name string) string
+	// upsertQuery 生成多行幂等写入语句，identity 为空时只插入
+	upsertQuery(table string, columns []string, rows int, identity string) string
+	// upsertNewerQuery 与 upsertQuery 相同，但只在新行 version 列不低于目标行（或目标行为 NULL）时覆盖
+	upsertNewerQuery(table string, columns []string, rows int, identity, version string) string
+	// insertQuery 生成多行插入语句，identity 非空时跳过与目标已有行冲突的行
+	insertQuery(table string, columns []string, rows int, identity string) string
+	// deleteOneQuery 生成只删除一条匹配行的语句
+	deleteOneQuery(table string, conditions []string) string
+	nullSafeEqual(column string) string
+	// maxBindParams 是单条语句允许的参数上限，批量写入按此拆分
+	maxBindParams() int
+	// limit 生成追加在 ORDER BY 之后的取前 n 行子句
+	limit(n int) string
+	describeTable(db *gorm.DB, table string) ([]mysqlColumn, error)
+	// indexes 读取唯一索引和主键，主键统一命名为 PRIMARY
+	indexes(db *gorm.DB, table string) ([]mysqlIndex, error)
+	createTableLike(sourceDB, targetDB *gorm.DB, sourceTable, targetTable string) error
+	compatibleType(sourceType, targetType string) bool
+}
+
+func dialectOf(db *gorm.DB) sqlDialect {
+	if db.Dialector != nil {
+		switch db.Dialector.Name() {
+		case "postgres":
+			return postgresTarget{}
+		case "sqlserver":
+			return sqlserverTarget{}
+		}
+	}
+	return mysqlTarget{}
+}
+
+// supportedTargetType 是可靠同步支持的目标连接类型
+func supportedTargetType(connectionType string) bool {
+	return connectionType == "mysql" || connectionType == "postgres" || connectionType == "sqlserver"
+}
+
+func describeTargetTable(db *gorm.DB, table string) ([]mysqlColumn, error) {
+	return dialectOf(db).describeTable(db, table)
+}
+
+func createTargetTableLike(sourceDB, targetDB *gorm.DB, sourceTable, targetTable string) error {
+	return dialectOf(targetDB).createTableLike(sourceDB, targetDB, sourceTable, targetTable)
+}
+
+func placeholderRows(columns, rows int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?,", columns), ",") + ")"
+	return strings.TrimSuffix(strings.Repeat(row+",", rows), ",")
+}
+
+func quoteAll(quote func(string) string, columns []string) []string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quote(column)
+	}
+	return quoted
+}
+
+type mysqlTarget struct{}
+
+func (mysqlTarget) name() string                       { return "mysql" }
+func (mysqlTarget) quote(identifier string) string     { return quoteMySQL(identifier) }
+func (mysqlTarget) quoteTable(name string) string      { return quoteMySQLTable(name) }
+func (mysqlTarget) nullSafeEqual(column string) string { return quoteMySQL(column) + " <=> ?" }
+func (mysqlTarget) maxBindParams() int                 { return 65535 }
+func (mysqlTarget) limit(n int) string                 { return fmt.Sprintf(" LIMIT %d", n) }
+
+func (mysqlTarget) upsertQuery(table string, columns []string, rows int, identity string) string {
+	placeholders := make([]string, rows)
+	for i := range placeholders {
+		placeholders[i] = placeholderRows(len(columns), 1)
+	}
+	return buildMySQLUpsertQuery(table, columns, quoteAll(quoteMySQL, columns), placeholders, identity)
+}
+
+// upsertNewerQuery 逐列按版本条件取新值或旧值；版本列最后赋值，前面各列比较的仍是目标行原有版本
+func (mysqlTarget) upsertNewerQuery(table string, columns []string, rows int, identity, version string) string {
+	v := quoteMySQL(version)
+	newer := "(" + v + " IS NULL OR VALUES(" + v + ") >= " + v + ")"
+	updates := []string{}
+	for _, column := range columns {
+		if column != version && !isPrimaryKeyColumn(identity, column) {
+			q := quoteMySQL(column)
+			updates = append(updates, q+"=IF("+newer+",VALUES("+q+"),"+q+")")
+		}
+	}
+	updates = append(updates, v+"=IF("+newer+",VALUES("+v+"),"+v+")")
+	return "INSERT INTO " + quoteMySQL(table) + " (" + strings.Join(quoteAll(quoteMySQL, columns), ",") + ") VALUES " + placeholderRows(len(columns), rows) + " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ",")
+}
+
+// insertQuery 冲突时回写键列本身跳过该行；不用 INSERT IGNORE，它会把截断等数据错误也降级为警告
+func (mysqlTarget) insertQuery(table string, columns []string, rows int, identity string) string {
+	query := "INSERT INTO " + quoteMySQL(table) + " (" + strings.Join(quoteAll(quoteMySQL, columns), ",") + ") VALUES " + placeholderRows(len(columns), rows)
+	keys := primaryKeyColumns(identity)
+	if len(keys) == 0 {
+		return query
+	}
+	q := quoteMySQL(keys[0])
+	return query + " ON DUPLICATE KEY UPDATE " + q + "=" + q
+}
+
+func (mysqlTarget) deleteOneQuery(table string, conditions []string) string {
+	return "DELETE FROM " + quoteMySQLTable(table) + " WHERE " + strings.Join(conditions, " AND ") + " LIMIT 1"
+}
+
+func (mysqlTarget) describeTable(db *gorm.DB, table string) ([]mysqlColumn, error) {
+	return describeMySQLTable(db, table)
+}
+
+func (mysqlTarget) indexes(db *gorm.DB, table string) ([]mysqlIndex, error) {
+	return mysqlIndexes(db, table)
+}
+
+func (mysqlTarget) createTableLike(sourceDB, targetDB *gorm.DB, sourceTable, targetTable string) error {
+	return createMySQLTableLike(sourceDB, targetDB, sourceTable, targetTable)
+}
+
+func (mysqlTarget) compatibleType(sourceType, targetType string) bool {
+	return mysqlBaseType(sourceType) == mysqlBaseType(targetType)
+}
+
+type postgresTarget struct{}
+
+func (postgresTarget) name() string { return "postgres" }
+
+func (postgresTarget) quote(identifier string) string { return quoteIdentifier("postgres", identifier) }
+
+func (t postgresTarget) quoteTable(name string) string {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return t.quote(schema) + "." + t.quote(table)
+	}
+	return t.quote(name)
+}
+
+func (t postgresTarget) nullSafeEqual(column string) string {
+	return t.quote(column) + " IS NOT DISTINCT FROM ?"
+}
+
+func (postgresTarget) maxBindParams() int { return 65535 }
+
+func (postgresTarget) limit(n int) string { return fmt.Sprintf(" LIMIT %d", n) }
+
+// upsertQuery 按行标识生成 ON CONFLICT，只有键列时冲突即跳过
+func (t postgresTarget) upsertQuery(table string, columns []string, rows int, identity string) string {
+	query := "INSERT INTO " + t.quoteTable(table) + " (" + strings.Join(quoteAll(t.quote, columns), ",") + ") VALUES " + placeholderRows(len(columns), rows)
+	keys := primaryKeyColumns(identity)
+	if len(keys) == 0 {
+		return query
+	}
+	updates := []string{}
+	for _, column := range columns {
+		if !containsString(keys, column) {
+			updates = append(updates, t.quote(column)+"=EXCLUDED."+t.quote(column))
+		}
+	}
+	conflict := " ON CONFLICT (" + strings.Join(quoteAll(t.quote, keys), ",") + ")"
+	if len(updates) == 0 {
+		return query + conflict + " DO NOTHING"
+	}
+	return query + conflict + " DO UPDATE SET " + strings.Join(updates, ",")
+}
+
+func (t postgresTarget) upsertNewerQuery(table string, columns []string, rows int, identity, version string) string {
+	keys := primaryKeyColumns(identity)
+	updates := []string{}
+	for _, column := range columns {
+		if !containsString(keys, column) {
+			updates = append(updates, t.quote(column)+"=EXCLUDED."+t.quote(column))
+		}
+	}
+	v := t.quote(version)
+	return "INSERT INTO " + t.quoteTable(table) + " AS target (" + strings.Join(quoteAll(t.quote, columns), ",") + ") VALUES " + placeholderRows(len(columns), rows) +
+		" ON CONFLICT (" + strings.Join(quoteAll(t.quote, keys), ",") + ") DO UPDATE SET " + strings.Join(updates, ",") + " WHERE target." + v + " IS NULL OR EXCLUDED." + v + " >= target." + v
+}
+
+func (t postgresTarget) insertQuery(table string, columns []string, rows int, identity string) string {
+	query := "INSERT INTO " + t.quoteTable(table) + " (" + strings.Join(quoteAll(t.quote, columns), ",") + ") VALUES " + placeholderRows(len(columns), rows)
+	keys := primaryKeyColumns(identity)
+	if len(keys) == 0 {
+		return query
+	}
+	return query + " ON CONFLICT (" + strings.Join(quoteAll(t.quote, keys), ",") + ") DO NOTHING"
+}
+
+// deleteOneQuery 借助 ctid 只删除一条，PostgreSQL 的 DELETE 不支持 LIMIT
+func (t postgresTarget) deleteOneQuery(table string, conditions []string) string {
+	quoted := t.quoteTable(table)
+	return "DELETE FROM " + quoted + " WHERE ctid = (SELECT ctid FROM " + quoted + " WHERE " + strings.Join(conditions, " AND ") + " LIMIT 1)"
+}
+
+func (t postgresTarget) describeTable(db *gorm.DB, table string) ([]mysqlColumn, error) {
+	if !validTableReference(table) {
+		return nil, fmt.Errorf("非法表名")
+	}
+	var columns []mysqlColumn
+	err := db.Raw(`SELECT a.attname AS "Field", format_type(a.atttypid, a.atttypmod) AS "Type",
+		CASE WHEN EXISTS (SELECT 1 FROM pg_index i WHERE i.indrelid = a.attrelid AND i.indisprimary AND a.attnum = ANY(i.indkey)) THEN 'PRI' ELSE '' END AS "Key"
+		FROM pg_attribute a WHERE a.attrelid = to_regclass(?) AND a.attnum > 0 AND NOT a.attisdropped ORDER BY a.attnum`, t.quoteTable(table)).Scan(&columns).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("表不存在")
+	}
+	return columns, nil
+}
+
+// indexes 只取非部分、非表达式的唯一索引，它们才能作为 ON CONFLICT 的冲突目标
+func (t postgresTarget) indexes(db *gorm.DB, table string) ([]mysqlIndex, error) {
+	var keys []struct {
+		IndexName  string
+		IsPrimary  bool
+		ColumnName string
+		Nullable   bool
+	}
+	err := db.Raw(`SELECT c.relname AS index_name, i.indisprimary AS is_primary, a.attname AS column_name, NOT a.attnotnull AS nullable
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		CROSS JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+		WHERE i.indrelid = to_regclass(?) AND i.indisunique AND i.indpred IS NULL AND i.indexprs IS NULL
+		ORDER BY c.relname, k.ord`, t.quoteTable(table)).Scan(&keys).Error
+	if err != nil {
+		return nil, err
+	}
+	indexes := []mysqlIndex{}
+	positions := map[string]int{}
+	for _, key := range keys {
+		name := key.IndexName
+		if key.IsPrimary {
+			name = "PRIMARY"
+		}
+		i, ok := positions[name]
+		if !ok {
+			i = len(indexes)
+			positions[name] = i
+			indexes = append(indexes, mysqlIndex{Name: name, Unique: true})
+		}
+		indexes[i].Columns = append(indexes[i].Columns, key.ColumnName)
+		if key.Nullable {
+			indexes[i].Nullable = true
+		}
+	}
+	return indexes, nil
+}
+
+// createTableLike 按源表字段翻译类型建表，并带上主键和唯一索引保证幂等写入
+func (t postgresTarget) createTableLike(sourceDB, targetDB *gorm.DB, sourceTable, targetTable string) error {
+	var columns []struct {
+		Field string `gorm:"column:Field"`
+		Type  string `gorm:"column:Type"`
+		Null  string `gorm:"column:Null"`
+	}
+	if err := sourceDB.Raw("SHOW COLUMNS FROM " + quoteMySQLTable(sourceTable)).Scan(&columns).Error; err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("无法读取源表 %s 结构", sourceTable)
+	}
+	indexes, err := mysqlIndexes(sourceDB, sourceTable)
+	if err != nil {
+		return err
+	}
+	definitions := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		definition := t.quote(column.Field) + " " + postgresColumnType(column.Type)
+		if !strings.EqualFold(column.Null, "YES") {
+			definition += " NOT NULL"
+		}
+		definitions = append(definitions, definition)
+	}
+	statements := []string{}
+	for _, index := range indexes {
+		if index.Name == "PRIMARY" {
+			definitions = append(definitions, "PRIMARY KEY ("+strings.Join(quoteAll(t.quote, index.Columns), ",")+")")
+		} else if index.Unique {
+			statements = append(statements, "CREATE UNIQUE INDEX "+t.quote(targetTable+"_"+index.Name)+" ON "+t.quoteTable(targetTable)+" ("+strings.Join(quoteAll(t.quote, index.Columns), ",")+")")
+		}
+	}
+	statements = append([]string{"CREATE TABLE " + t.quoteTable(targetTable) + " (" + strings.Join(definitions, ", ") + ")"}, statements...)
+	return targetDB.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("%w；语句：%s", err, statement)
+			}
+		}
+		return nil
+	})
+}
+
+func (postgresTarget) compatibleType(sourceType, targetType string) bool {
+	return targetBaseType(postgresColumnType(sourceType)) == targetBaseType(targetType)
+}
+
+var mysqlTypeArgsPattern = regexp.MustCompile(`\(([^)]*)\)`)
+
+// postgresColumnType 把 MySQL 列类型翻译成 PostgreSQL 类型，写法与 format_type 输出一致便于比较。
+// 无符号整数升一级避免溢出；ENUM/SET 落为 text，CDC 中它们以序号写入。
+func postgresColumnType(mysqlType string) string {
+	lower := strings.ToLower(mysqlType)
+	unsigned := strings.Contains(lower, "unsigned")
+	args := ""
+	if match := mysqlTypeArgsPattern.FindStringSubmatch(lower); match != nil {
+		args = strings.ReplaceAll(match[1], " ", "")
+	}
+	switch mysqlBaseType(lower) {
+	case "tinyint", "year":
+		return "smallint"
+	case "smallint":
+		if unsigned {
+			return "integer"
+		}
+		return "smallint"
+	case "mediumint":
+		return "integer"
+	case "int", "integer":
+		if unsigned {
+			return "bigint"
+		}
+		return "integer"
+	case "bigint":
+		if unsigned {
+			return "numeric(20,0)"
+		}
+		return "bigint"
+	case "bit":
+		return "bigint"
+	case "decimal", "numeric":
+		if args == "" {
+			return "numeric"
+		}
+		if !strings.Contains(args, ",") {
+			args += ",0"
+		}
+		return "numeric(" + args + ")"
+	case "float":
+		return "real"
+	case "double", "real":
+		return "double precision"
+	case "char":
+		if args == "" {
+			return "character(1)"
+		}
+		return "character(" + args + ")"
+	case "varchar":
+		return "character varying(" + args + ")"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "bytea"
+	case "date":
+		return "date"
+	case "datetime", "timestamp":
+		if args != "" && args != "0" {
+			return "timestamp(" + args + ") without time zone"
+		}
+		return "timestamp without time zone"
+	case "time":
+		if args != "" && args != "0" {
+			return "time(" + args + ") without time zone"
+		}
+		return "time without time zone"
+	case "json":
+		return "jsonb"
+	default:
+		return "text"
+	}
+}
+
+// targetBaseType 去掉长度和精度，只保留类型名，用于比较目标库的类型
+func targetBaseType(value string) string {
+	return strings.Join(strings.Fields(mysqlTypeArgsPattern.ReplaceAllString(strings.ToLower(value), "")), " ")
+}
+
+type sqlserverTarget struct{}
+
+func (sqlserverTarget) name() string { return "sqlserver" }
+
+func (sqlserverTarget) quote(identifier string) string {
+	return quoteIdentifier("sqlserver", identifier)
+}
+
+func (t sqlserverTarget) quoteTable(name string) string {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return t.quote(schema) + "." + t.quote(table)
+	}
+	return t.quote(name)
+}
+
+// nullSafeEqual 用 INTERSECT 比较，NULL 与 NULL 视为相等且只需一个参数
+func (t sqlserverTarget) nullSafeEqual(column string) string {
+	return "EXISTS (SELECT " + t.quote(column) + " INTERSECT SELECT ?)"
+}
+
+// maxBindParams 低于 SQL Server 单次请求 2100 个参数的上限
+func (sqlserverTarget) maxBindParams() int { return 2000 }
+
+func (sqlserverTarget) limit(n int) string {
+	return fmt.Sprintf(" OFFSET 0 ROWS FETCH NEXT %d ROWS ONLY", n)
+}
+
+// upsertQuery 以 VALUES 派生表为源执行 MERGE；派生表不受 INSERT VALUES 每次 1000 行的限制
+func (t sqlserverTarget) upsertQuery(table string, columns []string, rows int, identity string) string {
+	return t.mergeQuery(table, columns, rows, identity, "", true)
+}
+
+func (t sqlserverTarget) upsertNewerQuery(table string, columns []string, rows int, identity, version string) string {
+	v := t.quote(version)
+	return t.mergeQuery(table, columns, rows, identity, " AND (target."+v+" IS NULL OR source."+v+" >= target."+v+")", true)
+}
+
+func (t sqlserverTarget) insertQuery(table string, columns []string, rows int, identity string) string {
+	return t.mergeQuery(table, columns, rows, identity, "", false)
+}
+
+// mergeQuery 生成 MERGE 语句；matched 为匹配行的附加更新条件，update 为 false 时匹配行保持不变。identity 为空时直接插入
+func (t sqlserverTarget) mergeQuery(table string, columns []string, rows int, identity, matched string, update bool) string {
+	quoted := quoteAll(t.quote, columns)
+	source := "(VALUES " + placeholderRows(len(columns), rows) + ") AS source (" + strings.Join(quoted, ",") + ")"
+	keys := primaryKeyColumns(identity)
+	if len(keys) == 0 {
+		return "INSERT INTO " + t.quoteTable(table) + " (" + strings.Join(quoted, ",") + ") SELECT * FROM " + source
+	}
+	matches := make([]string, len(keys))
+	for i, key := range keys {
+		matches[i] = "target." + t.quote(key) + " = source." + t.quote(key)
+	}
+	updates := []string{}
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		values[i] = "source." + quoted[i]
+		if !containsString(keys, column) {
+			updates = append(updates, "target."+quoted[i]+" = source."+quoted[i])
+		}
+	}
+	query := "MERGE INTO " + t.quoteTable(table) + " WITH (HOLDLOCK) AS target USING " + source + " ON " + strings.Join(matches, " AND ")
+	if update && len(updates) > 0 {
+		query += " WHEN MATCHED" + matched + " THEN UPDATE SET " + strings.Join(updates, ", ")
+	}
+	return query + " WHEN NOT MATCHED THEN INSERT (" + strings.Join(quoted, ",") + ") VALUES (" + strings.Join(values, ",") + ");"
+}
+
+func (t sqlserverTarget) deleteOneQuery(table string, conditions []string) string {
+	return "DELETE TOP (1) FROM " + t.quoteTable(table) + " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// describeTable 拼出带长度和精度的类型名，与 sqlserverColumnType 的写法一致
+func (t sqlserverTarget) describeTable(db *gorm.DB, table string) ([]mysqlColumn, error) {
+	if !validTableReference(table) {
+		return nil, fmt.Errorf("非法表名")
+	}
+	var columns []mysqlColumn
+	err := db.Raw(`SELECT c.name AS Field,
+		TYPE_NAME(c.user_type_id) + CASE
+			WHEN TYPE_NAME(c.user_type_id) IN ('varchar', 'char', 'varbinary', 'binary') THEN '(' + CASE WHEN c.max_length = -1 THEN 'max' ELSE CAST(c.max_length AS varchar(10)) END + ')'
+			WHEN TYPE_NAME(c.user_type_id) IN ('nvarchar', 'nchar') THEN '(' + CASE WHEN c.max_length = -1 THEN 'max' ELSE CAST(c.max_length / 2 AS varchar(10)) END + ')'
+			WHEN TYPE_NAME(c.user_type_id) IN ('decimal', 'numeric') THEN '(' + CAST(c.precision AS varchar(10)) + ',' + CAST(c.scale AS varchar(10)) + ')'
+			WHEN TYPE_NAME(c.user_type_id) IN ('datetime2', 'time', 'datetimeoffset') THEN '(' + CAST(c.scale AS varchar(10)) + ')'
+			ELSE '' END AS Type,
+		CASE WHEN EXISTS (SELECT 1 FROM sys.indexes i JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id
+			WHERE i.object_id = c.object_id AND i.is_primary_key = 1 AND ic.column_id = c.column_id) THEN 'PRI' ELSE '' END AS [Key]
+		FROM sys.columns c WHERE c.object_id = OBJECT_ID(?) ORDER BY c.column_id`, t.quoteTable(table)).Scan(&columns).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("表不存在")
+	}
+	return columns, nil
+}
+
+// indexes 只取无筛选条件的唯一索引，MERGE 按这些列匹配目标行
+func (t sqlserverTarget) indexes(db *gorm.DB, table string) ([]mysqlIndex, error) {
+	var keys []struct {
+		IndexName  string
+		IsPrimary  bool
+		ColumnName string
+		Nullable   bool
+	}
+	err := db.Raw(`SELECT i.name AS index_name, i.is_primary_key AS is_primary, c.name AS column_name, c.is_nullable AS nullable
+		FROM sys.indexes i
+		JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id
+		JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+		WHERE i.object_id = OBJECT_ID(?) AND i.is_unique = 1 AND i.has_filter = 0 AND ic.is_included_column = 0
+		ORDER BY i.name, ic.key_ordinal`, t.quoteTable(table)).Scan(&keys).Error
+	if err != nil {
+		return nil, err
+	}
+	indexes := []mysqlIndex{}
+	positions := map[string]int{}
+	for _, key := range keys {
+		name := key.IndexName
+		if key.IsPrimary {
+			name = "PRIMARY"
+		}
+		i, ok := positions[name]
+		if !ok {
+			i = len(indexes)
+			positions[name] = i
+			indexes = append(indexes, mysqlIndex{Name: name, Unique: true})
+		}
+		indexes[i].Columns = append(indexes[i].Columns, key.ColumnName)
+		if key.Nullable {
+			indexes[i].Nullable = true
+		}
+	}
+	return indexes, nil
+}
+
+func (t sqlserverTarget) createTableLike(sourceDB, targetDB *gorm.DB, sourceTable, targetTable string) error {
+	var columns []struct {
+		Field string `gorm:"column:Field"`
+		Type  string `gorm:"column:Type"`
+		Null  string `gorm:"column:Null"`
+	}
+	if err := sourceDB.Raw("SHOW COLUMNS FROM " + quoteMySQLTable(sourceTable)).Scan(&columns).Error; err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("无法读取源表 %s 结构", sourceTable)
+	}
+	indexes, err := mysqlIndexes(sourceDB, sourceTable)
+	if err != nil {
+		return err
+	}
+	definitions := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		definition := t.quote(column.Field) + " " + sqlserverColumnType(column.Type)
+		if strings.EqualFold(column.Null, "YES") {
+			definition += " NULL"
+		} else {
+			definition += " NOT NULL"
+		}
+		definitions = append(definitions, definition)
+	}
+	statements := []string{}
+	for _, index := range indexes {
+		if index.Name == "PRIMARY" {
+			definitions = append(definitions, "PRIMARY KEY ("+strings.Join(quoteAll(t.quote, index.Columns), ",")+")")
+		} else if index.Unique {
+			statements = append(statements, "CREATE UNIQUE INDEX "+t.quote(targetTable+"_"+index.Name)+" ON "+t.quoteTable(targetTable)+" ("+strings.Join(quoteAll(t.quote, index.Columns), ",")+")")
+		}
+	}
+	statements = append([]string{"CREATE TABLE " + t.quoteTable(targetTable) + " (" + strings.Join(definitions, ", ") + ")"}, statements...)
+	return targetDB.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("%w；语句：%s", err, statement)
+			}
+		}
+		return nil
+	})
+}
+
+func (sqlserverTarget) compatibleType(sourceType, targetType string) bool {
+	return targetBaseType(sqlserverColumnType(sourceType)) == targetBaseType(targetType)
+}
+
+// sqlserverColumnType 把 MySQL 列类型翻译成 SQL Server 类型：字符统一用 Unicode 类型，
+// tinyint(1) 视为布尔落为 bit，JSON 落为 nvarchar(max)，超出行内长度的字符和二进制用 max。
+func sqlserverColumnType(mysqlType string) string {
+	lower := strings.ToLower(mysqlType)
+	unsigned := strings.Contains(lower, "unsigned")
+	args := ""
+	if match := mysqlTypeArgsPattern.FindStringSubmatch(lower); match != nil {
+		args = strings.ReplaceAll(match[1], " ", "")
+	}
+	sized := func(name string, limit int) string {
+		if length, err := strconv.Atoi(args); err == nil && length > 0 && length <= limit {
+			return name + "(" + args + ")"
+		}
+		return name + "(max)"
+	}
+	switch mysqlBaseType(lower) {
+	case "tinyint":
+		if args == "1" {
+			return "bit"
+		}
+		if unsigned {
+			return "tinyint"
+		}
+		return "smallint"
+	case "year":
+		return "smallint"
+	case "smallint":
+		if unsigned {
+			return "int"
+		}
+		return "smallint"
+	case "mediumint":
+		return "int"
+	case "int", "integer":
+		if unsigned {
+			return "bigint"
+		}
+		return "int"
+	case "bigint":
+		if unsigned {
+			return "decimal(20,0)"
+		}
+		return "bigint"
+	case "bit":
+		if args == "" || args == "1" {
+			return "bit"
+		}
+		return "bigint"
+	case "decimal", "numeric":
+		if args == "" {
+			return "decimal(10,0)"
+		}
+		if !strings.Contains(args, ",") {
+			args += ",0"
+		}
+		return "decimal(" + args + ")"
+	case "float":
+		return "real"
+	case "double", "real":
+		return "float"
+	case "char":
+		if args == "" {
+			return "nchar(1)"
+		}
+		return "nchar(" + args + ")"
+	case "varchar":
+		return sized("nvarchar", 4000)
+	case "enum", "set":
+		return "nvarchar(255)"
+	case "binary":
+		return sized("binary", 8000)
+	case "varbinary":
+		return sized("varbinary", 8000)
+	case "tinyblob", "blob", "mediumblob", "longblob":
+		return "varbinary(max)"
+	case "date":
+		return "date"
+	case "datetime", "timestamp":
+		if args == "" {
+			args = "0"
+		}
+		return "datetime2(" + args + ")"
+	case "time":
+		if args == "" {
+			args = "0"
+		}
+		return "time(" + args + ")"
+	default:
+		return "nvarchar(max)"
+	}
+}
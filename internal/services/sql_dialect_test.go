@@ -0,0 +1,124 @@
+package services
+
+import "testing"
+
+func TestPostgresUpsertQuery(t *testing.T) {
+	target := postgresTarget{}
+	tests := []struct {
+		name     string
+		columns  []string
+		identity string
+		want     string
+	}{
+		{name: "update non key columns", columns: []string{"id", "memo"}, identity: "id", want: `INSERT INTO "orders" ("id","memo") VALUES (?,?),(?,?) ON CONFLICT ("id") DO UPDATE SET "memo"=EXCLUDED."memo"`},
+		{name: "key only", columns: []string{"a", "b"}, identity: "a,b", want: `INSERT INTO "orders" ("a","b") VALUES (?,?),(?,?) ON CONFLICT ("a","b") DO NOTHING`},
+		{name: "keyless", columns: []string{"memo"}, want: `INSERT INTO "orders" ("memo") VALUES (?),(?)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := target.upsertQuery("orders", tt.columns, 2, tt.identity); got != tt.want {
+				t.Fatalf("upsertQuery = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresColumnType(t *testing.T) {
+	tests := map[string]string{
+		"int(11)":          "integer",
+		"int(10) unsigned": "bigint",
+		"bigint unsigned":  "numeric(20,0)",
+		"decimal(10, 2)":   "numeric(10,2)",
+		"varchar(64)":      "character varying(64)",
+		"datetime(3)":      "timestamp(3) without time zone",
+		"datetime":         "timestamp without time zone",
+		"longblob":         "bytea",
+		"enum('a','b')":    "text",
+		"json":             "jsonb",
+		"tinyint(1)":       "smallint",
+		"double":           "double precision",
+	}
+	for source, want := range tests {
+		if got := postgresColumnType(source); got != want {
+			t.Fatalf("postgresColumnType(%s) = %s, want %s", source, got, want)
+		}
+	}
+	if !(postgresTarget{}).compatibleType("varchar(32)", "character varying(255)") || (postgresTarget{}).compatibleType("bigint", "integer") {
+		t.Fatalf("compatibleType mismatch")
+	}
+}
+
+func TestSQLServerUpsertQuery(t *testing.T) {
+	target := sqlserverTarget{}
+	tests := []struct {
+		name     string
+		columns  []string
+		identity string
+		want     string
+	}{
+		{name: "merge", columns: []string{"id", "memo"}, identity: "id", want: "MERGE INTO [orders] WITH (HOLDLOCK) AS target USING (VALUES (?,?),(?,?)) AS source ([id],[memo]) ON target.[id] = source.[id] WHEN MATCHED THEN UPDATE SET target.[memo] = source.[memo] WHEN NOT MATCHED THEN INSERT ([id],[memo]) VALUES (source.[id],source.[memo]);"},
+		{name: "key only", columns: []string{"id"}, identity: "id", want: "MERGE INTO [orders] WITH (HOLDLOCK) AS target USING (VALUES (?),(?)) AS source ([id]) ON target.[id] = source.[id] WHEN NOT MATCHED THEN INSERT ([id]) VALUES (source.[id]);"},
+		{name: "keyless", columns: []string{"memo"}, want: "INSERT INTO [orders] ([memo]) SELECT * FROM (VALUES (?),(?)) AS source ([memo])"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := target.upsertQuery("orders", tt.columns, 2, tt.identity); got != tt.want {
+				t.Fatalf("upsertQuery = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLServerColumnType(t *testing.T) {
+	tests := map[string]string{
+		"tinyint(1)":          "bit",
+		"tinyint(4)":          "smallint",
+		"tinyint(3) unsigned": "tinyint",
+		"datetime(6)":         "datetime2(6)",
+		"timestamp":           "datetime2(0)",
+		"json":                "nvarchar(max)",
+		"varchar(64)":         "nvarchar(64)",
+		"varchar(8000)":       "nvarchar(max)",
+		"varbinary(16)":       "varbinary(16)",
+		"bigint unsigned":     "decimal(20,0)",
+		"double":              "float",
+	}
+	for source, want := range tests {
+		if got := sqlserverColumnType(source); got != want {
+			t.Fatalf("sqlserverColumnType(%s) = %s, want %s", source, got, want)
+		}
+	}
+}
+
+func TestLastRowPerIdentity(t *testing.T) {
+	batch := []map[string]interface{}{{"id": 1, "memo": "a"}, {"id": 2, "memo": "b"}, {"id": 1, "memo": "c"}}
+	rows := lastRowPerIdentity(batch, []string{"id", "memo"}, []string{"order_id", "memo"}, "order_id")
+	if len(rows) != 2 || rows[0]["id"] != 2 || rows[1]["memo"] != "c" {
+		t.Fatalf("rows = %v", rows)
+	}
+	if rows := lastRowPerIdentity(batch, []string{"id", "memo"}, []string{"order_id", "memo"}, ""); len(rows) != 3 {
+		t.Fatalf("keyless rows = %v", rows)
+	}
+}
+
+func TestWriteModeQueries(t *testing.T) {
+	columns := []string{"id", "memo", "version"}
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "mysql newer", got: mysqlTarget{}.upsertNewerQuery("orders", columns, 1, "id", "version"), want: "INSERT INTO `orders` (`id`,`memo`,`version`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `memo`=IF((`version` IS NULL OR VALUES(`version`) >= `version`),VALUES(`memo`),`memo`),`version`=IF((`version` IS NULL OR VALUES(`version`) >= `version`),VALUES(`version`),`version`)"},
+		{name: "mysql insert ignore", got: mysqlTarget{}.insertQuery("orders", columns, 1, "id"), want: "INSERT INTO `orders` (`id`,`memo`,`version`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `id`=`id`"},
+		{name: "mysql history", got: mysqlTarget{}.insertQuery("orders", columns, 1, ""), want: "INSERT INTO `orders` (`id`,`memo`,`version`) VALUES (?,?,?)"},
+		{name: "postgres newer", got: postgresTarget{}.upsertNewerQuery("orders", columns, 1, "id", "version"), want: `INSERT INTO "orders" AS target ("id","memo","version") VALUES (?,?,?) ON CONFLICT ("id") DO UPDATE SET "memo"=EXCLUDED."memo","version"=EXCLUDED."version" WHERE target."version" IS NULL OR EXCLUDED."version" >= target."version"`},
+		{name: "postgres insert ignore", got: postgresTarget{}.insertQuery("orders", columns, 1, "id"), want: `INSERT INTO "orders" ("id","memo","version") VALUES (?,?,?) ON CONFLICT ("id") DO NOTHING`},
+		{name: "sqlserver newer", got: sqlserverTarget{}.upsertNewerQuery("orders", columns, 1, "id", "version"), want: "MERGE INTO [orders] WITH (HOLDLOCK) AS target USING (VALUES (?,?,?)) AS source ([id],[memo],[version]) ON target.[id] = source.[id] WHEN MATCHED AND (target.[version] IS NULL OR source.[version] >= target.[version]) THEN UPDATE SET target.[memo] = source.[memo], target.[version] = source.[version] WHEN NOT MATCHED THEN INSERT ([id],[memo],[version]) VALUES (source.[id],source.[memo],source.[version]);"},
+		{name: "sqlserver insert ignore", got: sqlserverTarget{}.insertQuery("orders", columns, 1, "id"), want: "MERGE INTO [orders] WITH (HOLDLOCK) AS target USING (VALUES (?,?,?)) AS source ([id],[memo],[version]) ON target.[id] = source.[id] WHEN NOT MATCHED THEN INSERT ([id],[memo],[version]) VALUES (source.[id],source.[memo],source.[version]);"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Fatalf("%s:\n got %s\nwant %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
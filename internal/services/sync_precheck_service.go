@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -27,6 +28,7 @@ type mysqlColumn struct {
 	Field string `gorm:"column:Field"`
 	Type  string `gorm:"column:Type"`
 	Key   string `gorm:"column:Key"`
+	Extra string `gorm:"column:Extra"`
 }
 
 func (s *SyncService) PrecheckTask(taskID uint) (*PrecheckResult, error) {
@@ -55,10 +57,39 @@ func (s *SyncService) PrecheckTask(taskID uint) (*PrecheckResult, error) {
 	if err := s.systemDB.Where("name = ?", task.TargetDB).First(&targetConn).Error; err != nil {
 		return nil, err
 	}
-	if sourceConn.Type != "mysql" || targetConn.Type != "mysql" {
-		add("error", "连接类型", "可靠多表同步当前仅支持 MySQL → MySQL")
+	if !supportedTargetType(sourceConn.Type) || !supportedTargetType(targetConn.Type) {
+		add("error", "连接类型", "可靠多表同步当前仅支持 MySQL / PostgreSQL / SQL Server → MySQL / PostgreSQL / SQL Server")
 		return result, nil
 	}
+	incremental := task.SyncType == "incremental"
+	if task.SyncType == "cdc" || task.SyncType == "full_cdc" {
+		policy, _ := normalizeBinlogPurgePolicy(task.BinlogPurgePolicy)
+		if err := validateBinlogPurgeEndpoints(policy, sourceConn.Type, targetConn.Type); err != nil {
+			add("error", "Binlog 清理恢复策略", err.Error())
+		}
+	}
+	mysqlSource := sourceConn.Type == "mysql"
+	// postgresSource 指 PostgreSQL 逻辑复制，轮询增量只读表数据
+	postgresSource := sourceConn.Type == "postgres" && !incremental
+	if sourceConn.Type == "postgres" && task.SyncType != "cdc" && !incremental {
+		add("error", "同步类型", "PostgreSQL 源当前仅支持 CDC 增量同步（逻辑复制）或轮询增量同步，不支持全量初始化")
+		return result, nil
+	}
+	if sourceConn.Type == "sqlserver" && !incremental {
+		add("error", "同步类型", "SQL Server 源仅支持轮询增量同步")
+		return result, nil
+	}
+	if !mysqlSource && len(task.TablePatterns) > 0 {
+		add("error", "分表规则", "非 MySQL 源暂不支持分表合并规则")
+		return result, nil
+	}
+	if incremental && len(task.TablePatterns) > 0 {
+		add("error", "分表规则", "轮询增量同步暂不支持分表合并规则")
+		return result, nil
+	}
+	if incremental && task.ScheduleType == "manual" {
+		add("warning", "执行方式", "轮询增量同步未配置 Cron 或轮询间隔，只在手动执行时同步")
+	}
 	if task.SyncType == "cdc" || task.SyncType == "full_cdc" {
 		if task.ScheduleType != "manual" {
 			add("error", "执行方式", "Binlog CDC 由任务自身持续运行，不需要 Cron 或轮询间隔")
@@ -84,12 +115,18 @@ func (s *SyncService) PrecheckTask(taskID uint) (*PrecheckResult, error) {
 	} else {
 		add("success", "目标连接", "连接正常")
 	}
-	grants, grantErr := mysqlCurrentGrants(targetDB)
-	if grantErr != nil {
-		add("warning", "目标权限", "无法读取账号授权信息: "+grantErr.Error())
+	dialect := dialectOf(targetDB)
+	// 目标账号授权只对 MySQL 读取，其他目标库在首次写入时暴露权限问题
+	grants, grantErr := "", errors.New("非 MySQL 目标库")
+	if dialect.name() == "mysql" {
+		if grants, grantErr = mysqlCurrentGrants(targetDB); grantErr != nil {
+			add("warning", "目标权限", "无法读取账号授权信息: "+grantErr.Error())
+		}
 	}
 	upperGrants := strings.ToUpper(grants)
-	if task.SyncType == "cdc" || task.SyncType == "full_cdc" {
+	if postgresSource {
+		precheckPostgresSource(sourceDB, add)
+	} else if task.SyncType == "cdc" || task.SyncType == "full_cdc" {
 		var variable struct {
 			VariableName string `gorm:"column:Variable_name"`
 			Value        string `gorm:"column:Value"`
@@ -119,11 +156,23 @@ func (s *SyncService) PrecheckTask(taskID uint) (*PrecheckResult, error) {
 		} else {
 			add("success", "行镜像", "FULL 模式")
 		}
+		if mysqlGTIDEnabled(sourceDB) {
+			add("success", "GTID", "gtid_mode 已开启，检查点将按 GTID 恢复，支持主从切换后续传")
+		} else {
+			add("warning", "GTID", "gtid_mode 未开启，检查点仅按文件位点恢复，主从切换后需要手动调整位点")
+		}
 		sourceGrants, err := mysqlCurrentGrants(sourceDB)
 		upper := strings.ToUpper(sourceGrants)
 		if err != nil || (!strings.Contains(upper, "ALL PRIVILEGES") && (!strings.Contains(upper, "REPLICATION SLAVE") || !strings.Contains(upper, "REPLICATION CLIENT"))) {
 			add("error", "源端权限", "CDC 账号需要 REPLICATION SLAVE 和 REPLICATION CLIENT 权限")
 		}
+		if task.SyncType == "full_cdc" && task.SnapshotMode == snapshotModeConsistent {
+			if err == nil && !strings.Contains(upper, "ALL PRIVILEGES") && !strings.Contains(upper, "RELOAD") && !strings.Contains(upper, "LOCK TABLES") {
+				add("error", "一致性快照", "一致性快照需要 RELOAD（全局读锁）或 LOCK TABLES 权限")
+			} else {
+				add("warning", "一致性快照", fmt.Sprintf("建立快照时短暂加读锁（最多等待 %d 秒）；全量期间源库要为快照保留 undo 版本，大表初始化耗时较长时注意 undo 空间；中断后将重新建立快照并从头初始化", snapshotLockWaitSeconds()))
+			}
+		}
 		if _, _, err := currentMySQLPosition(task.SourceDB); err != nil {
 			add("error", "Binlog 位点", err.Error())
 		} else {
@@ -135,32 +184,118 @@ func (s *SyncService) PrecheckTask(taskID uint) (*PrecheckResult, error) {
 	}
 
 	needsCreate := false
-	if len(task.TaskTables) == 0 {
-		task.TaskTables = []models.SyncTaskTable{{TaskID: task.ID, SourceTable: task.SourceTable, TargetTable: task.TargetTable, IncrementalKey: task.IncrementalKey, FieldMapping: task.FieldMapping}}
+	if len(task.TaskTables) == 0 && len(task.TablePatterns) == 0 {
+		task.TaskTables = []models.SyncTaskTable{{TaskID: task.ID, SourceTable: task.SourceTable, TargetTable: task.TargetTable, IncrementalKey: task.IncrementalKey, FieldMapping: task.FieldMapping, RowIdentity: rowIdentityPrimaryKey}}
 	}
+	var staleShards []uint
+	if len(task.TablePatterns) > 0 {
+		defaultSchema, err := currentMySQLSchema(sourceDB)
+		if err != nil {
+			add("error", "分表规则", "读取源库名失败: "+err.Error())
+			return result, nil
+		}
+		tables := []models.SyncTaskTable{}
+		for _, table := range task.TaskTables {
+			if table.PatternID == nil {
+				tables = append(tables, table)
+			}
+		}
+		kept := map[uint]bool{}
+		for i := range task.TablePatterns {
+			pattern := &task.TablePatterns[i]
+			object := "分表 " + pattern.SourcePattern + " → " + pattern.TargetTable
+			shards, err := expandTablePattern(sourceDB, pattern, defaultSchema, task.TaskTables)
+			if err != nil {
+				add("error", object, err.Error())
+				continue
+			}
+			if len(shards) == 0 {
+				add("error", object, "没有匹配的源表")
+				continue
+			}
+			if !targetDB.Migrator().HasTable(pattern.TargetTable) {
+				add("error", object, "分表合并的目标表必须预先创建")
+				continue
+			}
+			problems := precheckPatternShards(sourceDB, targetDB, pattern, shards)
+			for j := range shards {
+				for _, table := range tables {
+					if table.SourceSchema == shards[j].SourceSchema && table.SourceTable == shards[j].SourceTable {
+						problems = append(problems, "分片 "+sourceTableName(&shards[j])+" 已被其他映射或分表规则使用")
+					}
+				}
+			}
+			for _, problem := range problems {
+				add("error", object, problem)
+			}
+			if len(problems) > 0 {
+				continue
+			}
+			names := make([]string, len(shards))
+			for j := range shards {
+				names[j] = sourceTableName(&shards[j])
+				if shards[j].ID != 0 {
+					kept[shards[j].ID] = true
+				}
+			}
+			add("success", object, fmt.Sprintf("匹配 %d 个分片: %s", len(shards), strings.Join(names, "、")))
+			if pattern.DiscriminatorColumn == "" {
+				add("warning", object, "未配置来源分片列：各分片的行标识必须全局唯一，否则不同分片的行会互相覆盖，且数据比对不检查目标端多余数据")
+			}
+			tables = append(tables, shards...)
+		}
+		for _, table := range task.TaskTables {
+			if table.PatternID != nil && !kept[table.ID] {
+				staleShards = append(staleShards, table.ID)
+			}
+		}
+		task.TaskTables = tables
+	}
+	sourceDialect := dialectOf(sourceDB)
 	for i := range task.TaskTables {
 		mapping := &task.TaskTables[i]
-		object := mapping.SourceTable + " → " + mapping.TargetTable
+		object := sourceTableName(mapping) + " → " + mapping.TargetTable
 		if !validMySQLIdentifier(mapping.SourceTable) || !validMySQLIdentifier(mapping.TargetTable) {
 			add("error", object, "表名只能包含字母、数字、下划线和 $，且不能以数字开头")
 			continue
 		}
-		sourceColumns, err := describeMySQLTable(sourceDB, mapping.SourceTable)
+		sourceColumns, err := sourceDialect.describeTable(sourceDB, sourceTableName(mapping))
 		if err != nil {
 			add("error", object, "读取源表结构失败: "+err.Error())
 			continue
 		}
-		permissionRows, permissionErr := sourceDB.Raw("SELECT * FROM `" + mapping.SourceTable + "` LIMIT 0").Rows()
+		permissionRows, permissionErr := sourceDB.Raw("SELECT * FROM " + sourceDialect.quoteTable(sourceTableName(mapping)) + " WHERE 1 = 0").Rows()
 		if permissionErr != nil {
 			add("error", object, "源账号缺少读取权限: "+permissionErr.Error())
 			continue
 		}
 		permissionRows.Close()
-		pk := primaryKeyOf(sourceColumns)
-		if pk == "" {
-			add("error", object, "源表没有单列主键，无法稳定分页和幂等写入")
+		pk, err := sourceRowIdentity(sourceDB, mapping)
+		if err != nil {
+			add("error", object, err.Error())
 			continue
 		}
+		if postgresSource {
+			if err := postgresReplicaIdentity(sourceDB, mapping); err != nil {
+				add("error", object, err.Error())
+				continue
+			}
+		}
+		if incremental {
+			if problem, warning := precheckIncrementalColumns(mapping, sourceColumns); problem != "" {
+				add("error", object, problem)
+				continue
+			} else if warning != "" {
+				add("warning", object, warning)
+			}
+		} else if keylessRowIdentity(mapping) {
+			if task.SyncType == "full_cdc" && task.SnapshotMode != snapshotModeConsistent {
+				// 无键表按偏移分页读取，replay 快照期间的并发写入会让后续页漏读或重复读取，且无法靠回放 Binlog 收敛
+				add("error", object, "无键表的全量 + CDC 任务需使用一致性快照（consistent），否则全量读取期间的写入会导致漏行或重复行")
+				continue
+			}
+			add("warning", object, keylessRowIdentityWarning(mapping))
+		}
 		for sourceName := range mapping.FieldMapping {
 			if ignoredField(mapping, sourceName) {
 				add("error", object, "忽略字段不能再配置字段映射: "+sourceName)
@@ -181,23 +316,84 @@ func (s *SyncService) PrecheckTask(taskID uint) (*PrecheckResult, error) {
 			}
 			mappedTargets[targetName] = column.Field
 		}
-		if ignoredField(mapping, pk) {
-			add("error", object, "主键字段不能忽略: "+pk)
+		ignoredKey := ""
+		for _, column := range primaryKeyColumns(pk) {
+			if ignoredField(mapping, column) {
+				ignoredKey = column
+				break
+			}
+		}
+		if ignoredKey != "" {
+			add("error", object, "行标识字段不能忽略: "+ignoredKey)
 			continue
 		}
-		mapping.SourcePrimaryKey, mapping.TargetPrimaryKey = pk, mappedColumn(mapping.FieldMapping, pk)
+		mapping.SourcePrimaryKey, mapping.TargetPrimaryKey = pk, mappedPrimaryKey(mapping.FieldMapping, pk)
 		if targetDB.Migrator().HasTable(mapping.TargetTable) {
-			targetColumns, err := describeMySQLTable(targetDB, mapping.TargetTable)
+			targetColumns, err := describeTargetTable(targetDB, mapping.TargetTable)
 			if err != nil {
 				add("error", object, "读取目标表结构失败: "+err.Error())
 				continue
 			}
-			if primaryKeyOf(targetColumns) != mapping.TargetPrimaryKey {
-				add("error", object, "目标表必须使用单列主键: "+mapping.TargetPrimaryKey)
+			targetKeyed := false
+			if pk != "" {
+				matched, targetKeys, err := targetHasRowIdentity(targetDB, mapping)
+				if err != nil {
+					add("error", object, "读取目标表索引失败: "+err.Error())
+					continue
+				}
+				targetKeyed = matched
+				if writesHistory(mapping) {
+					matched = true
+				}
+				if targetKeys == "" {
+					targetKeys = "无"
+				}
+				if !matched && mapping.RowIdentity == rowIdentityPrimaryKey {
+					add("error", object, fmt.Sprintf("目标表主键必须与源表映射后的主键一致: 期望 (%s)，实际 %s", shardTargetIdentity(mapping), targetKeys))
+					continue
+				}
+				if !matched {
+					add("error", object, fmt.Sprintf("目标表缺少与行标识 (%s) 一致的主键或唯一索引", shardTargetIdentity(mapping)))
+					continue
+				}
+			}
+			if problem, warning := precheckWriteMode(task, mapping, sourceColumns, targetColumns, targetKeyed); problem != "" {
+				add("error", object, problem)
+				continue
+			} else if warning != "" {
+				add("warning", object, warning)
+			}
+			if problem, warning := precheckDeleteMode(mapping, sourceColumns, targetColumns); problem != "" {
+				add("error", object, problem)
+				continue
+			} else if warning != "" {
+				add("warning", object, warning)
+			}
+			if problem, warning := precheckRowFilter(task, mapping, sourceColumns); problem != "" {
+				add("error", object, problem)
 				continue
+			} else if warning != "" {
+				add("warning", object, warning)
 			}
-			triggers, triggerErr := mysqlTriggerNames(targetDB, mapping.TargetTable)
-			if triggerErr == nil && len(triggers) > 0 {
+			if problem := precheckTransforms(mapping, sourceColumns, targetColumns); problem != "" {
+				add("error", object, problem)
+				continue
+			}
+			if problem, warning := precheckRowPlugin(s.systemDB, mapping, true); problem != "" {
+				add("error", object, problem)
+				continue
+			} else if warning != "" {
+				add("warning", object, warning)
+			}
+			if postgresSource {
+				add("warning", object, "PostgreSQL 源不校验字段类型兼容性，逻辑复制中的值按文本写入目标库，请确认目标字段能接受对应格式")
+			} else if !mysqlSource {
+				add("warning", object, "非 MySQL 源不校验字段类型兼容性，请确认目标字段能接受源库读出的值")
+			} else if dialect.name() != "mysql" {
+				if enums := enumColumns(sourceColumns, mapping); len(enums) > 0 {
+					add("warning", object, "ENUM/SET 字段 "+strings.Join(enums, "、")+" 在 CDC 中按序号写入非 MySQL 目标库，建议目标端使用整数列或改为同步到 MySQL")
+				}
+			} else if triggers, triggerErr := mysqlTriggerNames(targetDB, mapping.TargetTable); triggerErr == nil && len(triggers) > 0 {
 				add("warning", object, "目标表存在触发器: "+strings.Join(triggers, "、")+"；若触发器内部 INSERT 未指定列清单，可能导致 Column count doesn't match value count")
 			}
 			for _, column := range sourceColumns {
@@ -210,7 +406,7 @@ func (s *SyncService) PrecheckTask(taskID uint) (*PrecheckResult, error) {
 					add("error", object, "目标表缺少字段: "+targetName)
 					continue
 				}
-				if mysqlBaseType(column.Type) != mysqlBaseType(targetColumn.Type) {
+				if mysqlSource && !dialect.compatibleType(column.Type, targetColumn.Type) {
 					confirmKey := typeMismatchKey(column.Field, targetName)
 					message := fmt.Sprintf("字段类型不兼容: %s(%s) → %s(%s)", column.Field, column.Type, targetName, targetColumn.Type)
 					if confirmedTypeMismatch(mapping, confirmKey) {
@@ -220,13 +416,30 @@ func (s *SyncService) PrecheckTask(taskID uint) (*PrecheckResult, error) {
 					}
 				}
 			}
-			add("success", object, "源表、目标表和主键检查通过")
+			add("success", object, "源表、目标表和行标识检查通过")
+		} else if problem, _ := precheckWriteMode(task, mapping, sourceColumns, nil, false); problem != "" {
+			add("error", object, problem)
+		} else if problem, _ := precheckDeleteMode(mapping, sourceColumns, nil); problem != "" {
+			add("error", object, problem)
+		} else if problem, _ := precheckRowFilter(task, mapping, sourceColumns); problem != "" {
+			add("error", object, problem)
+		} else if len(mapping.Transforms) > 0 {
+			add("error", object, "字段转换需预先创建目标表")
+		} else if problem, _ := precheckRowPlugin(s.systemDB, mapping, false); problem != "" {
+			add("error", object, problem)
+		} else if !mysqlSource {
+			add("error", object, "非 MySQL 源需预先创建目标表")
 		} else {
 			needsCreate = true
 			if len(mapping.FieldMapping) > 0 {
 				add("error", object, "目标表不存在时不能使用字段改名，请先创建目标表")
 			} else {
 				add("warning", object, "目标表不存在，首次执行时将按源表结构创建")
+				if dialect.name() != "mysql" {
+					if enums := enumColumns(sourceColumns, mapping); len(enums) > 0 {
+						add("warning", object, "ENUM/SET 字段 "+strings.Join(enums, "、")+" 将按文本列创建，CDC 中按序号写入")
+					}
+				}
 			}
 		}
 	}
@@ -236,6 +449,15 @@ func (s *SyncService) PrecheckTask(taskID uint) (*PrecheckResult, error) {
 
 	if result.Passed {
 		err = s.systemDB.Transaction(func(tx *gorm.DB) error {
+			if len(staleShards) > 0 {
+				// 源端已不存在的分片连同检查点一起移除
+				if err := tx.Where("task_table_id IN ?", staleShards).Delete(&models.SyncCheckpoint{}).Error; err != nil {
+					return err
+				}
+				if err := tx.Where("id IN ?", staleShards).Delete(&models.SyncTaskTable{}).Error; err != nil {
+					return err
+				}
+			}
 			for i := range task.TaskTables {
 				m := &task.TaskTables[i]
 				if m.ID == 0 {
@@ -247,6 +469,10 @@ func (s *SyncService) PrecheckTask(taskID uint) (*PrecheckResult, error) {
 					return err
 				}
 			}
+			// 预检查通过即接受当前表结构，此后的变化由巡检报告为漂移
+			if err := recordSchemaBaselines(tx, task, sourceDB, targetDB); err != nil {
+				return err
+			}
 			// 预检查通过只更新验证状态和启用状态，不覆盖 runtime_status
 			// 保持原有的 paused/stopped/failed/completed 状态，由用户手动决定是否启动
 			return tx.Model(&models.SyncTask{}).Where("id = ?", task.ID).Updates(map[string]interface{}{"validation_status": "passed", "status": 1}).Error
@@ -265,11 +491,11 @@ var mysqlIdentifierPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
 func validMySQLIdentifier(value string) bool { return mysqlIdentifierPattern.MatchString(value) }
 
 func describeMySQLTable(db *gorm.DB, table string) ([]mysqlColumn, error) {
-	if !taskIdentifierPattern.MatchString(table) {
+	if !validTableReference(table) {
 		return nil, fmt.Errorf("非法表名")
 	}
 	var columns []mysqlColumn
-	if err := db.Raw("DESCRIBE `" + table + "`").Scan(&columns).Error; err != nil {
+	if err := db.Raw("DESCRIBE " + quoteMySQLTable(table)).Scan(&columns).Error; err != nil {
 		return nil, err
 	}
 	if len(columns) == 0 {
@@ -278,17 +504,15 @@ func describeMySQLTable(db *gorm.DB, table string) ([]mysqlColumn, error) {
 	return columns, nil
 }
 
-func primaryKeyOf(columns []mysqlColumn) string {
-	keys := []string{}
+// enumColumns 返回参与同步的 ENUM/SET 字段，binlog 中它们只携带序号或位图
+func enumColumns(columns []mysqlColumn, mapping *models.SyncTaskTable) []string {
+	names := []string{}
 	for _, column := range columns {
-		if strings.EqualFold(column.Key, "PRI") {
-			keys = append(keys, column.Field)
+		if baseType := mysqlBaseType(column.Type); (baseType == "enum" || baseType == "set") && !ignoredField(mapping, column.Field) {
+			names = append(names, column.Field)
 		}
 	}
-	if len(keys) == 1 {
-		return keys[0]
-	}
-	return ""
+	return names
 }
 
 func hasColumn(columns []mysqlColumn, name string) bool {
@@ -400,3 +624,24 @@ func mysqlTriggerNames(db *gorm.DB, table string) ([]string, error) {
 	}
 	return triggers, rows.Err()
 }
+
+// precheckIncrementalColumns 检查轮询增量的增量字段和软删除列，返回错误和提示
+func precheckIncrementalColumns(mapping *models.SyncTaskTable, sourceColumns []mysqlColumn) (string, string) {
+	if mapping.IncrementalKey == "" {
+		return "轮询增量同步必须指定增量字段（如 updated_at 或自增 id）", ""
+	}
+	if keylessRowIdentity(mapping) {
+		return "轮询增量同步需要主键或非空唯一索引作为行标识，不支持仅追加或整行匹配模式", ""
+	}
+	if !hasColumn(sourceColumns, mapping.IncrementalKey) {
+		return "增量字段不存在: " + mapping.IncrementalKey, ""
+	}
+	if mapping.SoftDeleteColumn != "" && !hasColumn(sourceColumns, mapping.SoftDeleteColumn) {
+		return "软删除列不存在: " + mapping.SoftDeleteColumn, ""
+	}
+	warning := "轮询增量无法感知物理删除，增量字段须在每次写入时递增，值为 NULL 的行不会同步"
+	if mapping.SoftDeleteColumn == "" {
+		warning += "；如源端使用软删除，可配置软删除列同步删除"
+	}
+	return "", warning
+}
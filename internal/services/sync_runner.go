@@ -104,13 +104,21 @@ type snapshotTuning struct {
 	shardWorkers int
 }
 
+// acquireTaskRunLock 防止同一任务在本实例内重叠执行，并取得 run 租约防止其他实例同时执行
 func acquireTaskRunLock(taskID uint) (func(), error) {
 	value, _ := taskRunLocks.LoadOrStore(taskID, &sync.Mutex{})
 	lock := value.(*sync.Mutex)
 	if !lock.TryLock() {
 		return nil, fmt.Errorf("同一任务正在执行，不能重叠运行")
 	}
-	return lock.Unlock, nil
+	if err := acquireTaskLease(taskID, taskLeaseRun); err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	return func() {
+		releaseTaskLease(taskID, taskLeaseRun)
+		lock.Unlock()
+	}, nil
 }
 
 func (s *SyncService) syncValidatedTask(task *models.SyncTask) (int64, error) {
@@ -134,7 +142,11 @@ func (s *SyncService) syncValidatedTask(task *models.SyncTask) (int64, error) {
 			defer wg.Done()
 			sem <- struct{}{}
 			defer func() { <-sem }()
-			rows, err := s.syncValidatedTable(task, mapping, sourceDB, targetDB)
+			syncTable := s.syncValidatedTable
+			if task.SyncType == "incremental" {
+				syncTable = s.syncIncrementalTable
+			}
+			rows, err := syncTable(task, mapping, sourceDB, targetDB)
 			if err != nil {
 				_ = updateTaskTableProgress(s.systemDB, mapping.ID, map[string]interface{}{"sync_state": "failed", "progress_message": err.Error()})
 				errCh <- fmt.Errorf("表 %s 同步失败: %w", mapping.SourceTable, err)
@@ -156,14 +168,26 @@ func (s *SyncService) syncValidatedTask(task *models.SyncTask) (int64, error) {
 }
 
 func (s *SyncService) syncValidatedTable(task *models.SyncTask, mapping *models.SyncTaskTable, sourceDB, targetDB *gorm.DB) (int64, error) {
-	if mapping.SourcePrimaryKey == "" || mapping.TargetPrimaryKey == "" {
+	if !keylessRowIdentity(mapping) && (mapping.SourcePrimaryKey == "" || mapping.TargetPrimaryKey == "") {
 		return 0, fmt.Errorf("缺少预检查主键信息")
 	}
 	if !targetDB.Migrator().HasTable(mapping.TargetTable) {
 		if len(mapping.FieldMapping) > 0 {
 			return 0, fmt.Errorf("目标表不存在时暂不支持字段改名")
 		}
-		if err := createMySQLTableLike(sourceDB, targetDB, mapping.SourceTable, mapping.TargetTable); err != nil {
+		if writesHistory(mapping) {
+			return 0, fmt.Errorf("历史模式需预先创建目标表")
+		}
+		if softDeletes(mapping) {
+			return 0, fmt.Errorf("软删除需预先创建包含标记列的目标表")
+		}
+		if len(mapping.Transforms) > 0 {
+			return 0, fmt.Errorf("字段转换需预先创建目标表")
+		}
+		if mapping.PluginID != nil {
+			return 0, fmt.Errorf("行处理插件需预先创建目标表")
+		}
+		if err := createTargetTableLike(sourceDB, targetDB, mapping.SourceTable, mapping.TargetTable); err != nil {
 			return 0, err
 		}
 	}
@@ -180,7 +204,7 @@ func (s *SyncService) syncValidatedTable(task *models.SyncTask, mapping *models.
 	}
 	checkpoint.TaskTableID = mapping.ID
 	var sourceTotal int64
-	if err := sourceDB.Table(mapping.SourceTable).Count(&sourceTotal).Error; err != nil {
+	if err := sourceDB.Table(sourceTableName(mapping)).Count(&sourceTotal).Error; err != nil {
 		return 0, err
 	}
 	shards, err := s.ensureSnapshotShards(task, sourceDB, mapping, sourceTotal)
@@ -235,15 +259,21 @@ func updateTaskTableProgress(db *gorm.DB, tableID uint, updates map[string]inter
 }
 
 func (s *SyncService) syncSnapshotShard(task *models.SyncTask, mapping *models.SyncTaskTable, sourceDB, targetDB *gorm.DB, shard *models.SyncSnapshotShardCheckpoint, sourceTotal int64, total *atomic.Int64) error {
+	throttle := readThrottle{
+		task:     task,
+		sourceDB: sourceDB,
+		stopped:  func() error { return checkTaskPaused(s.systemDB, task.ID) },
+		report: func(message string) {
+			_ = updateTaskTableProgress(s.systemDB, mapping.ID, map[string]interface{}{"progress_message": message})
+		},
+	}
 	for {
-		var runtime struct{ RuntimeStatus string }
-		if err := s.systemDB.Model(&models.SyncTask{}).Select("runtime_status").Where("id = ?", task.ID).Scan(&runtime).Error; err != nil {
+		if err := checkTaskPaused(s.systemDB, task.ID); err != nil {
 			return err
 		}
-		if runtime.RuntimeStatus == "paused" {
-			return ErrTaskPaused
-		}
-		batch, columns, lastPK, err := readMySQLShardBatch(task, mapping, sourceDB, shard)
+		reader, release := snapshotReader(task.ID, sourceDB)
+		batch, columns, lastPK, err := readMySQLShardBatch(task, mapping, reader, shard)
+		release()
 		if err != nil {
 			return err
 		}
@@ -254,9 +284,19 @@ func (s *SyncService) syncSnapshotShard(task *models.SyncTask, mapping *models.S
 			}
 			return nil
 		}
-		if err := writeMySQLBatch(targetDB, mapping, columns, batch); err != nil {
+		if err := throttle.wait(len(batch), batchBytes(batch)); err != nil {
+			return err
+		}
+		writeColumns, writeRows, err := applyRowPluginBatch(mapping, "snapshot", columns, batch)
+		if err != nil {
 			return err
 		}
+		if len(writeRows) > 0 {
+			if err := writeSnapshotRows(targetDB, task, s.systemDB, mapping, writeColumns, writeRows); err != nil {
+				return err
+			}
+			recordRunRows(task.ID, sourceTableName(mapping), len(writeRows), batchBytes(writeRows))
+		}
 		shard.CursorPrimaryKey = lastPK
 		shard.ProcessedRows += int64(len(batch))
 		if err := saveShardCheckpoint(s.systemDB, shard); err != nil {
@@ -297,10 +337,10 @@ func (s *SyncService) ensureSnapshotShards(task *models.SyncTask, db *gorm.DB, m
 	} else if sourceTotal < int64(shardCount) {
 		shardCount = int(sourceTotal)
 	}
-	if shardCount < 1 {
+	if shardCount < 1 || keylessRowIdentity(mapping) {
 		shardCount = 1
 	}
-	bounds, err := snapshotShardBounds(db, mapping.SourceTable, mapping.SourcePrimaryKey, sourceTotal, shardCount)
+	bounds, err := snapshotShardBounds(db, sourceTableName(mapping), mapping.SourcePrimaryKey, sourceTotal, shardCount)
 	if err != nil {
 		return nil, err
 	}
@@ -327,14 +367,23 @@ func snapshotShardBounds(db *gorm.DB, table, pk string, sourceTotal int64, shard
 	if shardCount <= 1 || sourceTotal <= 0 {
 		return bounds, nil
 	}
+	columns := primaryKeyColumns(pk)
+	order := primaryKeyOrder(columns)
 	for i := 1; i < shardCount; i++ {
 		offset := sourceTotal * int64(i) / int64(shardCount)
-		var value interface{}
-		row := db.Raw("SELECT "+quoteMySQL(pk)+" FROM "+quoteMySQL(table)+" ORDER BY "+quoteMySQL(pk)+" LIMIT 1 OFFSET ?", offset).Row()
-		if err := row.Scan(&value); err != nil {
+		values, pointers := make([]interface{}, len(columns)), make([]interface{}, len(columns))
+		for j := range values {
+			pointers[j] = &values[j]
+		}
+		row := db.Raw("SELECT "+order+" FROM "+quoteMySQLTable(table)+" ORDER BY "+order+" LIMIT 1 OFFSET ?", offset).Row()
+		if err := row.Scan(pointers...); err != nil {
 			return nil, err
 		}
-		bounds = append(bounds, valueString(normalizeMySQLScannedValue(value)))
+		bound := make([]string, len(values))
+		for j := range values {
+			bound[j] = valueString(normalizeMySQLScannedValue(values[j]))
+		}
+		bounds = append(bounds, encodePrimaryKey(bound))
 	}
 	return bounds, nil
 }
@@ -347,79 +396,8 @@ func shardProcessedRows(shards []models.SyncSnapshotShardCheckpoint) int64 {
 	return total
 }
 
-func readMySQLBatch(task *models.SyncTask, mapping *models.SyncTaskTable, db *gorm.DB, checkpoint *models.SyncCheckpoint) ([]map[string]interface{}, []string, string, string, error) {
-	pk := quoteMySQL(mapping.SourcePrimaryKey)
-	table := quoteMySQL(mapping.SourceTable)
-	sourceColumns, err := selectableSourceColumns(task, mapping, db)
-	if err != nil {
-		return nil, nil, "", "", err
-	}
-	if len(sourceColumns) == 0 {
-		return nil, nil, "", "", fmt.Errorf("没有可读取的同步字段")
-	}
-	selectList := make([]string, len(sourceColumns))
-	for i, column := range sourceColumns {
-		selectList[i] = quoteMySQL(column)
-	}
-	query := "SELECT " + strings.Join(selectList, ",") + " FROM " + table
-	params := []interface{}{}
-	if task.SyncType == "incremental" {
-		cursor := quoteMySQL(mapping.IncrementalKey)
-		if checkpoint.CursorValue != "" || checkpoint.CursorPrimaryKey != "" {
-			query += " WHERE (" + cursor + " > ?) OR (" + cursor + " = ? AND " + pk + " > ?)"
-			params = append(params, checkpoint.CursorValue, checkpoint.CursorValue, checkpoint.CursorPrimaryKey)
-		}
-		query += " ORDER BY " + cursor + ", " + pk
-	} else {
-		if checkpoint.CursorPrimaryKey != "" {
-			query += " WHERE " + pk + " > ?"
-			params = append(params, checkpoint.CursorPrimaryKey)
-		}
-		query += " ORDER BY " + pk
-	}
-	if mapping.CustomWhere != "" && !strings.Contains(query, "WHERE") {
-		query += " WHERE (" + mapping.CustomWhere + ")"
-	} else if mapping.CustomWhere != "" {
-		query += " AND (" + mapping.CustomWhere + ")"
-	}
-	query += fmt.Sprintf(" LIMIT %d", snapshotBatchSize(task))
-	rows, err := db.Raw(query, params...).Rows()
-	if err != nil {
-		return nil, nil, "", "", err
-	}
-	defer rows.Close()
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, nil, "", "", err
-	}
-	batch := []map[string]interface{}{}
-	lastCursor, lastPK := "", ""
-	for rows.Next() {
-		values, pointers := make([]interface{}, len(columns)), make([]interface{}, len(columns))
-		for i := range values {
-			pointers[i] = &values[i]
-		}
-		if err := rows.Scan(pointers...); err != nil {
-			return nil, nil, "", "", err
-		}
-		row := map[string]interface{}{}
-		for i, column := range columns {
-			value := normalizeMySQLScannedValue(values[i])
-			row[column] = value
-			if column == mapping.SourcePrimaryKey {
-				lastPK = valueString(value)
-			}
-			if task.SyncType == "incremental" && column == mapping.IncrementalKey {
-				lastCursor = valueString(value)
-			}
-		}
-		batch = append(batch, row)
-	}
-	return batch, columns, lastCursor, lastPK, rows.Err()
-}
-
 func readMySQLShardBatch(task *models.SyncTask, mapping *models.SyncTaskTable, db *gorm.DB, shard *models.SyncSnapshotShardCheckpoint) ([]map[string]interface{}, []string, string, error) {
-	pk := quoteMySQL(mapping.SourcePrimaryKey)
+	pkColumns := primaryKeyColumns(mapping.SourcePrimaryKey)
 	sourceColumns, err := selectableSourceColumns(task, mapping, db)
 	if err != nil {
 		return nil, nil, "", err
@@ -435,24 +413,40 @@ func readMySQLShardBatch(task *models.SyncTask, mapping *models.SyncTaskTable, d
 	if cursor == "" {
 		cursor = shard.LowerBound
 	}
-	query := "SELECT " + strings.Join(selectList, ",") + " FROM " + quoteMySQL(mapping.SourceTable)
+	query := "SELECT " + strings.Join(selectList, ",") + " FROM " + quoteMySQLTable(sourceTableName(mapping))
 	params := []interface{}{}
 	wheres := []string{}
 	if cursor != "" {
-		wheres = append(wheres, pk+" > ?")
-		params = append(params, cursor)
+		pkArgs, err := primaryKeyArgs(cursor, pkColumns)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		wheres = append(wheres, primaryKeyCondition(pkColumns, ">"))
+		params = append(params, pkArgs...)
 	}
 	if shard.UpperBound != "" {
-		wheres = append(wheres, pk+" <= ?")
-		params = append(params, shard.UpperBound)
+		pkArgs, err := primaryKeyArgs(shard.UpperBound, pkColumns)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		wheres = append(wheres, primaryKeyCondition(pkColumns, "<="))
+		params = append(params, pkArgs...)
 	}
 	if mapping.CustomWhere != "" {
 		wheres = append(wheres, "("+mapping.CustomWhere+")")
 	}
+	filters, filterArgs := rowFilterSQL(quoteMySQL, mapping.RowFilter)
+	wheres, params = append(wheres, filters...), append(params, filterArgs...)
 	if len(wheres) > 0 {
 		query += " WHERE " + strings.Join(wheres, " AND ")
 	}
-	query += " ORDER BY " + pk + fmt.Sprintf(" LIMIT %d", snapshotBatchSize(task))
+	if len(pkColumns) == 0 {
+		// 无键表没有可比较的游标，按已处理行数偏移续读；不加 ORDER BY，依赖 InnoDB 按聚簇索引顺序扫描。
+		// 并发写入会移动偏移，全量 + CDC 任务因此由预检查要求一致性快照，各页都在同一读视图内读取
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", snapshotBatchSize(task), shard.ProcessedRows)
+	} else {
+		query += " ORDER BY " + primaryKeyOrder(pkColumns) + fmt.Sprintf(" LIMIT %d", snapshotBatchSize(task))
+	}
 	rows, err := db.Raw(query, params...).Rows()
 	if err != nil {
 		return nil, nil, "", err
@@ -474,22 +468,24 @@ func readMySQLShardBatch(task *models.SyncTask, mapping *models.SyncTaskTable, d
 		}
 		row := map[string]interface{}{}
 		for i, column := range columns {
-			value := normalizeMySQLScannedValue(values[i])
-			row[column] = value
-			if column == mapping.SourcePrimaryKey {
-				lastPK = valueString(value)
-			}
+			row[column] = normalizeMySQLScannedValue(values[i])
+		}
+		if len(pkColumns) > 0 {
+			lastPK = rowPrimaryKey(row, pkColumns)
 		}
 		batch = append(batch, row)
 	}
 	return batch, columns, lastPK, rows.Err()
 }
 
-func writeMySQLBatch(db *gorm.DB, mapping *models.SyncTaskTable, sourceColumns []string, batch []map[string]interface{}) error {
-	return db.Transaction(func(tx *gorm.DB) error { return writeMySQLBatchTx(tx, mapping, sourceColumns, batch) })
+func writeTargetBatch(db *gorm.DB, mapping *models.SyncTaskTable, sourceColumns []string, batch []map[string]interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error { return writeTargetBatchTx(tx, mapping, sourceColumns, batch) })
 }
 
-func writeMySQLBatchTx(db *gorm.DB, mapping *models.SyncTaskTable, sourceColumns []string, batch []map[string]interface{}) error {
+func writeTargetBatchTx(db *gorm.DB, mapping *models.SyncTaskTable, sourceColumns []string, batch []map[string]interface{}) error {
+	if err := checkTaskLeaseFence(mapping.TaskID); err != nil {
+		return err
+	}
 	pairs, err := syncColumnPairs(db, mapping, sourceColumns)
 	if err != nil {
 		return err
@@ -497,25 +493,92 @@ func writeMySQLBatchTx(db *gorm.DB, mapping *models.SyncTaskTable, sourceColumns
 	if len(pairs) == 0 {
 		return fmt.Errorf("没有可写入的同步字段")
 	}
+	pairs = withTransformPairs(mapping, pairs)
+	if batch, err = applyTransforms(mapping, pairs, batch); err != nil {
+		return err
+	}
 	sourceColumns = make([]string, len(pairs))
 	targetColumns := make([]string, len(pairs))
 	for i, pair := range pairs {
 		sourceColumns[i] = pair.source
 		targetColumns[i] = pair.target
 	}
-	quoted := make([]string, len(targetColumns))
-	for i, column := range targetColumns {
-		quoted[i] = quoteMySQL(column)
+	if mapping.DiscriminatorColumn != "" {
+		sourceColumns = append(sourceColumns, shardDiscriminatorSource)
+		targetColumns = append(targetColumns, mapping.DiscriminatorColumn)
+		batch = withShardDiscriminator(mapping, batch)
+	}
+	if writesHistory(mapping) {
+		sourceColumns = append(sourceColumns, historyOpSource, historyPositionSource)
+		targetColumns = append(targetColumns, historyOpColumn, historyPositionColumn)
+		batch = withHistoryColumns(batch)
+	}
+	if softDeletes(mapping) {
+		sourceColumns = append(sourceColumns, softDeleteSource)
+		targetColumns = append(targetColumns, mapping.DeleteColumn)
+		batch = withSoftDeleteReset(mapping, batch)
+	}
+	dialect := dialectOf(db)
+	if dialect.name() != "mysql" && !writesHistory(mapping) {
+		// ON CONFLICT 和 MERGE 不允许同一语句多次命中同一行，同键只保留最后一次写入
+		batch = lastRowPerIdentity(batch, sourceColumns, targetColumns, shardTargetIdentity(mapping))
+	}
+	chunkRows := dialect.maxBindParams() / len(targetColumns)
+	for start := 0; start < len(batch); start += chunkRows {
+		end := start + chunkRows
+		if end > len(batch) {
+			end = len(batch)
+		}
+		if err := writeTargetRows(db, dialect, mapping, sourceColumns, targetColumns, batch[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lastRowPerIdentity(batch []map[string]interface{}, sourceColumns, targetColumns []string, identity string) []map[string]interface{} {
+	keys := primaryKeyColumns(identity)
+	if len(keys) == 0 || len(batch) < 2 {
+		return batch
 	}
+	keySources := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for i, target := range targetColumns {
+			if target == key {
+				keySources = append(keySources, sourceColumns[i])
+			}
+		}
+	}
+	if len(keySources) != len(keys) {
+		return batch
+	}
+	last := make(map[string]int, len(batch))
+	for i, row := range batch {
+		last[rowPrimaryKey(row, keySources)] = i
+	}
+	if len(last) == len(batch) {
+		return batch
+	}
+	rows := make([]map[string]interface{}, 0, len(last))
+	for i, row := range batch {
+		if last[rowPrimaryKey(row, keySources)] == i {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func writeTargetRows(db *gorm.DB, dialect sqlDialect, mapping *models.SyncTaskTable, sourceColumns, targetColumns []string, batch []map[string]interface{}) error {
 	placeholders, args := buildMySQLInsertValues(sourceColumns, batch)
 	expectedArgs := len(placeholders) * len(targetColumns)
 	if len(args) != expectedArgs {
 		return fmt.Errorf("写入列和值数量不一致: 目标列 %d，行数 %d，参数 %d", len(targetColumns), len(placeholders), len(args))
 	}
-	query := buildMySQLUpsertQuery(mapping.TargetTable, targetColumns, quoted, placeholders, mapping.TargetPrimaryKey)
+	query := targetWriteQuery(dialect, mapping, targetColumns, len(batch))
 	if err := db.Exec(query, args...).Error; err != nil {
-		if len(batch) > 1 && strings.Contains(err.Error(), "1136") {
-			return writeMySQLRowsOneByOne(db, mapping, sourceColumns, targetColumns, quoted, batch, err)
+		// 逐行和 SET 语法兜底都按覆盖写入生成，只用于 upsert 方式
+		if dialect.name() == "mysql" && len(batch) > 1 && (mapping.WriteMode == "" || mapping.WriteMode == writeModeUpsert) && strings.Contains(err.Error(), "1136") {
+			return writeMySQLRowsOneByOne(db, mapping, sourceColumns, targetColumns, quoteAll(quoteMySQL, targetColumns), batch, err)
 		}
 		return fmt.Errorf("%w；写入字段数=%d，批次行数=%d，目标字段=%s，忽略源字段=%s", err, len(targetColumns), len(batch), strings.Join(targetColumns, ","), strings.Join([]string(mapping.IgnoredFields), ","))
 	}
@@ -536,30 +599,35 @@ func buildMySQLInsertValues(sourceColumns []string, batch []map[string]interface
 }
 
 func buildMySQLUpsertQuery(targetTable string, targetColumns, quoted, placeholders []string, targetPrimaryKey string) string {
+	return "INSERT INTO " + quoteMySQL(targetTable) + " (" + strings.Join(quoted, ",") + ") VALUES " + strings.Join(placeholders, ",") + " ON DUPLICATE KEY UPDATE " + strings.Join(mysqlUpsertAssignments(targetColumns, targetPrimaryKey), ",")
+}
+
+// mysqlUpsertAssignments 更新除主键列之外的字段；只有主键列时回写第一个主键列保证语法有效
+func mysqlUpsertAssignments(targetColumns []string, targetPrimaryKey string) []string {
 	updates := []string{}
 	for _, column := range targetColumns {
-		if column != targetPrimaryKey {
+		if !isPrimaryKeyColumn(targetPrimaryKey, column) {
 			q := quoteMySQL(column)
 			updates = append(updates, q+"=VALUES("+q+")")
 		}
 	}
 	if len(updates) == 0 {
-		q := quoteMySQL(targetPrimaryKey)
+		q := quoteMySQL(primaryKeyColumns(targetPrimaryKey)[0])
 		updates = append(updates, q+"=VALUES("+q+")")
 	}
-	return "INSERT INTO " + quoteMySQL(targetTable) + " (" + strings.Join(quoted, ",") + ") VALUES " + strings.Join(placeholders, ",") + " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ",")
+	return updates
 }
 
 func writeMySQLRowsOneByOne(db *gorm.DB, mapping *models.SyncTaskTable, sourceColumns, targetColumns, quoted []string, batch []map[string]interface{}, batchErr error) error {
 	for _, row := range batch {
 		placeholders, args := buildMySQLInsertValues(sourceColumns, []map[string]interface{}{row})
-		query := buildMySQLUpsertQuery(mapping.TargetTable, targetColumns, quoted, placeholders, mapping.TargetPrimaryKey)
+		query := buildMySQLUpsertQuery(mapping.TargetTable, targetColumns, quoted, placeholders, shardTargetIdentity(mapping))
 		if err := db.Exec(query, args...).Error; err != nil {
 			setErr := writeMySQLRowWithSetSyntax(db, mapping, sourceColumns, targetColumns, row)
 			if setErr == nil {
 				continue
 			}
-			return fmt.Errorf("%w；批量写入曾失败=%v；单行 VALUES 写入失败=%v；单行 SET 写入仍失败，主键=%v，写入字段数=%d，目标字段=%s，忽略源字段=%s。此时字段和值数量已经由 SET 语法规避，若仍为 1136，通常是目标表触发器、视图或目标端内部 INSERT 语句列数不匹配", setErr, batchErr, err, row[mapping.SourcePrimaryKey], len(targetColumns), strings.Join(targetColumns, ","), strings.Join([]string(mapping.IgnoredFields), ","))
+			return fmt.Errorf("%w；批量写入曾失败=%v；单行 VALUES 写入失败=%v；单行 SET 写入仍失败，主键=%v，写入字段数=%d，目标字段=%s，忽略源字段=%s。此时字段和值数量已经由 SET 语法规避，若仍为 1136，通常是目标表触发器、视图或目标端内部 INSERT 语句列数不匹配", setErr, batchErr, err, rowPrimaryKey(row, primaryKeyColumns(mapping.SourcePrimaryKey)), len(targetColumns), strings.Join(targetColumns, ","), strings.Join([]string(mapping.IgnoredFields), ","))
 		}
 	}
 	return nil
@@ -572,47 +640,19 @@ func writeMySQLRowWithSetSyntax(db *gorm.DB, mapping *models.SyncTaskTable, sour
 		assignments[i] = quoteMySQL(target) + "=?"
 		args = append(args, row[sourceColumns[i]])
 	}
-	updates := []string{}
-	for _, target := range targetColumns {
-		if target != mapping.TargetPrimaryKey {
-			q := quoteMySQL(target)
-			updates = append(updates, q+"=VALUES("+q+")")
-		}
-	}
-	if len(updates) == 0 {
-		q := quoteMySQL(mapping.TargetPrimaryKey)
-		updates = append(updates, q+"=VALUES("+q+")")
-	}
-	query := "INSERT INTO " + quoteMySQL(mapping.TargetTable) + " SET " + strings.Join(assignments, ",") + " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ",")
+	query := "INSERT INTO " + quoteMySQL(mapping.TargetTable) + " SET " + strings.Join(assignments, ",") + " ON DUPLICATE KEY UPDATE " + strings.Join(mysqlUpsertAssignments(targetColumns, shardTargetIdentity(mapping)), ",")
 	return db.Exec(query, args...).Error
 }
 
 func selectableSourceColumns(task *models.SyncTask, mapping *models.SyncTaskTable, db *gorm.DB) ([]string, error) {
-	columns, err := mysqlColumnNamesFromDB(db, mapping.SourceTable)
+	columns, err := mysqlColumnNamesFromDB(db, sourceTableName(mapping))
 	if err != nil {
 		return nil, err
 	}
 	columns = syncSourceColumns(mapping, columns)
-	hasPK := false
-	for _, column := range columns {
-		if column == mapping.SourcePrimaryKey {
-			hasPK = true
-			break
-		}
-	}
-	if !hasPK {
-		return nil, fmt.Errorf("同步字段缺少主键列 %s", mapping.SourcePrimaryKey)
-	}
-	if task.SyncType == "incremental" && mapping.IncrementalKey != "" {
-		hasCursor := false
-		for _, column := range columns {
-			if column == mapping.IncrementalKey {
-				hasCursor = true
-				break
-			}
-		}
-		if !hasCursor {
-			return nil, fmt.Errorf("同步字段缺少增量游标列 %s", mapping.IncrementalKey)
+	for _, pk := range primaryKeyColumns(mapping.SourcePrimaryKey) {
+		if !containsString(columns, pk) {
+			return nil, fmt.Errorf("同步字段缺少主键列 %s", pk)
 		}
 	}
 	return columns, nil
@@ -624,7 +664,7 @@ type syncColumnPair struct {
 }
 
 func syncColumnPairs(db *gorm.DB, mapping *models.SyncTaskTable, sourceColumns []string) ([]syncColumnPair, error) {
-	targetColumns, err := cachedMySQLColumnNames(db, mapping.TargetTable)
+	targetColumns, err := cachedTargetColumnNames(db, mapping.TargetTable)
 	if err != nil {
 		return nil, fmt.Errorf("读取目标表字段失败: %w", err)
 	}
@@ -648,7 +688,7 @@ func syncColumnPairs(db *gorm.DB, mapping *models.SyncTaskTable, sourceColumns [
 	return pairs, nil
 }
 
-func cachedMySQLColumnNames(db *gorm.DB, table string) ([]string, error) {
+func cachedTargetColumnNames(db *gorm.DB, table string) ([]string, error) {
 	// 缓存 key 用数据库 DSN + 表名，不用 %p 指针（事务创建的 ConnPool 每次不同导致缓存失效）
 	key := ""
 	if sqlDB, err := db.DB(); err == nil {
@@ -659,14 +699,28 @@ func cachedMySQLColumnNames(db *gorm.DB, table string) ([]string, error) {
 	if cached, ok := mysqlColumnNameCache.Load(key); ok {
 		return cached.([]string), nil
 	}
-	columns, err := mysqlColumnNamesFromDB(db, table)
+	described, err := describeTargetTable(db, table)
 	if err != nil {
 		return nil, err
 	}
+	columns := make([]string, len(described))
+	for i := range described {
+		columns[i] = described[i].Field
+	}
 	mysqlColumnNameCache.Store(key, columns)
 	return columns, nil
 }
 
+// invalidateMySQLColumnCache 在表结构变化后清理所有连接下该表的字段缓存
+func invalidateMySQLColumnCache(table string) {
+	mysqlColumnNameCache.Range(func(key, _ interface{}) bool {
+		if name := key.(string); name == table || strings.HasSuffix(name, ":"+table) {
+			mysqlColumnNameCache.Delete(key)
+		}
+		return true
+	})
+}
+
 func syncSourceColumns(mapping *models.SyncTaskTable, sourceColumns []string) []string {
 	filtered := make([]string, 0, len(sourceColumns))
 	ignored := map[string]bool{}
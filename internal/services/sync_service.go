@@ -1,8 +1,10 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
 	"regexp"
 	"strings"
 	"time"
@@ -37,17 +39,24 @@ func (s *SyncService) CreateTask(task *models.SyncTask) error {
 	if err := validateTaskExecutionSettings(task); err != nil {
 		return err
 	}
+	if err := s.ValidateBinlogPurgeEndpoints(task.SourceDB, task.TargetDB, task.BinlogPurgePolicy); err != nil {
+		return err
+	}
 	return s.systemDB.Create(task).Error
 }
 
-func (s *SyncService) CreateTaskWithTables(task *models.SyncTask, tables []models.SyncTaskTable) error {
-	if err := validateTaskTables(tables); err != nil {
+func (s *SyncService) CreateTaskWithTables(task *models.SyncTask, tables []models.SyncTaskTable, patterns []models.SyncTablePattern) error {
+	if err := validateTaskTables(tables, patterns); err != nil {
 		return err
 	}
-	first := tables[0]
-	task.SourceTable, task.TargetTable = first.SourceTable, first.TargetTable
-	if first.FieldMapping != nil {
-		task.FieldMapping = first.FieldMapping
+	if len(tables) > 0 {
+		first := tables[0]
+		task.SourceTable, task.TargetTable = first.SourceTable, first.TargetTable
+		if first.FieldMapping != nil {
+			task.FieldMapping = first.FieldMapping
+		}
+	} else {
+		task.SourceTable, task.TargetTable = patterns[0].SourcePattern, patterns[0].TargetTable
 	}
 	task.Status = 0
 	task.ValidationStatus = "pending"
@@ -64,10 +73,24 @@ func (s *SyncService) CreateTaskWithTables(task *models.SyncTask, tables []model
 	if err := validateTaskExecutionSettings(task); err != nil {
 		return err
 	}
+	if err := s.ValidateBinlogPurgeEndpoints(task.SourceDB, task.TargetDB, task.BinlogPurgePolicy); err != nil {
+		return err
+	}
 	return s.systemDB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(task).Error; err != nil {
 			return err
 		}
+		for i := range patterns {
+			patterns[i].TaskID, patterns[i].Position = task.ID, i
+		}
+		if len(patterns) > 0 {
+			if err := tx.Create(&patterns).Error; err != nil {
+				return err
+			}
+		}
+		if len(tables) == 0 {
+			return nil
+		}
 		for i := range tables {
 			tables[i].TaskID = task.ID
 			tables[i].Position = i
@@ -76,8 +99,8 @@ func (s *SyncService) CreateTaskWithTables(task *models.SyncTask, tables []model
 	})
 }
 
-func (s *SyncService) ReplaceTaskTables(taskID uint, tables []models.SyncTaskTable) error {
-	if err := validateTaskTables(tables); err != nil {
+func (s *SyncService) ReplaceTaskTables(taskID uint, tables []models.SyncTaskTable, patterns []models.SyncTablePattern) error {
+	if err := validateTaskTables(tables, patterns); err != nil {
 		return err
 	}
 	return s.systemDB.Transaction(func(tx *gorm.DB) error {
@@ -87,22 +110,39 @@ func (s *SyncService) ReplaceTaskTables(taskID uint, tables []models.SyncTaskTab
 		if err := tx.Where("task_id = ?", taskID).Delete(&models.SyncTaskTable{}).Error; err != nil {
 			return err
 		}
-		for i := range tables {
-			tables[i].TaskID, tables[i].Position = taskID, i
-		}
-		if err := tx.Create(&tables).Error; err != nil {
+		if err := tx.Where("task_id = ?", taskID).Delete(&models.SyncTablePattern{}).Error; err != nil {
 			return err
 		}
-		updates := map[string]interface{}{"source_table": tables[0].SourceTable, "target_table": tables[0].TargetTable, "field_mapping": tables[0].FieldMapping, "validation_status": "pending"}
+		for i := range patterns {
+			patterns[i].TaskID, patterns[i].Position = taskID, i
+		}
+		if len(patterns) > 0 {
+			if err := tx.Create(&patterns).Error; err != nil {
+				return err
+			}
+		}
+		updates := map[string]interface{}{"validation_status": "pending"}
+		if len(tables) > 0 {
+			for i := range tables {
+				tables[i].TaskID, tables[i].Position = taskID, i
+			}
+			if err := tx.Create(&tables).Error; err != nil {
+				return err
+			}
+			updates["source_table"], updates["target_table"], updates["field_mapping"] = tables[0].SourceTable, tables[0].TargetTable, tables[0].FieldMapping
+		} else {
+			// 分表展开的分片在预检查时生成，任务上只记录第一条规则
+			updates["source_table"], updates["target_table"], updates["field_mapping"] = patterns[0].SourcePattern, patterns[0].TargetTable, nil
+		}
 		return tx.Model(&models.SyncTask{}).Where("id = ?", taskID).Updates(updates).Error
 	})
 }
 
 var taskIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
 
-func validateTaskTables(tables []models.SyncTaskTable) error {
-	if len(tables) == 0 {
-		return fmt.Errorf("至少选择一张同步表")
+func validateTaskTables(tables []models.SyncTaskTable, patterns []models.SyncTablePattern) error {
+	if len(tables) == 0 && len(patterns) == 0 {
+		return fmt.Errorf("至少选择一张同步表或配置一条分表规则")
 	}
 	sources, targets := map[string]bool{}, map[string]bool{}
 	for i := range tables {
@@ -129,12 +169,50 @@ func validateTaskTables(tables []models.SyncTaskTable) error {
 			return fmt.Errorf("表 %s 忽略字段不正确: %w", table.SourceTable, err)
 		}
 		table.IgnoredFields = ignored
+		identity, err := normalizeRowIdentity(table.RowIdentity)
+		if err != nil {
+			return fmt.Errorf("表 %s %w", table.SourceTable, err)
+		}
+		table.RowIdentity, table.IdentityIndex = identity, strings.TrimSpace(table.IdentityIndex)
+		if identity != rowIdentityUniqueIndex {
+			table.IdentityIndex = ""
+		} else if table.IdentityIndex == "" {
+			return fmt.Errorf("表 %s 使用唯一索引作为行标识时必须指定索引名", table.SourceTable)
+		}
+		if err := validateWriteMode(table); err != nil {
+			return fmt.Errorf("表 %s %w", table.SourceTable, err)
+		}
+		if err := validateDeleteMode(table); err != nil {
+			return fmt.Errorf("表 %s %w", table.SourceTable, err)
+		}
+		filter, err := validateRowFilter(table.RowFilter)
+		if err != nil {
+			return fmt.Errorf("表 %s %w", table.SourceTable, err)
+		}
+		table.RowFilter = filter
+		if err := validateTransforms(table); err != nil {
+			return fmt.Errorf("表 %s %w", table.SourceTable, err)
+		}
+		table.IncrementalKey, table.SoftDeleteColumn = strings.TrimSpace(table.IncrementalKey), strings.TrimSpace(table.SoftDeleteColumn)
+		for _, column := range []string{table.IncrementalKey, table.SoftDeleteColumn} {
+			if column != "" && !taskIdentifierPattern.MatchString(column) {
+				return fmt.Errorf("表 %s 增量字段 %s 不合法", table.SourceTable, column)
+			}
+		}
 		confirmed, err := normalizeIdentifierPairList(table.TypeMismatchIgnores)
 		if err != nil {
 			return fmt.Errorf("表 %s 类型忽略确认不正确: %w", table.SourceTable, err)
 		}
 		table.TypeMismatchIgnores = confirmed
 	}
+	if err := validateTablePatterns(patterns); err != nil {
+		return err
+	}
+	for _, pattern := range patterns {
+		if targets[pattern.TargetTable] {
+			return fmt.Errorf("分表规则 %s 的目标表 %s 已被单表映射使用", pattern.SourcePattern, pattern.TargetTable)
+		}
+	}
 	return nil
 }
 
@@ -225,7 +303,7 @@ func (s *SyncService) ValidateTaskConnections(sourceName, targetName string) err
 }
 
 func validateTaskAlertSettings(task *models.SyncTask) error {
-	if task.SyncType != "full" && task.SyncType != "cdc" && task.SyncType != "full_cdc" {
+	if task.SyncType != "full" && task.SyncType != "cdc" && task.SyncType != "full_cdc" && task.SyncType != "incremental" {
 		return fmt.Errorf("不支持的同步类型")
 	}
 	if task.SyncType == "cdc" || task.SyncType == "full_cdc" {
@@ -240,6 +318,35 @@ func validateTaskAlertSettings(task *models.SyncTask) error {
 }
 
 func validateTaskExecutionSettings(task *models.SyncTask) error {
+	policy, err := normalizeDDLPolicy(task.DDLPolicy)
+	if err != nil {
+		return err
+	}
+	task.DDLPolicy = policy
+	mode, err := normalizeSnapshotMode(task.SnapshotMode)
+	if err != nil {
+		return err
+	}
+	if mode == snapshotModeConsistent && task.SyncType != "full_cdc" {
+		return fmt.Errorf("一致性快照仅用于全量初始化 + Binlog CDC 任务")
+	}
+	task.SnapshotMode = mode
+	applyPolicy, err := normalizeApplyErrorSettings(task.ApplyErrorPolicy, task.ApplyRetryTimes)
+	if err != nil {
+		return err
+	}
+	task.ApplyErrorPolicy = applyPolicy
+	purgePolicy, purgeColumn, err := normalizeBinlogPurgeSettings(task.BinlogPurgePolicy, task.BinlogPurgeColumn)
+	if err != nil {
+		return err
+	}
+	task.BinlogPurgePolicy, task.BinlogPurgeColumn = purgePolicy, purgeColumn
+	if purgePolicy != binlogPurgePolicyRepair {
+		task.BinlogPurgeAutoApply = false
+	}
+	if task.TransientRetries, task.TransientBackoff, err = normalizeTransientRetrySettings(task.TransientRetries, task.TransientBackoff); err != nil {
+		return err
+	}
 	if task.SyncBatchSize < 0 {
 		return fmt.Errorf("批大小不能小于 0")
 	}
@@ -261,15 +368,33 @@ func validateTaskExecutionSettings(task *models.SyncTask) error {
 	if task.SnapshotShardWorkers > 32 {
 		return fmt.Errorf("分片并发不能超过 32")
 	}
+	if task.CDCApplyWorkers < 0 || task.CDCApplyWorkers > 32 {
+		return fmt.Errorf("CDC 写入并发需在 0 到 32 之间")
+	}
+	if task.ReadRowsPerSecond < 0 || task.ReadBytesPerSecond < 0 {
+		return fmt.Errorf("读取限流不能小于 0")
+	}
 	return nil
 }
 
-func (s *SyncService) ValidateTaskExecutionConfig(batchSize, tableWorkers, shardWorkers int) error {
-	return validateTaskExecutionSettings(&models.SyncTask{
-		SyncBatchSize:        batchSize,
-		SnapshotTableWorkers: tableWorkers,
-		SnapshotShardWorkers: shardWorkers,
-	})
+// ValidateTaskExecutionConfig 校验批大小、并发和读取限流，config 只需填写这些字段
+func (s *SyncService) ValidateTaskExecutionConfig(config models.SyncTask) error {
+	return validateTaskExecutionSettings(&config)
+}
+
+// NormalizeSnapshotMode 校验全量快照方式，空值按 replay 处理
+func (s *SyncService) NormalizeSnapshotMode(mode string) (string, error) {
+	return normalizeSnapshotMode(mode)
+}
+
+// NormalizeApplyErrorPolicy 校验写入失败策略和重试次数，空值按 stop 处理
+func (s *SyncService) NormalizeApplyErrorPolicy(policy string, retryTimes int) (string, error) {
+	return normalizeApplyErrorSettings(policy, retryTimes)
+}
+
+// NormalizeDDLPolicy 校验 DDL 处理策略，空值按 ignore 处理
+func (s *SyncService) NormalizeDDLPolicy(policy string) (string, error) {
+	return normalizeDDLPolicy(policy)
 }
 
 func (s *SyncService) ValidateAlertChannelID(id uint) error {
@@ -296,7 +421,7 @@ func (s *SyncService) validateAlertChannel(id *uint) error {
 // GetTask 获取同步任务
 func (s *SyncService) GetTask(id uint) (*models.SyncTask, error) {
 	var task models.SyncTask
-	if err := s.systemDB.Preload("AlertChannel").Preload("CDCCheckpoint").Preload("TaskTables", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).First(&task, id).Error; err != nil {
+	if err := s.systemDB.Preload("AlertChannel").Preload("CDCCheckpoint").Preload("Leases").Preload("TaskTables", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).Preload("TaskTables.SchemaState").Preload("TablePatterns", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).First(&task, id).Error; err != nil {
 		return nil, err
 	}
 	return &task, nil
@@ -309,6 +434,14 @@ func (s *SyncService) UpdateTask(id uint, updates map[string]interface{}) error
 
 // DeleteTask 删除同步任务
 func (s *SyncService) DeleteTask(id uint) error {
+	var task models.SyncTask
+	var source models.DatabaseConnection
+	if s.systemDB.First(&task, id).Error == nil && s.systemDB.Where("name = ?", task.SourceDB).First(&source).Error == nil && source.Type == "postgres" {
+		// 复制槽会让源库一直保留 WAL，删除任务时一并清理；清理失败不阻止删除
+		if err := dropPostgresReplication(task.SourceDB, id); err != nil {
+			log.Printf("删除任务 %d 的复制槽和发布失败: %v", id, err)
+		}
+	}
 	return s.systemDB.Delete(&models.SyncTask{}, id).Error
 }
 
@@ -320,7 +453,7 @@ func (s *SyncService) ListTasks(page, pageSize int) ([]models.SyncTask, int64, e
 	s.systemDB.Model(&models.SyncTask{}).Count(&total)
 
 	offset := (page - 1) * pageSize
-	if err := s.systemDB.Order("id DESC").Preload("AlertChannel").Preload("CDCCheckpoint").Preload("TaskTables", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).Offset(offset).Limit(pageSize).Find(&tasks).Error; err != nil {
+	if err := s.systemDB.Order("id DESC").Preload("AlertChannel").Preload("CDCCheckpoint").Preload("TaskTables", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).Preload("TablePatterns", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).Offset(offset).Limit(pageSize).Find(&tasks).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -328,13 +461,13 @@ func (s *SyncService) ListTasks(page, pageSize int) ([]models.SyncTask, int64, e
 }
 
 // ExecuteTask 执行同步任务
-func (s *SyncService) ExecuteTask(taskID uint) error {
+func (s *SyncService) ExecuteTask(taskID uint, trigger string) error {
 	task, err := s.GetTask(taskID)
 	if err != nil {
 		return err
 	}
 	if task.SyncType == "cdc" || task.SyncType == "full_cdc" {
-		return GetCDCManager().StartTask(taskID)
+		return GetCDCManager().StartTask(taskID, trigger)
 	}
 	release, err := acquireTaskRunLock(taskID)
 	if err != nil {
@@ -359,38 +492,71 @@ func (s *SyncService) ExecuteTask(taskID uint) error {
 		_ = s.systemDB.Where("task_table_id IN (?)", s.systemDB.Model(&models.SyncTaskTable{}).Select("id").Where("task_id = ?", task.ID)).Delete(&models.SyncSnapshotShardCheckpoint{}).Error
 	}
 
+	// 轮询增量沿用上次游标，不重置检查点
+	incremental := task.SyncType == "incremental"
+	runtimeStatus, phase, label := "initializing", "snapshot", "全量初始化"
+	if incremental {
+		runtimeStatus, phase, label = "catching_up", "incremental", "增量同步"
+	}
+
 	// 更新任务状态为运行中
 	now := time.Now()
 	s.UpdateTask(taskID, map[string]interface{}{
 		"last_run_at":      &now,
 		"last_run_status":  "running",
-		"runtime_status":   "initializing",
+		"runtime_status":   runtimeStatus,
 		"phase_started_at": &now,
 	})
-	s.RecordTaskEvent(task, "snapshot_started", "snapshot", "running", "全量数据初始化开始", "", 0, 0)
+	if incremental {
+		s.RecordTaskEvent(task, "incremental_started", phase, "running", "轮询增量同步开始", "", 0, 0)
+	} else {
+		s.RecordTaskEvent(task, "snapshot_started", phase, "running", "全量数据初始化开始", "", 0, 0)
+	}
+
+	run := beginTaskRun(s.systemDB, task, trigger, incrementalRunCheckpoint(s.systemDB, task))
 
 	// 创建同步日志
 	log := &models.SyncLog{
-		TaskID: taskID, TaskName: task.Name, EventType: "snapshot_run", Phase: "snapshot",
+		TaskID: taskID, TaskName: task.Name, EventType: phase + "_run", Phase: phase,
 		Status: "running", CreatedAt: now,
 	}
 
 	startTime := time.Now()
 
-	// 执行同步
+	// 执行同步，临时故障按退避间隔重试，全量沿用分片检查点、轮询增量沿用游标继续
 	var rowsAffected int64
-	if task.ValidationStatus == "passed" && len(task.TaskTables) > 0 {
-		rowsAffected, err = s.syncValidatedTask(task)
-	} else {
-		rowsAffected, err = s.syncData(task)
+	for attempt := 1; ; attempt++ {
+		var rows int64
+		if task.ValidationStatus == "passed" && len(task.TaskTables) > 0 {
+			rows, err = s.syncValidatedTask(task)
+		} else {
+			rows, err = s.syncData(task)
+		}
+		rowsAffected += rows
+		if err == nil {
+			if attempt > 1 {
+				s.RecordTaskEvent(task, "retry_recovered", phase, "success", fmt.Sprintf("第 %d 次重试成功", attempt-1), "", 0, 0)
+			}
+			break
+		}
+		if err = s.retryTransientFailure(context.Background(), task, phase, attempt, err); err != nil {
+			break
+		}
+		s.UpdateTask(taskID, map[string]interface{}{"runtime_status": runtimeStatus, "last_run_message": fmt.Sprintf("%s第 %d 次重试", label, attempt)})
 	}
 	duration := time.Since(startTime).Milliseconds()
 
 	if err != nil {
+		if errors.Is(err, ErrTaskLeaseLost) {
+			// 任务已归其他实例，本实例只结束执行记录，不改写任务状态
+			run.finish("stopped", label+"租约失效，停止执行", err, incrementalRunCheckpoint(s.systemDB, task))
+			return err
+		}
 		if errors.Is(err, ErrTaskPaused) {
-			log.Status, log.Message, log.Duration = "success", "全量初始化已暂停", duration
+			log.Status, log.Message, log.Duration = "success", label+"已暂停", duration
 			s.systemDB.Create(log)
-			s.UpdateTask(taskID, map[string]interface{}{"last_run_status": "paused", "runtime_status": "paused", "last_run_message": "全量初始化已暂停"})
+			s.UpdateTask(taskID, map[string]interface{}{"last_run_status": "paused", "runtime_status": "paused", "last_run_message": label + "已暂停"})
+			run.finish("paused", label+"已暂停", nil, incrementalRunCheckpoint(s.systemDB, task))
 			return nil
 		}
 		// 同步失败
@@ -405,6 +571,7 @@ func (s *SyncService) ExecuteTask(taskID uint) error {
 			"runtime_status":   "failed",
 			"last_run_message": err.Error(),
 		})
+		run.finish("failed", "同步失败", err, incrementalRunCheckpoint(s.systemDB, task))
 		return err
 	}
 
@@ -415,7 +582,7 @@ func (s *SyncService) ExecuteTask(taskID uint) error {
 	log.Duration = duration
 
 	s.systemDB.Create(log)
-	s.UpdateTask(taskID, map[string]interface{}{
+	updates := map[string]interface{}{
 		"last_run_status":  "success",
 		"runtime_status":   "completed",
 		"last_run_message": fmt.Sprintf("成功同步 %d 行数据", rowsAffected),
@@ -427,8 +594,18 @@ func (s *SyncService) ExecuteTask(taskID uint) error {
 			}
 			return 0
 		}(),
-	})
-	s.RecordTaskEvent(task, "snapshot_completed", "snapshot", "success", "全量数据初始化完成", "", rowsAffected, duration)
+	}
+	if incremental {
+		// 增量任务累计各次轮询的行数
+		updates["last_run_message"] = fmt.Sprintf("本次增量同步 %d 行", rowsAffected)
+		updates["rows_processed"] = gorm.Expr("rows_processed + ?", rowsAffected)
+		s.UpdateTask(taskID, updates)
+		s.RecordTaskEvent(task, "incremental_completed", phase, "success", "轮询增量同步完成", "", rowsAffected, duration)
+	} else {
+		s.UpdateTask(taskID, updates)
+		s.RecordTaskEvent(task, "snapshot_completed", phase, "success", "全量数据初始化完成", "", rowsAffected, duration)
+	}
+	run.finish("success", fmt.Sprintf("同步 %d 行", rowsAffected), nil, incrementalRunCheckpoint(s.systemDB, task))
 	alertService := NewAlertService()
 	_ = alertService.ResolveTaskAlertSilent(taskID, "error")
 	_ = alertService.ResolveTaskAlertSilent(taskID, "delay")
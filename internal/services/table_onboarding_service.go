@@ -14,17 +14,26 @@ import (
 	"github.com/redgreat/mergewong/internal/models"
 )
 
-func (s *SyncService) AddTaskTablesOnline(taskID uint, requested []models.SyncTaskTable) ([]uint, error) {
-	if err := validateTaskTables(requested); err != nil {
+func (s *SyncService) AddTaskTablesOnline(taskID uint, requested []models.SyncTaskTable, patterns []models.SyncTablePattern) ([]uint, error) {
+	if err := validateTaskTables(requested, patterns); err != nil {
 		return nil, err
 	}
 	task, err := s.GetTask(taskID)
 	if err != nil {
 		return nil, err
 	}
+	if task.SyncType != "cdc" && task.SyncType != "full_cdc" {
+		return nil, fmt.Errorf("任务正在执行，请等待本次同步结束后再修改同步对象")
+	}
+	if !sameTablePatterns(task.TablePatterns, patterns) {
+		return nil, fmt.Errorf("运行中的任务不能修改分表规则，请先暂停任务")
+	}
 	existing := map[string]models.SyncTaskTable{}
 	for _, table := range task.TaskTables {
-		existing[table.SourceTable] = table
+		// 分表规则展开的分片由规则维护，不参与单表映射的增删校验
+		if table.PatternID == nil {
+			existing[table.SourceTable] = table
+		}
 	}
 	requestedMap := map[string]models.SyncTaskTable{}
 	for _, table := range requested {
@@ -41,12 +50,33 @@ func (s *SyncService) AddTaskTablesOnline(taskID uint, requested []models.SyncTa
 		if !reflect.DeepEqual(next.FieldMapping, old.FieldMapping) {
 			return nil, fmt.Errorf("运行中的任务不能修改表 %s 的字段映射，请先暂停任务", name)
 		}
+		if (len(next.Transforms) > 0 || len(old.Transforms) > 0) && !reflect.DeepEqual(next.Transforms, old.Transforms) {
+			return nil, fmt.Errorf("运行中的任务不能修改表 %s 的字段转换，请先暂停任务", name)
+		}
+		if !reflect.DeepEqual(next.PluginID, old.PluginID) {
+			return nil, fmt.Errorf("运行中的任务不能修改表 %s 的行处理插件，请先暂停任务", name)
+		}
+		if next.RowIdentity != old.RowIdentity || next.IdentityIndex != old.IdentityIndex {
+			return nil, fmt.Errorf("运行中的任务不能修改表 %s 的行标识方式，请先暂停任务", name)
+		}
+		if next.WriteMode != old.WriteMode || next.VersionColumn != old.VersionColumn {
+			return nil, fmt.Errorf("运行中的任务不能修改表 %s 的写入方式，请先暂停任务", name)
+		}
+		if next.DeleteMode != old.DeleteMode || next.DeleteColumn != old.DeleteColumn {
+			return nil, fmt.Errorf("运行中的任务不能修改表 %s 的删除方式，请先暂停任务", name)
+		}
+		if (len(next.RowFilter) > 0 || len(old.RowFilter) > 0) && !reflect.DeepEqual(next.RowFilter, old.RowFilter) {
+			return nil, fmt.Errorf("运行中的任务不能修改表 %s 的行过滤，请先暂停任务", name)
+		}
 	}
-	file, pos, err := currentMySQLPosition(task.SourceDB)
+	sourceDB, err := database.GetManager().GetConnection(task.SourceDB)
 	if err != nil {
 		return nil, err
 	}
-	sourceDB, err := database.GetManager().GetConnection(task.SourceDB)
+	if dialectOf(sourceDB).name() != "mysql" {
+		return nil, fmt.Errorf("PostgreSQL 源暂不支持运行中新增表，请暂停任务后修改并重新预检查")
+	}
+	file, pos, err := currentMySQLPosition(task.SourceDB)
 	if err != nil {
 		return nil, err
 	}
@@ -55,16 +85,15 @@ func (s *SyncService) AddTaskTablesOnline(taskID uint, requested []models.SyncTa
 		if _, ok := existing[table.SourceTable]; ok {
 			continue
 		}
-		columns, err := describeMySQLTable(sourceDB, table.SourceTable)
-		if err != nil {
+		if _, err := describeMySQLTable(sourceDB, table.SourceTable); err != nil {
 			return nil, fmt.Errorf("读取新增表 %s 失败: %w", table.SourceTable, err)
 		}
-		pk := primaryKeyOf(columns)
-		if pk == "" {
-			return nil, fmt.Errorf("新增表 %s 必须有单列主键", table.SourceTable)
+		pk, err := sourceRowIdentity(sourceDB, &table)
+		if err != nil {
+			return nil, fmt.Errorf("新增表 %s: %w", table.SourceTable, err)
 		}
 		table.TaskID, table.Position = taskID, len(task.TaskTables)+len(added)
-		table.SourcePrimaryKey, table.TargetPrimaryKey = pk, mappedColumn(table.FieldMapping, pk)
+		table.SourcePrimaryKey, table.TargetPrimaryKey = pk, mappedPrimaryKey(table.FieldMapping, pk)
 		table.SyncState, table.OnboardingFile, table.OnboardingPosition = "initializing", file, pos
 		table.ProgressMessage = "等待独立初始化链路启动"
 		added = append(added, table)
@@ -146,18 +175,18 @@ func (s *SyncService) runTableOnboarding(taskID uint, tableIDs []uint) {
 	if reached.Compare(finalTarget) < 0 {
 		if _, err := s.catchupTables(task, tables, reached, finalTarget); err != nil {
 			fail(err)
-			_ = GetCDCManager().StartTask(taskID)
+			_ = GetCDCManager().StartTask(taskID, RunTriggerSystem)
 			return
 		}
 	}
 	now := time.Now()
 	if err := s.systemDB.Model(&models.SyncTaskTable{}).Where("id IN ?", tableIDs).Updates(map[string]interface{}{"sync_state": "active", "progress_percent": 100, "progress_message": "已追平并合并到主同步链路", "activated_at": &now}).Error; err != nil {
 		fail(err)
-		_ = GetCDCManager().StartTask(taskID)
+		_ = GetCDCManager().StartTask(taskID, RunTriggerSystem)
 		return
 	}
 	s.RecordTaskEvent(task, "tables_merged", "object_onboarding", "success", "新增同步对象已追平并合并", fmt.Sprintf("合并位点 %s:%d", finalTarget.Name, finalTarget.Pos), initialized, 0)
-	if err := GetCDCManager().StartTask(taskID); err != nil {
+	if err := GetCDCManager().StartTask(taskID, RunTriggerSystem); err != nil {
 		fail(err)
 	}
 }
@@ -174,7 +203,7 @@ func (s *SyncService) catchupTables(task *models.SyncTask, tables []models.SyncT
 	if err != nil {
 		return start, err
 	}
-	syncer := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{ServerID: 510000 + uint32(task.ID), Flavor: "mysql", Host: source.Host, Port: uint16(source.Port), User: source.Username, Password: source.Password, Charset: source.Charset, ParseTime: true})
+	syncer := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{ServerID: binlogServerID(binlogServerIDTableOnboarding, task.ID), Flavor: "mysql", Host: source.Host, Port: uint16(source.Port), User: source.Username, Password: source.Password, Charset: source.Charset, ParseTime: true})
 	defer syncer.Close()
 	streamer, err := syncer.StartSync(start)
 	if err != nil {
@@ -182,7 +211,7 @@ func (s *SyncService) catchupTables(task *models.SyncTask, tables []models.SyncT
 	}
 	mappings := map[string]*models.SyncTaskTable{}
 	for i := range tables {
-		mappings[tables[i].SourceTable] = &tables[i]
+		mappings[cdcMappingKey(&tables[i], source.Database)] = &tables[i]
 	}
 	columns := map[string][]string{}
 	var operations []cdcOperation
@@ -198,35 +227,22 @@ func (s *SyncService) catchupTables(task *models.SyncTask, tables []models.SyncT
 		case *replication.RotateEvent:
 			current.Name = string(e.NextLogName)
 		case *replication.RowsEvent:
-			if string(e.Table.Schema) != source.Database {
-				continue
-			}
-			mapping := mappings[string(e.Table.Table)]
+			mapping := mappings[cdcTableKey(string(e.Table.Schema), string(e.Table.Table))]
 			if mapping == nil {
 				continue
 			}
-			cols := columns[mapping.SourceTable]
+			cols := columns[sourceTableName(mapping)]
 			if len(cols) == 0 {
-				cols, err = mysqlColumnNames(task.SourceDB, mapping.SourceTable)
+				cols, err = mysqlColumnNames(task.SourceDB, sourceTableName(mapping))
 				if err != nil {
 					return current, err
 				}
-				columns[mapping.SourceTable] = cols
-			}
-			switch event.Header.EventType {
-			case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
-				for _, row := range e.Rows {
-					operations = append(operations, cdcOperation{kind: "upsert", mapping: mapping, columns: cols, values: row})
-				}
-			case replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
-				for i := 1; i < len(e.Rows); i += 2 {
-					operations = append(operations, cdcOperation{kind: "upsert", mapping: mapping, columns: cols, values: e.Rows[i]})
-				}
-			case replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2:
-				for _, row := range e.Rows {
-					operations = append(operations, cdcOperation{kind: "delete", mapping: mapping, columns: cols, values: row})
+				if err := resolveRowFilterTypes(task.SourceDB, mapping); err != nil {
+					return current, err
 				}
+				columns[sourceTableName(mapping)] = cols
 			}
+			operations = appendCDCRowsOperations(operations, event.Header.EventType, mapping, cols, e.Rows, nil)
 		case *replication.XIDEvent:
 			if err := applyCDCTransaction(targetDB, operations, nil, nil, time.Time{}); err != nil {
 				return current, err
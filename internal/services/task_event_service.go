@@ -33,6 +33,8 @@ func runtimeLabel(status string) string {
 		return "增量追数"
 	case "cdc_running":
 		return "增量同步中"
+	case "retrying":
+		return "故障重试中"
 	case "paused":
 		return "暂停"
 	case "completed":
@@ -103,7 +105,7 @@ func (s *SyncService) pauseDelayUpdater(taskID uint) {
 	}
 }
 
-func (s *SyncService) ResumeTask(taskID uint) error {
+func (s *SyncService) ResumeTask(taskID uint, trigger string) error {
 	task, err := s.GetTask(taskID)
 	if err != nil {
 		return err
@@ -115,10 +117,10 @@ func (s *SyncService) ResumeTask(taskID uint) error {
 		return fmt.Errorf("任务预检查尚未通过")
 	}
 	s.RecordTaskEvent(task, "task_resumed", "control", "success", "任务开始运行", "", 0, 0)
-	return s.ExecuteTask(taskID)
+	return s.ExecuteTask(taskID, trigger)
 }
 
-func (s *SyncService) UpdateBinlogPosition(taskID uint, file string, position uint32) error {
+func (s *SyncService) UpdateBinlogPosition(taskID uint, file string, position uint32, gtidSet string) error {
 	task, err := s.GetTask(taskID)
 	if err != nil {
 		return err
@@ -129,17 +131,36 @@ func (s *SyncService) UpdateBinlogPosition(taskID uint, file string, position ui
 	if task.SyncType != "cdc" && task.SyncType != "full_cdc" {
 		return fmt.Errorf("该任务不是 Binlog CDC 任务")
 	}
-	if file == "" || position < 4 {
-		return fmt.Errorf("请填写有效的 Binlog file 和 position")
+	gtidSet = normalizeGTIDSet(gtidSet)
+	if gtidSet == "" && (file == "" || position < 4) {
+		return fmt.Errorf("请填写有效的 Binlog file 和 position 或 GTID 集合")
+	}
+	if gtidSet != "" {
+		if _, err := parseGTIDSet(gtidSet); err != nil {
+			return err
+		}
 	}
 	var checkpoint models.SyncCDCCheckpoint
 	if err := s.systemDB.Where("task_id = ?", taskID).First(&checkpoint).Error; err != nil {
 		return err
 	}
-	old := fmt.Sprintf("%s:%d", checkpoint.BinlogFile, checkpoint.BinlogPosition)
-	if err := s.systemDB.Model(&checkpoint).Updates(map[string]interface{}{"binlog_file": file, "binlog_position": position, "last_event_at": nil}).Error; err != nil {
+	if checkpoint.LSN != "" {
+		return fmt.Errorf("PostgreSQL 源按复制槽位置续传，不支持修改 Binlog 位点")
+	}
+	old := cdcCheckpointLabel(&checkpoint)
+	// 只改文件位点时清空 GTID 集合，否则下次启动仍会按旧 GTID 恢复
+	updates := map[string]interface{}{"gtid_set": gtidSet, "last_event_at": nil}
+	if file != "" && position >= 4 {
+		updates["binlog_file"] = file
+		updates["binlog_position"] = position
+		// 手工指定的位点无法确认所属源库，有 GTID 集合时下次启动按 GTID 独立读取
+		updates["server_uuid"] = ""
+		checkpoint.BinlogFile, checkpoint.BinlogPosition, checkpoint.ServerUUID = file, position, ""
+	}
+	checkpoint.GTIDSet = gtidSet
+	if err := s.systemDB.Model(&checkpoint).Updates(updates).Error; err != nil {
 		return err
 	}
-	s.RecordTaskEvent(task, "checkpoint_changed", "control", "success", "Binlog 位点已修改", fmt.Sprintf("%s → %s:%d", old, file, position), 0, 0)
+	s.RecordTaskEvent(task, "checkpoint_changed", "control", "success", "Binlog 位点已修改", fmt.Sprintf("%s → %s", old, cdcCheckpointLabel(&checkpoint)), 0, 0)
 	return nil
 }
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/database"
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 多实例高可用：任务租约存放在系统库 sync_task_leases 表中，持有实例按心跳续期。CDC 会话和单次执行在运行期间持有 run 租约，
+// 定时任务由持有 schedule 租约的实例触发，保证同一任务只在一个实例上运行。持有实例停止心跳超过租约时长后，
+// 其他实例在心跳时接管仍应运行的 CDC 任务，定时任务由下一个触发的实例接管。租约过期按实例本地时间判断，各实例需保持时钟同步。
+// 与系统库失联超过半个租约时长的实例主动停止本地 CDC 会话和单次执行，并在重新取得租约前拒绝该任务的目标端写入，
+// 避免与接管的实例重复写入。
+const (
+	taskLeaseRun      = "run"
+	taskLeaseSchedule = "schedule"
+)
+
+var ErrTaskLeaseHeld = errors.New("任务正由其他实例运行")
+
+// ErrTaskLeaseLost 表示本实例已失去任务的 run 租约，正在执行的写入应立即停止
+var ErrTaskLeaseLost = errors.New("任务租约已失效，本实例停止写入")
+
+var (
+	instanceIDOnce sync.Once
+	instanceID     string
+	heldTaskLeases sync.Map // taskLeaseKey -> struct{}
+	// fencedTasks 是失去 run 租约的任务，重新取得租约前拒绝写入目标端
+	fencedTasks sync.Map // 任务 ID -> struct{}
+)
+
+type taskLeaseKey struct {
+	taskID uint
+	kind   string
+}
+
+// InstanceID 返回当前实例 ID，取 MERGEWONG_INSTANCE_ID，未配置时为主机名；同一主机运行多个实例时需分别配置
+func InstanceID() string {
+	instanceIDOnce.Do(func() {
+		instanceID = strings.TrimSpace(os.Getenv("MERGEWONG_INSTANCE_ID"))
+		if instanceID == "" {
+			instanceID, _ = os.Hostname()
+		}
+		if instanceID == "" {
+			instanceID = "mergewong"
+		}
+	})
+	return instanceID
+}
+
+func taskLeaseTTL() time.Duration {
+	return time.Duration(envPositiveInt("MERGEWONG_LEASE_TTL_SECONDS", 30)) * time.Second
+}
+
+func taskLeaseDB() *gorm.DB {
+	db, err := database.GetManager().GetConnection("system")
+	if err != nil {
+		return nil
+	}
+	return db
+}
+
+// acquireTaskLease 获取或续期任务租约，其他实例持有且未过期时返回 ErrTaskLeaseHeld
+func acquireTaskLease(taskID uint, kind string) error {
+	db := taskLeaseDB()
+	if db == nil {
+		return nil
+	}
+	now := time.Now()
+	expires := now.Add(taskLeaseTTL())
+	lease := models.SyncTaskLease{TaskID: taskID, Kind: kind, Holder: InstanceID(), AcquiredAt: now, RenewedAt: now, ExpiresAt: expires}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&lease)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		result = db.Model(&models.SyncTaskLease{}).Where("task_id = ? AND kind = ? AND holder = ?", taskID, kind, InstanceID()).
+			Updates(map[string]interface{}{"renewed_at": now, "expires_at": expires})
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	if result.RowsAffected == 0 {
+		// 原持有实例的租约已过期时接管
+		result = db.Model(&models.SyncTaskLease{}).Where("task_id = ? AND kind = ? AND expires_at < ?", taskID, kind, now).
+			Updates(map[string]interface{}{"holder": InstanceID(), "acquired_at": now, "renewed_at": now, "expires_at": expires})
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	if result.RowsAffected == 0 {
+		var current models.SyncTaskLease
+		_ = db.Where("task_id = ? AND kind = ?", taskID, kind).First(&current).Error
+		return fmt.Errorf("%w：%s", ErrTaskLeaseHeld, current.Holder)
+	}
+	heldTaskLeases.Store(taskLeaseKey{taskID: taskID, kind: kind}, struct{}{})
+	if kind == taskLeaseRun {
+		fencedTasks.Delete(taskID)
+	}
+	return nil
+}
+
+// checkTaskLeaseFence 在本实例已失去任务的 run 租约时返回 ErrTaskLeaseLost，写入目标端前调用
+func checkTaskLeaseFence(taskID uint) error {
+	if _, fenced := fencedTasks.Load(taskID); fenced {
+		return ErrTaskLeaseLost
+	}
+	return nil
+}
+
+func releaseTaskLease(taskID uint, kind string) {
+	heldTaskLeases.Delete(taskLeaseKey{taskID: taskID, kind: kind})
+	if db := taskLeaseDB(); db != nil {
+		_ = db.Where("task_id = ? AND kind = ? AND holder = ?", taskID, kind, InstanceID()).Delete(&models.SyncTaskLease{}).Error
+	}
+}
+
+// AcquireScheduleLease 获取定时触发任务的租约，其他实例负责该任务时返回 ErrTaskLeaseHeld
+func AcquireScheduleLease(taskID uint) error {
+	return acquireTaskLease(taskID, taskLeaseSchedule)
+}
+
+// ReleaseScheduleLease 释放定时触发任务的租约，任务不再由本实例定时触发时调用
+func ReleaseScheduleLease(taskID uint) {
+	releaseTaskLease(taskID, taskLeaseSchedule)
+}
+
+// ReleaseTaskLeases 在实例关闭时释放持有的全部租约，其他实例无需等待过期即可接管
+func ReleaseTaskLeases() {
+	heldTaskLeases.Range(func(key, _ interface{}) bool {
+		heldTaskLeases.Delete(key)
+		return true
+	})
+	if db := taskLeaseDB(); db != nil {
+		_ = db.Where("holder = ?", InstanceID()).Delete(&models.SyncTaskLease{}).Error
+	}
+}
+
+// StartTaskLeaseKeeper 清理本实例上次运行遗留的租约和未结束的执行记录并开始心跳，需在恢复 CDC 任务和启动定时任务前调用
+func StartTaskLeaseKeeper() {
+	db := taskLeaseDB()
+	if db == nil {
+		return
+	}
+	if err := db.Where("holder = ?", InstanceID()).Delete(&models.SyncTaskLease{}).Error; err != nil {
+		log.Printf("清理遗留任务租约失败: %v", err)
+	}
+	closeInterruptedTaskRuns(db)
+	log.Printf("实例 %s 已启动任务租约心跳", InstanceID())
+	go GetCDCManager().keepTaskLeases(db)
+}
+
+func (m *CDCManager) keepTaskLeases(db *gorm.DB) {
+	ttl := taskLeaseTTL()
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	renewedAt := time.Now()
+	for range ticker.C {
+		// 续期超时不超过心跳间隔，失联超过半个租约时长即隔离，其他实例最早在租约到期后才会接管
+		attempt := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), ttl/3)
+		err := m.renewTaskLeases(db.WithContext(ctx), ttl)
+		cancel()
+		if err != nil {
+			log.Printf("续期任务租约失败: %v", err)
+			if time.Since(renewedAt) >= ttl/2 {
+				m.fenceTaskLeases()
+			}
+			continue
+		}
+		renewedAt = attempt
+		m.stopPausedWorkers(db, ttl/3)
+		m.adoptOrphanTasks(db)
+	}
+}
+
+// renewTaskLeases 续期本实例的租约，并停止租约已被其他实例接管的本地 CDC 会话
+func (m *CDCManager) renewTaskLeases(db *gorm.DB, ttl time.Duration) error {
+	var held []taskLeaseKey
+	heldTaskLeases.Range(func(key, _ interface{}) bool {
+		held = append(held, key.(taskLeaseKey))
+		return true
+	})
+	now := time.Now()
+	if err := db.Model(&models.SyncTaskLease{}).Where("holder = ?", InstanceID()).
+		Updates(map[string]interface{}{"renewed_at": now, "expires_at": now.Add(ttl)}).Error; err != nil {
+		return err
+	}
+	var leases []models.SyncTaskLease
+	if err := db.Select("task_id, kind").Where("holder = ?", InstanceID()).Find(&leases).Error; err != nil {
+		return err
+	}
+	current := make(map[taskLeaseKey]bool, len(leases))
+	for _, lease := range leases {
+		current[taskLeaseKey{taskID: lease.TaskID, kind: lease.Kind}] = true
+	}
+	for _, key := range held {
+		if _, still := heldTaskLeases.Load(key); still && !current[key] {
+			m.loseTaskLease(key)
+		}
+	}
+	return nil
+}
+
+func (m *CDCManager) loseTaskLease(key taskLeaseKey) {
+	heldTaskLeases.Delete(key)
+	log.Printf("任务 %d 的 %s 租约已被其他实例接管", key.taskID, key.kind)
+	if key.kind != taskLeaseRun {
+		return
+	}
+	fencedTasks.Store(key.taskID, struct{}{})
+	if !m.IsRunning(key.taskID) {
+		return
+	}
+	// 停止会等待会话退出，放到心跳之外执行，期间写入已被拒绝
+	go func() {
+		m.StopTask(key.taskID)
+		if task, err := m.service.GetTask(key.taskID); err == nil {
+			m.service.RecordTaskEvent(task, "lease_lost", "cdc", "success", "任务已由其他实例接管，本实例停止 CDC 会话", "实例 "+InstanceID(), 0, 0)
+		}
+	}()
+}
+
+// localWorkers 返回本实例启动超过 minAge 的 CDC 会话
+func (m *CDCManager) localWorkers(minAge time.Duration) []uint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	taskIDs := make([]uint, 0, len(m.workers))
+	for taskID, worker := range m.workers {
+		if time.Since(worker.startedAt) >= minAge {
+			taskIDs = append(taskIDs, taskID)
+		}
+	}
+	return taskIDs
+}
+
+// stopPausedWorkers 停止在其他实例上被暂停的本地 CDC 会话；刚启动的会话尚未写入运行状态，跳过
+func (m *CDCManager) stopPausedWorkers(db *gorm.DB, minAge time.Duration) {
+	taskIDs := m.localWorkers(minAge)
+	if len(taskIDs) == 0 {
+		return
+	}
+	var paused []uint
+	if err := db.Model(&models.SyncTask{}).Where("id IN ? AND runtime_status IN ?", taskIDs, []string{"paused", "stopped"}).Pluck("id", &paused).Error; err != nil {
+		return
+	}
+	for _, taskID := range paused {
+		log.Printf("CDC 任务 %d 已在其他实例上暂停，停止本地会话", taskID)
+		go m.StopTask(taskID)
+	}
+}
+
+// fenceTaskLeases 与系统库失联超过半个租约时长时拒绝本实例全部任务的写入，并停止本地 CDC 会话；
+// 持有 run 租约的单次执行在下一次写入或暂停检查时以 ErrTaskLeaseLost 结束
+func (m *CDCManager) fenceTaskLeases() {
+	taskIDs := m.localWorkers(0)
+	for _, taskID := range taskIDs {
+		fencedTasks.Store(taskID, struct{}{})
+	}
+	heldTaskLeases.Range(func(key, _ interface{}) bool {
+		if lease := key.(taskLeaseKey); lease.kind == taskLeaseRun {
+			fencedTasks.Store(lease.taskID, struct{}{})
+		}
+		heldTaskLeases.Delete(key)
+		return true
+	})
+	if len(taskIDs) > 0 {
+		log.Printf("与系统库失联超过半个租约时长，停止本实例的 %d 个 CDC 任务", len(taskIDs))
+	}
+	for _, taskID := range taskIDs {
+		go m.StopTask(taskID)
+	}
+}
+
+// adoptOrphanTasks 接管仍应运行、但 run 租约已过期或已释放的 CDC 任务
+func (m *CDCManager) adoptOrphanTasks(db *gorm.DB) {
+	var tasks []models.SyncTask
+	if err := db.Select("id").
+		Where("status = ? AND validation_status = ? AND sync_type IN ? AND runtime_status IN ?", 1, "passed", []string{"cdc", "full_cdc"}, cdcResumeRuntimeStatuses).
+		Order("id").Find(&tasks).Error; err != nil {
+		return
+	}
+	now := time.Now()
+	for _, task := range tasks {
+		if _, pending := m.resuming.Load(task.ID); pending || m.IsRunning(task.ID) {
+			continue
+		}
+		var lease models.SyncTaskLease
+		err := db.Where("task_id = ? AND kind = ?", task.ID, taskLeaseRun).First(&lease).Error
+		if err == nil && lease.ExpiresAt.After(now) {
+			continue
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		message := "接管未在运行的 CDC 任务"
+		if lease.Holder != "" {
+			message = fmt.Sprintf("实例 %s 的租约已过期，接管 CDC 同步", lease.Holder)
+		}
+		m.resumeCDCTask(task.ID, message)
+	}
+}
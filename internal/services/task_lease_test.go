@@ -0,0 +1,30 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFenceTaskLeasesBlocksWrites(t *testing.T) {
+	m := &CDCManager{workers: map[uint]cdcWorker{}}
+	held := taskLeaseKey{taskID: 91, kind: taskLeaseRun}
+	schedule := taskLeaseKey{taskID: 92, kind: taskLeaseSchedule}
+	heldTaskLeases.Store(held, struct{}{})
+	heldTaskLeases.Store(schedule, struct{}{})
+	defer fencedTasks.Delete(held.taskID)
+
+	m.fenceTaskLeases()
+
+	if err := checkTaskLeaseFence(held.taskID); !errors.Is(err, ErrTaskLeaseLost) {
+		t.Fatalf("run lease holder should be fenced, got %v", err)
+	}
+	if err := checkTaskLeaseFence(schedule.taskID); err != nil {
+		t.Fatalf("schedule-only task should not be fenced, got %v", err)
+	}
+	if _, ok := heldTaskLeases.Load(held); ok {
+		t.Fatalf("fenced leases should no longer be considered held")
+	}
+	if err := checkTaskPaused(nil, held.taskID); !errors.Is(err, ErrTaskLeaseLost) {
+		t.Fatalf("batch runs should stop at the next pause check, got %v", err)
+	}
+}
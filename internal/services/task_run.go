@@ -0,0 +1,213 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+	"gorm.io/gorm"
+)
+
+// 任务执行记录：全量、轮询增量每执行一次、CDC 每启动一次会话各记一行，记录触发方式、起止检查点、
+// 各表写入行数、数据量和死信数。写入时先在内存累计，长时间运行的会话按间隔落盘。
+
+const (
+	RunTriggerManual   = "manual"
+	RunTriggerCron     = "cron"
+	RunTriggerRecovery = "recovery"
+	RunTriggerSystem   = "system"
+
+	taskRunFlushInterval = 30 * time.Second
+)
+
+var activeTaskRuns sync.Map // 任务 ID -> *taskRun
+
+type taskRun struct {
+	systemDB *gorm.DB
+	mu       sync.Mutex
+	record   models.SyncTaskRun
+	flushed  time.Time
+}
+
+// beginTaskRun 创建执行记录并登记为任务当前的执行，同一任务的上一条记录不再累计
+func beginTaskRun(systemDB *gorm.DB, task *models.SyncTask, trigger, startCheckpoint string) *taskRun {
+	run := &taskRun{systemDB: systemDB, flushed: time.Now(), record: models.SyncTaskRun{
+		TaskID: task.ID, RunType: task.SyncType, Trigger: trigger, Status: "running", Instance: InstanceID(),
+		StartedAt: time.Now(), TableRows: models.RunTableRows{}, StartCheckpoint: startCheckpoint,
+	}}
+	if systemDB == nil || systemDB.Create(&run.record).Error != nil {
+		return nil
+	}
+	activeTaskRuns.Store(task.ID, run)
+	return run
+}
+
+// recordRunRows 把写入目标的行数和数据量记到任务当前的执行记录
+func recordRunRows(taskID uint, table string, rows int, bytes int64) {
+	value, ok := activeTaskRuns.Load(taskID)
+	if !ok || rows <= 0 {
+		return
+	}
+	run := value.(*taskRun)
+	run.mu.Lock()
+	run.record.RowsTotal += int64(rows)
+	run.record.Bytes += bytes
+	run.record.TableRows[table] += int64(rows)
+	flush := time.Since(run.flushed) >= taskRunFlushInterval
+	run.mu.Unlock()
+	if flush {
+		run.flush(nil)
+	}
+}
+
+// recordCDCRunRows 按表汇总一批已提交的行操作
+func recordCDCRunRows(taskID uint, operations []cdcOperation) {
+	if _, ok := activeTaskRuns.Load(taskID); !ok {
+		return
+	}
+	rows, bytes := map[string]int{}, map[string]int64{}
+	for _, op := range operations {
+		table := sourceTableName(op.mapping)
+		rows[table]++
+		for _, value := range op.values {
+			bytes[table] += valueBytes(value)
+		}
+	}
+	for table, count := range rows {
+		recordRunRows(taskID, table, count, bytes[table])
+	}
+}
+
+// recordRunError 累计任务当前执行中记入死信的行数
+func recordRunError(taskID uint) {
+	if value, ok := activeTaskRuns.Load(taskID); ok {
+		run := value.(*taskRun)
+		run.mu.Lock()
+		run.record.ErrorCount++
+		run.mu.Unlock()
+	}
+}
+
+func (r *taskRun) flush(extra map[string]interface{}) {
+	r.mu.Lock()
+	updates := map[string]interface{}{
+		"rows_total":  r.record.RowsTotal,
+		"bytes":       r.record.Bytes,
+		"error_count": r.record.ErrorCount,
+		"duration_ms": time.Since(r.record.StartedAt).Milliseconds(),
+	}
+	for key, value := range extra {
+		updates[key] = value
+	}
+	r.flushed = time.Now()
+	// 复制一份表行数，避免落盘序列化时与写入协程并发访问
+	tableRows := make(models.RunTableRows, len(r.record.TableRows))
+	for table, rows := range r.record.TableRows {
+		tableRows[table] = rows
+	}
+	updates["table_rows"] = tableRows
+	r.mu.Unlock()
+	_ = r.systemDB.Model(&models.SyncTaskRun{}).Where("id = ?", r.record.ID).Updates(updates).Error
+}
+
+// finish 结束执行记录，status 为 success、failed、paused 或 stopped
+func (r *taskRun) finish(status, message string, runErr error, endCheckpoint string) {
+	if r == nil {
+		return
+	}
+	activeTaskRuns.CompareAndDelete(r.record.TaskID, r)
+	now := time.Now()
+	extra := map[string]interface{}{"status": status, "message": message, "finished_at": &now, "end_checkpoint": endCheckpoint}
+	if runErr != nil {
+		extra["error_detail"] = runErr.Error()
+	}
+	r.flush(extra)
+}
+
+// closeInterruptedTaskRuns 把本实例上次运行时未结束的执行记录标记为 interrupted，需在恢复任务前调用
+func closeInterruptedTaskRuns(systemDB *gorm.DB) {
+	var runs []models.SyncTaskRun
+	if err := systemDB.Where("instance = ? AND status = ?", InstanceID(), "running").Find(&runs).Error; err != nil {
+		log.Printf("查询未结束的执行记录失败: %v", err)
+		return
+	}
+	for _, run := range runs {
+		now := time.Now()
+		checkpoint := ""
+		var task models.SyncTask
+		if systemDB.Preload("TaskTables").First(&task, run.TaskID).Error == nil {
+			if run.RunType == "full_cdc" || run.RunType == "cdc" {
+				checkpoint = cdcRunCheckpoint(systemDB, task.ID)
+			} else {
+				checkpoint = incrementalRunCheckpoint(systemDB, &task)
+			}
+		}
+		updates := map[string]interface{}{"status": "interrupted", "message": "实例重启，执行中断", "finished_at": &now, "end_checkpoint": checkpoint}
+		if now.After(run.StartedAt) {
+			updates["duration_ms"] = now.Sub(run.StartedAt).Milliseconds()
+		}
+		if err := systemDB.Model(&models.SyncTaskRun{}).Where("id = ? AND status = ?", run.ID, "running").Updates(updates).Error; err != nil {
+			log.Printf("标记执行记录 %d 中断失败: %v", run.ID, err)
+		}
+	}
+}
+
+// cdcRunCheckpoint 读取任务当前的 CDC 检查点描述
+func cdcRunCheckpoint(systemDB *gorm.DB, taskID uint) string {
+	var checkpoint models.SyncCDCCheckpoint
+	if err := systemDB.Where("task_id = ?", taskID).First(&checkpoint).Error; err != nil {
+		return ""
+	}
+	return cdcCheckpointLabel(&checkpoint)
+}
+
+// incrementalRunCheckpoint 汇总轮询增量各表的游标，全量任务没有跨次保留的位点
+func incrementalRunCheckpoint(systemDB *gorm.DB, task *models.SyncTask) string {
+	if task.SyncType != "incremental" {
+		return ""
+	}
+	names := map[uint]string{}
+	ids := make([]uint, 0, len(task.TaskTables))
+	for _, table := range task.TaskTables {
+		names[table.ID] = table.SourceTable
+		ids = append(ids, table.ID)
+	}
+	var checkpoints []models.SyncCheckpoint
+	if len(ids) == 0 || systemDB.Where("task_table_id IN ?", ids).Find(&checkpoints).Error != nil {
+		return ""
+	}
+	parts := make([]string, 0, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		if checkpoint.CursorValue == "" && checkpoint.CursorPrimaryKey == "" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s/%s", names[checkpoint.TaskTableID], checkpoint.CursorValue, checkpoint.CursorPrimaryKey))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "; ")
+}
+
+// ListTaskRuns 分页查询任务的执行记录，最近的在前
+func (s *SyncService) ListTaskRuns(taskID uint, page, pageSize int) ([]models.SyncTaskRun, int64, error) {
+	var total int64
+	query := s.systemDB.Model(&models.SyncTaskRun{}).Where("task_id = ?", taskID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var runs []models.SyncTaskRun
+	err := query.Order("started_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&runs).Error
+	return runs, total, err
+}
+
+// GetTaskRun 返回一条执行记录
+func (s *SyncService) GetTaskRun(taskID, runID uint) (*models.SyncTaskRun, error) {
+	var run models.SyncTaskRun
+	if err := s.systemDB.Where("id = ? AND task_id = ?", runID, taskID).First(&run).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
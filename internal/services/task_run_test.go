@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestRecordRunRows(t *testing.T) {
+	run := &taskRun{flushed: time.Now(), record: models.SyncTaskRun{TaskID: 9001, TableRows: models.RunTableRows{}}}
+	activeTaskRuns.Store(uint(9001), run)
+	defer activeTaskRuns.Delete(uint(9001))
+
+	recordRunRows(9001, "orders", 3, 120)
+	recordRunRows(9001, "orders", 2, 80)
+	recordRunRows(9001, "users", 1, 10)
+	recordRunRows(9001, "users", 0, 10)
+	recordRunRows(9002, "orders", 5, 50)
+	recordRunError(9001)
+
+	if run.record.RowsTotal != 6 || run.record.Bytes != 210 || run.record.ErrorCount != 1 {
+		t.Fatalf("totals = %d rows %d bytes %d errors", run.record.RowsTotal, run.record.Bytes, run.record.ErrorCount)
+	}
+	if run.record.TableRows["orders"] != 5 || run.record.TableRows["users"] != 1 {
+		t.Fatalf("table rows = %v", run.record.TableRows)
+	}
+}
+
+func TestRecordCDCRunRowsPerShard(t *testing.T) {
+	run := &taskRun{flushed: time.Now(), record: models.SyncTaskRun{TaskID: 9003, TableRows: models.RunTableRows{}}}
+	activeTaskRuns.Store(uint(9003), run)
+	defer activeTaskRuns.Delete(uint(9003))
+
+	shardA := &models.SyncTaskTable{SourceSchema: "shop_a", SourceTable: "orders", TargetTable: "orders"}
+	shardB := &models.SyncTaskTable{SourceSchema: "shop_b", SourceTable: "orders", TargetTable: "orders"}
+	recordCDCRunRows(9003, []cdcOperation{
+		{kind: "upsert", mapping: shardA, values: []interface{}{1}},
+		{kind: "upsert", mapping: shardA, values: []interface{}{2}},
+		{kind: "delete", mapping: shardB, values: []interface{}{3}},
+	})
+
+	if run.record.TableRows["shop_a.orders"] != 2 || run.record.TableRows["shop_b.orders"] != 1 {
+		t.Fatalf("table rows = %v", run.record.TableRows)
+	}
+}
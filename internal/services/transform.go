@@ -0,0 +1,640 @@
+package services
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+// 字段转换表达式按目标字段配置，表达式使用 Go 表达式语法引用源字段名，例如 upper(trim(name))、
+// mask(phone, 3, 4)、concat(first_name, " ", last_name)。目标字段有对应源字段时替换该字段的值，
+// 否则作为计算列写入。表达式只允许字面量、字段、运算符和白名单函数，没有循环和副作用；
+// 全量、CDC、补数写入和数据比对都经过同一转换，比对不会把转换后的字段报告为不一致。
+
+// transformSourcePrefix 是计算列在写入行中的内部列名前缀，不会与真实字段冲突
+const transformSourcePrefix = "\x00transform:"
+
+var transformFunctions = map[string][2]int{
+	// 函数名: {最少参数, 最多参数}，-1 表示不限
+	"trim": {1, 1}, "upper": {1, 1}, "lower": {1, 1}, "len": {1, 1},
+	"substr": {2, 3}, "replace": {3, 3}, "concat": {1, -1}, "coalesce": {1, -1}, "iif": {3, 3},
+	"md5": {1, 1}, "sha1": {1, 1}, "sha256": {1, 1}, "mask": {3, 3},
+	"convert_tz": {3, 3}, "string": {1, 1}, "int": {1, 1}, "float": {1, 1}, "round": {1, 2},
+}
+
+var transformCache sync.Map
+
+// parseTransform 解析并校验表达式，返回表达式引用的源字段
+func parseTransform(expression string) (ast.Expr, []string, error) {
+	if cached, ok := transformCache.Load(expression); ok {
+		entry := cached.(parsedTransform)
+		return entry.expr, entry.columns, entry.err
+	}
+	expr, err := parser.ParseExpr(expression)
+	var columns []string
+	if err == nil {
+		columns, err = checkTransformNode(expr, nil)
+	}
+	transformCache.Store(expression, parsedTransform{expr: expr, columns: columns, err: err})
+	return expr, columns, err
+}
+
+type parsedTransform struct {
+	expr    ast.Expr
+	columns []string
+	err     error
+}
+
+func checkTransformNode(node ast.Expr, columns []string) ([]string, error) {
+	var err error
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		if n.Kind == token.IMAG || n.Kind == token.CHAR {
+			return nil, fmt.Errorf("不支持的字面量: %s", n.Value)
+		}
+	case *ast.Ident:
+		if n.Name != "nil" && n.Name != "true" && n.Name != "false" && !containsString(columns, n.Name) {
+			columns = append(columns, n.Name)
+		}
+	case *ast.ParenExpr:
+		return checkTransformNode(n.X, columns)
+	case *ast.UnaryExpr:
+		if n.Op != token.SUB && n.Op != token.NOT {
+			return nil, fmt.Errorf("不支持的运算符: %s", n.Op)
+		}
+		return checkTransformNode(n.X, columns)
+	case *ast.BinaryExpr:
+		switch n.Op {
+		case token.ADD, token.SUB, token.MUL, token.QUO, token.REM, token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ, token.LAND, token.LOR:
+		default:
+			return nil, fmt.Errorf("不支持的运算符: %s", n.Op)
+		}
+		if columns, err = checkTransformNode(n.X, columns); err != nil {
+			return nil, err
+		}
+		return checkTransformNode(n.Y, columns)
+	case *ast.CallExpr:
+		name, ok := n.Fun.(*ast.Ident)
+		if !ok {
+			return nil, fmt.Errorf("只能调用内置函数")
+		}
+		arity, ok := transformFunctions[name.Name]
+		if !ok {
+			return nil, fmt.Errorf("不支持的函数: %s", name.Name)
+		}
+		if len(n.Args) < arity[0] || (arity[1] >= 0 && len(n.Args) > arity[1]) || n.Ellipsis.IsValid() {
+			return nil, fmt.Errorf("函数 %s 参数个数不正确", name.Name)
+		}
+		for _, arg := range n.Args {
+			if columns, err = checkTransformNode(arg, columns); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("不支持的表达式")
+	}
+	return columns, nil
+}
+
+// validateTransforms 规范化表映射的字段转换，目标字段名和表达式都不能为空
+func validateTransforms(table *models.SyncTaskTable) error {
+	if len(table.Transforms) == 0 {
+		table.Transforms = nil
+		return nil
+	}
+	if table.RowIdentity == rowIdentityFullRow {
+		return fmt.Errorf("整行匹配模式按源字段值删除目标行，不能使用字段转换")
+	}
+	normalized := make(models.FieldMapping, len(table.Transforms))
+	for target, expression := range table.Transforms {
+		target, expression = strings.TrimSpace(target), strings.TrimSpace(expression)
+		if !taskIdentifierPattern.MatchString(target) {
+			return fmt.Errorf("转换目标字段 %s 不合法", target)
+		}
+		if _, _, err := parseTransform(expression); err != nil {
+			return fmt.Errorf("字段 %s 转换表达式不正确: %w", target, err)
+		}
+		normalized[target] = expression
+	}
+	table.Transforms = normalized
+	return nil
+}
+
+// withTransformPairs 为没有对应源字段的转换目标追加计算列
+func withTransformPairs(mapping *models.SyncTaskTable, pairs []syncColumnPair) []syncColumnPair {
+	for _, target := range sortedTransformTargets(mapping) {
+		mapped := false
+		for _, pair := range pairs {
+			if pair.target == target {
+				mapped = true
+				break
+			}
+		}
+		if !mapped {
+			pairs = append(pairs, syncColumnPair{source: transformSourcePrefix + target, target: target})
+		}
+	}
+	return pairs
+}
+
+func sortedTransformTargets(mapping *models.SyncTaskTable) []string {
+	targets := make([]string, 0, len(mapping.Transforms))
+	for target := range mapping.Transforms {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// applyTransforms 按转换表达式计算每行写入值，表达式始终基于源行原值求值
+func applyTransforms(mapping *models.SyncTaskTable, pairs []syncColumnPair, batch []map[string]interface{}) ([]map[string]interface{}, error) {
+	if len(mapping.Transforms) == 0 {
+		return batch, nil
+	}
+	rows := make([]map[string]interface{}, len(batch))
+	for i, row := range batch {
+		transformed, err := transformRow(mapping, pairs, row)
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = transformed
+	}
+	return rows, nil
+}
+
+func transformRow(mapping *models.SyncTaskTable, pairs []syncColumnPair, row map[string]interface{}) (map[string]interface{}, error) {
+	if len(mapping.Transforms) == 0 || row == nil {
+		return row, nil
+	}
+	copied := make(map[string]interface{}, len(row)+len(mapping.Transforms))
+	for column, v := range row {
+		copied[column] = v
+	}
+	for _, pair := range pairs {
+		expression, ok := mapping.Transforms[pair.target]
+		if !ok {
+			continue
+		}
+		expr, _, err := parseTransform(expression)
+		if err != nil {
+			return nil, fmt.Errorf("字段 %s 转换表达式不正确: %w", pair.target, err)
+		}
+		value, err := evalTransform(expr, row)
+		if err != nil {
+			return nil, fmt.Errorf("字段 %s 转换失败: %w", pair.target, err)
+		}
+		copied[pair.source] = value
+	}
+	return copied, nil
+}
+
+func evalTransform(node ast.Expr, row map[string]interface{}) (interface{}, error) {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		switch n.Kind {
+		case token.INT:
+			return strconv.ParseInt(n.Value, 0, 64)
+		case token.FLOAT:
+			return strconv.ParseFloat(n.Value, 64)
+		default:
+			return strconv.Unquote(n.Value)
+		}
+	case *ast.Ident:
+		switch n.Name {
+		case "nil":
+			return nil, nil
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return transformValue(row[n.Name]), nil
+	case *ast.ParenExpr:
+		return evalTransform(n.X, row)
+	case *ast.UnaryExpr:
+		value, err := evalTransform(n.X, row)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		if n.Op == token.NOT {
+			return !transformTruthy(value), nil
+		}
+		return transformArithmetic(token.SUB, int64(0), value)
+	case *ast.BinaryExpr:
+		left, err := evalTransform(n.X, row)
+		if err != nil {
+			return nil, err
+		}
+		if n.Op == token.LAND && !transformTruthy(left) {
+			return false, nil
+		}
+		if n.Op == token.LOR && transformTruthy(left) {
+			return true, nil
+		}
+		right, err := evalTransform(n.Y, row)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case token.LAND, token.LOR:
+			return transformTruthy(right), nil
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return transformCompare(n.Op, left, right), nil
+		}
+		return transformArithmetic(n.Op, left, right)
+	case *ast.CallExpr:
+		name := n.Fun.(*ast.Ident).Name
+		if name == "iif" {
+			condition, err := evalTransform(n.Args[0], row)
+			if err != nil {
+				return nil, err
+			}
+			if transformTruthy(condition) {
+				return evalTransform(n.Args[1], row)
+			}
+			return evalTransform(n.Args[2], row)
+		}
+		args := make([]interface{}, len(n.Args))
+		for i, arg := range n.Args {
+			value, err := evalTransform(arg, row)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+		return callTransform(name, args)
+	}
+	return nil, fmt.Errorf("不支持的表达式")
+}
+
+// transformValue 统一源库读出的值：字节转字符串，整数统一为 int64
+func transformValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return value
+}
+
+func transformTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != "" && v != "0"
+	}
+	if number, ok := transformNumber(value); ok {
+		return number != 0
+	}
+	return true
+}
+
+func transformNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+func transformString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+func transformCompare(op token.Token, left, right interface{}) bool {
+	if left == nil || right == nil {
+		equal := left == nil && right == nil
+		if op == token.EQL {
+			return equal
+		}
+		return op == token.NEQ && !equal
+	}
+	cmp := 0
+	leftNumber, leftOK := transformNumber(left)
+	rightNumber, rightOK := transformNumber(right)
+	if leftOK && rightOK {
+		switch {
+		case leftNumber < rightNumber:
+			cmp = -1
+		case leftNumber > rightNumber:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(transformString(left), transformString(right))
+	}
+	switch op {
+	case token.EQL:
+		return cmp == 0
+	case token.NEQ:
+		return cmp != 0
+	case token.LSS:
+		return cmp < 0
+	case token.LEQ:
+		return cmp <= 0
+	case token.GTR:
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// transformArithmetic 计算四则运算：任一侧为 NULL 结果为 NULL；+ 任一侧为字符串时拼接；整数运算保持整数
+func transformArithmetic(op token.Token, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	_, leftText := left.(string)
+	_, rightText := right.(string)
+	if op == token.ADD && (leftText || rightText) {
+		return transformString(left) + transformString(right), nil
+	}
+	leftInt, leftIsInt := left.(int64)
+	rightInt, rightIsInt := right.(int64)
+	if leftIsInt && rightIsInt && op != token.QUO {
+		switch op {
+		case token.ADD:
+			return leftInt + rightInt, nil
+		case token.SUB:
+			return leftInt - rightInt, nil
+		case token.MUL:
+			return leftInt * rightInt, nil
+		case token.REM:
+			if rightInt == 0 {
+				return nil, nil
+			}
+			return leftInt % rightInt, nil
+		}
+	}
+	leftNumber, leftOK := transformNumber(left)
+	rightNumber, rightOK := transformNumber(right)
+	if !leftOK || !rightOK {
+		return nil, fmt.Errorf("%v %s %v 不是数值运算", left, op, right)
+	}
+	switch op {
+	case token.ADD:
+		return leftNumber + rightNumber, nil
+	case token.SUB:
+		return leftNumber - rightNumber, nil
+	case token.MUL:
+		return leftNumber * rightNumber, nil
+	case token.QUO:
+		if rightNumber == 0 {
+			return nil, nil
+		}
+		return leftNumber / rightNumber, nil
+	}
+	if rightNumber == 0 {
+		return nil, nil
+	}
+	return math.Mod(leftNumber, rightNumber), nil
+}
+
+func callTransform(name string, args []interface{}) (interface{}, error) {
+	switch name {
+	case "concat":
+		// 与 CONCAT_WS 一致跳过 NULL，便于拼接可空字段
+		var builder strings.Builder
+		for _, arg := range args {
+			builder.WriteString(transformString(arg))
+		}
+		return builder.String(), nil
+	case "coalesce":
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	text := transformString(args[0])
+	switch name {
+	case "trim":
+		return strings.TrimSpace(text), nil
+	case "upper":
+		return strings.ToUpper(text), nil
+	case "lower":
+		return strings.ToLower(text), nil
+	case "len":
+		return int64(len([]rune(text))), nil
+	case "substr":
+		return transformSubstr(text, args[1:])
+	case "replace":
+		return strings.ReplaceAll(text, transformString(args[1]), transformString(args[2])), nil
+	case "md5":
+		sum := md5.Sum([]byte(text))
+		return hex.EncodeToString(sum[:]), nil
+	case "sha1":
+		sum := sha1.Sum([]byte(text))
+		return hex.EncodeToString(sum[:]), nil
+	case "sha256":
+		sum := sha256.Sum256([]byte(text))
+		return hex.EncodeToString(sum[:]), nil
+	case "mask":
+		return transformMask(text, args[1], args[2])
+	case "convert_tz":
+		return transformConvertTZ(args[0], transformString(args[1]), transformString(args[2]))
+	case "string":
+		return text, nil
+	case "int":
+		number, ok := transformNumber(args[0])
+		if !ok {
+			return nil, fmt.Errorf("%q 不是数值", text)
+		}
+		return int64(number), nil
+	case "float":
+		number, ok := transformNumber(args[0])
+		if !ok {
+			return nil, fmt.Errorf("%q 不是数值", text)
+		}
+		return number, nil
+	case "round":
+		number, ok := transformNumber(args[0])
+		if !ok {
+			return nil, fmt.Errorf("%q 不是数值", text)
+		}
+		places := 0.0
+		if len(args) > 1 {
+			places, _ = transformNumber(args[1])
+		}
+		scale := math.Pow(10, math.Trunc(places))
+		return math.Round(number*scale) / scale, nil
+	}
+	return nil, fmt.Errorf("不支持的函数: %s", name)
+}
+
+// transformSubstr 与 SQL SUBSTRING 一致，起始位置从 1 开始，按字符计算
+func transformSubstr(text string, args []interface{}) (interface{}, error) {
+	runes := []rune(text)
+	start, ok := transformNumber(args[0])
+	if !ok {
+		return nil, fmt.Errorf("substr 起始位置不是数值")
+	}
+	from := int(start) - 1
+	if from < 0 {
+		from = 0
+	}
+	if from > len(runes) {
+		return "", nil
+	}
+	to := len(runes)
+	if len(args) > 1 {
+		length, ok := transformNumber(args[1])
+		if !ok {
+			return nil, fmt.Errorf("substr 长度不是数值")
+		}
+		if from+int(length) < to {
+			to = from + int(length)
+		}
+	}
+	if to < from {
+		return "", nil
+	}
+	return string(runes[from:to]), nil
+}
+
+// transformMask 保留前 keepStart 和后 keepEnd 个字符，其余替换为 *
+func transformMask(text string, keepStart, keepEnd interface{}) (interface{}, error) {
+	start, startOK := transformNumber(keepStart)
+	end, endOK := transformNumber(keepEnd)
+	if !startOK || !endOK || start < 0 || end < 0 {
+		return nil, fmt.Errorf("mask 保留位数不正确")
+	}
+	runes := []rune(text)
+	for i := range runes {
+		if i >= int(start) && i < len(runes)-int(end) {
+			runes[i] = '*'
+		}
+	}
+	return string(runes), nil
+}
+
+// transformConvertTZ 把时间从 from 时区换算到 to 时区，时区可写 Asia/Shanghai、UTC 或 +08:00
+func transformConvertTZ(value interface{}, from, to string) (interface{}, error) {
+	fromLocation, err := transformLocation(from)
+	if err != nil {
+		return nil, err
+	}
+	toLocation, err := transformLocation(to)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := value.(time.Time); ok {
+		wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), fromLocation)
+		converted := wall.In(toLocation)
+		return time.Date(converted.Year(), converted.Month(), converted.Day(), converted.Hour(), converted.Minute(), converted.Second(), converted.Nanosecond(), t.Location()), nil
+	}
+	text := strings.TrimSpace(transformString(value))
+	parsed, err := time.ParseInLocation("2006-01-02 15:04:05.999999", text, fromLocation)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析时间 %q", text)
+	}
+	layout := "2006-01-02 15:04:05"
+	if dot := strings.LastIndex(text, "."); dot > 0 {
+		layout += "." + strings.Repeat("0", len(text)-dot-1)
+	}
+	return parsed.In(toLocation).Format(layout), nil
+}
+
+func transformLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 6 && (name[0] == '+' || name[0] == '-') && name[3] == ':' {
+		hours, hourErr := strconv.Atoi(name[1:3])
+		minutes, minuteErr := strconv.Atoi(name[4:])
+		if hourErr == nil && minuteErr == nil {
+			offset := hours*3600 + minutes*60
+			if name[0] == '-' {
+				offset = -offset
+			}
+			return time.FixedZone(name, offset), nil
+		}
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("未知时区 %s", name)
+	}
+	return location, nil
+}
+
+// precheckTransforms 检查转换引用的源字段和写入的目标字段
+func precheckTransforms(mapping *models.SyncTaskTable, sourceColumns, targetColumns []mysqlColumn) string {
+	reserved := []string{mapping.DiscriminatorColumn, mapping.DeleteColumn}
+	if writesHistory(mapping) {
+		reserved = append(reserved, historyOpColumn, historyPositionColumn)
+	}
+	for _, target := range sortedTransformTargets(mapping) {
+		if !hasColumn(targetColumns, target) {
+			return "转换目标字段不存在: " + target
+		}
+		if isPrimaryKeyColumn(mapping.TargetPrimaryKey, target) || containsString(reserved, target) {
+			return "行标识和系统维护的字段不能配置转换: " + target
+		}
+		_, columns, err := parseTransform(mapping.Transforms[target])
+		if err != nil {
+			return fmt.Sprintf("字段 %s 转换表达式不正确: %v", target, err)
+		}
+		for _, column := range columns {
+			if !hasColumn(sourceColumns, column) || ignoredField(mapping, column) {
+				return fmt.Sprintf("字段 %s 转换引用的源字段不存在或已忽略: %s", target, column)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+func TestEvalTransform(t *testing.T) {
+	row := map[string]interface{}{"name": []byte("  Alice "), "phone": "13812345678", "qty": int32(3), "price": "2.50", "created_at": "2024-03-01 08:00:00", "memo": nil}
+	tests := []struct {
+		expression string
+		want       interface{}
+	}{
+		{expression: `upper(trim(name))`, want: "ALICE"},
+		{expression: `mask(phone, 3, 4)`, want: "138****5678"},
+		{expression: `qty * 2 + 1`, want: int64(7)},
+		{expression: `float(price) * qty`, want: 7.5},
+		{expression: `concat(trim(name), "-", memo, qty)`, want: "Alice-3"},
+		{expression: `coalesce(memo, "none")`, want: "none"},
+		{expression: `iif(qty > 2, "bulk", "single")`, want: "bulk"},
+		{expression: `upper(memo)`, want: nil},
+		{expression: `substr(phone, 4, 4)`, want: "1234"},
+		{expression: `md5("a")`, want: "0cc175b9c0f1b6a831c399e269772661"},
+		{expression: `convert_tz(created_at, "UTC", "+08:00")`, want: "2024-03-01 16:00:00"},
+		{expression: `"ERP"`, want: "ERP"},
+		{expression: `round(10 / 3, 2)`, want: 3.33},
+	}
+	for _, tt := range tests {
+		expr, _, err := parseTransform(tt.expression)
+		if err != nil {
+			t.Fatalf("%s: parse error %v", tt.expression, err)
+		}
+		got, err := evalTransform(expr, row)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: got %#v, %v, want %#v", tt.expression, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseTransformRejectsUnsafeExpressions(t *testing.T) {
+	for _, expression := range []string{`os.Getenv("HOME")`, `name[0]`, `func() int { return 1 }()`, `exec("rm")`, `upper(name, 1)`, `qty << 2`} {
+		if _, _, err := parseTransform(expression); err == nil {
+			t.Fatalf("%s: expected error", expression)
+		}
+	}
+	if _, columns, err := parseTransform(`concat(first_name, " ", last_name, first_name)`); err != nil || !reflect.DeepEqual(columns, []string{"first_name", "last_name"}) {
+		t.Fatalf("columns = %v, %v", columns, err)
+	}
+}
+
+func TestTransformPairsAndRow(t *testing.T) {
+	mapping := &models.SyncTaskTable{Transforms: models.FieldMapping{"email": "lower(email)", "full_name": `concat(first, " ", last)`}}
+	pairs := withTransformPairs(mapping, []syncColumnPair{{source: "id", target: "id"}, {source: "email", target: "email"}})
+	if len(pairs) != 3 || pairs[2].target != "full_name" || pairs[2].source != transformSourcePrefix+"full_name" {
+		t.Fatalf("pairs = %v", pairs)
+	}
+	row := map[string]interface{}{"id": int64(1), "email": "A@B.COM", "first": "Li", "last": "Lei"}
+	got, err := transformRow(mapping, pairs, row)
+	if err != nil || got["email"] != "a@b.com" || got[transformSourcePrefix+"full_name"] != "Li Lei" || row["email"] != "A@B.COM" {
+		t.Fatalf("transformRow = %v, %v; source row %v", got, err, row)
+	}
+	if columns := sourcePairColumns(pairs); !reflect.DeepEqual(columns, []string{"id", "email"}) {
+		t.Fatalf("source columns = %v", columns)
+	}
+}
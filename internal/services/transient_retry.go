@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	mssql "github.com/microsoft/go-mssqldb"
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+// 临时故障自动重试：连接中断、锁等待超时、死锁、连接数打满等故障通常短时间内自行恢复，
+// 任务按指数退避加随机抖动重试，等待期间运行状态为 retrying，不触发失败预警；重试次数用尽后才按失败处理并预警。
+// 数据错误、权限不足、Binlog 已清理等永久性错误不重试。
+const (
+	defaultTransientRetries = 3
+	defaultTransientBackoff = 10
+	// transientRetryHealthyAfter CDC 会话持续运行超过该时长后再失败，重新计算重试次数
+	transientRetryHealthyAfter = 10 * time.Minute
+	transientRetryPollInterval = 5 * time.Second
+)
+
+// 连接数打满、服务端关闭、网络读写错误、锁等待超时、死锁、连接被终止、连接断开、查询超时
+var transientMySQLErrors = map[uint16]bool{
+	1040: true, 1053: true, 1158: true, 1159: true, 1160: true, 1161: true, 1205: true, 1213: true,
+	1927: true, 2002: true, 2003: true, 2006: true, 2013: true, 3024: true, 4031: true,
+}
+
+// 超时、死锁、锁等待超时及 Azure SQL 的服务暂不可用
+var transientSQLServerErrors = map[int32]bool{
+	-2: true, 1205: true, 1222: true, 40197: true, 40501: true, 40613: true,
+}
+
+var transientErrorMessages = []string{
+	"connection reset by peer", "broken pipe", "i/o timeout", "connection refused", "invalid connection",
+	"bad connection", "unexpected eof", "server has gone away", "lost connection to mysql server",
+	"lock wait timeout exceeded", "deadlock found", "too many connections", "context deadline exceeded",
+}
+
+func normalizeTransientRetrySettings(retries, backoff int) (int, int, error) {
+	if retries == 0 {
+		retries = defaultTransientRetries
+	}
+	if backoff == 0 {
+		backoff = defaultTransientBackoff
+	}
+	if retries < 1 || retries > 20 {
+		return 0, 0, fmt.Errorf("临时故障重试次数需在 1 到 20 之间")
+	}
+	if backoff < 1 || backoff > 3600 {
+		return 0, 0, fmt.Errorf("临时故障重试间隔需在 1 到 3600 秒之间")
+	}
+	return retries, backoff, nil
+}
+
+// NormalizeTransientRetrySettings 校验临时故障重试次数和首次重试间隔，0 按默认值处理
+func (s *SyncService) NormalizeTransientRetrySettings(retries, backoff int) (int, int, error) {
+	return normalizeTransientRetrySettings(retries, backoff)
+}
+
+// isTransientError 判断错误是否为可自动恢复的临时故障；驱动错误被格式化为字符串时按错误信息判断
+func isTransientError(err error) bool {
+	if err == nil || errors.Is(err, ErrTaskPaused) || errors.Is(err, context.Canceled) || isBinlogPurgedError(err) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return transientMySQLErrors[mysqlErr.Number]
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 08 类为连接异常，53 类为资源不足，57P0x 为服务端关闭
+		switch pgErr.Code {
+		case "40001", "40P01", "55P03":
+			return true
+		}
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "53") || strings.HasPrefix(pgErr.Code, "57P0")
+	}
+	var sqlserverErr mssql.Error
+	if errors.As(err, &sqlserverErr) {
+		return transientSQLServerErrors[sqlserverErr.Number]
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, pattern := range transientErrorMessages {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// transientRetryDelay 计算第 attempt 次重试前的等待时间：base 逐次翻倍，不超过 limit，再按 jitter 比例随机浮动，
+// random 取值 [0,1)，避免多个任务同时失败后同时重连
+func transientRetryDelay(attempt int, base, limit time.Duration, jitter, random float64) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return time.Duration(float64(delay) * (1 + jitter*(2*random-1)))
+}
+
+// retryTransientFailure 在临时故障且未用尽重试次数时记录事件并等待退避间隔，返回 nil 表示应立即重试；
+// 否则返回最终应按其处理的错误：原错误、等待期间被暂停时的 ErrTaskPaused，或 ctx 取消的原因
+func (s *SyncService) retryTransientFailure(ctx context.Context, task *models.SyncTask, phase string, attempt int, err error) error {
+	if !isTransientError(err) {
+		return err
+	}
+	retries, backoff, settingsErr := normalizeTransientRetrySettings(task.TransientRetries, task.TransientBackoff)
+	if settingsErr != nil {
+		retries, backoff = defaultTransientRetries, defaultTransientBackoff
+	}
+	if attempt > retries {
+		s.RecordTaskEvent(task, "retry_exhausted", phase, "failed", fmt.Sprintf("临时故障重试 %d 次仍未恢复", retries), err.Error(), 0, 0)
+		return err
+	}
+	limit := time.Duration(envPositiveInt("MERGEWONG_RETRY_MAX_BACKOFF_SECONDS", 600)) * time.Second
+	jitter := float64(min(envPositiveInt("MERGEWONG_RETRY_JITTER_PERCENT", 20), 100)) / 100
+	wait := transientRetryDelay(attempt, time.Duration(backoff)*time.Second, limit, jitter, rand.Float64())
+	message := fmt.Sprintf("临时故障，%s 后进行第 %d/%d 次重试", wait.Round(time.Second), attempt, retries)
+	_ = s.UpdateTask(task.ID, map[string]interface{}{"runtime_status": "retrying", "last_run_message": message + ": " + err.Error()})
+	s.RecordTaskEvent(task, "retry_scheduled", phase, "running", message, err.Error(), 0, 0)
+	return s.waitTransientRetry(ctx, task.ID, wait)
+}
+
+// waitTransientRetry 等待重试间隔，期间任务被暂停时返回 ErrTaskPaused，失去租约时返回 ErrTaskLeaseLost
+func (s *SyncService) waitTransientRetry(ctx context.Context, taskID uint, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	ticker := time.NewTicker(transientRetryPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := checkTaskPaused(s.systemDB, taskID); errors.Is(err, ErrTaskPaused) || errors.Is(err, ErrTaskLeaseLost) {
+				return err
+			}
+		case <-timer.C:
+			if err := checkTaskPaused(s.systemDB, taskID); errors.Is(err, ErrTaskPaused) || errors.Is(err, ErrTaskLeaseLost) {
+				return err
+			}
+			return nil
+		}
+	}
+}
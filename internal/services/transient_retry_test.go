@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "bad conn", err: fmt.Errorf("写入失败: %w", driver.ErrBadConn), want: true},
+		{name: "deadline", err: context.DeadlineExceeded, want: true},
+		{name: "lock wait", err: &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, want: true},
+		{name: "deadlock", err: fmt.Errorf("批量写入: %w", &mysql.MySQLError{Number: 1213}), want: true},
+		{name: "duplicate key", err: &mysql.MySQLError{Number: 1062}, want: false},
+		{name: "access denied", err: &mysql.MySQLError{Number: 1045}, want: false},
+		{name: "pg connection", err: &pgconn.PgError{Code: "08006"}, want: true},
+		{name: "pg constraint", err: &pgconn.PgError{Code: "23505"}, want: false},
+		{name: "formatted reset", err: errors.New("read tcp 10.0.0.1:3306: connection reset by peer"), want: true},
+		{name: "binlog purged", err: errors.New("ERROR 1236: Could not find first log file name in binary log index file"), want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "paused", err: ErrTaskPaused, want: false},
+	}
+	for _, tt := range tests {
+		if got := isTransientError(tt.err); got != tt.want {
+			t.Fatalf("%s: got %v", tt.name, got)
+		}
+	}
+}
+
+func TestTransientRetryDelay(t *testing.T) {
+	base, limit := 10*time.Second, time.Minute
+	tests := []struct {
+		attempt int
+		random  float64
+		want    time.Duration
+	}{
+		{attempt: 1, random: 0.5, want: 10 * time.Second},
+		{attempt: 2, random: 0.5, want: 20 * time.Second},
+		{attempt: 3, random: 0.5, want: 40 * time.Second},
+		{attempt: 4, random: 0.5, want: time.Minute},
+		{attempt: 10, random: 0.5, want: time.Minute},
+		{attempt: 1, random: 0, want: 8 * time.Second},
+		{attempt: 2, random: 1, want: 24 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := transientRetryDelay(tt.attempt, base, limit, 0.2, tt.random); got != tt.want {
+			t.Fatalf("attempt %d random %v: got %s, want %s", tt.attempt, tt.random, got, tt.want)
+		}
+	}
+}
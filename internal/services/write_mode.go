@@ -0,0 +1,146 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/redgreat/mergewong/internal/models"
+)
+
+// 写入方式决定目标已有同标识行时如何处理。upsert 覆盖；insert_ignore 保留目标行；
+// newer_only 只在新行版本列不低于目标行时覆盖，适合多源汇聚或目标端也有写入的场景；
+// history 不覆盖也不删除，每次变更作为新行写入并记录操作类型和源库位点，用于审计和拉链表。
+const (
+	writeModeUpsert       = "upsert"
+	writeModeInsertIgnore = "insert_ignore"
+	writeModeNewerOnly    = "newer_only"
+	writeModeHistory      = "history"
+)
+
+// 历史模式目标表需预先建好的两列：操作类型（snapshot、insert、update、delete、upsert）和源库位点
+const (
+	historyOpColumn       = "mw_op"
+	historyPositionColumn = "mw_position"
+)
+
+// historyOpSource、historyPositionSource 是写入时承载历史列值的内部列名，不会与真实字段冲突
+const (
+	historyOpSource       = "\x00history_op"
+	historyPositionSource = "\x00history_position"
+)
+
+func normalizeWriteMode(value string) (string, error) {
+	switch strings.TrimSpace(value) {
+	case "", writeModeUpsert:
+		return writeModeUpsert, nil
+	case writeModeInsertIgnore:
+		return writeModeInsertIgnore, nil
+	case writeModeNewerOnly:
+		return writeModeNewerOnly, nil
+	case writeModeHistory:
+		return writeModeHistory, nil
+	default:
+		return "", fmt.Errorf("不支持的写入方式: %s", value)
+	}
+}
+
+// validateWriteMode 规范化表映射的写入方式和版本列
+func validateWriteMode(table *models.SyncTaskTable) error {
+	mode, err := normalizeWriteMode(table.WriteMode)
+	if err != nil {
+		return err
+	}
+	table.WriteMode, table.VersionColumn = mode, strings.TrimSpace(table.VersionColumn)
+	if mode != writeModeNewerOnly {
+		table.VersionColumn = ""
+	} else if !taskIdentifierPattern.MatchString(table.VersionColumn) {
+		return fmt.Errorf("按版本更新需要指定合法的版本列")
+	}
+	if (mode == writeModeInsertIgnore || mode == writeModeNewerOnly) && keylessRowIdentity(table) {
+		return fmt.Errorf("无键模式只能使用覆盖写入或历史模式")
+	}
+	return nil
+}
+
+// writesHistory 表示该表的每次变更都追加为目标表新行
+func writesHistory(mapping *models.SyncTaskTable) bool {
+	return mapping.WriteMode == writeModeHistory
+}
+
+// targetWriteQuery 按表映射的写入方式生成多行写入语句
+func targetWriteQuery(dialect sqlDialect, mapping *models.SyncTaskTable, targetColumns []string, rows int) string {
+	identity := shardTargetIdentity(mapping)
+	switch mapping.WriteMode {
+	case writeModeInsertIgnore:
+		return dialect.insertQuery(mapping.TargetTable, targetColumns, rows, identity)
+	case writeModeNewerOnly:
+		return dialect.upsertNewerQuery(mapping.TargetTable, targetColumns, rows, identity, mappedColumn(mapping.FieldMapping, mapping.VersionColumn))
+	case writeModeHistory:
+		return dialect.insertQuery(mapping.TargetTable, targetColumns, rows, "")
+	default:
+		return dialect.upsertQuery(mapping.TargetTable, targetColumns, rows, identity)
+	}
+}
+
+// withHistoryColumns 为历史模式的每行补上操作类型和位点；全量读取的行没有操作类型，记为 snapshot
+func withHistoryColumns(batch []map[string]interface{}) []map[string]interface{} {
+	rows := make([]map[string]interface{}, len(batch))
+	for i, row := range batch {
+		copied := make(map[string]interface{}, len(row)+2)
+		for column, v := range row {
+			copied[column] = v
+		}
+		if _, ok := copied[historyOpSource]; !ok {
+			copied[historyOpSource] = "snapshot"
+		}
+		if _, ok := copied[historyPositionSource]; !ok {
+			copied[historyPositionSource] = ""
+		}
+		rows[i] = copied
+	}
+	return rows
+}
+
+// historyOperation 返回 CDC 操作写入历史表时的操作类型
+func historyOperation(op cdcOperation) string {
+	if op.change != "" {
+		return op.change
+	}
+	return op.kind
+}
+
+// precheckWriteMode 检查写入方式依赖的源字段和目标表结构，targetColumns 为空表示目标表不存在
+func precheckWriteMode(task *models.SyncTask, mapping *models.SyncTaskTable, sourceColumns, targetColumns []mysqlColumn, targetKeyed bool) (problem, warning string) {
+	switch mapping.WriteMode {
+	case writeModeNewerOnly:
+		if !hasColumn(sourceColumns, mapping.VersionColumn) {
+			return "版本列不存在: " + mapping.VersionColumn, ""
+		}
+		if ignoredField(mapping, mapping.VersionColumn) {
+			return "版本列不能忽略: " + mapping.VersionColumn, ""
+		}
+		if isPrimaryKeyColumn(mapping.SourcePrimaryKey, mapping.VersionColumn) {
+			return "版本列不能是行标识列: " + mapping.VersionColumn, ""
+		}
+		return "", "按版本更新：目标行版本列高于新行时保留目标行；删除不比较版本"
+	case writeModeInsertIgnore:
+		return "", "冲突跳过：目标已有同标识行时不更新，源端 UPDATE 不会同步到目标"
+	case writeModeHistory:
+		if task.SyncType == "full" {
+			return "历史模式需要 CDC 或轮询增量同步，全量同步每次执行都会重复写入全部行", ""
+		}
+		if len(targetColumns) == 0 {
+			return fmt.Sprintf("历史模式需预先创建目标表，并包含 %s、%s 列", historyOpColumn, historyPositionColumn), ""
+		}
+		for _, column := range []string{historyOpColumn, historyPositionColumn} {
+			if !hasColumn(targetColumns, column) {
+				return "历史模式目标表缺少字段: " + column, ""
+			}
+		}
+		if targetKeyed {
+			return "历史模式目标表不能以行标识列作为主键或唯一索引，否则同一行的第二次变更会冲突", ""
+		}
+		return "", "历史模式：每次变更追加一行，删除以旧行值写入；全量中断续传或位点回放可能产生重复记录，且不参与数据比对"
+	}
+	return "", ""
+}